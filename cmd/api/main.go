@@ -16,13 +16,25 @@ import (
 	"github.com/rs/cors"
 
 	"github.com/tommygebru/kiekky-backend/internal/auth"
+	"github.com/tommygebru/kiekky-backend/internal/billing"
+	"github.com/tommygebru/kiekky-backend/internal/common"
 	"github.com/tommygebru/kiekky-backend/internal/config"
+	"github.com/tommygebru/kiekky-backend/internal/export"
+	"github.com/tommygebru/kiekky-backend/internal/groups"
 	"github.com/tommygebru/kiekky-backend/internal/messaging"
 	"github.com/tommygebru/kiekky-backend/internal/notification"
 	"github.com/tommygebru/kiekky-backend/internal/posts"
 	"github.com/tommygebru/kiekky-backend/internal/stories"
+	"github.com/tommygebru/kiekky-backend/internal/tenant"
 	"github.com/tommygebru/kiekky-backend/internal/user"
 	"github.com/tommygebru/kiekky-backend/pkg/database"
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+	"github.com/tommygebru/kiekky-backend/pkg/oauth"
+	"github.com/tommygebru/kiekky-backend/pkg/passhash"
+	"github.com/tommygebru/kiekky-backend/pkg/passpolicy"
+	"github.com/tommygebru/kiekky-backend/pkg/sms"
+	"github.com/tommygebru/kiekky-backend/pkg/storage"
+	"github.com/tommygebru/kiekky-backend/pkg/webauthn"
 )
 
 func main() {
@@ -53,45 +65,173 @@ func main() {
 	defer db.Close()
 	log.Println("✅ Connected to PostgreSQL")
 
+	// Tenants: every request is scoped to the workspace its host belongs to
+	tenantRepo := tenant.NewPostgresRepository(db)
+	tenantService := tenant.NewService(tenantRepo, cfg.DefaultTenant)
+	tenantMiddleware := tenant.NewMiddleware(tenantService)
+
+	// 9. Initialize Notification module - before auth, user and posts
+	log.Println("🔔 Initializing Notifications...")
+	notificationRepo := notification.NewPostgresRepository(db)
+	notificationService := notification.NewService(notificationRepo)
+	notificationHandler := notification.NewHandler(notificationService)
+	log.Println("✅ Notifications initialized")
+
 	// 4. Initialize Auth module
 	log.Println("🔐 Initializing Auth...")
 	authRepo := auth.NewPostgresRepository(db)
+	mailer, err := email.NewSender(&email.Config{
+		Provider:     cfg.EmailProvider,
+		From:         cfg.EmailFrom,
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUsername: cfg.SMTPUsername,
+		SMTPPassword: cfg.SMTPPassword,
+	})
+	if err != nil {
+		log.Fatal("❌ Email setup failed:", err)
+	}
+	smsSender, err := sms.NewSender(&sms.Config{
+		Provider:          cfg.SMSProvider,
+		TwilioBaseURL:     cfg.TwilioBaseURL,
+		TwilioAccountSID:  cfg.TwilioAccountSID,
+		TwilioAuthToken:   cfg.TwilioAuthToken,
+		TwilioPhoneNumber: cfg.TwilioPhoneNumber,
+	})
+	if err != nil {
+		log.Fatal("❌ SMS setup failed:", err)
+	}
+	storageProvider := "local"
+	if cfg.UseS3 {
+		storageProvider = "s3"
+	}
+	mediaStorage, err := storage.New(&storage.Config{
+		Provider:          storageProvider,
+		LocalDir:          cfg.LocalUploadDir,
+		BaseURL:           cfg.BaseURL,
+		S3Bucket:          cfg.S3Bucket,
+		S3Region:          cfg.S3Region,
+		S3Endpoint:        cfg.S3Endpoint,
+		S3AccessKeyID:     cfg.S3AccessKeyID,
+		S3SecretAccessKey: cfg.S3SecretAccessKey,
+		S3PublicURL:       cfg.S3PublicURL,
+		S3PathStyle:       cfg.S3PathStyle,
+	})
+	if err != nil {
+		log.Fatal("❌ Media storage setup failed:", err)
+	}
+	authKeys, err := auth.LoadKeySet(&auth.KeyConfig{
+		SigningMethod:        cfg.JWTSigningMethod,
+		Secret:               cfg.JWTSecret,
+		SigningKeyFile:       cfg.JWTSigningKeyFile,
+		VerificationKeyFiles: cfg.JWTVerificationKeyFiles,
+	})
+	if err != nil {
+		log.Fatal("❌ JWT key setup failed:", err)
+	}
+	oauthProviders := make(map[string]oauth.Provider)
+	if c := cfg.GoogleOAuth; c.ClientID != "" {
+		oauthProviders[c.Name] = oauth.NewGoogleProvider(oauthConfig(c))
+	}
+	if c := cfg.GitHubOAuth; c.ClientID != "" {
+		oauthProviders[c.Name] = oauth.NewGitHubProvider(oauthConfig(c))
+	}
+	if c := cfg.OIDCOAuth; c.ClientID != "" {
+		oauthProviders[c.Name] = oauth.NewOIDCProvider(oauthConfig(c))
+	}
+	webauthnOrigins := cfg.WebAuthnOrigins
+	if len(webauthnOrigins) == 0 {
+		webauthnOrigins = []string{cfg.FrontendURL}
+	}
+	relyingParty, err := webauthn.New(webauthn.Config{
+		RPID:    cfg.WebAuthnRPID,
+		RPName:  cfg.WebAuthnRPName,
+		Origins: webauthnOrigins,
+	})
+	if err != nil {
+		log.Fatal("❌ Passkey setup failed:", err)
+	}
+	passwordHasher := passhash.New(passhash.Params{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+	var breachedPasswords *passpolicy.BreachCorpus
+	if cfg.BreachedPasswordsDir != "" {
+		breachedPasswords, err = passpolicy.OpenBreachCorpus(cfg.BreachedPasswordsDir)
+		if err != nil {
+			log.Fatal("❌ Password policy setup failed:", err)
+		}
+	}
 	authConfig := &auth.Config{
-		JWTSecret:          cfg.JWTSecret,
-		AccessTokenExpiry:  cfg.AccessTokenExpiry,
-		RefreshTokenExpiry: cfg.RefreshTokenExpiry,
-		BCryptCost:         cfg.BCryptCost,
+		JWTSecret:             cfg.JWTSecret,
+		Keys:                  authKeys,
+		AccessTokenExpiry:     cfg.AccessTokenExpiry,
+		RefreshTokenExpiry:    cfg.RefreshTokenExpiry,
+		PasswordHasher:        passwordHasher,
+		PasswordPolicy:        passpolicy.New(cfg.PasswordMinScore, breachedPasswords),
+		OTPLength:             cfg.OTPLength,
+		OTPExpiry:             cfg.OTPExpiry,
+		MaxOTPAttempts:        cfg.MaxOTPAttempts,
+		MagicLinkExpiry:       cfg.MagicLinkExpiry,
+		FrontendURL:           cfg.FrontendURL,
+		Enable2FA:             cfg.Enable2FA,
+		MaxLoginAttempts:      cfg.MaxLoginAttempts,
+		MaxLoginAttemptsPerIP: cfg.MaxLoginAttemptsPerIP,
+		LoginLockoutDuration:  cfg.LoginLockoutDuration,
+		OAuthProviders:        oauthProviders,
+		DeletionGracePeriod:   cfg.AccountDeletionGracePeriod,
+		ImpersonationExpiry:   cfg.ImpersonationExpiry,
+		InviteOnly:            cfg.InviteOnly,
+		InviteExpiry:          cfg.InviteExpiry,
+		MaxActiveInvites:      cfg.MaxActiveInvites,
+		MaxInviteUses:         cfg.MaxInviteUses,
+		Storage:               mediaStorage,
+		WebAuthn:              relyingParty,
 	}
-	authService := auth.NewService(authRepo, authConfig)
+	authService := auth.NewService(authRepo, authConfig, mailer, smsSender, notificationService)
 	authHandler := auth.NewHandler(authService)
 	authMiddleware := auth.NewMiddleware(authService)
 	log.Println("✅ Auth initialized")
 
-	// 9. Initialize Notification module
-	log.Println("🔔 Initializing Notifications...")
-	notificationRepo := notification.NewPostgresRepository(db)
-	notificationService := notification.NewService(notificationRepo)
-	notificationHandler := notification.NewHandler(notificationService)
-	log.Println("✅ Notifications initialized")
+	// Billing - before the modules whose actions are limited by plan
+	log.Println("💳 Initializing Billing...")
+	billingRepo := billing.NewPostgresRepository(db)
+	billingService := billing.NewService(billingRepo, &billing.Config{
+		WebhookSecret:    cfg.BillingWebhookSecret,
+		WebhookTolerance: cfg.BillingWebhookTolerance,
+	})
+	billingHandler := billing.NewHandler(billingService)
+	if cfg.BillingWebhookSecret == "" {
+		log.Println("⚠️  BILLING_WEBHOOK_SECRET not set, plan changes cannot be received")
+	}
+	log.Println("✅ Billing initialized")
 
 	// 5. Initialize User module (with Follow system) - after notifications
 	log.Println("👤 Initializing User & Follow system...")
 	userRepo := user.NewPostgresRepository(db)
-	userService := user.NewService(userRepo, notificationService)
+	userService := user.NewService(userRepo, notificationService, billingService)
 	userHandler := user.NewHandler(userService)
 	log.Println("✅ User & Follow system initialized")
 
+	// Groups - before posts, which checks group access for group posts
+	log.Println("👥 Initializing Groups...")
+	groupsRepo := groups.NewPostgresRepository(db)
+	groupsService := groups.NewService(groupsRepo, billingService, mediaStorage)
+	groupsHandler := groups.NewHandler(groupsService)
+	log.Println("✅ Groups initialized")
+
 	// 6. Initialize Posts module - after notifications
 	log.Println("📝 Initializing Posts...")
 	postsRepo := posts.NewPostgresRepository(db)
-	postsService := posts.NewService(postsRepo, notificationService)
+	postsService := posts.NewService(postsRepo, notificationService, groupsService, billingService, mediaStorage)
 	postsHandler := posts.NewHandler(postsService)
 	log.Println("✅ Posts initialized")
 
 	// 7. Initialize Stories module
 	log.Println("📸 Initializing Stories...")
 	storiesRepo := stories.NewPostgresRepository(db)
-	storiesService := stories.NewService(storiesRepo)
+	storiesService := stories.NewService(storiesRepo, billingService)
 	storiesHandler := stories.NewHandler(storiesService)
 	log.Println("✅ Stories initialized")
 
@@ -100,10 +240,42 @@ func main() {
 	messagingHub := messaging.NewHub()
 	go messagingHub.Run()
 	messagingRepo := messaging.NewPostgresRepository(db)
-	messagingService := messaging.NewService(messagingRepo)
+	messagingService := messaging.NewService(messagingRepo, billingService)
 	messagingHandler := messaging.NewHandler(messagingService, messagingHub)
 	log.Println("✅ Messaging initialized")
 
+	// 9. Initialize Data exports: every module contributes its data to the archive
+	log.Println("📦 Initializing Data exports...")
+	exportRepo := export.NewPostgresRepository(db)
+	exportService := export.NewService(exportRepo, &export.Config{
+		Dir:        cfg.ExportDir,
+		SigningKey: cfg.ExportSigningKey,
+		LinkExpiry: cfg.ExportLinkExpiry,
+		BaseURL:    cfg.BaseURL,
+	}, notificationService)
+	exportService.RegisterExporter(authService)
+	exportService.RegisterExporter(userService)
+	exportService.RegisterExporter(postsService)
+	exportService.RegisterExporter(groupsService)
+	exportService.RegisterExporter(storiesService)
+	exportService.RegisterExporter(messagingService)
+	exportService.RegisterExporter(notificationService)
+	exportService.RegisterExporter(billingService)
+	exportHandler := export.NewHandler(exportService)
+	go cleanupExpiredExports(exportService)
+	log.Println("✅ Data exports initialized")
+
+	// Account deletion: every module erases its data for deleted accounts
+	authService.RegisterDataEraser(userService)
+	authService.RegisterDataEraser(postsService)
+	authService.RegisterDataEraser(groupsService)
+	authService.RegisterDataEraser(storiesService)
+	authService.RegisterDataEraser(messagingService)
+	authService.RegisterDataEraser(notificationService)
+	authService.RegisterDataEraser(exportService)
+	authService.RegisterDataEraser(billingService)
+	go purgeDeletedAccounts(authService)
+
 	// 10. Setup routes
 	log.Println("🛣️  Setting up routes...")
 	router := mux.NewRouter()
@@ -116,9 +288,12 @@ func main() {
 	authHandler.RegisterRoutes(router, authMiddleware)
 	user.RegisterRoutes(router, userHandler, authMiddleware.Authenticate)
 	posts.RegisterRoutes(router, postsHandler, authMiddleware.Authenticate)
+	groups.RegisterRoutes(router, groupsHandler, authMiddleware.Authenticate)
 	stories.RegisterRoutes(router, storiesHandler, authMiddleware.Authenticate)
 	messaging.RegisterRoutes(router, messagingHandler, authMiddleware.Authenticate)
 	notification.RegisterRoutes(router, notificationHandler, authMiddleware.Authenticate)
+	export.RegisterRoutes(router, exportHandler, authMiddleware.Authenticate)
+	billing.RegisterRoutes(router, billingHandler, authMiddleware.Authenticate)
 
 	// Static files for local uploads
 	if !cfg.UseS3 {
@@ -133,10 +308,11 @@ func main() {
 
 	// Setup CORS using rs/cors package (proven to work)
 	// Note: AllowCredentials with AllowedOrigins: "*" is not allowed per CORS spec
-	// In production, specify exact origins. In development, we use AllowOriginFunc
-	// You can also set ALLOWED_ORIGINS env var (comma-separated) to add more origins
+	// In production, specify exact origins. In development, we use AllowOriginRequestFunc
+	// You can also set ALLOWED_ORIGINS env var (comma-separated) to add more origins.
+	// Each tenant's own frontends come from tenants.allowed_origins.
 	c := cors.New(cors.Options{
-		AllowOriginFunc: func(origin string) bool {
+		AllowOriginRequestFunc: func(r *http.Request, origin string) bool {
 			// In development, allow all origins
 			if cfg.Environment != "production" {
 				return true
@@ -150,19 +326,24 @@ func main() {
 				"https://kiekkyfront.vercel.app",
 				"https://community-platform-core.vercel.app",
 			}
-			
+
 			// Also check ALLOWED_ORIGINS environment variable
 			if envOrigins := os.Getenv("ALLOWED_ORIGINS"); envOrigins != "" {
 				for _, o := range strings.Split(envOrigins, ",") {
 					allowedOrigins = append(allowedOrigins, strings.TrimSpace(o))
 				}
 			}
-			
+
 			for _, allowed := range allowedOrigins {
 				if origin == allowed {
 					return true
 				}
 			}
+
+			// Origins of the tenant the request's host belongs to
+			if t, ok := tenant.FromContext(r.Context()); ok {
+				return t.AllowsOrigin(origin)
+			}
 			return false
 		},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
@@ -172,7 +353,11 @@ func main() {
 		MaxAge:           86400,
 		Debug:            cfg.Environment != "production",
 	})
-	handler := c.Handler(router)
+	clientIPResolver, err := common.NewClientIPResolver(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal("❌ Trusted proxy setup failed:", err)
+	}
+	handler := clientIPResolver.Resolve(tenantMiddleware.Resolve(c.Handler(router)))
 
 	// 8. Start server
 	srv := &http.Server{
@@ -209,6 +394,38 @@ func main() {
 	log.Println("✅ Server stopped")
 }
 
+// purgeDeletedAccounts erases accounts whose deletion grace period has ended, once an hour
+func purgeDeletedAccounts(authService auth.Service) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		purged, err := authService.PurgeDeletedAccounts(context.Background())
+		if err != nil {
+			log.Println("⚠️  Account purge failed:", err)
+		} else if purged > 0 {
+			log.Printf("🗑️  Deleted %d accounts", purged)
+		}
+		<-ticker.C
+	}
+}
+
+// cleanupExpiredExports removes export archives whose download link has expired, once an hour
+func cleanupExpiredExports(exportService export.Service) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		removed, err := exportService.CleanupExpiredExports(context.Background())
+		if err != nil {
+			log.Println("⚠️  Export cleanup failed:", err)
+		} else if removed > 0 {
+			log.Printf("🗑️  Removed %d expired exports", removed)
+		}
+		<-ticker.C
+	}
+}
+
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -238,3 +455,13 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+func oauthConfig(c config.OAuthProviderConfig) oauth.Config {
+	return oauth.Config{
+		Name:         c.Name,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+		IssuerURL:    c.IssuerURL,
+		APIURL:       c.APIURL,
+	}
+}
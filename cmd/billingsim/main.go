@@ -0,0 +1,99 @@
+// Command billingsim stands in for the billing provider during local
+// development. It sends a signed subscription event to the API's billing
+// webhook, e.g. to move user 42 to the pro plan:
+//
+//	BILLING_WEBHOOK_SECRET=dev-secret go run ./cmd/billingsim -user 42 -plan pro
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"github.com/tommygebru/kiekky-backend/pkg/webhook"
+)
+
+func main() {
+	_ = godotenv.Load()
+
+	url := flag.String("url", "http://localhost:8080/api/v1/billing/webhook", "billing webhook URL")
+	host := flag.String("host", "", "Host header, to reach a tenant's domain")
+	secret := flag.String("secret", os.Getenv("BILLING_WEBHOOK_SECRET"), "webhook signing secret")
+	eventType := flag.String("type", "subscription.updated", "subscription.created, subscription.updated or subscription.canceled")
+	eventID := flag.String("id", "", "event ID; random when empty, reuse one to test redelivery")
+	userID := flag.Int64("user", 0, "user ID the subscription belongs to")
+	plan := flag.String("plan", "plus", "plan code")
+	status := flag.String("status", "active", "active, trialing, past_due or canceled")
+	period := flag.Duration("period", 30*24*time.Hour, "time until the billing period ends; 0 for no end")
+	flag.Parse()
+
+	if *secret == "" || *userID == 0 {
+		flag.Usage()
+		log.Fatal("-secret (or BILLING_WEBHOOK_SECRET) and -user are required")
+	}
+	if *eventID == "" {
+		*eventID = "evt_" + randomHex(12)
+	}
+
+	now := time.Now().UTC()
+	data := map[string]interface{}{
+		"user_id":         *userID,
+		"plan":            *plan,
+		"status":          *status,
+		"customer_id":     fmt.Sprintf("cus_local_%d", *userID),
+		"subscription_id": fmt.Sprintf("sub_local_%d", *userID),
+	}
+	if *period > 0 {
+		data["current_period_end"] = now.Add(*period)
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         *eventID,
+		"type":       *eventType,
+		"created_at": now,
+		"data":       data,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(payload))
+	if err != nil {
+		log.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(*secret, payload, now))
+	if *host != "" {
+		req.Host = *host
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	fmt.Printf("-> %s %s\n%s\n", *eventType, *eventID, payload)
+	fmt.Printf("<- %s\n%s\n", resp.Status, body)
+	if resp.StatusCode >= 300 {
+		os.Exit(1)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
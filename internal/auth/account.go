@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+)
+
+// purgeBatchSize bounds how many accounts one PurgeDeletedAccounts run erases
+const purgeBatchSize = 100
+
+// exportPageSize is how many rows each read fetches while building a data export
+const exportPageSize = 100
+
+// UserDataEraser removes a module's data for an account being deleted.
+// It returns the storage keys of files the account uploaded, as recorded
+// when they were stored. URLs users entered themselves are never deleted.
+type UserDataEraser interface {
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+}
+
+// canLogin reports whether an account may sign in. Deactivated accounts and
+// accounts awaiting deletion are restored by signing in.
+func canLogin(user *User) bool {
+	switch user.AccountStatus {
+	case AccountStatusActive, AccountStatusDeactivated, AccountStatusPendingDeletion:
+		return true
+	}
+	return false
+}
+
+// reactivateAccount restores a deactivated account or cancels its deletion
+func (s *service) reactivateAccount(ctx context.Context, user *User) error {
+	restored, err := s.repo.ReactivateUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to reactivate account: %w", err)
+	}
+	if !restored {
+		return ErrAccountInactive
+	}
+
+	if user.AccountStatus == AccountStatusPendingDeletion {
+		fmt.Printf("INFO: Account deletion cancelled for user %d\n", user.ID)
+	} else {
+		fmt.Printf("INFO: Account reactivated for user %d\n", user.ID)
+	}
+	user.AccountStatus = AccountStatusActive
+	return nil
+}
+
+// verifyAccountPassword checks the password confirming a lifecycle change
+func (s *service) verifyAccountPassword(ctx context.Context, userID int64, password string) (*User, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.checkPassword(user, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// DeactivateAccount hides the account and signs it out everywhere until the user logs in again
+func (s *service) DeactivateAccount(ctx context.Context, userID int64, password string) error {
+	user, err := s.verifyAccountPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeactivateUser(ctx, userID, AccountStatusDeactivated, nil); err != nil {
+		return err
+	}
+	if err := s.revokeAllUserSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.mailer.Send(ctx, &email.Message{
+		To:      user.Email,
+		Subject: "Your account has been deactivated",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account has been deactivated and is hidden from other users. "+
+			"Log in at any time to reactivate it.\n", user.Username),
+	}); err != nil {
+		fmt.Printf("ERROR: Failed to send deactivation email to user %d: %v\n", userID, err)
+	}
+
+	return nil
+}
+
+// RequestAccountDeletion deactivates the account and schedules its permanent
+// deletion after the grace period. Logging in before then cancels it.
+func (s *service) RequestAccountDeletion(ctx context.Context, userID int64, password string) (*AccountDeletionResponse, error) {
+	user, err := s.verifyAccountPassword(ctx, userID, password)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduledFor := time.Now().Add(s.config.DeletionGracePeriod)
+	if err := s.repo.DeactivateUser(ctx, userID, AccountStatusPendingDeletion, &scheduledFor); err != nil {
+		return nil, err
+	}
+	if err := s.revokeAllUserSessions(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.mailer.Send(ctx, &email.Message{
+		To:      user.Email,
+		Subject: "Your account is scheduled for deletion",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account and all of its data will be permanently deleted on %s. "+
+			"If you change your mind, log in before then to cancel the deletion.\n",
+			user.Username, scheduledFor.UTC().Format("January 2, 2006")),
+	}); err != nil {
+		fmt.Printf("ERROR: Failed to send deletion email to user %d: %v\n", userID, err)
+	}
+
+	return &AccountDeletionResponse{ScheduledFor: scheduledFor}, nil
+}
+
+// RegisterDataEraser adds a module whose data is erased with deleted accounts
+func (s *service) RegisterDataEraser(eraser UserDataEraser) {
+	s.erasers = append(s.erasers, eraser)
+}
+
+// PurgeDeletedAccounts permanently erases accounts whose grace period has ended
+// and returns how many were erased
+func (s *service) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	users, err := s.repo.GetUsersDueForDeletion(ctx, purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		// Each account is erased within its own tenant
+		if err := s.purgeAccount(common.WithTenant(ctx, user.TenantID, false), user.ID); err != nil {
+			fmt.Printf("ERROR: Failed to delete account %d: %v\n", user.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeAccount erases one account's data, media files and identity
+func (s *service) purgeAccount(ctx context.Context, userID int64) error {
+	// Lock the account first so a login cannot race the erasure
+	marked, err := s.repo.MarkUserDeleted(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return nil
+	}
+
+	var storageKeys []string
+	for _, eraser := range s.erasers {
+		keys, err := eraser.EraseUserData(ctx, userID)
+		if err != nil {
+			return err
+		}
+		storageKeys = append(storageKeys, keys...)
+	}
+
+	if err := s.repo.AnonymizeUser(ctx, userID); err != nil {
+		return err
+	}
+
+	for _, key := range storageKeys {
+		s.removeUpload(ctx, key)
+	}
+
+	fmt.Printf("INFO: Deleted account %d\n", userID)
+	return nil
+}
+
+// removeUpload deletes an uploaded media file by its storage key
+func (s *service) removeUpload(ctx context.Context, key string) {
+	if s.config.Storage == nil || key == "" {
+		return
+	}
+
+	if err := s.config.Storage.Delete(ctx, key); err != nil {
+		fmt.Printf("WARNING: Failed to remove upload %s: %v\n", key, err)
+	}
+}
+
+// ExportUserData returns the user's account profile, sessions, devices and
+// login history for a personal data export
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repo.GetUserSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	describeSessions(sessions, "")
+
+	devices, err := s.repo.GetUserDevices(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export devices: %w", err)
+	}
+
+	history, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*LoginAttempt, error) {
+		attempts, _, err := s.repo.GetLoginHistory(ctx, userID, limit, offset)
+		return attempts, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export login history: %w", err)
+	}
+
+	return map[string]interface{}{
+		"profile":       user,
+		"sessions":      sessions,
+		"devices":       devices,
+		"login_history": history,
+	}, nil
+}
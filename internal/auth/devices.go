@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+	"github.com/tommygebru/kiekky-backend/pkg/useragent"
+)
+
+// sessionReportTokenType is the "type" claim of "this wasn't me" link tokens
+const sessionReportTokenType = "session_report"
+
+// sessionReportExpiry is how long a new-device alert's report link works
+const sessionReportExpiry = 7 * 24 * time.Hour
+
+// deviceFingerprint identifies a browser and OS combination on a network.
+// Versions are left out so routine browser updates are not reported as new
+// devices, and the network is only the address's /24 or /48 prefix so a
+// common browser and OS signing in from elsewhere still counts as new.
+func deviceFingerprint(info useragent.Info, ipAddress string) string {
+	return hashToken(strings.Join([]string{info.Browser, info.OS, info.DeviceType, networkPrefix(ipAddress)}, "|"))
+}
+
+// networkPrefix returns the /24 of an IPv4 address or the /48 of an IPv6 one
+func networkPrefix(ipAddress string) string {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// describeSessions adds parsed device details to sessions and flags the one
+// making the request
+func describeSessions(sessions []*Session, currentSessionID string) {
+	currentKey := ""
+	if currentSessionID != "" {
+		currentKey = hashToken(currentSessionID)
+	}
+	for _, session := range sessions {
+		ua := ""
+		if session.UserAgent != nil {
+			ua = *session.UserAgent
+		}
+		info := useragent.Parse(ua)
+		session.Device = &info
+		session.IsCurrent = currentKey != "" && session.SessionKey == currentKey
+	}
+}
+
+// checkNewDevice records the device and network behind a new session and
+// alerts the user when they have not been seen on their account before
+func (s *service) checkNewDevice(ctx context.Context, user *User, session *Session, ipAddress, userAgent string) {
+	info := useragent.Parse(userAgent)
+	device := &UserDevice{
+		UserID:      user.ID,
+		Fingerprint: deviceFingerprint(info, ipAddress),
+		Browser:     info.Browser,
+		OS:          info.OS,
+		DeviceType:  info.DeviceType,
+	}
+	if ipAddress != "" {
+		device.LastIP = &ipAddress
+	}
+
+	isNew, err := s.repo.TouchUserDevice(ctx, device)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to record device for user %d: %v\n", user.ID, err)
+		return
+	}
+	if !isNew {
+		return
+	}
+
+	// The first device on an account is where it was created, not a new sign-in
+	count, err := s.repo.CountUserDevices(ctx, user.ID)
+	if err != nil || count <= 1 {
+		return
+	}
+
+	go s.sendNewDeviceAlert(context.WithoutCancel(ctx), user, session.FamilyID, info, ipAddress)
+}
+
+// sendNewDeviceAlert notifies the user of a sign-in from a new device and emails
+// a link that signs that session out if the sign-in was not theirs
+func (s *service) sendNewDeviceAlert(ctx context.Context, user *User, familyID string, info useragent.Info, ipAddress string) {
+	device := info.String()
+
+	if s.notifySvc != nil {
+		if err := s.notifySvc.NotifySecurityAlert(ctx, user.ID,
+			"New sign-in to your account",
+			fmt.Sprintf("Your account was signed in from %s on a new device or network. If this wasn't you, use the link in the email we sent to secure your account.", device),
+			map[string]interface{}{
+				"reason":      "new_device",
+				"device":      device,
+				"device_type": info.DeviceType,
+				"ip_address":  ipAddress,
+			},
+		); err != nil {
+			fmt.Printf("WARNING: Failed to send new device notification to user %d: %v\n", user.ID, err)
+		}
+	}
+
+	link, err := s.createSessionReportLink(ctx, user.ID, familyID)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to create session report link for user %d: %v\n", user.ID, err)
+		return
+	}
+
+	if err := s.mailer.Send(ctx, &email.Message{
+		To:      user.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was just signed in from a new device or network:\n\n"+
+			"Device: %s\nIP address: %s\nTime: %s\n\n"+
+			"If this was you, you can ignore this email. If it wasn't, use this link to sign that device out "+
+			"and reset your password:\n\n%s\n\nThe link expires in %d days.\n",
+			user.Username, device, ipAddress, time.Now().UTC().Format("January 2, 2006 15:04 MST"),
+			link, int(sessionReportExpiry.Hours()/24)),
+	}); err != nil {
+		fmt.Printf("ERROR: Failed to send new device email to user %d: %v\n", user.ID, err)
+	}
+}
+
+// createSessionReportLink signs a single-use link that reports a session family
+func (s *service) createSessionReportLink(ctx context.Context, userID int64, familyID string) (string, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// The signed token carries a random ID; only its hash is stored for single use
+	jti := generateSecureToken(32)
+	expiresAt := time.Now().Add(sessionReportExpiry)
+
+	token, err := s.config.Keys.Sign(jwt.MapClaims{
+		"user_id":   userID,
+		"tenant_id": tenantID,
+		"family_id": familyID,
+		"jti":       jti,
+		"type":      sessionReportTokenType,
+		"exp":       expiresAt.Unix(),
+		"iat":       time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.repo.CreateOTP(ctx, &OTP{
+		UserID:         &userID,
+		Identifier:     hashToken(jti),
+		IdentifierType: "link",
+		Code:           "-",
+		Purpose:        OTPPurposeSessionReport,
+		MaxAttempts:    1,
+		ExpiresAt:      expiresAt,
+	}); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/auth/not-me?token=%s", strings.TrimRight(s.config.FrontendURL, "/"), url.QueryEscape(token)), nil
+}
+
+// ReportSession handles a "this wasn't me" link: it signs out every session,
+// revokes every personal access token and requires a password reset before
+// the account can be signed in to again
+func (s *service) ReportSession(ctx context.Context, tokenString string) error {
+	token, err := s.config.Keys.Parse(tokenString)
+	if err != nil || !token.Valid {
+		return ErrInvalidSessionReport
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ErrInvalidSessionReport
+	}
+	tokenType, _ := claims["type"].(string)
+	jti, _ := claims["jti"].(string)
+	familyID, _ := claims["family_id"].(string)
+	userIDClaim, _ := claims["user_id"].(float64)
+	if tokenType != sessionReportTokenType || jti == "" || familyID == "" {
+		return ErrInvalidSessionReport
+	}
+	if ctx, err = scopeToLinkTenant(ctx, claims); err != nil {
+		return ErrInvalidSessionReport
+	}
+
+	link, err := s.repo.GetLatestOTP(ctx, hashToken(jti), "link", OTPPurposeSessionReport)
+	if err != nil {
+		if errors.Is(err, ErrOTPNotFound) {
+			return ErrInvalidSessionReport
+		}
+		return err
+	}
+	if link.UserID == nil || *link.UserID != int64(userIDClaim) || time.Now().After(link.ExpiresAt) {
+		return ErrInvalidSessionReport
+	}
+
+	consumed, err := s.repo.ConsumeOTP(ctx, link.ID)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidSessionReport
+	}
+
+	user, err := s.repo.GetUserByID(ctx, *link.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidSessionReport
+		}
+		return err
+	}
+
+	fmt.Printf("WARNING: User %d reported a session as not theirs\n", user.ID)
+
+	// Whoever signed in may have opened other sessions or created tokens
+	if err := s.revokeAllUserSessions(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if err := s.repo.RevokeAllPersonalAccessTokens(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to revoke personal access tokens: %w", err)
+	}
+
+	if err := s.repo.SetPasswordResetRequired(ctx, user.ID, true); err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	if err := s.sendPasswordReset(ctx, user); err != nil {
+		if errors.Is(err, ErrOTPRateLimited) {
+			fmt.Printf("WARNING: Password reset rate limit reached for user %d\n", user.ID)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
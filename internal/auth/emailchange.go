@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+)
+
+// emailRevertTokenType is the "type" claim of email change revert link tokens
+const emailRevertTokenType = "email_revert"
+
+// emailRevertExpiry is how long the old address can undo an email change
+const emailRevertExpiry = 7 * 24 * time.Hour
+
+// RequestEmailChange emails a confirmation code to the new address and warns
+// the current address. The address on file changes only once the code is confirmed.
+func (s *service) RequestEmailChange(ctx context.Context, userID int64, newEmail, password string) error {
+	user, err := s.verifyAccountPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrEmailExists
+	}
+	exists, err := s.repo.EmailExists(ctx, newEmail)
+	if err != nil {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+	if exists {
+		return ErrEmailExists
+	}
+
+	otp, err := s.issueOTP(ctx, &user.ID, newEmail, "email", OTPPurposeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailer.Send(ctx, &email.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nYour code to confirm this as your new email address is: %s\n\n"+
+			"This code expires in %d minutes. If you did not ask to change your email, you can ignore this email.\n",
+			user.Username, otp.Code, int(s.config.OTPExpiry.Minutes())),
+	}); err != nil {
+		return fmt.Errorf("failed to send confirmation code: %w", err)
+	}
+
+	s.sendEmailChangeNotice(ctx, user, user.Email, newEmail,
+		"Email change requested",
+		fmt.Sprintf("Someone asked to change your account's email address to %s. It will change once the new address is confirmed.", newEmail),
+		"cancel the change")
+
+	return nil
+}
+
+// ConfirmEmailChange checks the code sent to the new address and swaps it in as verified
+func (s *service) ConfirmEmailChange(ctx context.Context, userID int64, newEmail, code string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	otp, err := s.verifyOTP(ctx, newEmail, "email", OTPPurposeEmailChange, code)
+	if err != nil {
+		return err
+	}
+	if otp.UserID == nil || *otp.UserID != userID {
+		return ErrInvalidOTP
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	oldEmail := user.Email
+
+	// The code proves the user controls the new address
+	if err := s.repo.UpdateEmail(ctx, userID, newEmail, true); err != nil {
+		return err
+	}
+
+	fmt.Printf("INFO: User %d changed their email address\n", userID)
+
+	s.sendEmailChangeNotice(ctx, user, oldEmail, newEmail,
+		"Your email address was changed",
+		fmt.Sprintf("Your account's email address was changed to %s.", newEmail),
+		"change it back")
+
+	return nil
+}
+
+// sendEmailChangeNotice emails the old address about an email change with a
+// link that cancels or reverts it
+func (s *service) sendEmailChangeNotice(ctx context.Context, user *User, oldEmail, newEmail, subject, message, action string) {
+	link, err := s.createEmailRevertLink(ctx, user.ID, oldEmail, newEmail)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to create email revert link for user %d: %v\n", user.ID, err)
+		return
+	}
+
+	if err := s.mailer.Send(ctx, &email.Message{
+		To:      oldEmail,
+		Subject: subject,
+		Body: fmt.Sprintf("Hi %s,\n\n%s\n\nIf this wasn't you, use this link to %s and secure your account:\n\n%s\n\n"+
+			"The link expires in %d days.\n",
+			user.Username, message, action, link, int(emailRevertExpiry.Hours()/24)),
+	}); err != nil {
+		fmt.Printf("ERROR: Failed to send email change notice to user %d: %v\n", user.ID, err)
+	}
+}
+
+// createEmailRevertLink signs a single-use link that restores oldEmail
+func (s *service) createEmailRevertLink(ctx context.Context, userID int64, oldEmail, newEmail string) (string, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// The signed token carries a random ID; only its hash is stored for single use
+	jti := generateSecureToken(32)
+	expiresAt := time.Now().Add(emailRevertExpiry)
+
+	token, err := s.config.Keys.Sign(jwt.MapClaims{
+		"user_id":   userID,
+		"tenant_id": tenantID,
+		"old_email": oldEmail,
+		"new_email": newEmail,
+		"jti":       jti,
+		"type":      emailRevertTokenType,
+		"exp":       expiresAt.Unix(),
+		"iat":       time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.repo.CreateOTP(ctx, &OTP{
+		UserID:         &userID,
+		Identifier:     hashToken(jti),
+		IdentifierType: "link",
+		Code:           "-",
+		Purpose:        OTPPurposeEmailRevert,
+		MaxAttempts:    1,
+		ExpiresAt:      expiresAt,
+	}); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/auth/email/revert?token=%s", strings.TrimRight(s.config.FrontendURL, "/"), url.QueryEscape(token)), nil
+}
+
+// RevertEmailChange handles a revert link sent to the old address. It cancels
+// a pending change or restores the old address, then signs the account out
+// everywhere and requires a password reset.
+func (s *service) RevertEmailChange(ctx context.Context, tokenString string) error {
+	token, err := s.config.Keys.Parse(tokenString)
+	if err != nil || !token.Valid {
+		return ErrInvalidEmailRevert
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ErrInvalidEmailRevert
+	}
+	tokenType, _ := claims["type"].(string)
+	jti, _ := claims["jti"].(string)
+	oldEmail, _ := claims["old_email"].(string)
+	newEmail, _ := claims["new_email"].(string)
+	userIDClaim, _ := claims["user_id"].(float64)
+	if tokenType != emailRevertTokenType || jti == "" || oldEmail == "" || newEmail == "" {
+		return ErrInvalidEmailRevert
+	}
+	if ctx, err = scopeToLinkTenant(ctx, claims); err != nil {
+		return ErrInvalidEmailRevert
+	}
+
+	link, err := s.repo.GetLatestOTP(ctx, hashToken(jti), "link", OTPPurposeEmailRevert)
+	if err != nil {
+		if errors.Is(err, ErrOTPNotFound) {
+			return ErrInvalidEmailRevert
+		}
+		return err
+	}
+	if link.UserID == nil || *link.UserID != int64(userIDClaim) || time.Now().After(link.ExpiresAt) {
+		return ErrInvalidEmailRevert
+	}
+
+	consumed, err := s.repo.ConsumeOTP(ctx, link.ID)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidEmailRevert
+	}
+
+	user, err := s.repo.GetUserByID(ctx, *link.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidEmailRevert
+		}
+		return err
+	}
+
+	switch {
+	case strings.EqualFold(user.Email, newEmail):
+		// Clicking the link proves the user still controls the old address
+		if err := s.repo.UpdateEmail(ctx, user.ID, oldEmail, true); err != nil {
+			return err
+		}
+		user.Email = oldEmail
+	case strings.EqualFold(user.Email, oldEmail):
+		if err := s.repo.InvalidateOTPs(ctx, newEmail, "email", OTPPurposeEmailChange); err != nil {
+			return fmt.Errorf("failed to cancel email change: %w", err)
+		}
+	default:
+		// The address has changed again since the link was sent
+		return ErrInvalidEmailRevert
+	}
+
+	fmt.Printf("WARNING: User %d reverted an email change to %s\n", user.ID, newEmail)
+
+	// Whoever changed the address knew the password
+	if err := s.revokeAllUserSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.repo.SetPasswordResetRequired(ctx, user.ID, true); err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+
+	if err := s.sendPasswordReset(ctx, user); err != nil {
+		if errors.Is(err, ErrOTPRateLimited) {
+			fmt.Printf("WARNING: Password reset rate limit reached for user %d\n", user.ID)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestEmailChange(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+	mailer.Reset()
+
+	if err := svc.RequestEmailChange(ctx, user.ID, "ada@new.example.com", testPassword); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+
+	if msg := mailer.LastTo("ada@new.example.com"); msg == nil || msg.Subject != "Confirm your new email address" {
+		t.Errorf("no confirmation code sent to the new address, outbox = %v", mailer.Outbox())
+	}
+	if msg := mailer.LastTo("ada@example.com"); msg == nil || msg.Subject != "Email change requested" {
+		t.Errorf("old address not warned, outbox = %v", mailer.Outbox())
+	}
+	mailedLinkToken(t, mailer, "ada@example.com")
+
+	// Nothing changes until the new address is confirmed
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if stored.Email != "ada@example.com" {
+		t.Errorf("email changed to %s before confirmation", stored.Email)
+	}
+}
+
+func TestRequestEmailChangeChecks(t *testing.T) {
+	svc, _, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+	registerTestUser(t, svc, "grace@example.com", "grace")
+	mailer.Reset()
+
+	if err := svc.RequestEmailChange(ctx, user.ID, "ada@new.example.com", "not the password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("RequestEmailChange() with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if err := svc.RequestEmailChange(ctx, user.ID, "Grace@example.com", testPassword); !errors.Is(err, ErrEmailExists) {
+		t.Errorf("RequestEmailChange() to a taken address error = %v, want %v", err, ErrEmailExists)
+	}
+	if outbox := mailer.Outbox(); len(outbox) != 0 {
+		t.Errorf("sent %d emails for refused changes, want 0", len(outbox))
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+
+	if err := svc.RequestEmailChange(ctx, user.ID, "ada@new.example.com", testPassword); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	code := mailedCode(t, mailer, "ada@new.example.com")
+
+	// The code only confirms the change for the account that asked for it
+	other := registerTestUser(t, svc, "grace@example.com", "grace")
+	if err := svc.ConfirmEmailChange(ctx, other.ID, "ada@new.example.com", code); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("ConfirmEmailChange() by another user error = %v, want %v", err, ErrInvalidOTP)
+	}
+
+	if err := svc.RequestEmailChange(ctx, user.ID, "ada@new.example.com", testPassword); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	if err := svc.ConfirmEmailChange(ctx, user.ID, "ada@new.example.com", mailedCode(t, mailer, "ada@new.example.com")); err != nil {
+		t.Fatalf("ConfirmEmailChange() error = %v", err)
+	}
+
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if stored.Email != "ada@new.example.com" || !stored.EmailVerified {
+		t.Errorf("email = %s, verified = %t; want ada@new.example.com, verified", stored.Email, stored.EmailVerified)
+	}
+	if msg := mailer.LastTo("ada@example.com"); msg == nil || msg.Subject != "Your email address was changed" {
+		t.Errorf("old address not told about the change, outbox = %v", mailer.Outbox())
+	}
+}
+
+func TestRevertEmailChange(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+	if err := svc.VerifyEmail(ctx, user.Email, mailedCode(t, mailer, user.Email)); err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	if _, err := svc.createSession(ctx, user, "", "203.0.113.7", "test-agent"); err != nil {
+		t.Fatalf("createSession() error = %v", err)
+	}
+
+	if err := svc.RequestEmailChange(ctx, user.ID, "mallory@example.com", testPassword); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	if err := svc.ConfirmEmailChange(ctx, user.ID, "mallory@example.com", mailedCode(t, mailer, "mallory@example.com")); err != nil {
+		t.Fatalf("ConfirmEmailChange() error = %v", err)
+	}
+	revert := mailedLinkToken(t, mailer, "ada@example.com")
+
+	if err := svc.RevertEmailChange(ctx, revert); err != nil {
+		t.Fatalf("RevertEmailChange() error = %v", err)
+	}
+
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if stored.Email != "ada@example.com" || !stored.EmailVerified {
+		t.Errorf("email = %s, verified = %t; want ada@example.com, verified", stored.Email, stored.EmailVerified)
+	}
+	if sessions, _ := repo.GetUserSessions(ctx, user.ID); len(sessions) != 0 {
+		t.Errorf("%d sessions still active, want 0", len(sessions))
+	}
+	if required, _ := repo.IsPasswordResetRequired(ctx, user.ID); !required {
+		t.Error("password reset not required")
+	}
+	if msg := mailer.LastTo("ada@example.com"); msg == nil || msg.Subject != "Reset your password" {
+		t.Errorf("no password reset code sent to the restored address, outbox = %v", mailer.Outbox())
+	}
+
+	// Revert links work once
+	if err := svc.RevertEmailChange(ctx, revert); !errors.Is(err, ErrInvalidEmailRevert) {
+		t.Errorf("second RevertEmailChange() error = %v, want %v", err, ErrInvalidEmailRevert)
+	}
+}
+
+func TestRevertPendingEmailChange(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+
+	if err := svc.RequestEmailChange(ctx, user.ID, "mallory@example.com", testPassword); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	code := mailedCode(t, mailer, "mallory@example.com")
+
+	if err := svc.RevertEmailChange(ctx, mailedLinkToken(t, mailer, "ada@example.com")); err != nil {
+		t.Fatalf("RevertEmailChange() error = %v", err)
+	}
+
+	// The cancelled change can no longer be confirmed
+	if err := svc.ConfirmEmailChange(ctx, user.ID, "mallory@example.com", code); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("ConfirmEmailChange() error = %v, want %v", err, ErrInvalidOTP)
+	}
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if stored.Email != "ada@example.com" {
+		t.Errorf("email = %s, want ada@example.com", stored.Email)
+	}
+}
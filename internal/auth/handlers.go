@@ -3,11 +3,13 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/oauth"
 )
 
 // Handler handles auth HTTP requests
@@ -25,17 +27,102 @@ func (h *Handler) RegisterRoutes(router *mux.Router, authMiddleware *Middleware)
 	// Public routes
 	router.HandleFunc("/api/v1/auth/register", h.Register).Methods("POST")
 	router.HandleFunc("/api/v1/auth/login", h.Login).Methods("POST")
+	router.HandleFunc("/api/v1/auth/login/2fa", h.LoginTwoFactor).Methods("POST")
+	router.HandleFunc("/api/v1/auth/magic-link", h.RequestMagicLink).Methods("POST")
+	router.HandleFunc("/api/v1/auth/magic-link/verify", h.LoginWithMagicLink).Methods("POST")
+	router.HandleFunc("/api/v1/auth/passkeys/login/options", h.BeginPasskeyLogin).Methods("POST")
+	router.HandleFunc("/api/v1/auth/passkeys/login", h.FinishPasskeyLogin).Methods("POST")
 	router.HandleFunc("/api/v1/auth/refresh", h.RefreshToken).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", h.JWKS).Methods("GET")
+	router.HandleFunc("/api/v1/auth/verify-email", h.VerifyEmail).Methods("POST")
+	router.HandleFunc("/api/v1/auth/resend-verification", h.ResendVerification).Methods("POST")
+	router.HandleFunc("/api/v1/auth/forgot-password", h.ForgotPassword).Methods("POST")
+	router.HandleFunc("/api/v1/auth/reset-password", h.ResetPassword).Methods("POST")
+	router.HandleFunc("/api/v1/auth/sessions/report", h.ReportSession).Methods("POST")
+	router.HandleFunc("/api/v1/auth/email/revert", h.RevertEmailChange).Methods("POST")
+	router.HandleFunc("/api/v1/auth/unlock/request", h.RequestUnlock).Methods("POST")
+	router.HandleFunc("/api/v1/auth/unlock", h.UnlockAccount).Methods("POST")
+	router.HandleFunc("/api/v1/auth/oauth/{provider}/authorize", h.StartOAuth).Methods("GET")
+	router.HandleFunc("/api/v1/auth/oauth/{provider}/callback", h.OAuthCallback).Methods("POST")
+	router.HandleFunc("/api/v1/auth/invites/validate", h.ValidateInvite).Methods("POST")
 
 	// Protected routes
 	protected := router.PathPrefix("/api/v1/auth").Subrouter()
 	protected.Use(authMiddleware.Authenticate)
+	protected.Use(authMiddleware.RequireSession)
 	protected.HandleFunc("/me", h.GetMe).Methods("GET")
 	protected.HandleFunc("/logout", h.Logout).Methods("POST")
-	protected.HandleFunc("/logout-all", h.LogoutAll).Methods("POST")
-	protected.HandleFunc("/change-password", h.ChangePassword).Methods("POST")
+	protected.HandleFunc("/2fa", h.GetTwoFactorStatus).Methods("GET")
+	protected.HandleFunc("/identities", h.GetIdentities).Methods("GET")
+	protected.HandleFunc("/login-history", h.GetLoginHistory).Methods("GET")
 	protected.HandleFunc("/sessions", h.GetSessions).Methods("GET")
-	protected.HandleFunc("/sessions/{id}", h.RevokeSession).Methods("DELETE")
+	protected.HandleFunc("/tokens", h.GetTokens).Methods("GET")
+	protected.HandleFunc("/passkeys", h.GetPasskeys).Methods("GET")
+	protected.HandleFunc("/invites", h.GetInvites).Methods("GET")
+	protected.HandleFunc("/referrals", h.GetReferrals).Methods("GET")
+	protected.HandleFunc("/referrals/tree", h.GetReferralTree).Methods("GET")
+	protected.HandleFunc("/referrals/stats", h.GetReferralStats).Methods("GET")
+
+	// Account and credential changes, refused while an admin impersonates the user
+	sensitive := protected.NewRoute().Subrouter()
+	sensitive.Use(common.BlockImpersonation)
+	sensitive.HandleFunc("/logout-all", h.LogoutAll).Methods("POST")
+	sensitive.HandleFunc("/change-password", h.ChangePassword).Methods("POST")
+	sensitive.HandleFunc("/email/change", h.ChangeEmail).Methods("POST")
+	sensitive.HandleFunc("/email/change/confirm", h.ConfirmEmailChange).Methods("POST")
+	sensitive.HandleFunc("/account/deactivate", h.DeactivateAccount).Methods("POST")
+	sensitive.HandleFunc("/account/delete", h.DeleteAccount).Methods("POST")
+	sensitive.HandleFunc("/phone/send-code", h.SendPhoneCode).Methods("POST")
+	sensitive.HandleFunc("/phone/verify", h.VerifyPhone).Methods("POST")
+	sensitive.HandleFunc("/2fa/setup", h.SetupTwoFactor).Methods("POST")
+	sensitive.HandleFunc("/2fa/enable", h.EnableTwoFactor).Methods("POST")
+	sensitive.HandleFunc("/2fa/disable", h.DisableTwoFactor).Methods("POST")
+	sensitive.HandleFunc("/2fa/recovery-codes", h.RegenerateRecoveryCodes).Methods("POST")
+	sensitive.HandleFunc("/sessions/{id}", h.RevokeSession).Methods("DELETE")
+	sensitive.HandleFunc("/tokens", h.CreateToken).Methods("POST")
+	sensitive.HandleFunc("/tokens/{id}", h.RevokeToken).Methods("DELETE")
+	sensitive.HandleFunc("/passkeys/register/options", h.BeginPasskeyRegistration).Methods("POST")
+	sensitive.HandleFunc("/passkeys/register", h.FinishPasskeyRegistration).Methods("POST")
+	sensitive.HandleFunc("/passkeys/{id}", h.RenamePasskey).Methods("PATCH")
+	sensitive.HandleFunc("/passkeys/{id}", h.DeletePasskey).Methods("DELETE")
+	sensitive.HandleFunc("/invites", h.CreateInvite).Methods("POST")
+	sensitive.HandleFunc("/invites/{id}", h.RevokeInvite).Methods("DELETE")
+
+	// Admin routes
+	admin := router.PathPrefix("/api/v1/admin").Subrouter()
+	admin.Use(authMiddleware.Authenticate)
+	admin.Use(authMiddleware.RequireSession)
+	admin.Use(authMiddleware.RequirePermission(PermissionRolesManage))
+	admin.HandleFunc("/roles", h.ListRoles).Methods("GET")
+	admin.HandleFunc("/users/{id}/roles", h.GetUserRoles).Methods("GET")
+	admin.HandleFunc("/users/{id}/roles", h.GrantRole).Methods("POST")
+	admin.HandleFunc("/users/{id}/roles/{role}", h.RevokeRole).Methods("DELETE")
+
+	// Impersonation
+	impersonation := router.PathPrefix("/api/v1/admin").Subrouter()
+	impersonation.Use(authMiddleware.Authenticate)
+	impersonation.Use(authMiddleware.RequireSession)
+	impersonation.Use(common.BlockImpersonation)
+	impersonation.Use(authMiddleware.RequirePermission(PermissionUsersImpersonate))
+	impersonation.HandleFunc("/users/{id}/impersonate", h.Impersonate).Methods("POST")
+
+	// Impersonation audit log
+	audit := router.PathPrefix("/api/v1/admin").Subrouter()
+	audit.Use(authMiddleware.Authenticate)
+	audit.Use(authMiddleware.RequireSession)
+	audit.Use(authMiddleware.RequirePermission(PermissionAuditRead))
+	audit.HandleFunc("/impersonations", h.GetImpersonations).Methods("GET")
+	audit.HandleFunc("/impersonations/{id}/requests", h.GetImpersonationRequests).Methods("GET")
+
+	// Invite administration
+	invites := router.PathPrefix("/api/v1/admin").Subrouter()
+	invites.Use(authMiddleware.Authenticate)
+	invites.Use(authMiddleware.RequireSession)
+	invites.Use(authMiddleware.RequirePermission(PermissionInvitesManage))
+	invites.HandleFunc("/invites", h.ListInvites).Methods("GET")
+	invites.HandleFunc("/invites/{id}", h.AdminRevokeInvite).Methods("DELETE")
+	invites.HandleFunc("/users/{id}/referrals/tree", h.GetUserReferralTree).Methods("GET")
+	invites.HandleFunc("/users/{id}/referrals/stats", h.GetUserReferralStats).Methods("GET")
 }
 
 // Register handles user registration
@@ -60,6 +147,21 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 			common.Conflict(w, "Username already taken")
 			return
 		}
+		if errors.Is(err, ErrPhoneExists) {
+			common.Conflict(w, "Phone number already registered")
+			return
+		}
+		if errors.Is(err, ErrInviteRequired) {
+			common.Forbidden(w, "Registration is by invitation only, an invite code is required")
+			return
+		}
+		if errors.Is(err, ErrInvalidInvite) {
+			common.BadRequest(w, "Invite code is invalid or has expired")
+			return
+		}
+		if writePasswordPolicyError(w, err) {
+			return
+		}
 		common.InternalError(w, fmt.Sprintf("Failed to create account: %v", err))
 		return
 	}
@@ -81,14 +183,63 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 
 	response, err := h.service.Login(r.Context(), &req, ipAddress, userAgent)
 	if err != nil {
+		if writeLockoutError(w, err) {
+			return
+		}
 		if errors.Is(err, ErrInvalidCredentials) {
-			common.Unauthorized(w, "Invalid email/username or password")
+			common.Unauthorized(w, "Invalid email/username/phone or password")
+			return
+		}
+		if errors.Is(err, ErrAccountInactive) {
+			common.Forbidden(w, "Account is not active")
+			return
+		}
+		if errors.Is(err, ErrPasswordResetRequired) {
+			common.Forbidden(w, "Password reset required. Check your email for a reset code")
 			return
 		}
 		common.InternalError(w, "Login failed")
 		return
 	}
 
+	if response.TwoFactorRequired {
+		common.Success(w, "Two-factor authentication required", response)
+		return
+	}
+
+	common.Success(w, "Login successful", response)
+}
+
+// LoginTwoFactor completes a login that requires a second factor
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	response, err := h.service.CompleteTwoFactorLogin(r.Context(), &req, getClientIP(r), r.UserAgent())
+	if err != nil {
+		if writeLockoutError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, ErrInvalidChallenge):
+			common.Unauthorized(w, "Login challenge is invalid or expired, please login again")
+		case errors.Is(err, ErrInvalidTwoFactorCode):
+			common.Unauthorized(w, "Invalid two-factor code")
+		case errors.Is(err, ErrTooManyAttempts):
+			common.Error(w, http.StatusTooManyRequests, "Too many attempts, please login again")
+		case errors.Is(err, ErrAccountInactive):
+			common.Forbidden(w, "Account is not active")
+		case errors.Is(err, ErrPasswordResetRequired):
+			common.Forbidden(w, "Password reset required. Check your email for a reset code")
+		default:
+			common.InternalError(w, "Login failed")
+		}
+		return
+	}
+
 	common.Success(w, "Login successful", response)
 }
 
@@ -100,6 +251,16 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Logging out of an impersonation token ends the impersonation
+	if impersonationID, ok := common.GetImpersonationID(r.Context()); ok {
+		if err := h.service.EndImpersonation(r.Context(), impersonationID); err != nil {
+			common.InternalError(w, "Logout failed")
+			return
+		}
+		common.Success(w, "Impersonation ended", nil)
+		return
+	}
+
 	sessionID, _ := common.GetSessionID(r.Context())
 
 	if err := h.service.Logout(r.Context(), userID, sessionID); err != nil {
@@ -136,6 +297,10 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 	response, err := h.service.RefreshToken(r.Context(), req.RefreshToken)
 	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			common.Unauthorized(w, "Refresh token has already been used; please log in again")
+			return
+		}
 		common.Unauthorized(w, "Invalid refresh token")
 		return
 	}
@@ -143,6 +308,294 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, "Token refreshed", response)
 }
 
+// JWKS serves the public token verification keys
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	common.JSON(w, http.StatusOK, h.service.JWKS())
+}
+
+// VerifyEmail handles email verification with a one-time code
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	req.Email = common.SanitizeEmail(req.Email)
+
+	if err := h.service.VerifyEmail(r.Context(), req.Email, common.SanitizeString(req.Code)); err != nil {
+		if writeOTPError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to verify email")
+		return
+	}
+
+	common.Success(w, "Email verified successfully", nil)
+}
+
+// ResendVerification handles requests for a new email verification code
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	req.Email = common.SanitizeEmail(req.Email)
+
+	if err := h.service.ResendEmailVerification(r.Context(), req.Email); err != nil {
+		if errors.Is(err, ErrOTPRateLimited) {
+			common.Error(w, http.StatusTooManyRequests, "Too many codes requested, please try again later")
+			return
+		}
+		common.InternalError(w, "Failed to send verification code")
+		return
+	}
+
+	common.Success(w, "If the email is registered, a verification code has been sent", nil)
+}
+
+// ForgotPassword handles password reset code requests
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	req.Email = common.SanitizeEmail(req.Email)
+
+	if err := h.service.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		common.InternalError(w, "Failed to request password reset")
+		return
+	}
+
+	common.Success(w, "If the email is registered, a password reset code has been sent", nil)
+}
+
+// ResetPassword handles password reset confirmation
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ConfirmResetRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	req.Email = common.SanitizeEmail(req.Email)
+
+	if err := h.service.ResetPassword(r.Context(), req.Email, common.SanitizeString(req.Code), req.NewPassword); err != nil {
+		if writeOTPError(w, err) || writePasswordPolicyError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to reset password")
+		return
+	}
+
+	common.Success(w, "Password reset successfully. Please login again.", nil)
+}
+
+// RequestUnlock emails an account unlock code
+func (h *Handler) RequestUnlock(w http.ResponseWriter, r *http.Request) {
+	var req AccountUnlockRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	req.Email = common.SanitizeEmail(req.Email)
+
+	if err := h.service.RequestAccountUnlock(r.Context(), req.Email); err != nil {
+		common.InternalError(w, "Failed to request unlock code")
+		return
+	}
+
+	common.Success(w, "If the email is registered, an unlock code has been sent", nil)
+}
+
+// UnlockAccount lifts a login lock with an emailed code
+func (h *Handler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	var req ConfirmUnlockRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	req.Email = common.SanitizeEmail(req.Email)
+
+	if err := h.service.UnlockAccount(r.Context(), req.Email, common.SanitizeString(req.Code)); err != nil {
+		if writeOTPError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to unlock account")
+		return
+	}
+
+	common.Success(w, "Account unlocked. You can log in again.", nil)
+}
+
+// GetLoginHistory lists the current user's login attempts
+func (h *Handler) GetLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	attempts, total, err := h.service.GetLoginHistory(r.Context(), userID, limit, offset)
+	if err != nil {
+		common.InternalError(w, "Failed to get login history")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", attempts, &common.Meta{Total: total})
+}
+
+// SendPhoneCode sends a verification code to the given phone number
+func (h *Handler) SendPhoneCode(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req SendPhoneCodeRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.SendPhoneVerification(r.Context(), userID, common.SanitizeString(req.Phone)); err != nil {
+		switch {
+		case errors.Is(err, ErrPhoneExists):
+			common.Conflict(w, "Phone number already registered")
+		case errors.Is(err, ErrOTPRateLimited):
+			common.Error(w, http.StatusTooManyRequests, "Too many codes requested, please try again later")
+		default:
+			common.InternalError(w, "Failed to send verification code")
+		}
+		return
+	}
+
+	common.Success(w, "Verification code sent", nil)
+}
+
+// VerifyPhone handles phone verification with a one-time code
+func (h *Handler) VerifyPhone(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req VerifyPhoneRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.VerifyPhone(r.Context(), userID, common.SanitizeString(req.Phone), common.SanitizeString(req.Code)); err != nil {
+		if errors.Is(err, ErrPhoneExists) {
+			common.Conflict(w, "Phone number already registered")
+			return
+		}
+		if writeOTPError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to verify phone")
+		return
+	}
+
+	common.Success(w, "Phone verified successfully", nil)
+}
+
+// ChangeEmail sends a confirmation code to a new email address
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req ChangeEmailRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.RequestEmailChange(r.Context(), userID, req.NewEmail, req.Password); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			common.BadRequest(w, "Password is incorrect")
+		case errors.Is(err, ErrEmailExists):
+			common.Conflict(w, "Email already registered")
+		case errors.Is(err, ErrOTPRateLimited):
+			common.Error(w, http.StatusTooManyRequests, "Too many codes requested, please try again later")
+		default:
+			common.InternalError(w, "Failed to start email change")
+		}
+		return
+	}
+
+	common.Success(w, "Confirmation code sent to the new email address", nil)
+}
+
+// ConfirmEmailChange switches to the new email address using the code sent to it
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req ConfirmEmailChangeRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.ConfirmEmailChange(r.Context(), userID, req.NewEmail, common.SanitizeString(req.Code)); err != nil {
+		if errors.Is(err, ErrEmailExists) {
+			common.Conflict(w, "Email already registered")
+			return
+		}
+		if writeOTPError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to change email")
+		return
+	}
+
+	common.Success(w, "Email address changed", nil)
+}
+
+// RevertEmailChange undoes an email change from the link sent to the old address
+func (h *Handler) RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req RevertEmailChangeRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.RevertEmailChange(r.Context(), req.Token); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidEmailRevert):
+			common.BadRequest(w, "Link is invalid or has expired")
+		case errors.Is(err, ErrEmailExists):
+			common.Conflict(w, "Your previous email address is now used by another account")
+		default:
+			common.InternalError(w, "Failed to revert email change")
+		}
+		return
+	}
+
+	common.Success(w, "Email change reverted. Check your email for a code to reset your password", nil)
+}
+
 // GetMe returns current user info
 func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
 	userID, err := common.GetUserID(r.Context())
@@ -179,6 +632,9 @@ func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 			common.BadRequest(w, err.Error())
 			return
 		}
+		if writePasswordPolicyError(w, err) {
+			return
+		}
 		common.InternalError(w, "Failed to change password")
 		return
 	}
@@ -186,57 +642,1110 @@ func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, "Password changed successfully. Please login again.", nil)
 }
 
-// GetSessions returns user's active sessions
-func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+// DeactivateAccount hides the user's account until they log in again
+func (h *Handler) DeactivateAccount(w http.ResponseWriter, r *http.Request) {
 	userID, err := common.GetUserID(r.Context())
 	if err != nil {
 		common.Unauthorized(w, "Unauthorized")
 		return
 	}
 
-	sessions, err := h.service.GetUserSessions(r.Context(), userID)
-	if err != nil {
-		common.InternalError(w, "Failed to get sessions")
+	var req DeactivateAccountRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
 		return
 	}
 
-	common.Success(w, "", sessions)
+	if err := h.service.DeactivateAccount(r.Context(), userID, req.Password); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			common.BadRequest(w, "Password is incorrect")
+			return
+		}
+		common.InternalError(w, "Failed to deactivate account")
+		return
+	}
+
+	common.Success(w, "Account deactivated. Log in again to reactivate it.", nil)
 }
 
-// RevokeSession revokes a specific session
-func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+// DeleteAccount schedules the user's account for permanent deletion
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 	userID, err := common.GetUserID(r.Context())
 	if err != nil {
 		common.Unauthorized(w, "Unauthorized")
 		return
 	}
 
-	vars := mux.Vars(r)
-	sessionID, err := strconv.ParseInt(vars["id"], 10, 64)
-	if err != nil {
-		common.BadRequest(w, "Invalid session ID")
+	var req DeleteAccountRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
 		return
 	}
 
-	if err := h.service.InvalidateSession(r.Context(), userID, sessionID); err != nil {
-		common.InternalError(w, "Failed to revoke session")
+	response, err := h.service.RequestAccountDeletion(r.Context(), userID, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			common.BadRequest(w, "Password is incorrect")
+			return
+		}
+		common.InternalError(w, "Failed to delete account")
+		return
+	}
+
+	common.Success(w, "Account scheduled for deletion. Log in before then to cancel.", response)
+}
+
+// GetTwoFactorStatus returns the user's 2FA status
+func (h *Handler) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	status, err := h.service.GetTwoFactorStatus(r.Context(), userID)
+	if err != nil {
+		common.InternalError(w, "Failed to get two-factor status")
+		return
+	}
+
+	common.Success(w, "", status)
+}
+
+// SetupTwoFactor starts TOTP enrollment
+func (h *Handler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	setup, err := h.service.SetupTwoFactor(r.Context(), userID)
+	if err != nil {
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to set up two-factor authentication")
+		return
+	}
+
+	common.Success(w, "Scan the code with your authenticator app, then confirm with a code", setup)
+}
+
+// EnableTwoFactor confirms TOTP enrollment and returns recovery codes
+func (h *Handler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	codes, err := h.service.EnableTwoFactor(r.Context(), userID, req.Code)
+	if err != nil {
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to enable two-factor authentication")
+		return
+	}
+
+	common.Success(w, "Two-factor authentication enabled. Store your recovery codes somewhere safe.", codes)
+}
+
+// DisableTwoFactor turns off 2FA
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.DisableTwoFactor(r.Context(), userID, req.Password, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			common.BadRequest(w, "Password is incorrect")
+			return
+		}
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to disable two-factor authentication")
+		return
+	}
+
+	common.Success(w, "Two-factor authentication disabled", nil)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), userID, req.Code)
+	if err != nil {
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to regenerate recovery codes")
+		return
+	}
+
+	common.Success(w, "Recovery codes regenerated", codes)
+}
+
+// GetSessions returns user's active sessions
+func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	// Personal access tokens have no session, so none is flagged current
+	sessionID, _ := common.GetSessionID(r.Context())
+
+	sessions, err := h.service.GetUserSessions(r.Context(), userID, sessionID)
+	if err != nil {
+		common.InternalError(w, "Failed to get sessions")
+		return
+	}
+
+	common.Success(w, "", sessions)
+}
+
+// ReportSession signs out a session reported from a new-device alert and
+// requires a password reset
+func (h *Handler) ReportSession(w http.ResponseWriter, r *http.Request) {
+	var req ReportSessionRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.ReportSession(r.Context(), req.Token); err != nil {
+		if errors.Is(err, ErrInvalidSessionReport) {
+			common.BadRequest(w, "Link is invalid or has expired")
+			return
+		}
+		common.InternalError(w, "Failed to secure account")
+		return
+	}
+
+	common.Success(w, "The session has been signed out. Check your email for a code to reset your password", nil)
+}
+
+// RevokeSession revokes a specific session
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	sessionID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid session ID")
+		return
+	}
+
+	if err := h.service.InvalidateSession(r.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			common.NotFound(w, "Session not found")
+			return
+		}
+		common.InternalError(w, "Failed to revoke session")
 		return
 	}
 
 	common.Success(w, "Session revoked", nil)
 }
 
-// Helper function to get client IP
-func getClientIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		return forwarded
+// GetTokens lists the user's personal access tokens
+func (h *Handler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	tokens, err := h.service.GetPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		common.InternalError(w, "Failed to get tokens")
+		return
+	}
+
+	common.Success(w, "", tokens)
+}
+
+// CreateToken issues a personal access token
+func (h *Handler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req CreateTokenRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	response, err := h.service.CreatePersonalAccessToken(r.Context(), userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidScope):
+			common.BadRequest(w, err.Error())
+		case errors.Is(err, ErrTokenLimitReached):
+			common.Conflict(w, "Maximum number of tokens reached, revoke one first")
+		default:
+			common.InternalError(w, "Failed to create token")
+		}
+		return
+	}
+
+	common.Created(w, "Token created. Copy it now, it will not be shown again", response)
+}
+
+// RevokeToken revokes a personal access token
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid token ID")
+		return
+	}
+
+	if err := h.service.RevokePersonalAccessToken(r.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			common.NotFound(w, "Token not found")
+			return
+		}
+		common.InternalError(w, "Failed to revoke token")
+		return
+	}
+
+	common.Success(w, "Token revoked", nil)
+}
+
+// GetPasskeys lists the user's passkeys
+func (h *Handler) GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	passkeys, err := h.service.GetPasskeys(r.Context(), userID)
+	if err != nil {
+		common.InternalError(w, "Failed to get passkeys")
+		return
+	}
+
+	common.Success(w, "", passkeys)
+}
+
+// BeginPasskeyRegistration returns options for creating a passkey
+func (h *Handler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	options, err := h.service.BeginPasskeyRegistration(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrPasskeyLimitReached) {
+			common.Conflict(w, "Maximum number of passkeys reached")
+			return
+		}
+		common.InternalError(w, "Failed to start passkey registration")
+		return
+	}
+
+	common.Success(w, "", options)
+}
+
+// FinishPasskeyRegistration stores a newly created passkey
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req PasskeyRegistrationRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
 	}
 
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+	passkey, err := h.service.FinishPasskeyRegistration(r.Context(), userID, &req)
+	if err != nil {
+		if writePasskeyError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to register passkey")
+		return
+	}
+
+	common.Created(w, "Passkey registered", passkey)
+}
+
+// RenamePasskey renames a passkey
+func (h *Handler) RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	passkeyID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid passkey ID")
+		return
 	}
 
-	return r.RemoteAddr
+	var req RenamePasskeyRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.RenamePasskey(r.Context(), userID, passkeyID, req.Name); err != nil {
+		if writePasskeyError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to rename passkey")
+		return
+	}
+
+	common.Success(w, "Passkey renamed", nil)
+}
+
+// DeletePasskey removes a passkey
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	passkeyID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid passkey ID")
+		return
+	}
+
+	if err := h.service.DeletePasskey(r.Context(), userID, passkeyID); err != nil {
+		if writePasskeyError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to delete passkey")
+		return
+	}
+
+	common.Success(w, "Passkey deleted", nil)
+}
+
+// BeginPasskeyLogin returns options for signing in with a passkey
+func (h *Handler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginOptionsRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	options, err := h.service.BeginPasskeyLogin(r.Context(), req.Identifier)
+	if err != nil {
+		common.InternalError(w, "Failed to start passkey login")
+		return
+	}
+
+	common.Success(w, "", options)
+}
+
+// FinishPasskeyLogin signs the user in with a passkey assertion
+func (h *Handler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	response, err := h.service.FinishPasskeyLogin(r.Context(), &req, getClientIP(r), r.UserAgent())
+	if err != nil {
+		if writeLockoutError(w, err) {
+			return
+		}
+		if writePasskeyError(w, err) {
+			return
+		}
+		common.InternalError(w, "Login failed")
+		return
+	}
+
+	if response.TwoFactorRequired {
+		common.Success(w, "Two-factor authentication required", response)
+		return
+	}
+
+	common.Success(w, "Login successful", response)
+}
+
+// writePasskeyError maps passkey errors to responses and reports whether it wrote one
+func writePasskeyError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrInvalidWebAuthnChallenge):
+		common.BadRequest(w, "Passkey challenge is invalid or expired, please try again")
+	case errors.Is(err, ErrInvalidPasskey):
+		common.Unauthorized(w, "Passkey could not be verified")
+	case errors.Is(err, ErrPasskeyExists):
+		common.Conflict(w, "Passkey already registered")
+	case errors.Is(err, ErrPasskeyNotFound):
+		common.NotFound(w, "Passkey not found")
+	case errors.Is(err, ErrAccountInactive):
+		common.Forbidden(w, "Account is not active")
+	case errors.Is(err, ErrPasswordResetRequired):
+		common.Forbidden(w, "Password reset required. Check your email for a reset code")
+	default:
+		return false
+	}
+	return true
+}
+
+// RequestMagicLink emails a passwordless login link
+func (h *Handler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req MagicLinkRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	req.Email = common.SanitizeEmail(req.Email)
+
+	if err := h.service.RequestMagicLink(r.Context(), req.Email); err != nil {
+		common.InternalError(w, "Failed to send login link")
+		return
+	}
+
+	common.Success(w, "If the email is registered, a login link has been sent", nil)
+}
+
+// LoginWithMagicLink signs the user in with a login link token
+func (h *Handler) LoginWithMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req MagicLinkLoginRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	response, err := h.service.LoginWithMagicLink(r.Context(), &req, getClientIP(r), r.UserAgent())
+	if err != nil {
+		if errors.Is(err, ErrInvalidMagicLink) {
+			common.Unauthorized(w, "Login link is invalid or has expired")
+			return
+		}
+		if errors.Is(err, ErrAccountInactive) {
+			common.Forbidden(w, "Account is not active")
+			return
+		}
+		if errors.Is(err, ErrPasswordResetRequired) {
+			common.Forbidden(w, "Password reset required. Check your email for a reset code")
+			return
+		}
+		common.InternalError(w, "Login failed")
+		return
+	}
+
+	if response.TwoFactorRequired {
+		common.Success(w, "Two-factor authentication required", response)
+		return
+	}
+
+	common.Success(w, "Login successful", response)
+}
+
+// StartOAuth returns the provider authorization URL for social login
+func (h *Handler) StartOAuth(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+
+	response, err := h.service.StartOAuthLogin(r.Context(), provider)
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			common.NotFound(w, "Unknown identity provider")
+			return
+		}
+		common.InternalError(w, "Failed to start login")
+		return
+	}
+
+	common.Success(w, "", response)
+}
+
+// OAuthCallback completes social login with the provider's authorization code
+func (h *Handler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+
+	var req OAuthCallbackRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	response, err := h.service.CompleteOAuthLogin(r.Context(), provider, &req, getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			common.NotFound(w, "Unknown identity provider")
+		case errors.Is(err, ErrInvalidOAuthState):
+			common.BadRequest(w, "Login request is invalid or has expired")
+		case errors.Is(err, ErrOAuthEmailUnverified), errors.Is(err, oauth.ErrNoEmail):
+			common.Forbidden(w, "Your provider account has no verified email address")
+		case errors.Is(err, ErrOAuthAccountConflict):
+			common.Conflict(w, "An account with this email exists; sign in with your password and verify your email first")
+		case errors.Is(err, ErrInviteRequired):
+			common.Forbidden(w, "Registration is by invitation only; register with an invite code before signing in with this provider")
+		case errors.Is(err, oauth.ErrExchangeFailed), errors.Is(err, oauth.ErrInvalidIDToken):
+			common.Unauthorized(w, "Identity provider rejected the login")
+		case errors.Is(err, ErrAccountInactive):
+			common.Forbidden(w, "Account is not active")
+		case errors.Is(err, ErrPasswordResetRequired):
+			common.Forbidden(w, "Password reset required. Check your email for a reset code")
+		default:
+			common.InternalError(w, "Login failed")
+		}
+		return
+	}
+
+	if response.TwoFactorRequired {
+		common.Success(w, "Two-factor authentication required", response)
+		return
+	}
+
+	common.Success(w, "Login successful", response)
+}
+
+// GetIdentities lists the external identities linked to the current user
+func (h *Handler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	identities, err := h.service.GetUserIdentities(r.Context(), userID)
+	if err != nil {
+		common.InternalError(w, "Failed to get identities")
+		return
+	}
+
+	common.Success(w, "", identities)
+}
+
+// ListRoles lists every role with its permissions
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.GetRoles(r.Context())
+	if err != nil {
+		common.InternalError(w, "Failed to get roles")
+		return
+	}
+
+	common.Success(w, "", roles)
+}
+
+// GetUserRoles lists the roles granted to a user
+func (h *Handler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	roles, err := h.service.GetUserRoles(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			common.NotFound(w, "User not found")
+			return
+		}
+		common.InternalError(w, "Failed to get user roles")
+		return
+	}
+
+	common.Success(w, "", roles)
+}
+
+// GrantRole grants a role to a user
+func (h *Handler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	actorID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	var req GrantRoleRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.GrantRole(r.Context(), actorID, userID, req.Role); err != nil {
+		if writeRoleError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to grant role")
+		return
+	}
+
+	common.Success(w, "Role granted", nil)
+}
+
+// RevokeRole removes a role from a user
+func (h *Handler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	actorID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	if err := h.service.RevokeRole(r.Context(), actorID, userID, vars["role"]); err != nil {
+		if writeRoleError(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to revoke role")
+		return
+	}
+
+	common.Success(w, "Role revoked", nil)
+}
+
+// Impersonate starts an impersonation session for support
+func (h *Handler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	adminID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	var req ImpersonateRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	response, err := h.service.StartImpersonation(r.Context(), adminID, userID, common.SanitizeString(req.Reason), getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			common.NotFound(w, "User not found")
+		case errors.Is(err, ErrCannotImpersonateSelf):
+			common.BadRequest(w, "You cannot impersonate yourself")
+		case errors.Is(err, ErrCannotImpersonateStaff):
+			common.Forbidden(w, "Staff accounts cannot be impersonated")
+		case errors.Is(err, ErrAccountInactive):
+			common.Conflict(w, "Only active accounts can be impersonated")
+		default:
+			common.InternalError(w, "Failed to start impersonation")
+		}
+		return
+	}
+
+	common.Created(w, "Impersonation started", response)
+}
+
+// GetImpersonations lists impersonation sessions, optionally filtered by
+// admin_id and user_id
+func (h *Handler) GetImpersonations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := ImpersonationFilter{}
+	filter.AdminID, _ = strconv.ParseInt(query.Get("admin_id"), 10, 64)
+	filter.TargetUserID, _ = strconv.ParseInt(query.Get("user_id"), 10, 64)
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	sessions, total, err := h.service.GetImpersonationSessions(r.Context(), filter, limit, offset)
+	if err != nil {
+		common.InternalError(w, "Failed to get impersonations")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", sessions, &common.Meta{Total: total})
+}
+
+// GetImpersonationRequests lists the requests made during an impersonation session
+func (h *Handler) GetImpersonationRequests(w http.ResponseWriter, r *http.Request) {
+	impersonationID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid impersonation ID")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	entries, total, err := h.service.GetImpersonationAuditLog(r.Context(), impersonationID, limit, offset)
+	if err != nil {
+		common.InternalError(w, "Failed to get impersonation requests")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", entries, &common.Meta{Total: total})
+}
+
+// ValidateInvite checks an invite code before the user fills in the registration form
+func (h *Handler) ValidateInvite(w http.ResponseWriter, r *http.Request) {
+	var req ValidateInviteRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	preview, err := h.service.ValidateInvite(r.Context(), req.Code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidInvite) {
+			common.NotFound(w, "Invite code is invalid or has expired")
+			return
+		}
+		common.InternalError(w, "Failed to check invite code")
+		return
+	}
+
+	common.Success(w, "Invite code is valid", preview)
+}
+
+// GetInvites lists the current user's invite codes
+func (h *Handler) GetInvites(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	invites, err := h.service.GetUserInvites(r.Context(), userID)
+	if err != nil {
+		common.InternalError(w, "Failed to get invites")
+		return
+	}
+
+	common.Success(w, "", invites)
+}
+
+// CreateInvite creates an invite code
+func (h *Handler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req CreateInviteRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	invite, err := h.service.CreateInvite(r.Context(), userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInviteTooGenerous):
+			common.BadRequest(w, "Invite allows more sign-ups or lasts longer than members may allow")
+		case errors.Is(err, ErrInviteLimitReached):
+			common.Conflict(w, "Maximum number of active invites reached, revoke one first")
+		default:
+			common.InternalError(w, "Failed to create invite")
+		}
+		return
+	}
+
+	common.Created(w, "Invite created", invite)
+}
+
+// RevokeInvite revokes one of the current user's invite codes
+func (h *Handler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	inviteID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid invite ID")
+		return
+	}
+
+	if err := h.service.RevokeInvite(r.Context(), userID, inviteID); err != nil {
+		if errors.Is(err, ErrInviteNotFound) {
+			common.NotFound(w, "Invite not found")
+			return
+		}
+		common.InternalError(w, "Failed to revoke invite")
+		return
+	}
+
+	common.Success(w, "Invite revoked", nil)
+}
+
+// GetReferrals lists the accounts the current user invited directly
+func (h *Handler) GetReferrals(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	referrals, total, err := h.service.GetReferrals(r.Context(), userID, limit, offset)
+	if err != nil {
+		common.InternalError(w, "Failed to get referrals")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", referrals, &common.Meta{Total: total})
+}
+
+// GetReferralTree returns the current user's referral tree
+func (h *Handler) GetReferralTree(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	h.writeReferralTree(w, r, userID)
+}
+
+// GetReferralStats summarises the current user's invites and referrals
+func (h *Handler) GetReferralStats(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	h.writeReferralStats(w, r, userID)
+}
+
+// ListInvites lists every invite code in the tenant
+func (h *Handler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := InviteFilter{}
+	filter.CreatedBy, _ = strconv.ParseInt(query.Get("created_by"), 10, 64)
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	invites, total, err := h.service.GetInvites(r.Context(), filter, limit, offset)
+	if err != nil {
+		common.InternalError(w, "Failed to get invites")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", invites, &common.Meta{Total: total})
+}
+
+// AdminRevokeInvite revokes any invite code in the tenant
+func (h *Handler) AdminRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	adminID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	inviteID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid invite ID")
+		return
+	}
+
+	if err := h.service.AdminRevokeInvite(r.Context(), adminID, inviteID); err != nil {
+		if errors.Is(err, ErrInviteNotFound) {
+			common.NotFound(w, "Invite not found")
+			return
+		}
+		common.InternalError(w, "Failed to revoke invite")
+		return
+	}
+
+	common.Success(w, "Invite revoked", nil)
+}
+
+// GetUserReferralTree returns any user's referral tree
+func (h *Handler) GetUserReferralTree(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	h.writeReferralTree(w, r, userID)
+}
+
+// GetUserReferralStats summarises any user's invites and referrals
+func (h *Handler) GetUserReferralStats(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	h.writeReferralStats(w, r, userID)
+}
+
+func (h *Handler) writeReferralTree(w http.ResponseWriter, r *http.Request, userID int64) {
+	depth, _ := strconv.Atoi(r.URL.Query().Get("depth"))
+
+	tree, err := h.service.GetReferralTree(r.Context(), userID, depth)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			common.NotFound(w, "User not found")
+			return
+		}
+		common.InternalError(w, "Failed to get referral tree")
+		return
+	}
+
+	common.Success(w, "", tree)
+}
+
+func (h *Handler) writeReferralStats(w http.ResponseWriter, r *http.Request, userID int64) {
+	stats, err := h.service.GetReferralStats(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			common.NotFound(w, "User not found")
+			return
+		}
+		common.InternalError(w, "Failed to get referral stats")
+		return
+	}
+
+	common.Success(w, "", stats)
+}
+
+// writeRoleError maps role management errors to responses, reporting whether it handled err
+func writeRoleError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrRoleNotFound):
+		common.NotFound(w, "Role not found")
+	case errors.Is(err, ErrUserNotFound):
+		common.NotFound(w, "User not found")
+	case errors.Is(err, ErrRoleNotGranted):
+		common.NotFound(w, "User does not have this role")
+	case errors.Is(err, ErrCannotRevokeOwnRole):
+		common.BadRequest(w, "You cannot revoke your own admin role")
+	default:
+		return false
+	}
+	return true
+}
+
+// writePasswordPolicyError responds with the reasons a new password was
+// rejected, reporting whether it handled err
+func writePasswordPolicyError(w http.ResponseWriter, err error) bool {
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	common.JSON(w, http.StatusBadRequest, common.Response{
+		Success: false,
+		Error:   "Password does not meet the requirements",
+		Data:    policyErr.Result,
+	})
+	return true
+}
+
+// writeLockoutError answers a login refused by the throttle, reporting whether it handled err
+func writeLockoutError(w http.ResponseWriter, err error) bool {
+	var lockErr *LockoutError
+	if !errors.As(err, &lockErr) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockErr.RetryAfter.Seconds()))))
+	common.Error(w, http.StatusTooManyRequests, "Too many failed login attempts. Try again later or request an unlock code")
+	return true
+}
+
+// writeOTPError maps one-time code errors to responses, reporting whether it handled err
+func writeOTPError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrInvalidOTP):
+		common.BadRequest(w, "Invalid verification code")
+	case errors.Is(err, ErrOTPExpired):
+		common.BadRequest(w, "Verification code has expired")
+	case errors.Is(err, ErrTooManyAttempts):
+		common.Error(w, http.StatusTooManyRequests, "Too many attempts, please request a new code")
+	default:
+		return false
+	}
+	return true
+}
+
+// writeTwoFactorError maps 2FA errors to responses, reporting whether it handled err
+func writeTwoFactorError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrTwoFactorUnavailable):
+		common.Forbidden(w, "Two-factor authentication is not available")
+	case errors.Is(err, ErrTwoFactorNotFound):
+		common.BadRequest(w, "Start two-factor setup first")
+	case errors.Is(err, ErrTwoFactorAlreadyEnabled):
+		common.Conflict(w, "Two-factor authentication already enabled")
+	case errors.Is(err, ErrTwoFactorNotEnabled):
+		common.BadRequest(w, "Two-factor authentication is not enabled")
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		common.BadRequest(w, "Invalid two-factor code")
+	default:
+		return false
+	}
+	return true
+}
+
+// Helper function to get client IP
+func getClientIP(r *http.Request) string {
+	return common.ClientIP(r)
 }
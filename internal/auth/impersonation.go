@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// StartImpersonation signs an admin in as another user for support. The
+// access token names both users and cannot be refreshed.
+func (s *service) StartImpersonation(ctx context.Context, adminID, targetUserID int64, reason, ipAddress, userAgent string) (*ImpersonationResponse, error) {
+	if adminID == targetUserID {
+		return nil, ErrCannotImpersonateSelf
+	}
+
+	target, err := s.repo.GetUserByID(ctx, targetUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !canLogin(target) {
+		return nil, ErrAccountInactive
+	}
+
+	// Staff accounts are off limits so impersonation cannot widen an admin's access
+	roles, err := s.repo.GetUserRoleNames(ctx, target.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	for _, permission := range []string{PermissionRolesManage, PermissionUsersImpersonate} {
+		privileged, err := s.HasPermission(ctx, roles, permission)
+		if err != nil {
+			return nil, err
+		}
+		if privileged {
+			return nil, ErrCannotImpersonateStaff
+		}
+	}
+
+	sessionID := generateSecureToken(32)
+	session := &ImpersonationSession{
+		AdminID:      adminID,
+		TargetUserID: target.ID,
+		SessionKey:   hashToken(sessionID),
+		Reason:       reason,
+		ExpiresAt:    time.Now().Add(s.config.ImpersonationExpiry),
+	}
+	if ipAddress != "" {
+		session.IPAddress = &ipAddress
+	}
+	if userAgent != "" {
+		session.UserAgent = &userAgent
+	}
+	if err := s.repo.CreateImpersonationSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create impersonation session: %w", err)
+	}
+
+	accessToken, err := s.config.Keys.Sign(jwt.MapClaims{
+		"user_id":          target.ID,
+		"username":         target.Username,
+		"email":            target.Email,
+		"session_id":       sessionID,
+		"roles":            roles,
+		"impersonator_id":  adminID,
+		"impersonation_id": session.ID,
+		"tenant_id":        target.TenantID,
+		"type":             "access",
+		"exp":              session.ExpiresAt.Unix(),
+		"iat":              time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	fmt.Printf("INFO: Impersonation started - AdminID: %d, UserID: %d, ImpersonationID: %d\n", adminID, target.ID, session.ID)
+
+	return &ImpersonationResponse{
+		ImpersonationID: session.ID,
+		User:            target.ToResponse(),
+		AccessToken:     accessToken,
+		ExpiresIn:       int64(s.config.ImpersonationExpiry.Seconds()),
+	}, nil
+}
+
+// ValidateImpersonation reports whether the impersonation session behind a
+// token is still running
+func (s *service) ValidateImpersonation(ctx context.Context, claims *TokenClaims) ([]string, error) {
+	session, err := s.repo.GetImpersonationSessionByKey(ctx, hashToken(claims.SessionID))
+	if err != nil {
+		if errors.Is(err, ErrImpersonationNotFound) {
+			return nil, ErrImpersonationEnded
+		}
+		return nil, err
+	}
+	if session.ID != claims.ImpersonationID || session.AdminID != claims.ImpersonatorID || session.TargetUserID != claims.UserID {
+		return nil, ErrImpersonationEnded
+	}
+	if session.EndedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, ErrImpersonationEnded
+	}
+
+	roles, err := s.repo.GetUserRoleNames(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	return roles, nil
+}
+
+// EndImpersonation ends an impersonation session before it expires
+func (s *service) EndImpersonation(ctx context.Context, impersonationID int64) error {
+	if err := s.repo.EndImpersonationSession(ctx, impersonationID); err != nil {
+		return err
+	}
+	fmt.Printf("INFO: Impersonation ended - ImpersonationID: %d\n", impersonationID)
+	return nil
+}
+
+// RecordImpersonatedRequest adds a request to the impersonation audit log
+func (s *service) RecordImpersonatedRequest(ctx context.Context, entry *ImpersonationAuditEntry) {
+	if err := s.repo.CreateImpersonationAuditEntry(ctx, entry); err != nil {
+		fmt.Printf("ERROR: Failed to audit impersonated request - ImpersonationID: %d, %s %s: %v\n",
+			entry.ImpersonationID, entry.Method, entry.Path, err)
+	}
+}
+
+// GetImpersonationSessions lists impersonation sessions for the audit log
+func (s *service) GetImpersonationSessions(ctx context.Context, filter ImpersonationFilter, limit, offset int) ([]*ImpersonationSession, int64, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.GetImpersonationSessions(ctx, filter, limit, offset)
+}
+
+// GetImpersonationAuditLog lists the requests made in one impersonation session
+func (s *service) GetImpersonationAuditLog(ctx context.Context, impersonationID int64, limit, offset int) ([]*ImpersonationAuditEntry, int64, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.GetImpersonationAuditLog(ctx, impersonationID, limit, offset)
+}
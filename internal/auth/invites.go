@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+// Referral tree limits
+const (
+	defaultReferralTreeDepth = 3
+	maxReferralTreeDepth     = 10
+	maxReferralTreeNodes     = 1000
+)
+
+// inviteCodeAlphabet leaves out characters that are easily misread when a
+// code is typed from a screenshot or read aloud
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteCodeLength = 10
+
+// CreateInvite issues an invite code. Members are held to the configured
+// number of active invites, sign-ups per invite and lifetime; holders of
+// invites:manage are not.
+func (s *service) CreateInvite(ctx context.Context, userID int64, req *CreateInviteRequest) (*Invite, error) {
+	unlimited, err := s.HasPermission(ctx, common.GetRoles(ctx), PermissionInvitesManage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+
+	maxUses := req.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	lifetime := s.config.InviteExpiry
+	if req.ExpiresInDays > 0 {
+		lifetime = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	if !unlimited {
+		if maxUses > s.config.MaxInviteUses || lifetime > s.config.InviteExpiry {
+			return nil, ErrInviteTooGenerous
+		}
+
+		count, err := s.repo.CountActiveInvites(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count invites: %w", err)
+		}
+		if count >= s.config.MaxActiveInvites {
+			return nil, ErrInviteLimitReached
+		}
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite code: %w", err)
+	}
+
+	invite := &Invite{
+		Code:      code,
+		CreatedBy: userID,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	if err := s.repo.CreateInvite(ctx, invite); err != nil {
+		return nil, fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	fmt.Printf("INFO: Invite created - InviteID: %d, UserID: %d, MaxUses: %d\n", invite.ID, userID, maxUses)
+	return invite, nil
+}
+
+// GetUserInvites lists the user's unrevoked invites
+func (s *service) GetUserInvites(ctx context.Context, userID int64) ([]*Invite, error) {
+	return s.repo.GetUserInvites(ctx, userID)
+}
+
+// RevokeInvite revokes one of the user's invites
+func (s *service) RevokeInvite(ctx context.Context, userID, inviteID int64) error {
+	ok, err := s.repo.RevokeInvite(ctx, inviteID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// ValidateInvite checks that an invite code can be used to register
+func (s *service) ValidateInvite(ctx context.Context, code string) (*InvitePreview, error) {
+	invite, err := s.repo.GetInviteByCode(ctx, normalizeInviteCode(code))
+	if errors.Is(err, ErrInviteNotFound) {
+		return nil, ErrInvalidInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !invite.Usable() {
+		return nil, ErrInvalidInvite
+	}
+
+	return &InvitePreview{
+		Code:      invite.Code,
+		InvitedBy: invite.InviterUsername,
+		ExpiresAt: invite.ExpiresAt,
+	}, nil
+}
+
+// GetInvites lists every invite in the tenant for administrators
+func (s *service) GetInvites(ctx context.Context, filter InviteFilter, limit, offset int) ([]*Invite, int64, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return s.repo.GetInvites(ctx, filter, limit, offset)
+}
+
+// AdminRevokeInvite revokes any invite in the tenant
+func (s *service) AdminRevokeInvite(ctx context.Context, adminID, inviteID int64) error {
+	ok, err := s.repo.RevokeInvite(ctx, inviteID, 0)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInviteNotFound
+	}
+
+	fmt.Printf("INFO: Invite revoked by admin - InviteID: %d, AdminID: %d\n", inviteID, adminID)
+	return nil
+}
+
+// GetReferrals lists the accounts the user invited directly
+func (s *service) GetReferrals(ctx context.Context, userID int64, limit, offset int) ([]*ReferredUser, int64, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return s.repo.GetReferrals(ctx, userID, limit, offset)
+}
+
+// GetReferralTree returns the accounts the user invited, each with the
+// accounts it invited in turn, down to depth levels
+func (s *service) GetReferralTree(ctx context.Context, userID int64, depth int) ([]*ReferredUser, error) {
+	if depth <= 0 {
+		depth = defaultReferralTreeDepth
+	}
+	if depth > maxReferralTreeDepth {
+		depth = maxReferralTreeDepth
+	}
+
+	if _, err := s.repo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.repo.GetReferralTree(ctx, userID, depth, maxReferralTreeNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows are ordered by depth, so every inviter is placed before its invitees
+	roots := []*ReferredUser{}
+	nodes := make(map[int64]*ReferredUser, len(rows))
+	for _, row := range rows {
+		nodes[row.ID] = row
+		if row.InviterID == userID {
+			roots = append(roots, row)
+		} else if parent, ok := nodes[row.InviterID]; ok {
+			parent.Referrals = append(parent.Referrals, row)
+		}
+	}
+	return roots, nil
+}
+
+// GetReferralStats summarises the user's invites and referral tree
+func (s *service) GetReferralStats(ctx context.Context, userID int64) (*ReferralStats, error) {
+	if _, err := s.repo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetReferralStats(ctx, userID)
+}
+
+// generateInviteCode returns a random code from inviteCodeAlphabet
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		// 256 is a multiple of the alphabet's 32 characters, so this is unbiased
+		b[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// normalizeInviteCode strips formatting so codes match regardless of case,
+// spaces or dashes
+func normalizeInviteCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+func inviteOnly(c *Config) {
+	c.InviteOnly = true
+	c.MaxActiveInvites = 2
+	c.MaxInviteUses = 5
+	c.InviteExpiry = 7 * 24 * time.Hour
+}
+
+// createTestInviter makes an account directly in the repository, since
+// invite-only registration needs an existing member
+func createTestInviter(t *testing.T, repo *memoryRepository) *User {
+	t.Helper()
+
+	inviter := &User{Email: "ada@example.com", Username: "ada"}
+	if err := repo.CreateUser(testContext(), inviter); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return inviter
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	svc, repo, mailer := newTestService(t, inviteOnly)
+	ctx := testContext()
+	inviter := createTestInviter(t, repo)
+
+	_, err := svc.Register(ctx, &RegisterRequest{Email: "grace@example.com", Username: "grace", Password: testPassword})
+	if !errors.Is(err, ErrInviteRequired) {
+		t.Fatalf("Register() without a code error = %v, want %v", err, ErrInviteRequired)
+	}
+	_, err = svc.Register(ctx, &RegisterRequest{Email: "grace@example.com", Username: "grace", Password: testPassword, InviteCode: "NOTACODE23"})
+	if !errors.Is(err, ErrInvalidInvite) {
+		t.Fatalf("Register() with an unknown code error = %v, want %v", err, ErrInvalidInvite)
+	}
+	if outbox := mailer.Outbox(); len(outbox) != 0 {
+		t.Fatalf("sent %d emails for refused registrations, want 0", len(outbox))
+	}
+
+	invite, err := svc.CreateInvite(ctx, inviter.ID, &CreateInviteRequest{})
+	if err != nil {
+		t.Fatalf("CreateInvite() error = %v", err)
+	}
+	if invite.MaxUses != 1 {
+		t.Errorf("MaxUses = %d, want a single-use code by default", invite.MaxUses)
+	}
+
+	// Codes are accepted however they are typed
+	typed := invite.Code[:5] + "-" + invite.Code[5:]
+	preview, err := svc.ValidateInvite(ctx, typed)
+	if err != nil {
+		t.Fatalf("ValidateInvite() error = %v", err)
+	}
+	if preview.InvitedBy != "ada" {
+		t.Errorf("InvitedBy = %q, want ada", preview.InvitedBy)
+	}
+
+	user, err := svc.Register(ctx, &RegisterRequest{Email: "grace@example.com", Username: "grace", Password: testPassword, InviteCode: typed})
+	if err != nil {
+		t.Fatalf("Register() with an invite error = %v", err)
+	}
+	if repo.invitedBy[user.ID] != inviter.ID {
+		t.Errorf("referral recorded inviter %d, want %d", repo.invitedBy[user.ID], inviter.ID)
+	}
+	if msg := mailer.LastTo("grace@example.com"); msg == nil || msg.Subject != "Verify your email address" {
+		t.Errorf("no verification email sent to the invited user, outbox = %v", mailer.Outbox())
+	}
+
+	// The single use is spent
+	_, err = svc.Register(ctx, &RegisterRequest{Email: "alan@example.com", Username: "alan", Password: testPassword, InviteCode: invite.Code})
+	if !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Register() with a used code error = %v, want %v", err, ErrInvalidInvite)
+	}
+	if _, err := svc.ValidateInvite(ctx, invite.Code); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("ValidateInvite() with a used code error = %v, want %v", err, ErrInvalidInvite)
+	}
+}
+
+func TestCreateInviteLimits(t *testing.T) {
+	svc, repo, _ := newTestService(t, inviteOnly)
+	ctx := testContext()
+	inviter := createTestInviter(t, repo)
+
+	if _, err := svc.CreateInvite(ctx, inviter.ID, &CreateInviteRequest{MaxUses: 6}); !errors.Is(err, ErrInviteTooGenerous) {
+		t.Errorf("CreateInvite() over MaxInviteUses error = %v, want %v", err, ErrInviteTooGenerous)
+	}
+	if _, err := svc.CreateInvite(ctx, inviter.ID, &CreateInviteRequest{ExpiresInDays: 8}); !errors.Is(err, ErrInviteTooGenerous) {
+		t.Errorf("CreateInvite() over InviteExpiry error = %v, want %v", err, ErrInviteTooGenerous)
+	}
+
+	for i := 0; i < svc.config.MaxActiveInvites; i++ {
+		if _, err := svc.CreateInvite(ctx, inviter.ID, &CreateInviteRequest{MaxUses: 5}); err != nil {
+			t.Fatalf("CreateInvite() %d error = %v", i+1, err)
+		}
+	}
+	if _, err := svc.CreateInvite(ctx, inviter.ID, &CreateInviteRequest{}); !errors.Is(err, ErrInviteLimitReached) {
+		t.Errorf("CreateInvite() over MaxActiveInvites error = %v, want %v", err, ErrInviteLimitReached)
+	}
+
+	// Admins are not held to the member limits
+	adminCtx := context.WithValue(ctx, common.RolesKey, []string{"admin"})
+	invite, err := svc.CreateInvite(adminCtx, inviter.ID, &CreateInviteRequest{MaxUses: 100, ExpiresInDays: 30})
+	if err != nil {
+		t.Fatalf("CreateInvite() as admin error = %v", err)
+	}
+	if invite.MaxUses != 100 {
+		t.Errorf("MaxUses = %d, want 100", invite.MaxUses)
+	}
+}
+
+func TestMultiUseInvite(t *testing.T) {
+	svc, repo, _ := newTestService(t, inviteOnly)
+	ctx := testContext()
+	inviter := createTestInviter(t, repo)
+
+	invite, err := svc.CreateInvite(ctx, inviter.ID, &CreateInviteRequest{MaxUses: 2})
+	if err != nil {
+		t.Fatalf("CreateInvite() error = %v", err)
+	}
+
+	for _, name := range []string{"grace", "alan"} {
+		req := &RegisterRequest{Email: name + "@example.com", Username: name, Password: testPassword, InviteCode: invite.Code}
+		if _, err := svc.Register(ctx, req); err != nil {
+			t.Fatalf("Register(%s) error = %v", name, err)
+		}
+	}
+	req := &RegisterRequest{Email: "edsger@example.com", Username: "edsger", Password: testPassword, InviteCode: invite.Code}
+	if _, err := svc.Register(ctx, req); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Register() past MaxUses error = %v, want %v", err, ErrInvalidInvite)
+	}
+}
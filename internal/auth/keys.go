@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported token signing methods
+const (
+	SigningMethodHS256 = "HS256" // Legacy shared-secret mode
+	SigningMethodRS256 = "RS256"
+	SigningMethodEdDSA = "EdDSA"
+)
+
+// KeyConfig describes where token signing keys come from
+type KeyConfig struct {
+	SigningMethod        string
+	Secret               string   // HS256 only
+	SigningKeyFile       string   // PEM private key used to sign new tokens
+	VerificationKeyFiles []string // Extra PEM public keys still accepted during rotation
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type verificationKey struct {
+	kid    string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	jwk    JWK
+}
+
+// KeySet signs tokens with one key and verifies them against every active key
+type KeySet struct {
+	method     jwt.SigningMethod
+	secret     []byte
+	signingKID string
+	signingKey crypto.PrivateKey
+	verifyKeys map[string]*verificationKey
+	order      []string
+}
+
+// NewHMACKeySet creates a legacy HS256 key set from a shared secret
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		method:     jwt.SigningMethodHS256,
+		secret:     []byte(secret),
+		verifyKeys: make(map[string]*verificationKey),
+	}
+}
+
+// LoadKeySet builds a key set from configuration, reading PEM files from disk
+func LoadKeySet(cfg *KeyConfig) (*KeySet, error) {
+	method := cfg.SigningMethod
+	if method == "" {
+		method = SigningMethodHS256
+	}
+
+	switch method {
+	case SigningMethodHS256:
+		if cfg.Secret == "" {
+			return nil, errors.New("HS256 signing requires a JWT secret")
+		}
+		return NewHMACKeySet(cfg.Secret), nil
+	case SigningMethodRS256, SigningMethodEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing method: %s", method)
+	}
+
+	if cfg.SigningKeyFile == "" {
+		return nil, fmt.Errorf("%s signing requires a signing key file", method)
+	}
+
+	ks := &KeySet{
+		method:     jwt.GetSigningMethod(method),
+		verifyKeys: make(map[string]*verificationKey),
+	}
+
+	privateKey, err := readPrivateKey(cfg.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var public crypto.PublicKey
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if method != SigningMethodRS256 {
+			return nil, fmt.Errorf("signing key %s is an RSA key but method is %s", cfg.SigningKeyFile, method)
+		}
+		public = &key.PublicKey
+	case ed25519.PrivateKey:
+		if method != SigningMethodEdDSA {
+			return nil, fmt.Errorf("signing key %s is an Ed25519 key but method is %s", cfg.SigningKeyFile, method)
+		}
+		public = key.Public()
+	default:
+		return nil, fmt.Errorf("unsupported signing key type in %s", cfg.SigningKeyFile)
+	}
+
+	signing, err := ks.addVerificationKey(public)
+	if err != nil {
+		return nil, err
+	}
+	ks.signingKey = privateKey
+	ks.signingKID = signing.kid
+
+	for _, path := range cfg.VerificationKeyFiles {
+		public, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ks.addVerificationKey(public); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return ks, nil
+}
+
+// Sign signs claims with the current signing key, setting the kid header
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.secret != nil {
+		return token.SignedString(k.secret)
+	}
+	token.Header["kid"] = k.signingKID
+	return token.SignedString(k.signingKey)
+}
+
+// Parse verifies a token against the active keys
+func (k *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	if k.secret != nil {
+		return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			return k.secret, nil
+		}, jwt.WithValidMethods([]string{SigningMethodHS256}))
+	}
+
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.public, nil
+	}, jwt.WithValidMethods([]string{SigningMethodRS256, SigningMethodEdDSA}))
+}
+
+// JWKS returns the public verification keys; it is empty in HS256 mode
+func (k *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: make([]JWK, 0, len(k.order))}
+	for _, kid := range k.order {
+		jwks.Keys = append(jwks.Keys, k.verifyKeys[kid].jwk)
+	}
+	return jwks
+}
+
+func (k *KeySet) addVerificationKey(public crypto.PublicKey) (*verificationKey, error) {
+	key := &verificationKey{public: public}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+		key.jwk = JWK{
+			Kty: "RSA",
+			Alg: SigningMethodRS256,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.jwk = JWK{
+			Kty: "OKP",
+			Alg: SigningMethodEdDSA,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	default:
+		return nil, errors.New("unsupported public key type")
+	}
+
+	key.kid = jwkThumbprint(&key.jwk)
+	key.jwk.Kid = key.kid
+	key.jwk.Use = "sig"
+
+	if _, exists := k.verifyKeys[key.kid]; !exists {
+		k.verifyKeys[key.kid] = key
+		k.order = append(k.order, key.kid)
+	}
+	return key, nil
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint used as the key ID
+func jwkThumbprint(jwk *JWK) string {
+	var members interface{}
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func readPEMBlock(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (crypto.PrivateKey, error) {
+	block, err := readPEMBlock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+}
+
+// readPublicKey reads a public key, also accepting a private key file
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEMBlock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case block.Type == "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case block.Type == "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+		key, err := readPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer.Public(), nil
+		}
+		return nil, fmt.Errorf("unsupported private key in %s", path)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+)
+
+// loginBackoffBase is the delay after the second consecutive failure; it doubles with each further failure
+const loginBackoffBase = time.Second
+
+// Login history failure reasons
+const (
+	loginFailureInvalidCredentials = "invalid_credentials"
+	loginFailureLocked             = "locked"
+	loginFailureInactive           = "inactive"
+	loginFailureResetRequired      = "password_reset_required"
+)
+
+// LockoutError reports that logins are blocked and when to retry.
+// It matches ErrAccountLocked with errors.Is.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrAccountLocked, e.RetryAfter.Round(time.Second))
+}
+
+// Is lets errors.Is match ErrAccountLocked
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+func userThrottleKey(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// identifierThrottleKey keys unknown identifiers per tenant, since the same
+// email may be registered in several tenants
+func identifierThrottleKey(tenantID int64, identifier string) string {
+	return fmt.Sprintf("identifier:%d:%s", tenantID, strings.ToLower(strings.TrimSpace(identifier)))
+}
+
+func ipThrottleKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+// checkLoginThrottle returns a LockoutError while key is locked or backing off
+func (s *service) checkLoginThrottle(ctx context.Context, key string) error {
+	throttle, err := s.repo.GetLoginThrottle(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrLoginThrottleNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to check login throttle: %w", err)
+	}
+
+	if throttle.LockedUntil != nil && time.Now().Before(*throttle.LockedUntil) {
+		return &LockoutError{RetryAfter: time.Until(*throttle.LockedUntil)}
+	}
+	return nil
+}
+
+// registerLoginFailure counts a failed attempt against key. With backoff set,
+// each failure below the limit delays the next attempt exponentially; reaching
+// maxAttempts locks the key for the lockout duration. It returns the resulting
+// lock, if any.
+func (s *service) registerLoginFailure(ctx context.Context, key string, maxAttempts int, backoff bool) *LockoutError {
+	throttle, err := s.repo.RecordLoginFailure(ctx, key, time.Now().Add(-s.config.LoginLockoutDuration))
+	if err != nil {
+		fmt.Printf("ERROR: Failed to record login failure for %s: %v\n", key, err)
+		return nil
+	}
+
+	var delay time.Duration
+	switch {
+	case throttle.FailedCount >= maxAttempts:
+		delay = s.config.LoginLockoutDuration
+	case backoff && throttle.FailedCount > 1:
+		delay = loginBackoffBase << uint(throttle.FailedCount-2)
+		if delay > s.config.LoginLockoutDuration {
+			delay = s.config.LoginLockoutDuration
+		}
+	default:
+		return nil
+	}
+
+	if err := s.repo.LockLoginThrottle(ctx, key, time.Now().Add(delay)); err != nil {
+		fmt.Printf("ERROR: Failed to lock %s: %v\n", key, err)
+		return nil
+	}
+	if throttle.FailedCount >= maxAttempts {
+		fmt.Printf("WARNING: Login locked for %s after %d failed attempts\n", key, throttle.FailedCount)
+	}
+	return &LockoutError{RetryAfter: delay}
+}
+
+// recordLoginAttempt writes a login history entry; reason is empty on success
+func (s *service) recordLoginAttempt(ctx context.Context, userID *int64, identifier, ipAddress, userAgent, reason string) {
+	attempt := &LoginAttempt{
+		UserID:     userID,
+		Identifier: identifier,
+		IPAddress:  &ipAddress,
+		UserAgent:  &userAgent,
+		Success:    reason == "",
+	}
+	if reason != "" {
+		attempt.FailureReason = &reason
+	}
+
+	if err := s.repo.RecordLoginAttempt(ctx, attempt); err != nil {
+		fmt.Printf("ERROR: Failed to record login attempt: %v\n", err)
+	}
+}
+
+// RequestAccountUnlock emails an unlock code if the address belongs to an account.
+// It never reports whether the email is registered.
+func (s *service) RequestAccountUnlock(ctx context.Context, emailAddr string) error {
+	user, err := s.repo.GetUserByEmail(ctx, emailAddr)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	otp, err := s.issueOTP(ctx, &user.ID, user.Email, "email", OTPPurposeAccountUnlock)
+	if err != nil {
+		if errors.Is(err, ErrOTPRateLimited) {
+			return nil
+		}
+		return err
+	}
+
+	return s.mailer.Send(ctx, &email.Message{
+		To:      user.Email,
+		Subject: "Unlock your account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account unlock code is: %s\n\nThis code expires in %d minutes. "+
+			"If you did not try to sign in recently, consider changing your password.\n",
+			user.Username, otp.Code, int(s.config.OTPExpiry.Minutes())),
+	})
+}
+
+// UnlockAccount checks an unlock code and clears the account's login lock
+func (s *service) UnlockAccount(ctx context.Context, emailAddr, code string) error {
+	user, err := s.repo.GetUserByEmail(ctx, emailAddr)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidOTP
+		}
+		return err
+	}
+
+	if _, err := s.verifyOTP(ctx, user.Email, "email", OTPPurposeAccountUnlock, code); err != nil {
+		return err
+	}
+
+	return s.repo.ClearLoginThrottle(ctx, userThrottleKey(user.ID))
+}
+
+// GetLoginHistory lists a user's recent login attempts
+func (s *service) GetLoginHistory(ctx context.Context, userID int64, limit, offset int) ([]*LoginAttempt, int64, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.GetLoginHistory(ctx, userID, limit, offset)
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+)
+
+// magicLinkTokenType is the "type" claim of login link tokens
+const magicLinkTokenType = "magic_link"
+
+// RequestMagicLink emails a single-use login link if the address belongs to an account.
+// It never reports whether the email is registered.
+func (s *service) RequestMagicLink(ctx context.Context, emailAddr string) error {
+	user, err := s.repo.GetUserByEmail(ctx, emailAddr)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !canLogin(user) {
+		return nil
+	}
+
+	recent, err := s.repo.CountRecentUserOTPs(ctx, user.ID, OTPPurposeMagicLink, time.Now().Add(-otpRateLimitWindow))
+	if err != nil {
+		return fmt.Errorf("failed to check link rate limit: %w", err)
+	}
+	if recent >= otpRateLimitMax {
+		return nil
+	}
+
+	// The signed token carries a random ID; only its hash is stored for single use
+	jti := generateSecureToken(32)
+	expiresAt := time.Now().Add(s.config.MagicLinkExpiry)
+
+	token, err := s.config.Keys.Sign(jwt.MapClaims{
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"jti":       jti,
+		"type":      magicLinkTokenType,
+		"exp":       expiresAt.Unix(),
+		"iat":       time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign login link: %w", err)
+	}
+
+	if err := s.repo.CreateOTP(ctx, &OTP{
+		UserID:         &user.ID,
+		Identifier:     hashToken(jti),
+		IdentifierType: "link",
+		Code:           "-",
+		Purpose:        OTPPurposeMagicLink,
+		MaxAttempts:    1,
+		ExpiresAt:      expiresAt,
+	}); err != nil {
+		return fmt.Errorf("failed to store login link: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/auth/magic-link?token=%s", strings.TrimRight(s.config.FrontendURL, "/"), url.QueryEscape(token))
+
+	return s.mailer.Send(ctx, &email.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to sign in:\n\n%s\n\nThe link works once and expires in %d minutes. "+
+			"If you did not ask to sign in, you can ignore this email.\n",
+			user.Username, link, int(s.config.MagicLinkExpiry.Minutes())),
+	})
+}
+
+// LoginWithMagicLink consumes a login link and signs the user in like Login
+func (s *service) LoginWithMagicLink(ctx context.Context, req *MagicLinkLoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	token, err := s.config.Keys.Parse(req.Token)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidMagicLink
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidMagicLink
+	}
+	tokenType, _ := claims["type"].(string)
+	jti, _ := claims["jti"].(string)
+	userIDClaim, _ := claims["user_id"].(float64)
+	if tokenType != magicLinkTokenType || jti == "" {
+		return nil, ErrInvalidMagicLink
+	}
+	if ctx, err = scopeToLinkTenant(ctx, claims); err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	link, err := s.repo.GetLatestOTP(ctx, hashToken(jti), "link", OTPPurposeMagicLink)
+	if err != nil {
+		if errors.Is(err, ErrOTPNotFound) {
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+	if link.UserID == nil || *link.UserID != int64(userIDClaim) || time.Now().After(link.ExpiresAt) {
+		return nil, ErrInvalidMagicLink
+	}
+
+	consumed, err := s.repo.ConsumeOTP(ctx, link.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidMagicLink
+	}
+
+	user, err := s.repo.GetUserByID(ctx, *link.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !canLogin(user) {
+		s.recordLoginAttempt(ctx, &user.ID, user.Email, ipAddress, userAgent, loginFailureInactive)
+		return nil, ErrAccountInactive
+	}
+
+	// Following the link proves control of the address
+	if !user.EmailVerified {
+		if err := s.repo.UpdateVerificationStatus(ctx, user.ID, "email", true); err != nil {
+			return nil, fmt.Errorf("failed to verify email: %w", err)
+		}
+		user.EmailVerified = true
+	}
+
+	s.recordLoginAttempt(ctx, &user.ID, user.Email, ipAddress, userAgent, "")
+
+	return s.completeLogin(ctx, user, req.DeviceInfo, ipAddress, userAgent)
+}
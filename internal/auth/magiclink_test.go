@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+)
+
+var linkTokenPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+// mailedLinkToken returns the token of the link in the latest message sent to an address
+func mailedLinkToken(t *testing.T, mailer *email.MockSender, to string) string {
+	t.Helper()
+
+	msg := mailer.LastTo(to)
+	if msg == nil {
+		t.Fatalf("no email sent to %s", to)
+	}
+	match := linkTokenPattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no link in email to %s: %q", to, msg.Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("unreadable link token %q: %v", match[1], err)
+	}
+	return token
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+	mailer.Reset()
+
+	if err := svc.RequestMagicLink(ctx, user.Email); err != nil {
+		t.Fatalf("RequestMagicLink() error = %v", err)
+	}
+	msg := mailer.LastTo(user.Email)
+	if msg == nil || msg.Subject != "Your sign-in link" {
+		t.Fatalf("sign-in link not sent, outbox = %v", mailer.Outbox())
+	}
+	if !strings.Contains(msg.Body, "https://kiekky.test/auth/magic-link?token=") {
+		t.Errorf("link does not point at the frontend: %q", msg.Body)
+	}
+
+	req := &MagicLinkLoginRequest{Token: mailedLinkToken(t, mailer, user.Email), DeviceInfo: "Ada's laptop"}
+	resp, err := svc.LoginWithMagicLink(ctx, req, "203.0.113.7", "test-agent")
+	if err != nil {
+		t.Fatalf("LoginWithMagicLink() error = %v", err)
+	}
+	if resp.AccessToken == "" || resp.RefreshToken == "" {
+		t.Error("no tokens issued")
+	}
+
+	sessions, _ := repo.GetUserSessions(ctx, user.ID)
+	if len(sessions) != 1 {
+		t.Fatalf("%d sessions created, want 1", len(sessions))
+	}
+	session := sessions[0]
+	if *session.DeviceInfo != "Ada's laptop" || *session.IPAddress != "203.0.113.7" || *session.UserAgent != "test-agent" {
+		t.Errorf("session recorded device %q, IP %q, user agent %q", *session.DeviceInfo, *session.IPAddress, *session.UserAgent)
+	}
+
+	// Following the link proves the address
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if !stored.EmailVerified {
+		t.Error("email not marked verified")
+	}
+}
+
+func TestMagicLinkSingleUse(t *testing.T) {
+	svc, _, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+
+	if err := svc.RequestMagicLink(ctx, user.Email); err != nil {
+		t.Fatalf("RequestMagicLink() error = %v", err)
+	}
+	req := &MagicLinkLoginRequest{Token: mailedLinkToken(t, mailer, user.Email)}
+
+	if _, err := svc.LoginWithMagicLink(ctx, req, "203.0.113.7", "test-agent"); err != nil {
+		t.Fatalf("first LoginWithMagicLink() error = %v", err)
+	}
+	if _, err := svc.LoginWithMagicLink(ctx, req, "203.0.113.7", "test-agent"); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Errorf("second LoginWithMagicLink() error = %v, want %v", err, ErrInvalidMagicLink)
+	}
+}
+
+func TestMagicLinkExpired(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+
+	if err := svc.RequestMagicLink(ctx, user.Email); err != nil {
+		t.Fatalf("RequestMagicLink() error = %v", err)
+	}
+	req := &MagicLinkLoginRequest{Token: mailedLinkToken(t, mailer, user.Email)}
+
+	repo.mu.Lock()
+	for _, otp := range repo.otps {
+		if otp.Purpose == OTPPurposeMagicLink {
+			otp.ExpiresAt = time.Now().Add(-time.Second)
+		}
+	}
+	repo.mu.Unlock()
+
+	if _, err := svc.LoginWithMagicLink(ctx, req, "203.0.113.7", "test-agent"); !errors.Is(err, ErrInvalidMagicLink) {
+		t.Errorf("LoginWithMagicLink() error = %v, want %v", err, ErrInvalidMagicLink)
+	}
+}
+
+func TestMagicLinkUnknownEmail(t *testing.T) {
+	svc, _, mailer := newTestService(t, nil)
+
+	if err := svc.RequestMagicLink(testContext(), "nobody@example.com"); err != nil {
+		t.Fatalf("RequestMagicLink() error = %v", err)
+	}
+	if outbox := mailer.Outbox(); len(outbox) != 0 {
+		t.Errorf("sent %d emails for an unknown address, want 0", len(outbox))
+	}
+}
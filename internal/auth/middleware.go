@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
 
@@ -37,6 +40,23 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 
 		token := parts[1]
 
+		// Personal access tokens are limited by scopes instead of tied to a session
+		if IsPersonalAccessToken(token) {
+			claims, err := m.service.ValidatePersonalAccessToken(r.Context(), token)
+			if err != nil {
+				common.Unauthorized(w, "Invalid, expired or revoked token")
+				return
+			}
+			ctx, err := common.ScopeToTokenTenant(r.Context(), claims.TenantID)
+			if err != nil {
+				common.Unauthorized(w, "Token is not valid for this tenant")
+				return
+			}
+			ctx = m.recheckContext(ctx, token, claims)
+			next.ServeHTTP(w, r.WithContext(claimsContext(ctx, claims)))
+			return
+		}
+
 		// Validate token
 		claims, err := m.service.ValidateAccessToken(token)
 		if err != nil {
@@ -44,17 +64,129 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		// Set user context
-		ctx := context.WithValue(r.Context(), common.UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, common.UsernameKey, claims.Username)
-		ctx = context.WithValue(ctx, common.EmailKey, claims.Email)
-		ctx = context.WithValue(ctx, common.SessionIDKey, claims.SessionID)
+		// Tokens issued before tenants existed carry no tenant and must be refreshed
+		ctx, err := common.ScopeToTokenTenant(r.Context(), claims.TenantID)
+		if err != nil {
+			common.Unauthorized(w, "Token is not valid for this tenant")
+			return
+		}
+
+		// Reject tokens whose session was logged out or revoked
+		if err := m.validateSession(ctx, claims); err != nil {
+			if errors.Is(err, ErrSessionRevoked) || errors.Is(err, ErrImpersonationEnded) {
+				common.Unauthorized(w, "Session has expired or been revoked")
+				return
+			}
+			common.InternalError(w, "Failed to validate session")
+			return
+		}
 
 		// Continue with enriched context
-		next.ServeHTTP(w, r.WithContext(ctx))
+		ctx = m.recheckContext(ctx, token, claims)
+		m.serve(next, w, r.WithContext(claimsContext(ctx, claims)), claims)
 	})
 }
 
+// recheckContext lets handlers whose connection outlives the request check
+// later that the personal access token or session is still valid
+func (m *Middleware) recheckContext(ctx context.Context, token string, claims *TokenClaims) context.Context {
+	var check common.AuthCheck = func(ctx context.Context) error {
+		if claims.TokenID != 0 {
+			_, err := m.service.ValidatePersonalAccessToken(ctx, token)
+			return err
+		}
+		current := *claims
+		return m.validateSession(ctx, &current)
+	}
+	return context.WithValue(ctx, common.AuthCheckKey, check)
+}
+
+// validateSession checks the session or impersonation session behind an
+// access token and replaces the token's roles with the user's current ones
+func (m *Middleware) validateSession(ctx context.Context, claims *TokenClaims) error {
+	var roles []string
+	var err error
+	if claims.ImpersonatorID != 0 {
+		roles, err = m.service.ValidateImpersonation(ctx, claims)
+	} else {
+		roles, err = m.service.ValidateSession(ctx, claims.UserID, claims.SessionID)
+	}
+	if err != nil {
+		return err
+	}
+	claims.Roles = roles
+	return nil
+}
+
+// serve runs the handler, recording it in the audit log when an admin is
+// impersonating the user
+func (m *Middleware) serve(next http.Handler, w http.ResponseWriter, r *http.Request, claims *TokenClaims) {
+	if claims.ImpersonatorID == 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(recorder, r)
+
+	entry := &ImpersonationAuditEntry{
+		ImpersonationID: claims.ImpersonationID,
+		AdminID:         claims.ImpersonatorID,
+		TargetUserID:    claims.UserID,
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		StatusCode:      recorder.status,
+	}
+	if ip := getClientIP(r); ip != "" {
+		entry.IPAddress = &ip
+	}
+	m.service.RecordImpersonatedRequest(context.WithoutCancel(r.Context()), entry)
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets websocket upgrades through the recorder
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// claimsContext stores the authenticated user in the request context
+func claimsContext(ctx context.Context, claims *TokenClaims) context.Context {
+	ctx = context.WithValue(ctx, common.UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, common.UsernameKey, claims.Username)
+	ctx = context.WithValue(ctx, common.EmailKey, claims.Email)
+	if claims.TokenID != 0 {
+		ctx = context.WithValue(ctx, common.TokenIDKey, claims.TokenID)
+		ctx = context.WithValue(ctx, common.ScopesKey, claims.Scopes)
+		return ctx
+	}
+	ctx = context.WithValue(ctx, common.SessionIDKey, claims.SessionID)
+	ctx = context.WithValue(ctx, common.RolesKey, claims.Roles)
+	if claims.ImpersonatorID != 0 {
+		ctx = context.WithValue(ctx, common.ImpersonatorIDKey, claims.ImpersonatorID)
+		ctx = context.WithValue(ctx, common.ImpersonationIDKey, claims.ImpersonationID)
+	}
+	return ctx
+}
+
 // AuthenticateFunc is a function version of Authenticate middleware
 func (m *Middleware) AuthenticateFunc(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -78,18 +210,85 @@ func (m *Middleware) OptionalAuth(next http.Handler) http.Handler {
 		}
 
 		token := parts[1]
+		if IsPersonalAccessToken(token) {
+			claims, err := m.service.ValidatePersonalAccessToken(r.Context(), token)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, err := common.ScopeToTokenTenant(r.Context(), claims.TenantID)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(claimsContext(ctx, claims)))
+			return
+		}
+
 		claims, err := m.service.ValidateAccessToken(token)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
+		ctx, err := common.ScopeToTokenTenant(r.Context(), claims.TenantID)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := m.validateSession(ctx, claims); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
 
 		// Set user context if valid
-		ctx := context.WithValue(r.Context(), common.UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, common.UsernameKey, claims.Username)
-		ctx = context.WithValue(ctx, common.EmailKey, claims.Email)
-		ctx = context.WithValue(ctx, common.SessionIDKey, claims.SessionID)
+		m.serve(next, w, r.WithContext(claimsContext(ctx, claims)), claims)
+	})
+}
+
+// RequireRole allows the request only if the user has one of the given roles.
+// It must run after Authenticate.
+func (m *Middleware) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, role := range roles {
+				if common.HasRole(r.Context(), role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			common.Forbidden(w, "Insufficient role")
+		})
+	}
+}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+// RequirePermission allows the request only if one of the user's roles grants
+// the permission. It must run after Authenticate.
+func (m *Middleware) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := m.service.HasPermission(r.Context(), common.GetRoles(r.Context()), permission)
+			if err != nil {
+				common.InternalError(w, "Failed to check permissions")
+				return
+			}
+			if !allowed {
+				common.Forbidden(w, "Insufficient permissions")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects requests made with a personal access token, for
+// account and security endpoints that need an interactive login.
+// It must run after Authenticate.
+func (m *Middleware) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := common.GetTokenID(r.Context()); ok {
+			common.Forbidden(w, "Personal access tokens cannot be used for this endpoint")
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
 }
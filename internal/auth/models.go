@@ -2,28 +2,42 @@ package auth
 
 import (
 	"time"
+
+	"github.com/tommygebru/kiekky-backend/pkg/useragent"
+	"github.com/tommygebru/kiekky-backend/pkg/webauthn"
 )
 
 // User represents a user in the system
 type User struct {
-	ID              int64     `json:"id" db:"id"`
-	Email           string    `json:"email" db:"email"`
-	Username        string    `json:"username" db:"username"`
-	PasswordHash    string    `json:"-" db:"password_hash"`
-	Phone           *string   `json:"phone,omitempty" db:"phone"`
-	IsVerified      bool      `json:"is_verified" db:"is_verified"`
-	EmailVerified   bool      `json:"email_verified" db:"email_verified"`
-	PhoneVerified   bool      `json:"phone_verified" db:"phone_verified"`
-	DisplayName     *string   `json:"display_name,omitempty" db:"display_name"`
-	ProfilePicture  *string   `json:"profile_picture,omitempty" db:"profile_picture"`
-	Bio             *string   `json:"bio,omitempty" db:"bio"`
-	AccountStatus   string    `json:"account_status" db:"account_status"`
-	IsOnline        bool      `json:"is_online" db:"is_online"`
-	LastSeen        time.Time `json:"last_seen" db:"last_seen"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	ID             int64     `json:"id" db:"id"`
+	TenantID       int64     `json:"-" db:"tenant_id"`
+	Email          string    `json:"email" db:"email"`
+	Username       string    `json:"username" db:"username"`
+	PasswordHash   string    `json:"-" db:"password_hash"`
+	Phone          *string   `json:"phone,omitempty" db:"phone"`
+	IsVerified     bool      `json:"is_verified" db:"is_verified"`
+	EmailVerified  bool      `json:"email_verified" db:"email_verified"`
+	PhoneVerified  bool      `json:"phone_verified" db:"phone_verified"`
+	DisplayName    *string   `json:"display_name,omitempty" db:"display_name"`
+	ProfilePicture *string   `json:"profile_picture,omitempty" db:"profile_picture"`
+	Bio            *string   `json:"bio,omitempty" db:"bio"`
+	AccountStatus  string    `json:"account_status" db:"account_status"`
+	IsOnline       bool      `json:"is_online" db:"is_online"`
+	LastSeen       time.Time `json:"last_seen" db:"last_seen"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Account statuses
+const (
+	AccountStatusActive          = "active"
+	AccountStatusSuspended       = "suspended"
+	AccountStatusBanned          = "banned"
+	AccountStatusDeactivated     = "deactivated"      // Hidden until the user logs in again
+	AccountStatusPendingDeletion = "pending_deletion" // Erased after the grace period unless the user logs in
+	AccountStatusDeleted         = "deleted"          // Erased; the row is an anonymous tombstone
+)
+
 // UserWithStats represents a user with their profile stats
 type UserWithStats struct {
 	User
@@ -34,40 +48,90 @@ type UserWithStats struct {
 
 // Session represents a user session
 type Session struct {
-	ID               int64     `json:"id" db:"id"`
-	UserID           int64     `json:"user_id" db:"user_id"`
-	TokenHash        string    `json:"-" db:"token_hash"`
-	RefreshTokenHash string    `json:"-" db:"refresh_token_hash"`
-	DeviceInfo       *string   `json:"device_info,omitempty" db:"device_info"`
-	IPAddress        *string   `json:"ip_address,omitempty" db:"ip_address"`
-	UserAgent        *string   `json:"user_agent,omitempty" db:"user_agent"`
-	IsActive         bool      `json:"is_active" db:"is_active"`
-	ExpiresAt        time.Time `json:"expires_at" db:"expires_at"`
-	CreatedAt        time.Time `json:"created_at" db:"created_at"`
-	LastUsedAt       time.Time `json:"last_used_at" db:"last_used_at"`
+	ID               int64           `json:"id" db:"id"`
+	UserID           int64           `json:"user_id" db:"user_id"`
+	TokenHash        string          `json:"-" db:"token_hash"`
+	RefreshTokenHash string          `json:"-" db:"refresh_token_hash"`
+	SessionKey       string          `json:"-" db:"session_key"`
+	FamilyID         string          `json:"-" db:"family_id"`
+	RotatedAt        *time.Time      `json:"-" db:"rotated_at"`
+	DeviceInfo       *string         `json:"device_info,omitempty" db:"device_info"`
+	IPAddress        *string         `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent        *string         `json:"user_agent,omitempty" db:"user_agent"`
+	IsActive         bool            `json:"is_active" db:"is_active"`
+	ExpiresAt        time.Time       `json:"expires_at" db:"expires_at"`
+	CreatedAt        time.Time       `json:"created_at" db:"created_at"`
+	LastUsedAt       time.Time       `json:"last_used_at" db:"last_used_at"`
+	Device           *useragent.Info `json:"device,omitempty" db:"-"` // Parsed from UserAgent
+	IsCurrent        bool            `json:"is_current" db:"-"`       // The session making the request
+}
+
+// UserDevice is a browser and OS combination a user has logged in from
+type UserDevice struct {
+	ID          int64     `json:"id" db:"id"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	Fingerprint string    `json:"-" db:"fingerprint"`
+	Browser     string    `json:"browser" db:"browser"`
+	OS          string    `json:"os" db:"os"`
+	DeviceType  string    `json:"device_type" db:"device_type"`
+	LastIP      *string   `json:"last_ip,omitempty" db:"last_ip"`
+	FirstSeenAt time.Time `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
+
+// OTP represents a one-time code sent to an email or phone
+type OTP struct {
+	ID             int64     `json:"id" db:"id"`
+	UserID         *int64    `json:"user_id,omitempty" db:"user_id"`
+	Identifier     string    `json:"identifier" db:"identifier"`
+	IdentifierType string    `json:"identifier_type" db:"identifier_type"` // "email" or "phone"
+	Code           string    `json:"-" db:"code"`
+	Purpose        string    `json:"purpose" db:"purpose"`
+	Attempts       int       `json:"attempts" db:"attempts"`
+	MaxAttempts    int       `json:"max_attempts" db:"max_attempts"`
+	IsUsed         bool      `json:"is_used" db:"is_used"`
+	ExpiresAt      time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
+// OTP purposes
+const (
+	OTPPurposeVerification  = "verification"
+	OTPPurposePasswordReset = "password_reset"
+	OTPPurposeTwoFactor     = "2fa_login"
+	OTPPurposeAccountUnlock = "account_unlock"
+	OTPPurposeMagicLink     = "magic_login"
+	OTPPurposeSessionReport = "session_report"
+	OTPPurposeEmailChange   = "email_change"
+	OTPPurposeEmailRevert   = "email_revert"
+)
+
 // RegisterRequest represents registration request
 type RegisterRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Username string `json:"username" validate:"required,username"`
-	Password string `json:"password" validate:"required,min=8,max=72"`
-	Phone    string `json:"phone,omitempty" validate:"omitempty,phone"`
+	Email      string `json:"email" validate:"required,email"`
+	Username   string `json:"username" validate:"required,username"`
+	Password   string `json:"password" validate:"required,min=8,max=256"`
+	Phone      string `json:"phone,omitempty" validate:"omitempty,phone"`
+	InviteCode string `json:"invite_code,omitempty" validate:"omitempty,max=32"` // Required when registration is invite-only
 }
 
 // LoginRequest represents login request
 type LoginRequest struct {
-	Identifier string `json:"identifier" validate:"required"` // email or username
+	Identifier string `json:"identifier" validate:"required"` // email, username or verified phone in E.164 form (+...)
 	Password   string `json:"password" validate:"required"`
 	DeviceInfo string `json:"device_info,omitempty"`
 }
 
-// LoginResponse represents login response
+// LoginResponse represents login response.
+// When two-factor authentication is required only TwoFactorRequired and
+// ChallengeToken are set; exchange the token at /auth/login/2fa.
 type LoginResponse struct {
-	User         *UserResponse `json:"user"`
-	AccessToken  string        `json:"access_token"`
-	RefreshToken string        `json:"refresh_token"`
-	ExpiresIn    int64         `json:"expires_in"` // seconds
+	User              *UserResponse `json:"user,omitempty"`
+	AccessToken       string        `json:"access_token,omitempty"`
+	RefreshToken      string        `json:"refresh_token,omitempty"`
+	ExpiresIn         int64         `json:"expires_in,omitempty"` // seconds
+	TwoFactorRequired bool          `json:"two_factor_required,omitempty"`
+	ChallengeToken    string        `json:"challenge_token,omitempty"`
 }
 
 // UserResponse is a safe user representation (no sensitive data)
@@ -97,7 +161,39 @@ type RefreshRequest struct {
 // ChangePasswordRequest represents password change request
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password" validate:"required"`
-	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=256"`
+}
+
+// DeactivateAccountRequest represents an account deactivation
+type DeactivateAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// DeleteAccountRequest represents an account deletion request
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// ChangeEmailRequest starts an email address change
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ConfirmEmailChangeRequest confirms a new email address with the code sent to it
+type ConfirmEmailChangeRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// RevertEmailChangeRequest undoes an email change from the link sent to the old address
+type RevertEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// AccountDeletionResponse tells the user when their data will be erased
+type AccountDeletionResponse struct {
+	ScheduledFor time.Time `json:"scheduled_for"`
 }
 
 // ResetPasswordRequest represents password reset request
@@ -109,7 +205,7 @@ type ResetPasswordRequest struct {
 type ConfirmResetRequest struct {
 	Email       string `json:"email" validate:"required,email"`
 	Code        string `json:"code" validate:"required"`
-	NewPassword string `json:"new_password" validate:"required,min=8,max=72"`
+	NewPassword string `json:"new_password" validate:"required,min=8,max=256"`
 }
 
 // VerifyEmailRequest represents email verification request
@@ -118,19 +214,398 @@ type VerifyEmailRequest struct {
 	Code  string `json:"code" validate:"required"`
 }
 
+// ResendVerificationRequest represents a request for a new email verification code
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkRequest represents a request for a passwordless login link
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ReportSessionRequest reports a login from a new-device alert as not the user's
+type ReportSessionRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// MagicLinkLoginRequest exchanges a login link token for session tokens
+type MagicLinkLoginRequest struct {
+	Token      string `json:"token" validate:"required"`
+	DeviceInfo string `json:"device_info,omitempty"`
+}
+
+// AccountUnlockRequest represents a request for an account unlock code
+type AccountUnlockRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ConfirmUnlockRequest represents account unlock confirmation
+type ConfirmUnlockRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required"`
+}
+
+// SendPhoneCodeRequest represents a request for a phone verification code
+type SendPhoneCodeRequest struct {
+	Phone string `json:"phone" validate:"required,phone"`
+}
+
 // VerifyPhoneRequest represents phone verification request
 type VerifyPhoneRequest struct {
 	Phone string `json:"phone" validate:"required,phone"`
 	Code  string `json:"code" validate:"required"`
 }
 
+// TwoFactor represents a user's TOTP enrollment
+type TwoFactor struct {
+	UserID       int64      `json:"user_id" db:"user_id"`
+	Secret       string     `json:"-" db:"secret"`
+	IsEnabled    bool       `json:"is_enabled" db:"is_enabled"`
+	LastUsedStep int64      `json:"-" db:"last_used_step"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty" db:"enabled_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// TwoFactorSetupResponse contains the secret to load into an authenticator app
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorStatusResponse reports whether 2FA is enabled
+type TwoFactorStatusResponse struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// RecoveryCodesResponse contains freshly generated recovery codes
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorCodeRequest represents a request carrying a TOTP code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// DisableTwoFactorRequest represents a request to turn off 2FA
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"` // TOTP or recovery code
+}
+
+// TwoFactorLoginRequest exchanges a login challenge for session tokens
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"` // TOTP or recovery code
+	DeviceInfo     string `json:"device_info,omitempty"`
+}
+
+// LoginThrottle tracks consecutive failed logins for an account or IP address
+type LoginThrottle struct {
+	Key          string     `db:"throttle_key"`
+	FailedCount  int        `db:"failed_count"`
+	LastFailedAt time.Time  `db:"last_failed_at"`
+	LockedUntil  *time.Time `db:"locked_until"`
+}
+
+// LoginAttempt is a login history entry
+type LoginAttempt struct {
+	ID            int64     `json:"id" db:"id"`
+	UserID        *int64    `json:"user_id,omitempty" db:"user_id"`
+	Identifier    string    `json:"identifier" db:"identifier"`
+	IPAddress     *string   `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent     *string   `json:"user_agent,omitempty" db:"user_agent"`
+	Success       bool      `json:"success" db:"success"`
+	FailureReason *string   `json:"failure_reason,omitempty" db:"failure_reason"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID          int64     `json:"id" db:"id"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	Provider    string    `json:"provider" db:"provider"`
+	Subject     string    `json:"-" db:"subject"`
+	Email       *string   `json:"email,omitempty" db:"email"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at" db:"last_login_at"`
+}
+
+// OAuthState is a pending authorization request awaiting its callback
+type OAuthState struct {
+	StateHash    string    `db:"state_hash"`
+	Provider     string    `db:"provider"`
+	CodeVerifier string    `db:"code_verifier"`
+	Nonce        string    `db:"nonce"`
+	ExpiresAt    time.Time `db:"expires_at"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// OAuthStartResponse tells the client where to send the user for consent
+type OAuthStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+// OAuthCallbackRequest completes a social login with the provider's authorization code
+type OAuthCallbackRequest struct {
+	Code       string `json:"code" validate:"required"`
+	State      string `json:"state" validate:"required"`
+	DeviceInfo string `json:"device_info,omitempty"`
+}
+
+// Passkey ceremonies
+const (
+	PasskeyPurposeRegistration = "registration"
+	PasskeyPurposeLogin        = "login"
+)
+
+// Passkey is a WebAuthn credential registered to a user
+type Passkey struct {
+	ID           int64      `json:"id" db:"id"`
+	UserID       int64      `json:"user_id" db:"user_id"`
+	CredentialID []byte     `json:"-" db:"credential_id"`
+	PublicKey    []byte     `json:"-" db:"public_key"`
+	SignCount    int64      `json:"-" db:"sign_count"`
+	AAGUID       []byte     `json:"-" db:"aaguid"`
+	Transports   *string    `json:"-" db:"transports"`
+	Name         string     `json:"name" db:"name"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+// WebAuthnChallenge is a pending passkey registration or login
+type WebAuthnChallenge struct {
+	ChallengeHash string    `db:"challenge_hash"`
+	UserID        *int64    `db:"user_id"`
+	Purpose       string    `db:"purpose"`
+	ExpiresAt     time.Time `db:"expires_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// PasskeyRegistrationRequest completes a passkey registration
+type PasskeyRegistrationRequest struct {
+	Name       string                        `json:"name" validate:"omitempty,max=100"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// PasskeyLoginOptionsRequest starts a passkey login. Without an identifier
+// the authenticator offers any discoverable passkey.
+type PasskeyLoginOptionsRequest struct {
+	Identifier string `json:"identifier,omitempty"`
+}
+
+// PasskeyLoginRequest completes a passkey login
+type PasskeyLoginRequest struct {
+	Credential webauthn.AssertionResponse `json:"credential"`
+	DeviceInfo string                     `json:"device_info,omitempty"`
+}
+
+// RenamePasskeyRequest renames a passkey
+type RenamePasskeyRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// PersonalAccessToken is a long-lived, scoped API token for integrations
+type PersonalAccessToken struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	TenantID    int64      `json:"-" db:"tenant_id"` // Owner's tenant; only loaded by hash
+	Name        string     `json:"name" db:"name"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"`
+	Scopes      []string   `json:"scopes" db:"-"`
+	ScopeList   string     `json:"-" db:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateTokenRequest creates a personal access token
+type CreateTokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" validate:"omitempty,min=1,max=365"` // Omit for no expiry
+}
+
+// CreateTokenResponse returns a new token. The plaintext token is shown only once.
+type CreateTokenResponse struct {
+	Token               string               `json:"token"`
+	PersonalAccessToken *PersonalAccessToken `json:"personal_access_token"`
+}
+
+// Invite is a code that lets people register, possibly several times
+type Invite struct {
+	ID              int64      `json:"id" db:"id"`
+	TenantID        int64      `json:"-" db:"tenant_id"`
+	Code            string     `json:"code" db:"code"`
+	CreatedBy       int64      `json:"created_by" db:"created_by"`
+	InviterUsername string     `json:"-" db:"inviter_username"` // Only loaded by code
+	MaxUses         int        `json:"max_uses" db:"max_uses"`
+	UsesCount       int        `json:"uses_count" db:"uses_count"`
+	ExpiresAt       time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Usable reports whether the invite can still be redeemed
+func (i *Invite) Usable() bool {
+	return i.RevokedAt == nil && time.Now().Before(i.ExpiresAt) && i.UsesCount < i.MaxUses
+}
+
+// CreateInviteRequest creates an invite code. Omitted fields give a
+// single-use code with the configured lifetime.
+type CreateInviteRequest struct {
+	MaxUses       int `json:"max_uses,omitempty" validate:"omitempty,min=1,max=10000"`
+	ExpiresInDays int `json:"expires_in_days,omitempty" validate:"omitempty,min=1,max=365"`
+}
+
+// ValidateInviteRequest checks an invite code before registering
+type ValidateInviteRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// InvitePreview is what a prospective member learns about a valid invite
+type InvitePreview struct {
+	Code      string    `json:"code"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// InviteFilter narrows the admin invite list. Zero values match everything.
+type InviteFilter struct {
+	CreatedBy int64
+}
+
+// ReferredUser is an account that registered with someone's invite, with
+// the accounts it went on to invite when loaded as a tree
+type ReferredUser struct {
+	ID             int64           `json:"id" db:"id"`
+	Username       string          `json:"username" db:"username"`
+	DisplayName    *string         `json:"display_name,omitempty" db:"display_name"`
+	ProfilePicture *string         `json:"profile_picture,omitempty" db:"profile_picture"`
+	InviterID      int64           `json:"inviter_id" db:"inviter_id"`
+	Depth          int             `json:"depth" db:"depth"` // 1 for direct referrals
+	ReferredAt     time.Time       `json:"referred_at" db:"referred_at"`
+	Referrals      []*ReferredUser `json:"referrals,omitempty" db:"-"`
+}
+
+// ReferralStats summarises a user's invites and the accounts they brought in
+type ReferralStats struct {
+	DirectReferrals int64  `json:"direct_referrals" db:"direct_referrals"`
+	TotalReferrals  int64  `json:"total_referrals" db:"total_referrals"` // Everyone in the referral tree
+	TreeDepth       int    `json:"tree_depth" db:"tree_depth"`
+	InvitesCreated  int64  `json:"invites_created" db:"invites_created"`
+	ActiveInvites   int64  `json:"active_invites" db:"active_invites"`
+	InvitedBy       *int64 `json:"invited_by,omitempty" db:"invited_by"`
+}
+
+// Built-in roles
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// Built-in permissions
+const (
+	PermissionRolesManage      = "roles:manage"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersManage      = "users:manage"
+	PermissionPostsModerate    = "posts:moderate"
+	PermissionCommentsModerate = "comments:moderate"
+	PermissionStoriesModerate  = "stories:moderate"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionAuditRead        = "audit:read"
+	PermissionInvitesManage    = "invites:manage"
+)
+
+// Role is a named set of permissions
+type Role struct {
+	ID          int64     `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description *string   `json:"description,omitempty" db:"description"`
+	Permissions []string  `json:"permissions,omitempty" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserRole is a role granted to a user
+type UserRole struct {
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Role      string    `json:"role" db:"role"`
+	GrantedBy *int64    `json:"granted_by,omitempty" db:"granted_by"`
+	GrantedAt time.Time `json:"granted_at" db:"granted_at"`
+}
+
+// GrantRoleRequest represents a role grant
+type GrantRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// ImpersonationSession is a short-lived login by an admin as another user
+type ImpersonationSession struct {
+	ID           int64      `json:"id" db:"id"`
+	AdminID      int64      `json:"admin_id" db:"admin_id"`
+	TargetUserID int64      `json:"target_user_id" db:"target_user_id"`
+	SessionKey   string     `json:"-" db:"session_key"`
+	Reason       string     `json:"reason" db:"reason"`
+	IPAddress    *string    `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent    *string    `json:"user_agent,omitempty" db:"user_agent"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+	EndedAt      *time.Time `json:"ended_at,omitempty" db:"ended_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ImpersonationAuditEntry is one request made while impersonating
+type ImpersonationAuditEntry struct {
+	ID              int64     `json:"id" db:"id"`
+	ImpersonationID int64     `json:"impersonation_id" db:"impersonation_id"`
+	AdminID         int64     `json:"admin_id" db:"admin_id"`
+	TargetUserID    int64     `json:"target_user_id" db:"target_user_id"`
+	Method          string    `json:"method" db:"method"`
+	Path            string    `json:"path" db:"path"`
+	StatusCode      int       `json:"status_code" db:"status_code"`
+	IPAddress       *string   `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// ImpersonateRequest starts an impersonation session
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// ImpersonationResponse carries the access token for an impersonation session.
+// There is no refresh token; a new session must be started once it expires.
+type ImpersonationResponse struct {
+	ImpersonationID int64         `json:"impersonation_id"`
+	User            *UserResponse `json:"user"`
+	AccessToken     string        `json:"access_token"`
+	ExpiresIn       int64         `json:"expires_in"`
+}
+
+// ImpersonationFilter narrows the impersonation session list
+type ImpersonationFilter struct {
+	AdminID      int64
+	TargetUserID int64
+}
+
 // TokenClaims represents JWT token claims
 type TokenClaims struct {
-	UserID    int64  `json:"user_id"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	SessionID string `json:"session_id"`
-	Type      string `json:"type"` // "access" or "refresh"
+	UserID          int64    `json:"user_id"`
+	Username        string   `json:"username"`
+	Email           string   `json:"email"`
+	SessionID       string   `json:"session_id"`
+	Roles           []string `json:"roles,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`           // Personal access tokens only
+	TokenID         int64    `json:"token_id,omitempty"`         // Personal access tokens only
+	ImpersonatorID  int64    `json:"impersonator_id,omitempty"`  // Impersonation tokens only
+	ImpersonationID int64    `json:"impersonation_id,omitempty"` // Impersonation tokens only
+	TenantID        int64    `json:"tenant_id"`
+	Type            string   `json:"type"` // "access", "refresh" or "personal_access"
 }
 
 // ToResponse converts User to UserResponse
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/pkg/oauth"
+)
+
+// oauthStateTTL is how long a user has to complete the provider consent screen
+const oauthStateTTL = 10 * time.Minute
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// StartOAuthLogin creates a pending authorization request and returns the provider URL
+func (s *service) StartOAuthLogin(ctx context.Context, provider string) (*OAuthStartResponse, error) {
+	p, ok := s.config.OAuthProviders[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	state := oauth.GenerateState()
+	verifier := oauth.GenerateVerifier()
+	nonce := oauth.GenerateState()
+
+	authURL, err := p.AuthCodeURL(ctx, state, oauth.ChallengeS256(verifier), nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build authorization url: %w", err)
+	}
+
+	if err := s.repo.CreateOAuthState(ctx, &OAuthState{
+		StateHash:    hashToken(state),
+		Provider:     provider,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store oauth state: %w", err)
+	}
+
+	return &OAuthStartResponse{AuthorizationURL: authURL, State: state}, nil
+}
+
+// CompleteOAuthLogin exchanges the authorization code and signs the user in,
+// linking or creating an account as needed
+func (s *service) CompleteOAuthLogin(ctx context.Context, provider string, req *OAuthCallbackRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	p, ok := s.config.OAuthProviders[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	state, err := s.repo.ConsumeOAuthState(ctx, hashToken(req.State), provider)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := p.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.resolveOAuthUser(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canLogin(user) {
+		return nil, ErrAccountInactive
+	}
+
+	return s.completeLogin(ctx, user, req.DeviceInfo, ipAddress, userAgent)
+}
+
+// GetUserIdentities lists the external identities linked to a user
+func (s *service) GetUserIdentities(ctx context.Context, userID int64) ([]*UserIdentity, error) {
+	return s.repo.GetUserIdentities(ctx, userID)
+}
+
+// resolveOAuthUser finds the user for an external identity. Unknown identities
+// are linked to the account with the same verified email, or get a new account.
+func (s *service) resolveOAuthUser(ctx context.Context, identity *oauth.Identity) (*User, error) {
+	var email *string
+	if identity.Email != "" {
+		e := strings.ToLower(identity.Email)
+		email = &e
+	}
+
+	linked, err := s.repo.GetIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		_ = s.repo.UpdateIdentityLogin(ctx, linked.ID, email)
+		return s.repo.GetUserByID(ctx, linked.UserID)
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	// Only a provider-verified email may be trusted to link or create accounts
+	if email == nil || !identity.EmailVerified {
+		return nil, ErrOAuthEmailUnverified
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, *email)
+	switch {
+	case err == nil:
+		// Linking to an unverified account would let whoever registered the
+		// address first keep a password on the victim's account
+		if !user.EmailVerified {
+			return nil, ErrOAuthAccountConflict
+		}
+	case errors.Is(err, ErrUserNotFound):
+		// Provider sign-ups carry no invite code
+		if s.config.InviteOnly {
+			return nil, ErrInviteRequired
+		}
+		user, err = s.createOAuthUser(ctx, identity, *email)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := s.repo.CreateIdentity(ctx, &UserIdentity{
+		UserID:   user.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    email,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// createOAuthUser registers a new account for a provider-verified email
+func (s *service) createOAuthUser(ctx context.Context, identity *oauth.Identity, email string) (*User, error) {
+	username, err := s.availableUsername(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account has no usable password until the user sets one via reset
+	passwordHash, err := s.hashPassword(generateSecureToken(32))
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &User{
+		Email:        email,
+		Username:     username,
+		PasswordHash: passwordHash,
+	}
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := s.repo.UpdateVerificationStatus(ctx, user.ID, "email", true); err != nil {
+		return nil, fmt.Errorf("failed to verify email: %w", err)
+	}
+	user.EmailVerified = true
+
+	if identity.Name != "" {
+		name := identity.Name
+		user.DisplayName = &name
+		if err := s.repo.UpdateUser(ctx, user); err != nil {
+			fmt.Printf("WARNING: Failed to set display name for user %d: %v\n", user.ID, err)
+		}
+	}
+
+	return user, nil
+}
+
+// availableUsername derives an unused username from the email's local part
+func (s *service) availableUsername(ctx context.Context, email string) (string, error) {
+	base := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	base = usernameInvalidChars.ReplaceAllString(base, "_")
+	base = strings.Trim(base, "_")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		exists, err := s.repo.UsernameExists(ctx, candidate)
+		if err != nil {
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s_%04d", base, rand.Intn(10000))
+	}
+
+	return "", ErrUsernameExists
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+	"github.com/tommygebru/kiekky-backend/pkg/sms"
+)
+
+const (
+	// otpRateLimitWindow and otpRateLimitMax cap how many codes can be issued per identifier
+	otpRateLimitWindow = time.Hour
+	otpRateLimitMax    = 5
+)
+
+// issueOTP invalidates outstanding codes and stores a new one
+func (s *service) issueOTP(ctx context.Context, userID *int64, identifier, identifierType, purpose string) (*OTP, error) {
+	recent, err := s.repo.CountRecentOTPs(ctx, identifier, identifierType, purpose, time.Now().Add(-otpRateLimitWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check code rate limit: %w", err)
+	}
+	if recent >= otpRateLimitMax {
+		return nil, ErrOTPRateLimited
+	}
+
+	if err := s.repo.InvalidateOTPs(ctx, identifier, identifierType, purpose); err != nil {
+		return nil, fmt.Errorf("failed to invalidate old codes: %w", err)
+	}
+
+	code, err := generateOTPCode(s.config.OTPLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code: %w", err)
+	}
+
+	otp := &OTP{
+		UserID:         userID,
+		Identifier:     identifier,
+		IdentifierType: identifierType,
+		Code:           code,
+		Purpose:        purpose,
+		MaxAttempts:    s.config.MaxOTPAttempts,
+		ExpiresAt:      time.Now().Add(s.config.OTPExpiry),
+	}
+
+	if err := s.repo.CreateOTP(ctx, otp); err != nil {
+		return nil, fmt.Errorf("failed to store code: %w", err)
+	}
+
+	return otp, nil
+}
+
+// verifyOTP checks a code against the latest outstanding OTP and consumes it on success
+func (s *service) verifyOTP(ctx context.Context, identifier, identifierType, purpose, code string) (*OTP, error) {
+	otp, err := s.repo.GetLatestOTP(ctx, identifier, identifierType, purpose)
+	if err != nil {
+		if errors.Is(err, ErrOTPNotFound) {
+			return nil, ErrInvalidOTP
+		}
+		return nil, err
+	}
+
+	if time.Now().After(otp.ExpiresAt) {
+		return nil, ErrOTPExpired
+	}
+
+	// Claim the attempt before comparing, so parallel guesses cannot all
+	// slip under the cap
+	attempts, ok, err := s.repo.ClaimOTPAttempt(ctx, otp.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTooManyAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(otp.Code), []byte(code)) != 1 {
+		if attempts >= otp.MaxAttempts {
+			return nil, ErrTooManyAttempts
+		}
+		return nil, ErrInvalidOTP
+	}
+
+	// Only one of several parallel correct guesses may use the code
+	consumed, err := s.repo.ConsumeOTP(ctx, otp.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidOTP
+	}
+
+	return otp, nil
+}
+
+// sendEmailVerification issues and emails a verification code
+func (s *service) sendEmailVerification(ctx context.Context, user *User) error {
+	otp, err := s.issueOTP(ctx, &user.ID, user.Email, "email", OTPPurposeVerification)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, &email.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nYour verification code is: %s\n\nThis code expires in %d minutes.\n",
+			user.Username, otp.Code, int(s.config.OTPExpiry.Minutes())),
+	})
+}
+
+// sendPasswordReset issues and emails a password reset code
+func (s *service) sendPasswordReset(ctx context.Context, user *User) error {
+	otp, err := s.issueOTP(ctx, &user.ID, user.Email, "email", OTPPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, &email.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nYour password reset code is: %s\n\nThis code expires in %d minutes. "+
+			"If you did not request a password reset, you can ignore this email.\n",
+			user.Username, otp.Code, int(s.config.OTPExpiry.Minutes())),
+	})
+}
+
+// sendPhoneVerification issues and texts a phone verification code
+func (s *service) sendPhoneVerification(ctx context.Context, userID int64, phone string) error {
+	otp, err := s.issueOTP(ctx, &userID, phone, "phone", OTPPurposeVerification)
+	if err != nil {
+		return err
+	}
+
+	return s.sms.Send(ctx, &sms.Message{
+		To:   phone,
+		Body: fmt.Sprintf("Your Kiekky verification code is %s. It expires in %d minutes.", otp.Code, int(s.config.OTPExpiry.Minutes())),
+	})
+}
+
+// generateOTPCode returns a random numeric code of the given length
+func generateOTPCode(length int) (string, error) {
+	if length <= 0 {
+		length = 6
+	}
+
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
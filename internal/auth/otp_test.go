@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+	"github.com/tommygebru/kiekky-backend/pkg/passhash"
+	"github.com/tommygebru/kiekky-backend/pkg/sms"
+)
+
+const testPassword = "correct horse battery staple"
+
+// newTestService creates a service backed by an in-memory repository and
+// mock senders. configure may adjust the config before the service is built.
+func newTestService(t *testing.T, configure func(*Config)) (*service, *memoryRepository, *email.MockSender) {
+	t.Helper()
+
+	config := &Config{
+		JWTSecret:          "test-secret",
+		AccessTokenExpiry:  15 * time.Minute,
+		RefreshTokenExpiry: 24 * time.Hour,
+		PasswordHasher:     passhash.New(passhash.Params{Memory: 1024, Iterations: 1, Parallelism: 1}),
+		OTPLength:          6,
+		OTPExpiry:          10 * time.Minute,
+		MaxOTPAttempts:     3,
+		FrontendURL:        "https://kiekky.test",
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	repo := newMemoryRepository()
+	mailer := email.NewMockSender()
+	svc := NewService(repo, config, mailer, sms.NewMockSender(), nil).(*service)
+	return svc, repo, mailer
+}
+
+func testContext() context.Context {
+	return common.WithTenant(context.Background(), 1, false)
+}
+
+// registerTestUser registers an account and returns it
+func registerTestUser(t *testing.T, svc *service, emailAddr, username string) *User {
+	t.Helper()
+
+	user, err := svc.Register(testContext(), &RegisterRequest{Email: emailAddr, Username: username, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	return user
+}
+
+var codePattern = regexp.MustCompile(`code[^:]* is: (\d+)`)
+
+// mailedCode returns the code in the latest message sent to an address
+func mailedCode(t *testing.T, mailer *email.MockSender, to string) string {
+	t.Helper()
+
+	msg := mailer.LastTo(to)
+	if msg == nil {
+		t.Fatalf("no email sent to %s", to)
+	}
+	match := codePattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no code in email to %s: %q", to, msg.Body)
+	}
+	return match[1]
+}
+
+// wrongCode returns a code of the same length that differs from code
+func wrongCode(code string) string {
+	wrong := []byte(code)
+	wrong[0] = '0' + (wrong[0]-'0'+1)%10
+	return string(wrong)
+}
+
+func TestRegisterSendsVerificationCode(t *testing.T) {
+	svc, _, mailer := newTestService(t, nil)
+
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+
+	outbox := mailer.Outbox()
+	if len(outbox) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(outbox))
+	}
+	if outbox[0].To != "ada@example.com" || outbox[0].Subject != "Verify your email address" {
+		t.Errorf("sent %q to %s, want the verification email to ada@example.com", outbox[0].Subject, outbox[0].To)
+	}
+	if code := mailedCode(t, mailer, user.Email); len(code) != 6 {
+		t.Errorf("code %q has %d digits, want 6", code, len(code))
+	}
+	if user.EmailVerified {
+		t.Error("email verified before the code was entered")
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+
+	if err := svc.VerifyEmail(ctx, user.Email, mailedCode(t, mailer, user.Email)); err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if !stored.EmailVerified || !stored.IsVerified {
+		t.Error("email not marked verified")
+	}
+
+	// Codes are single use, and verified addresses answer like unknown ones
+	if err := svc.VerifyEmail(ctx, user.Email, mailedCode(t, mailer, user.Email)); !errors.Is(err, ErrInvalidOTP) {
+		t.Errorf("second VerifyEmail() error = %v, want %v", err, ErrInvalidOTP)
+	}
+}
+
+func TestVerifyEmailResendReplacesCode(t *testing.T) {
+	svc, _, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+	first := mailedCode(t, mailer, user.Email)
+
+	if err := svc.ResendEmailVerification(ctx, user.Email); err != nil {
+		t.Fatalf("ResendEmailVerification() error = %v", err)
+	}
+	second := mailedCode(t, mailer, user.Email)
+
+	if first != second {
+		if err := svc.VerifyEmail(ctx, user.Email, first); !errors.Is(err, ErrInvalidOTP) {
+			t.Errorf("VerifyEmail() with the replaced code error = %v, want %v", err, ErrInvalidOTP)
+		}
+	}
+	if err := svc.VerifyEmail(ctx, user.Email, second); err != nil {
+		t.Errorf("VerifyEmail() with the new code error = %v", err)
+	}
+}
+
+func TestVerifyEmailExpiredCode(t *testing.T) {
+	svc, repo, mailer := newTestService(t, func(c *Config) { c.OTPExpiry = -time.Minute })
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+
+	err := svc.VerifyEmail(ctx, user.Email, mailedCode(t, mailer, user.Email))
+	if !errors.Is(err, ErrOTPExpired) {
+		t.Fatalf("VerifyEmail() error = %v, want %v", err, ErrOTPExpired)
+	}
+
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if stored.EmailVerified {
+		t.Error("email verified with an expired code")
+	}
+}
+
+func TestVerifyEmailMaxAttempts(t *testing.T) {
+	svc, repo, mailer := newTestService(t, nil)
+	ctx := testContext()
+	user := registerTestUser(t, svc, "ada@example.com", "ada")
+	code := mailedCode(t, mailer, user.Email)
+
+	for i := 1; i < svc.config.MaxOTPAttempts; i++ {
+		if err := svc.VerifyEmail(ctx, user.Email, wrongCode(code)); !errors.Is(err, ErrInvalidOTP) {
+			t.Fatalf("attempt %d error = %v, want %v", i, err, ErrInvalidOTP)
+		}
+	}
+	if err := svc.VerifyEmail(ctx, user.Email, wrongCode(code)); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("last attempt error = %v, want %v", err, ErrTooManyAttempts)
+	}
+
+	// Once the attempts are used up even the right code is refused
+	if err := svc.VerifyEmail(ctx, user.Email, code); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("VerifyEmail() with the right code error = %v, want %v", err, ErrTooManyAttempts)
+	}
+
+	stored, _ := repo.GetUserByID(ctx, user.ID)
+	if stored.EmailVerified {
+		t.Error("email verified after the attempts ran out")
+	}
+}
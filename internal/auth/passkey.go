@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/pkg/webauthn"
+)
+
+// maxPasskeysPerUser bounds how many credentials one account can register
+const maxPasskeysPerUser = 10
+
+// passkeyUserHandle is the opaque user handle stored on the authenticator
+func passkeyUserHandle(userID int64) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+func passkeyDescriptors(passkeys []*Passkey) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, p := range passkeys {
+		d := webauthn.CredentialDescriptor{Type: "public-key", ID: p.CredentialID}
+		if p.Transports != nil && *p.Transports != "" {
+			d.Transports = strings.Split(*p.Transports, ",")
+		}
+		descriptors = append(descriptors, d)
+	}
+	return descriptors
+}
+
+// storeWebAuthnChallenge records a new ceremony and returns its challenge
+func (s *service) storeWebAuthnChallenge(ctx context.Context, userID *int64, purpose string) (string, error) {
+	challenge := webauthn.NewChallenge()
+	if err := s.repo.CreateWebAuthnChallenge(ctx, &WebAuthnChallenge{
+		ChallengeHash: hashToken(challenge),
+		UserID:        userID,
+		Purpose:       purpose,
+		ExpiresAt:     time.Now().Add(webauthn.ChallengeTimeout),
+	}); err != nil {
+		return "", fmt.Errorf("failed to store passkey challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge looks up and deletes the ceremony a client response answers
+func (s *service) consumeWebAuthnChallenge(ctx context.Context, clientDataJSON []byte, purpose string) (string, *WebAuthnChallenge, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return "", nil, ErrInvalidPasskey
+	}
+	stored, err := s.repo.ConsumeWebAuthnChallenge(ctx, hashToken(challenge), purpose)
+	if err != nil {
+		return "", nil, err
+	}
+	return challenge, stored, nil
+}
+
+// BeginPasskeyRegistration returns options for navigator.credentials.create()
+func (s *service) BeginPasskeyRegistration(ctx context.Context, userID int64) (*webauthn.CreationOptions, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetUserPasskeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passkeys: %w", err)
+	}
+	if len(existing) >= maxPasskeysPerUser {
+		return nil, ErrPasskeyLimitReached
+	}
+
+	challenge, err := s.storeWebAuthnChallenge(ctx, &userID, PasskeyPurposeRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := user.Username
+	if user.DisplayName != nil && *user.DisplayName != "" {
+		displayName = *user.DisplayName
+	}
+
+	return s.config.WebAuthn.CreationOptions(challenge, webauthn.User{
+		ID:          passkeyUserHandle(user.ID),
+		Name:        user.Username,
+		DisplayName: displayName,
+	}, passkeyDescriptors(existing)), nil
+}
+
+// FinishPasskeyRegistration verifies an attestation and stores the new passkey
+func (s *service) FinishPasskeyRegistration(ctx context.Context, userID int64, req *PasskeyRegistrationRequest) (*Passkey, error) {
+	challenge, stored, err := s.consumeWebAuthnChallenge(ctx, req.Credential.Response.ClientDataJSON, PasskeyPurposeRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if stored.UserID == nil || *stored.UserID != userID {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	credential, err := s.config.WebAuthn.VerifyRegistration(&req.Credential, challenge)
+	if err != nil {
+		fmt.Printf("WARNING: Passkey registration failed for user %d: %v\n", userID, err)
+		return nil, ErrInvalidPasskey
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	passkey := &Passkey{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		AAGUID:       credential.AAGUID,
+		Name:         name,
+	}
+	if len(credential.Transports) > 0 {
+		transports := strings.Join(credential.Transports, ",")
+		passkey.Transports = &transports
+	}
+
+	if err := s.repo.CreatePasskey(ctx, passkey); err != nil {
+		return nil, err
+	}
+
+	if s.notifySvc != nil {
+		go s.notifySvc.NotifySecurityAlert(context.WithoutCancel(ctx), userID,
+			"Passkey added",
+			fmt.Sprintf("A passkey named %q was added to your account. If this wasn't you, remove it and change your password.", name),
+			map[string]interface{}{"reason": "passkey_added", "passkey_id": passkey.ID},
+		)
+	}
+
+	return passkey, nil
+}
+
+// BeginPasskeyLogin returns options for navigator.credentials.get(). Unknown
+// identifiers get the same usernameless options so accounts cannot be probed.
+func (s *service) BeginPasskeyLogin(ctx context.Context, identifier string) (*webauthn.RequestOptions, error) {
+	var allow []webauthn.CredentialDescriptor
+	if identifier != "" {
+		user, err := s.repo.GetUserByIdentifier(ctx, identifier)
+		switch {
+		case err == nil:
+			passkeys, err := s.repo.GetUserPasskeys(ctx, user.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load passkeys: %w", err)
+			}
+			allow = passkeyDescriptors(passkeys)
+		case !errors.Is(err, ErrUserNotFound):
+			return nil, err
+		}
+	}
+
+	challenge, err := s.storeWebAuthnChallenge(ctx, nil, PasskeyPurposeLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.config.WebAuthn.RequestOptions(challenge, allow), nil
+}
+
+// FinishPasskeyLogin verifies an assertion and signs the user in like Login,
+// under the same per-IP and per-account throttle
+func (s *service) FinishPasskeyLogin(ctx context.Context, req *PasskeyLoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	ipKey := ipThrottleKey(ipAddress)
+	if err := s.checkLoginThrottle(ctx, ipKey); err != nil {
+		return nil, err
+	}
+
+	challenge, _, err := s.consumeWebAuthnChallenge(ctx, req.Credential.Response.ClientDataJSON, PasskeyPurposeLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := []byte(req.Credential.RawID)
+	if len(credentialID) == 0 {
+		if credentialID, err = base64.RawURLEncoding.DecodeString(req.Credential.ID); err != nil {
+			return nil, ErrInvalidPasskey
+		}
+	}
+
+	passkey, err := s.repo.GetPasskeyByCredentialID(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, ErrPasskeyNotFound) {
+			s.registerLoginFailure(ctx, ipKey, s.config.MaxLoginAttemptsPerIP, false)
+			return nil, ErrInvalidPasskey
+		}
+		return nil, err
+	}
+
+	if handle := req.Credential.Response.UserHandle; len(handle) > 0 && !bytes.Equal(handle, passkeyUserHandle(passkey.UserID)) {
+		s.registerLoginFailure(ctx, ipKey, s.config.MaxLoginAttemptsPerIP, false)
+		return nil, ErrInvalidPasskey
+	}
+
+	user, err := s.repo.GetUserByID(ctx, passkey.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	accountKey := userThrottleKey(user.ID)
+	if err := s.checkLoginThrottle(ctx, accountKey); err != nil {
+		s.recordLoginAttempt(ctx, &user.ID, user.Email, ipAddress, userAgent, loginFailureLocked)
+		return nil, err
+	}
+
+	assertion, err := s.config.WebAuthn.VerifyAssertion(&req.Credential, challenge, passkey.PublicKey, uint32(passkey.SignCount))
+	if err != nil {
+		if errors.Is(err, webauthn.ErrCounterRegression) {
+			fmt.Printf("WARNING: Passkey %d of user %d reported a stale signature counter, possible cloned authenticator\n", passkey.ID, user.ID)
+		}
+		s.recordLoginAttempt(ctx, &user.ID, user.Email, ipAddress, userAgent, loginFailureInvalidCredentials)
+		s.registerLoginFailure(ctx, ipKey, s.config.MaxLoginAttemptsPerIP, false)
+		if lock := s.registerLoginFailure(ctx, accountKey, s.config.MaxLoginAttempts, true); lock != nil && lock.RetryAfter >= s.config.LoginLockoutDuration {
+			return nil, lock
+		}
+		return nil, ErrInvalidPasskey
+	}
+
+	if !canLogin(user) {
+		s.recordLoginAttempt(ctx, &user.ID, user.Email, ipAddress, userAgent, loginFailureInactive)
+		return nil, ErrAccountInactive
+	}
+
+	if err := s.repo.UpdatePasskeyUsage(ctx, passkey.ID, int64(assertion.SignCount)); err != nil {
+		fmt.Printf("ERROR: Failed to update passkey %d usage: %v\n", passkey.ID, err)
+	}
+
+	s.recordLoginAttempt(ctx, &user.ID, user.Email, ipAddress, userAgent, "")
+
+	// A user-verified passkey already combines possession with a PIN or
+	// biometric, so it satisfies two-factor authentication on its own
+	var response *LoginResponse
+	if assertion.UserVerified {
+		response, err = s.createSession(ctx, user, req.DeviceInfo, ipAddress, userAgent)
+	} else {
+		response, err = s.completeLogin(ctx, user, req.DeviceInfo, ipAddress, userAgent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !response.TwoFactorRequired {
+		if err := s.repo.ClearLoginThrottle(ctx, accountKey); err != nil {
+			fmt.Printf("ERROR: Failed to reset login throttle for user %d: %v\n", user.ID, err)
+		}
+	}
+	return response, nil
+}
+
+// GetPasskeys lists a user's passkeys
+func (s *service) GetPasskeys(ctx context.Context, userID int64) ([]*Passkey, error) {
+	return s.repo.GetUserPasskeys(ctx, userID)
+}
+
+// RenamePasskey renames one of the user's passkeys
+func (s *service) RenamePasskey(ctx context.Context, userID, passkeyID int64, name string) error {
+	ok, err := s.repo.RenamePasskey(ctx, passkeyID, userID, strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// DeletePasskey removes one of the user's passkeys
+func (s *service) DeletePasskey(ctx context.Context, userID, passkeyID int64) error {
+	ok, err := s.repo.DeletePasskey(ctx, passkeyID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tommygebru/kiekky-backend/pkg/passpolicy"
+)
+
+// PasswordPolicyError lists why a new password was rejected.
+// It matches ErrWeakPassword with errors.Is.
+type PasswordPolicyError struct {
+	*passpolicy.Result
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		codes[i] = v.Code
+	}
+	return fmt.Sprintf("%s: %v", ErrWeakPassword, codes)
+}
+
+// Is lets errors.Is match ErrWeakPassword
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// validateNewPassword applies the password policy to a password being set.
+// If the breach corpus cannot be read the other rules still apply.
+func (s *service) validateNewPassword(password, username, email string) error {
+	result, err := s.config.PasswordPolicy.Check(password, passpolicy.UserInfo{Username: username, Email: email})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to check breached passwords: %v\n", err)
+	}
+	if !result.OK() {
+		return &PasswordPolicyError{Result: result}
+	}
+	return nil
+}
+
+// hashPassword hashes a new password with the configured hasher
+func (s *service) hashPassword(password string) (string, error) {
+	return s.config.PasswordHasher.Hash(password)
+}
+
+// checkPassword reports whether password matches the user's stored hash. An
+// unknown user is checked against a dummy hash with the same parameters, so
+// the response time does not tell which accounts exist.
+func (s *service) checkPassword(user *User, password string) bool {
+	if user == nil {
+		s.config.PasswordHasher.Verify(password, s.dummyHash)
+		return false
+	}
+	ok, err := s.config.PasswordHasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		fmt.Printf("WARNING: Unreadable password hash for user %d: %v\n", user.ID, err)
+		return false
+	}
+	return ok
+}
+
+// upgradePasswordHash rehashes a verified password when its stored hash uses
+// bcrypt or weaker argon2id parameters. Failures are logged and the login proceeds.
+func (s *service) upgradePasswordHash(ctx context.Context, user *User, password string) {
+	if !s.config.PasswordHasher.NeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	newHash, err := s.hashPassword(password)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to rehash password for user %d: %v\n", user.ID, err)
+		return
+	}
+
+	// Only replace the hash that was verified, in case the password changed meanwhile
+	if err := s.repo.RehashPassword(ctx, user.ID, user.PasswordHash, newHash); err != nil {
+		fmt.Printf("ERROR: Failed to store rehashed password for user %d: %v\n", user.ID, err)
+		return
+	}
+	user.PasswordHash = newHash
+}
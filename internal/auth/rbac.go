@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rolePermissionsTTL is how long the role to permission mapping is cached
+const rolePermissionsTTL = time.Minute
+
+// rolePermissionCache holds the role to permission mapping, reloaded after rolePermissionsTTL
+type rolePermissionCache struct {
+	mu       sync.RWMutex
+	perms    map[string]map[string]bool
+	loadedAt time.Time
+}
+
+// HasPermission reports whether any of the roles grants the permission
+func (s *service) HasPermission(ctx context.Context, roles []string, permission string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	perms, err := s.rolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if perms[role][permission] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetRoles lists every role with its permissions
+func (s *service) GetRoles(ctx context.Context) ([]*Role, error) {
+	roles, err := s.repo.GetRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	perms, err := s.repo.GetRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		role.Permissions = perms[role.Name]
+	}
+	return roles, nil
+}
+
+// GetUserRoles lists the roles granted to a user
+func (s *service) GetUserRoles(ctx context.Context, userID int64) ([]*UserRole, error) {
+	if _, err := s.repo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetUserRoles(ctx, userID)
+}
+
+// GrantRole grants a role to a user. It takes effect on the user's next
+// request; other instances see it once their session cache entry expires.
+func (s *service) GrantRole(ctx context.Context, actorID, userID int64, roleName string) error {
+	role, err := s.repo.GetRoleByName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if _, err := s.repo.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.repo.GrantRole(ctx, userID, role.ID, &actorID); err != nil {
+		return fmt.Errorf("failed to grant role: %w", err)
+	}
+
+	s.sessions.evictUser(userID)
+
+	fmt.Printf("INFO: Role granted - Role: %s, UserID: %d, By: %d\n", role.Name, userID, actorID)
+	return nil
+}
+
+// RevokeRole removes a role from a user. Admins cannot drop their own admin
+// role, so the last admin cannot lock everyone out by accident.
+func (s *service) RevokeRole(ctx context.Context, actorID, userID int64, roleName string) error {
+	if actorID == userID && roleName == RoleAdmin {
+		return ErrCannotRevokeOwnRole
+	}
+
+	role, err := s.repo.GetRoleByName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.repo.RevokeRole(ctx, userID, role.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke role: %w", err)
+	}
+	if !revoked {
+		return ErrRoleNotGranted
+	}
+
+	s.sessions.evictUser(userID)
+
+	fmt.Printf("INFO: Role revoked - Role: %s, UserID: %d, By: %d\n", role.Name, userID, actorID)
+	return nil
+}
+
+// rolePermissions returns the cached role to permission mapping, reloading it when stale
+func (s *service) rolePermissions(ctx context.Context) (map[string]map[string]bool, error) {
+	c := s.permissions
+
+	c.mu.RLock()
+	perms, loadedAt := c.perms, c.loadedAt
+	c.mu.RUnlock()
+	if perms != nil && time.Since(loadedAt) < rolePermissionsTTL {
+		return perms, nil
+	}
+
+	rows, err := s.repo.GetRolePermissions(ctx)
+	if err != nil {
+		if perms != nil {
+			// Serve the stale mapping rather than failing every request
+			fmt.Printf("WARNING: Failed to reload role permissions: %v\n", err)
+			return perms, nil
+		}
+		return nil, errors.New("failed to load role permissions")
+	}
+
+	perms = make(map[string]map[string]bool, len(rows))
+	for role, names := range rows {
+		perms[role] = make(map[string]bool, len(names))
+		for _, name := range names {
+			perms[role][name] = true
+		}
+	}
+
+	c.mu.Lock()
+	c.perms, c.loadedAt = perms, time.Now()
+	c.mu.Unlock()
+
+	return perms, nil
+}
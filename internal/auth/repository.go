@@ -4,17 +4,77 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrUserExists        = errors.New("user already exists")
-	ErrEmailExists       = errors.New("email already registered")
-	ErrUsernameExists    = errors.New("username already taken")
-	ErrSessionNotFound   = errors.New("session not found")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrEmailExists        = errors.New("email already registered")
+	ErrUsernameExists     = errors.New("username already taken")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionRevoked     = errors.New("session has been revoked")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWeakPassword       = errors.New("password does not meet requirements")
+	ErrAccountInactive    = errors.New("account is not active")
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	ErrOTPNotFound        = errors.New("otp not found")
+	ErrInvalidOTP         = errors.New("invalid verification code")
+	ErrOTPExpired         = errors.New("verification code has expired")
+	ErrTooManyAttempts    = errors.New("too many verification attempts")
+	ErrOTPRateLimited     = errors.New("too many codes requested")
+	ErrPhoneExists        = errors.New("phone number already registered")
+
+	ErrTwoFactorUnavailable    = errors.New("two-factor authentication is not available")
+	ErrTwoFactorNotFound       = errors.New("two-factor authentication not set up")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired login challenge")
+	ErrInvalidMagicLink        = errors.New("invalid or expired login link")
+	ErrInvalidSessionReport    = errors.New("invalid or expired session report link")
+	ErrInvalidEmailRevert      = errors.New("invalid or expired email revert link")
+	ErrPasswordResetRequired   = errors.New("password reset required")
+
+	ErrAccountLocked         = errors.New("account temporarily locked")
+	ErrLoginThrottleNotFound = errors.New("login throttle not found")
+
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrRoleNotGranted      = errors.New("role not granted")
+	ErrCannotRevokeOwnRole = errors.New("cannot revoke your own admin role")
+
+	ErrImpersonationNotFound  = errors.New("impersonation session not found")
+	ErrImpersonationEnded     = errors.New("impersonation session has ended")
+	ErrCannotImpersonateSelf  = errors.New("cannot impersonate yourself")
+	ErrCannotImpersonateStaff = errors.New("cannot impersonate a user with administrative permissions")
+
+	ErrPasskeyNotFound          = errors.New("passkey not found")
+	ErrPasskeyExists            = errors.New("passkey already registered")
+	ErrPasskeyLimitReached      = errors.New("maximum number of passkeys reached")
+	ErrInvalidPasskey           = errors.New("passkey verification failed")
+	ErrInvalidWebAuthnChallenge = errors.New("invalid or expired passkey challenge")
+
+	ErrTokenNotFound     = errors.New("personal access token not found")
+	ErrInvalidScope      = errors.New("invalid token scope")
+	ErrTokenLimitReached = errors.New("maximum number of personal access tokens reached")
+
+	ErrInviteRequired     = errors.New("an invite code is required to register")
+	ErrInvalidInvite      = errors.New("invalid or expired invite code")
+	ErrInviteNotFound     = errors.New("invite not found")
+	ErrInviteLimitReached = errors.New("maximum number of active invites reached")
+	ErrInviteTooGenerous  = errors.New("invite exceeds the member limits")
+
+	ErrUnknownProvider      = errors.New("unknown identity provider")
+	ErrInvalidOAuthState    = errors.New("invalid or expired oauth state")
+	ErrIdentityNotFound     = errors.New("identity not found")
+	ErrOAuthEmailUnverified = errors.New("identity provider did not verify the email address")
+	ErrOAuthAccountConflict = errors.New("an unverified account already uses this email")
 )
 
 // Repository defines auth data operations
@@ -28,22 +88,125 @@ type Repository interface {
 	GetUserWithStats(ctx context.Context, id int64) (*UserWithStats, error)
 	UpdateUser(ctx context.Context, user *User) error
 	UpdatePassword(ctx context.Context, userID int64, passwordHash string) error
+	RehashPassword(ctx context.Context, userID int64, oldHash, newHash string) error
+	UpdateEmail(ctx context.Context, userID int64, email string, verified bool) error
 	UpdateVerificationStatus(ctx context.Context, userID int64, field string, status bool) error
 	UpdateOnlineStatus(ctx context.Context, userID int64, isOnline bool) error
-	
+
+	// Account lifecycle
+	DeactivateUser(ctx context.Context, userID int64, status string, deletionScheduledAt *time.Time) error
+	ReactivateUser(ctx context.Context, userID int64) (bool, error)
+	GetUsersDueForDeletion(ctx context.Context, limit int) ([]*User, error)
+	MarkUserDeleted(ctx context.Context, userID int64) (bool, error)
+	AnonymizeUser(ctx context.Context, userID int64) error
+
 	// Session operations
 	CreateSession(ctx context.Context, session *Session) error
 	GetSessionByToken(ctx context.Context, tokenHash string) (*Session, error)
 	GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (*Session, error)
+	GetSessionByKey(ctx context.Context, sessionKey string) (*Session, error)
 	GetUserSessions(ctx context.Context, userID int64) ([]*Session, error)
 	UpdateSessionLastUsed(ctx context.Context, sessionID int64) error
 	InvalidateSession(ctx context.Context, sessionID int64) error
 	InvalidateAllUserSessions(ctx context.Context, userID int64) error
+	RotateSession(ctx context.Context, sessionID int64) (bool, error)
+	InvalidateSessionFamily(ctx context.Context, familyID string) error
 	CleanupExpiredSessions(ctx context.Context) error
-	
+
+	// Device operations
+	TouchUserDevice(ctx context.Context, device *UserDevice) (bool, error)
+	CountUserDevices(ctx context.Context, userID int64) (int, error)
+	GetUserDevices(ctx context.Context, userID int64) ([]*UserDevice, error)
+	SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error
+	IsPasswordResetRequired(ctx context.Context, userID int64) (bool, error)
+
+	// OTP operations
+	CreateOTP(ctx context.Context, otp *OTP) error
+	GetLatestOTP(ctx context.Context, identifier, identifierType, purpose string) (*OTP, error)
+	ClaimOTPAttempt(ctx context.Context, otpID int64) (int, bool, error)
+	ConsumeOTP(ctx context.Context, otpID int64) (bool, error)
+	InvalidateOTPs(ctx context.Context, identifier, identifierType, purpose string) error
+	CountRecentUserOTPs(ctx context.Context, userID int64, purpose string, since time.Time) (int, error)
+	CountRecentOTPs(ctx context.Context, identifier, identifierType, purpose string, since time.Time) (int, error)
+
+	// Two-factor operations
+	GetTwoFactor(ctx context.Context, userID int64) (*TwoFactor, error)
+	SaveTwoFactorSecret(ctx context.Context, userID int64, secret string) error
+	EnableTwoFactor(ctx context.Context, userID int64, step int64) error
+	DisableTwoFactor(ctx context.Context, userID int64) error
+	UpdateTwoFactorStep(ctx context.Context, userID int64, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+
+	// Login protection
+	GetLoginThrottle(ctx context.Context, key string) (*LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, key string, windowStart time.Time) (*LoginThrottle, error)
+	LockLoginThrottle(ctx context.Context, key string, until time.Time) error
+	ClearLoginThrottle(ctx context.Context, key string) error
+	RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error
+	GetLoginHistory(ctx context.Context, userID int64, limit, offset int) ([]*LoginAttempt, int64, error)
+
+	// Role operations
+	GetRoles(ctx context.Context) ([]*Role, error)
+	GetRoleByName(ctx context.Context, name string) (*Role, error)
+	GetRolePermissions(ctx context.Context) (map[string][]string, error)
+	GetUserRoles(ctx context.Context, userID int64) ([]*UserRole, error)
+	GetUserRoleNames(ctx context.Context, userID int64) ([]string, error)
+	GrantRole(ctx context.Context, userID, roleID int64, grantedBy *int64) error
+	RevokeRole(ctx context.Context, userID, roleID int64) (bool, error)
+
+	// Impersonation operations
+	CreateImpersonationSession(ctx context.Context, session *ImpersonationSession) error
+	GetImpersonationSessionByKey(ctx context.Context, sessionKey string) (*ImpersonationSession, error)
+	EndImpersonationSession(ctx context.Context, id int64) error
+	GetImpersonationSessions(ctx context.Context, filter ImpersonationFilter, limit, offset int) ([]*ImpersonationSession, int64, error)
+	CreateImpersonationAuditEntry(ctx context.Context, entry *ImpersonationAuditEntry) error
+	GetImpersonationAuditLog(ctx context.Context, impersonationID int64, limit, offset int) ([]*ImpersonationAuditEntry, int64, error)
+
+	// External identity operations
+	CreateOAuthState(ctx context.Context, state *OAuthState) error
+	ConsumeOAuthState(ctx context.Context, stateHash, provider string) (*OAuthState, error)
+	GetIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *UserIdentity) error
+	UpdateIdentityLogin(ctx context.Context, identityID int64, email *string) error
+	GetUserIdentities(ctx context.Context, userID int64) ([]*UserIdentity, error)
+
+	// Passkey operations
+	CreateWebAuthnChallenge(ctx context.Context, challenge *WebAuthnChallenge) error
+	ConsumeWebAuthnChallenge(ctx context.Context, challengeHash, purpose string) (*WebAuthnChallenge, error)
+	CreatePasskey(ctx context.Context, passkey *Passkey) error
+	GetPasskeyByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error)
+	GetUserPasskeys(ctx context.Context, userID int64) ([]*Passkey, error)
+	UpdatePasskeyUsage(ctx context.Context, passkeyID int64, signCount int64) error
+	RenamePasskey(ctx context.Context, passkeyID, userID int64, name string) (bool, error)
+	DeletePasskey(ctx context.Context, passkeyID, userID int64) (bool, error)
+
+	// Personal access token operations
+	CreatePersonalAccessToken(ctx context.Context, token *PersonalAccessToken) error
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+	GetUserPersonalAccessTokens(ctx context.Context, userID int64) ([]*PersonalAccessToken, error)
+	CountActivePersonalAccessTokens(ctx context.Context, userID int64) (int, error)
+	UpdatePersonalAccessTokenLastUsed(ctx context.Context, tokenID int64) error
+	RevokePersonalAccessToken(ctx context.Context, tokenID, userID int64) (bool, error)
+	RevokeAllPersonalAccessTokens(ctx context.Context, userID int64) error
+
+	// Invite and referral operations
+	CreateUserWithInvite(ctx context.Context, user *User, code string) error
+	CreateInvite(ctx context.Context, invite *Invite) error
+	GetInviteByCode(ctx context.Context, code string) (*Invite, error)
+	GetUserInvites(ctx context.Context, userID int64) ([]*Invite, error)
+	GetInvites(ctx context.Context, filter InviteFilter, limit, offset int) ([]*Invite, int64, error)
+	CountActiveInvites(ctx context.Context, userID int64) (int, error)
+	RevokeInvite(ctx context.Context, inviteID, userID int64) (bool, error)
+	GetReferrals(ctx context.Context, inviterID int64, limit, offset int) ([]*ReferredUser, int64, error)
+	GetReferralTree(ctx context.Context, userID int64, maxDepth, limit int) ([]*ReferredUser, error)
+	GetReferralStats(ctx context.Context, userID int64) (*ReferralStats, error)
+
 	// Existence checks
 	EmailExists(ctx context.Context, email string) (bool, error)
 	UsernameExists(ctx context.Context, username string) (bool, error)
+	PhoneExists(ctx context.Context, phone string, excludeUserID int64) (bool, error)
 }
 
 // PostgresRepository implements Repository for PostgreSQL
@@ -58,13 +221,24 @@ func NewPostgresRepository(db *sqlx.DB) Repository {
 
 // CreateUser creates a new user
 func (r *PostgresRepository) CreateUser(ctx context.Context, user *User) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	user.TenantID = tenantID
+
+	return insertUser(ctx, r.db, user)
+}
+
+// insertUser inserts a user whose tenant is already set, inside or outside a transaction
+func insertUser(ctx context.Context, q sqlx.QueryerContext, user *User) error {
 	query := `
-		INSERT INTO users (email, username, password_hash, phone)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (tenant_id, email, username, password_hash, phone)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, is_verified, email_verified, phone_verified, account_status, is_online, last_seen, created_at, updated_at`
 
-	return r.db.QueryRowxContext(ctx, query,
-		user.Email, user.Username, user.PasswordHash, user.Phone,
+	return q.QueryRowxContext(ctx, query,
+		user.TenantID, user.Email, user.Username, user.PasswordHash, user.Phone,
 	).Scan(
 		&user.ID, &user.IsVerified, &user.EmailVerified, &user.PhoneVerified,
 		&user.AccountStatus, &user.IsOnline, &user.LastSeen, &user.CreatedAt, &user.UpdatedAt,
@@ -73,13 +247,18 @@ func (r *PostgresRepository) CreateUser(ctx context.Context, user *User) error {
 
 // GetUserByID retrieves a user by ID
 func (r *PostgresRepository) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &User{}
 	query := `
-		SELECT id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
+		SELECT id, tenant_id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
 		       display_name, profile_picture, bio, account_status, is_online, last_seen, created_at, updated_at
-		FROM users WHERE id = $1`
+		FROM users WHERE id = $1 AND tenant_id = $2`
 
-	err := r.db.GetContext(ctx, user, query, id)
+	err = r.db.GetContext(ctx, user, query, id, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -88,16 +267,21 @@ func (r *PostgresRepository) GetUserByID(ctx context.Context, id int64) (*User,
 
 // GetUserWithStats retrieves a user by ID with their profile stats
 func (r *PostgresRepository) GetUserWithStats(ctx context.Context, id int64) (*UserWithStats, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &UserWithStats{}
-	
+
 	// First get user data
 	userQuery := `
 		SELECT id, email, username, password_hash, phone, is_verified, 
 			   email_verified, phone_verified, display_name, profile_picture, 
 			   bio, account_status, is_online, last_seen, created_at, updated_at
-		FROM users WHERE id = $1`
-	
-	err := r.db.QueryRowxContext(ctx, userQuery, id).Scan(
+		FROM users WHERE id = $1 AND tenant_id = $2`
+
+	err = r.db.QueryRowxContext(ctx, userQuery, id, tenantID).Scan(
 		&user.ID, &user.Email, &user.Username, &user.PasswordHash, &user.Phone,
 		&user.IsVerified, &user.EmailVerified, &user.PhoneVerified,
 		&user.DisplayName, &user.ProfilePicture, &user.Bio, &user.AccountStatus,
@@ -109,7 +293,7 @@ func (r *PostgresRepository) GetUserWithStats(ctx context.Context, id int64) (*U
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Get posts count
 	var postsCount int64
 	err = r.db.GetContext(ctx, &postsCount, `SELECT COUNT(*) FROM posts WHERE user_id = $1 AND deleted_at IS NULL`, id)
@@ -117,7 +301,7 @@ func (r *PostgresRepository) GetUserWithStats(ctx context.Context, id int64) (*U
 		postsCount = 0
 	}
 	user.PostsCount = postsCount
-	
+
 	// Get followers count
 	var followersCount int64
 	err = r.db.GetContext(ctx, &followersCount, `SELECT COUNT(*) FROM follows WHERE following_id = $1`, id)
@@ -125,7 +309,7 @@ func (r *PostgresRepository) GetUserWithStats(ctx context.Context, id int64) (*U
 		followersCount = 0
 	}
 	user.FollowersCount = followersCount
-	
+
 	// Get following count
 	var followingCount int64
 	err = r.db.GetContext(ctx, &followingCount, `SELECT COUNT(*) FROM follows WHERE follower_id = $1`, id)
@@ -133,19 +317,24 @@ func (r *PostgresRepository) GetUserWithStats(ctx context.Context, id int64) (*U
 		followingCount = 0
 	}
 	user.FollowingCount = followingCount
-	
+
 	return user, nil
 }
 
 // GetUserByEmail retrieves a user by email
 func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &User{}
 	query := `
-		SELECT id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
+		SELECT id, tenant_id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
 		       display_name, profile_picture, account_status, is_online, last_seen, created_at, updated_at
-		FROM users WHERE LOWER(email) = LOWER($1)`
+		FROM users WHERE LOWER(email) = LOWER($1) AND tenant_id = $2`
 
-	err := r.db.GetContext(ctx, user, query, email)
+	err = r.db.GetContext(ctx, user, query, email, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -154,28 +343,56 @@ func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (
 
 // GetUserByUsername retrieves a user by username
 func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &User{}
 	query := `
-		SELECT id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
+		SELECT id, tenant_id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
 		       display_name, profile_picture, account_status, is_online, last_seen, created_at, updated_at
-		FROM users WHERE LOWER(username) = LOWER($1)`
+		FROM users WHERE LOWER(username) = LOWER($1) AND tenant_id = $2`
 
-	err := r.db.GetContext(ctx, user, query, username)
+	err = r.db.GetContext(ctx, user, query, username, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
 	return user, err
 }
 
-// GetUserByIdentifier retrieves a user by email or username
+// GetUserByIdentifier retrieves a user by email, username or verified phone
+// number. The identifier's form decides which one it is, so an all-digit
+// username can never match someone else's phone: it is an email if it
+// contains "@", a phone number in E.164 form if it starts with "+", and a
+// username otherwise.
 func (r *PostgresRepository) GetUserByIdentifier(ctx context.Context, identifier string) (*User, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var match string
+	switch {
+	case strings.Contains(identifier, "@"):
+		match = `LOWER(email) = LOWER($1)`
+	case strings.HasPrefix(identifier, "+"):
+		if !common.ValidatePhone(identifier) {
+			return nil, ErrUserNotFound
+		}
+		match = `phone = $1 AND phone_verified = TRUE`
+	default:
+		match = `LOWER(username) = LOWER($1)`
+	}
+
 	user := &User{}
 	query := `
-		SELECT id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
+		SELECT id, tenant_id, email, username, password_hash, phone, is_verified, email_verified, phone_verified,
 		       display_name, profile_picture, account_status, is_online, last_seen, created_at, updated_at
-		FROM users WHERE LOWER(email) = LOWER($1) OR LOWER(username) = LOWER($1)`
+		FROM users
+		WHERE tenant_id = $2 AND ` + match
 
-	err := r.db.GetContext(ctx, user, query, identifier)
+	err = r.db.GetContext(ctx, user, query, identifier, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -197,11 +414,37 @@ func (r *PostgresRepository) UpdateUser(ctx context.Context, user *User) error {
 
 // UpdatePassword updates user password
 func (r *PostgresRepository) UpdatePassword(ctx context.Context, userID int64, passwordHash string) error {
-	query := `UPDATE users SET password_hash = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	query := `UPDATE users SET password_hash = $2, password_reset_required = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, userID, passwordHash)
 	return err
 }
 
+// RehashPassword replaces a password hash with a stronger hash of the same
+// password. It does nothing if the stored hash is no longer oldHash.
+func (r *PostgresRepository) RehashPassword(ctx context.Context, userID int64, oldHash, newHash string) error {
+	query := `UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2`
+	_, err := r.db.ExecContext(ctx, query, userID, oldHash, newHash)
+	return err
+}
+
+// UpdateEmail changes a user's email address unless another account uses it
+func (r *PostgresRepository) UpdateEmail(ctx context.Context, userID int64, email string, verified bool) error {
+	query := `
+		UPDATE users SET email = $2, email_verified = $3, is_verified = (is_verified OR $3), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND NOT EXISTS(
+			SELECT 1 FROM users u WHERE u.tenant_id = users.tenant_id AND LOWER(u.email) = LOWER($2) AND u.id <> $1
+		)`
+	result, err := r.db.ExecContext(ctx, query, userID, email, verified)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrEmailExists
+	}
+	return nil
+}
+
 // UpdateVerificationStatus updates verification status
 func (r *PostgresRepository) UpdateVerificationStatus(ctx context.Context, userID int64, field string, status bool) error {
 	var query string
@@ -224,15 +467,111 @@ func (r *PostgresRepository) UpdateOnlineStatus(ctx context.Context, userID int6
 	return err
 }
 
+// DeactivateUser hides an account by moving it to an inactive status
+func (r *PostgresRepository) DeactivateUser(ctx context.Context, userID int64, status string, deletionScheduledAt *time.Time) error {
+	query := `
+		UPDATE users SET account_status = $2, deactivated_at = CURRENT_TIMESTAMP,
+			deletion_scheduled_at = $3, is_online = FALSE
+		WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, userID, status, deletionScheduledAt)
+	return err
+}
+
+// ReactivateUser restores a deactivated account or cancels a pending deletion.
+// It returns false if the account was in neither state.
+func (r *PostgresRepository) ReactivateUser(ctx context.Context, userID int64) (bool, error) {
+	query := `
+		UPDATE users SET account_status = 'active', deactivated_at = NULL, deletion_scheduled_at = NULL
+		WHERE id = $1 AND account_status IN ('deactivated', 'pending_deletion')`
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// GetUsersDueForDeletion lists accounts of every tenant whose deletion grace
+// period has ended, including deletions that were started but not finished.
+// Only ID and TenantID are loaded.
+func (r *PostgresRepository) GetUsersDueForDeletion(ctx context.Context, limit int) ([]*User, error) {
+	var users []*User
+	query := `
+		SELECT id, tenant_id FROM users
+		WHERE account_status IN ('pending_deletion', 'deleted') AND deletion_scheduled_at <= CURRENT_TIMESTAMP
+		ORDER BY deletion_scheduled_at
+		LIMIT $1`
+	err := r.db.SelectContext(ctx, &users, query, limit)
+	return users, err
+}
+
+// MarkUserDeleted moves a due account to 'deleted' so it can no longer log in
+// while its data is erased. It reports false if the deletion was cancelled.
+func (r *PostgresRepository) MarkUserDeleted(ctx context.Context, userID int64) (bool, error) {
+	query := `
+		UPDATE users SET account_status = 'deleted', is_online = FALSE
+		WHERE id = $1 AND account_status IN ('pending_deletion', 'deleted')
+			AND deletion_scheduled_at <= CURRENT_TIMESTAMP`
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// AnonymizeUser removes a deleted account's credentials and personal data,
+// leaving an anonymous row so other users' conversations stay consistent
+func (r *PostgresRepository) AnonymizeUser(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{
+		"sessions", "otps", "user_identities", "recovery_codes", "user_two_factor",
+		"login_history", "user_roles", "webauthn_credentials", "webauthn_challenges",
+		"personal_access_tokens", "user_devices",
+	} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_throttles WHERE throttle_key = $1`, fmt.Sprintf("user:%d", userID)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE invite_codes SET revoked_at = CURRENT_TIMESTAMP WHERE created_by = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE users SET
+			email = 'deleted-' || id || '@deleted.invalid', username = 'deleted_' || id,
+			password_hash = '!', phone = NULL,
+			is_verified = FALSE, email_verified = FALSE, phone_verified = FALSE, is_profile_complete = FALSE,
+			display_name = NULL, profile_picture = NULL, cover_photo = NULL, bio = NULL,
+			date_of_birth = NULL, gender = NULL, location = NULL, latitude = NULL, longitude = NULL,
+			interests = NULL, education = NULL, work = NULL, website = NULL,
+			instagram = NULL, twitter = NULL, tiktok = NULL,
+			is_online = FALSE, password_reset_required = FALSE, account_status = 'deleted', deletion_scheduled_at = NULL
+		WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // CreateSession creates a new session
 func (r *PostgresRepository) CreateSession(ctx context.Context, session *Session) error {
 	query := `
-		INSERT INTO sessions (user_id, token_hash, refresh_token_hash, device_info, ip_address, user_agent, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO sessions (user_id, token_hash, refresh_token_hash, session_key, family_id, device_info, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, is_active, created_at, last_used_at`
 
 	return r.db.QueryRowxContext(ctx, query,
-		session.UserID, session.TokenHash, session.RefreshTokenHash,
+		session.UserID, session.TokenHash, session.RefreshTokenHash, session.SessionKey, session.FamilyID,
 		session.DeviceInfo, session.IPAddress, session.UserAgent, session.ExpiresAt,
 	).Scan(&session.ID, &session.IsActive, &session.CreatedAt, &session.LastUsedAt)
 }
@@ -252,13 +591,14 @@ func (r *PostgresRepository) GetSessionByToken(ctx context.Context, tokenHash st
 	return session, err
 }
 
-// GetSessionByRefreshToken retrieves a session by refresh token hash
+// GetSessionByRefreshToken retrieves a session by refresh token hash.
+// Inactive sessions are returned too so callers can detect refresh token reuse.
 func (r *PostgresRepository) GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (*Session, error) {
 	session := &Session{}
 	query := `
-		SELECT id, user_id, token_hash, refresh_token_hash, device_info, ip_address, user_agent,
+		SELECT id, user_id, token_hash, refresh_token_hash, session_key, family_id, rotated_at, device_info, ip_address, user_agent,
 		       is_active, expires_at, created_at, last_used_at
-		FROM sessions WHERE refresh_token_hash = $1 AND is_active = TRUE`
+		FROM sessions WHERE refresh_token_hash = $1`
 
 	err := r.db.GetContext(ctx, session, query, refreshTokenHash)
 	if err == sql.ErrNoRows {
@@ -267,11 +607,26 @@ func (r *PostgresRepository) GetSessionByRefreshToken(ctx context.Context, refre
 	return session, err
 }
 
+// GetSessionByKey retrieves an active, unexpired session by session key
+func (r *PostgresRepository) GetSessionByKey(ctx context.Context, sessionKey string) (*Session, error) {
+	session := &Session{}
+	query := `
+		SELECT id, user_id, session_key, family_id, device_info, ip_address, user_agent,
+		       is_active, expires_at, created_at, last_used_at
+		FROM sessions WHERE session_key = $1 AND is_active = TRUE AND expires_at > CURRENT_TIMESTAMP`
+
+	err := r.db.GetContext(ctx, session, query, sessionKey)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	return session, err
+}
+
 // GetUserSessions retrieves all active sessions for a user
 func (r *PostgresRepository) GetUserSessions(ctx context.Context, userID int64) ([]*Session, error) {
 	var sessions []*Session
 	query := `
-		SELECT id, user_id, device_info, ip_address, user_agent, is_active, expires_at, created_at, last_used_at
+		SELECT id, user_id, session_key, device_info, ip_address, user_agent, is_active, expires_at, created_at, last_used_at
 		FROM sessions WHERE user_id = $1 AND is_active = TRUE
 		ORDER BY last_used_at DESC`
 
@@ -300,6 +655,25 @@ func (r *PostgresRepository) InvalidateAllUserSessions(ctx context.Context, user
 	return err
 }
 
+// RotateSession retires a session whose refresh token was exchanged.
+// It returns false if the session was already inactive.
+func (r *PostgresRepository) RotateSession(ctx context.Context, sessionID int64) (bool, error) {
+	query := `UPDATE sessions SET is_active = FALSE, rotated_at = CURRENT_TIMESTAMP WHERE id = $1 AND is_active = TRUE`
+	result, err := r.db.ExecContext(ctx, query, sessionID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// InvalidateSessionFamily invalidates every session descended from the same login
+func (r *PostgresRepository) InvalidateSessionFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE sessions SET is_active = FALSE WHERE family_id = $1`
+	_, err := r.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
 // CleanupExpiredSessions removes expired sessions
 func (r *PostgresRepository) CleanupExpiredSessions(ctx context.Context) error {
 	query := `DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP OR is_active = FALSE`
@@ -307,18 +681,1106 @@ func (r *PostgresRepository) CleanupExpiredSessions(ctx context.Context) error {
 	return err
 }
 
-// EmailExists checks if email is already registered
-func (r *PostgresRepository) EmailExists(ctx context.Context, email string) (bool, error) {
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`
-	err := r.db.GetContext(ctx, &exists, query, email)
-	return exists, err
+// TouchUserDevice records a login from a device and reports whether the device is new
+func (r *PostgresRepository) TouchUserDevice(ctx context.Context, device *UserDevice) (bool, error) {
+	var inserted bool
+	query := `
+		INSERT INTO user_devices (user_id, fingerprint, browser, os, device_type, last_ip)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE
+			SET last_seen_at = CURRENT_TIMESTAMP, last_ip = EXCLUDED.last_ip
+		RETURNING id, first_seen_at, last_seen_at, (xmax = 0) AS inserted`
+	err := r.db.QueryRowxContext(ctx, query,
+		device.UserID, device.Fingerprint, device.Browser, device.OS, device.DeviceType, device.LastIP,
+	).Scan(&device.ID, &device.FirstSeenAt, &device.LastSeenAt, &inserted)
+	return inserted, err
 }
 
-// UsernameExists checks if username is already taken
-func (r *PostgresRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+// CountUserDevices counts the devices a user has logged in from
+func (r *PostgresRepository) CountUserDevices(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM user_devices WHERE user_id = $1`, userID)
+	return count, err
+}
+
+// GetUserDevices lists the devices a user has logged in from, most recent first
+func (r *PostgresRepository) GetUserDevices(ctx context.Context, userID int64) ([]*UserDevice, error) {
+	devices := []*UserDevice{}
+	query := `
+		SELECT id, user_id, fingerprint, browser, os, device_type, last_ip, first_seen_at, last_seen_at
+		FROM user_devices WHERE user_id = $1
+		ORDER BY last_seen_at DESC`
+	err := r.db.SelectContext(ctx, &devices, query, userID)
+	return devices, err
+}
+
+// SetPasswordResetRequired sets whether password logins are refused until a reset
+func (r *PostgresRepository) SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET password_reset_required = $2 WHERE id = $1`, userID, required)
+	return err
+}
+
+// IsPasswordResetRequired reports whether the user must reset their password before logging in with it
+func (r *PostgresRepository) IsPasswordResetRequired(ctx context.Context, userID int64) (bool, error) {
+	var required bool
+	err := r.db.GetContext(ctx, &required,
+		`SELECT COALESCE(password_reset_required, FALSE) FROM users WHERE id = $1`, userID)
+	if err == sql.ErrNoRows {
+		return false, ErrUserNotFound
+	}
+	return required, err
+}
+
+// CreateOTP stores a new one-time code
+func (r *PostgresRepository) CreateOTP(ctx context.Context, otp *OTP) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO otps (tenant_id, user_id, identifier, identifier_type, code, purpose, max_attempts, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, attempts, is_used, created_at`
+
+	return r.db.QueryRowxContext(ctx, query,
+		tenantID, otp.UserID, otp.Identifier, otp.IdentifierType, otp.Code, otp.Purpose, otp.MaxAttempts, otp.ExpiresAt,
+	).Scan(&otp.ID, &otp.Attempts, &otp.IsUsed, &otp.CreatedAt)
+}
+
+// GetLatestOTP retrieves the most recent unused code for an identifier and purpose
+func (r *PostgresRepository) GetLatestOTP(ctx context.Context, identifier, identifierType, purpose string) (*OTP, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	otp := &OTP{}
+	query := `
+		SELECT id, user_id, identifier, identifier_type, code, purpose, attempts, max_attempts,
+		       is_used, expires_at, created_at
+		FROM otps
+		WHERE tenant_id = $4 AND LOWER(identifier) = LOWER($1) AND identifier_type = $2 AND purpose = $3 AND is_used = FALSE
+		ORDER BY created_at DESC
+		LIMIT 1`
+
+	err = r.db.GetContext(ctx, otp, query, identifier, identifierType, purpose, tenantID)
+	if err == sql.ErrNoRows {
+		return nil, ErrOTPNotFound
+	}
+	return otp, err
+}
+
+// ClaimOTPAttempt counts a verification attempt if the code has attempts
+// left, returning the new count. It reports false once the cap is reached.
+func (r *PostgresRepository) ClaimOTPAttempt(ctx context.Context, otpID int64) (int, bool, error) {
+	var attempts int
+	query := `UPDATE otps SET attempts = attempts + 1 WHERE id = $1 AND attempts < max_attempts RETURNING attempts`
+	err := r.db.GetContext(ctx, &attempts, query, otpID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return attempts, true, nil
+}
+
+// ConsumeOTP marks an unused OTP as used, reporting whether this call consumed it
+func (r *PostgresRepository) ConsumeOTP(ctx context.Context, otpID int64) (bool, error) {
+	query := `UPDATE otps SET is_used = TRUE WHERE id = $1 AND is_used = FALSE`
+	result, err := r.db.ExecContext(ctx, query, otpID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// InvalidateOTPs marks all outstanding codes for an identifier and purpose as used
+func (r *PostgresRepository) InvalidateOTPs(ctx context.Context, identifier, identifierType, purpose string) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE otps SET is_used = TRUE
+		WHERE tenant_id = $4 AND LOWER(identifier) = LOWER($1) AND identifier_type = $2 AND purpose = $3 AND is_used = FALSE`
+	_, err = r.db.ExecContext(ctx, query, identifier, identifierType, purpose, tenantID)
+	return err
+}
+
+// CountRecentUserOTPs counts codes issued to a user for a purpose since a point in time
+func (r *PostgresRepository) CountRecentUserOTPs(ctx context.Context, userID int64, purpose string, since time.Time) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM otps WHERE user_id = $1 AND purpose = $2 AND created_at > $3`
+	err := r.db.GetContext(ctx, &count, query, userID, purpose, since)
+	return count, err
+}
+
+// CountRecentOTPs counts codes issued for an identifier and purpose since a point in time
+func (r *PostgresRepository) CountRecentOTPs(ctx context.Context, identifier, identifierType, purpose string, since time.Time) (int, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	query := `
+		SELECT COUNT(*) FROM otps
+		WHERE tenant_id = $5 AND LOWER(identifier) = LOWER($1) AND identifier_type = $2 AND purpose = $3 AND created_at > $4`
+	err = r.db.GetContext(ctx, &count, query, identifier, identifierType, purpose, since, tenantID)
+	return count, err
+}
+
+// GetTwoFactor retrieves a user's TOTP enrollment
+func (r *PostgresRepository) GetTwoFactor(ctx context.Context, userID int64) (*TwoFactor, error) {
+	tf := &TwoFactor{}
+	query := `
+		SELECT user_id, secret, is_enabled, last_used_step, enabled_at, created_at, updated_at
+		FROM user_two_factor WHERE user_id = $1`
+
+	err := r.db.GetContext(ctx, tf, query, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrTwoFactorNotFound
+	}
+	return tf, err
+}
+
+// SaveTwoFactorSecret stores a new, not yet enabled, TOTP secret
+func (r *PostgresRepository) SaveTwoFactorSecret(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_two_factor (user_id, secret, is_enabled, last_used_step)
+		VALUES ($1, $2, FALSE, 0)
+		ON CONFLICT (user_id) DO UPDATE SET secret = $2, is_enabled = FALSE, last_used_step = 0, enabled_at = NULL`
+	_, err := r.db.ExecContext(ctx, query, userID, secret)
+	return err
+}
+
+// EnableTwoFactor marks a user's TOTP enrollment as confirmed
+func (r *PostgresRepository) EnableTwoFactor(ctx context.Context, userID int64, step int64) error {
+	query := `
+		UPDATE user_two_factor SET is_enabled = TRUE, last_used_step = $2, enabled_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1`
+	_, err := r.db.ExecContext(ctx, query, userID, step)
+	return err
+}
+
+// DisableTwoFactor removes a user's TOTP enrollment and recovery codes
+func (r *PostgresRepository) DisableTwoFactor(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_two_factor WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateTwoFactorStep records the last accepted TOTP step.
+// It returns false if the step was already used (replay).
+func (r *PostgresRepository) UpdateTwoFactorStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	query := `UPDATE user_two_factor SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// ReplaceRecoveryCodes swaps all of a user's recovery codes for new ones
+func (r *PostgresRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode consumes an unused recovery code, reporting whether one matched
+func (r *PostgresRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// CountRecoveryCodes counts a user's unused recovery codes
+func (r *PostgresRepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.db.GetContext(ctx, &count, query, userID)
+	return count, err
+}
+
+// GetLoginThrottle retrieves the failure counter for a throttle key
+func (r *PostgresRepository) GetLoginThrottle(ctx context.Context, key string) (*LoginThrottle, error) {
+	throttle := &LoginThrottle{}
+	query := `
+		SELECT throttle_key, failed_count, last_failed_at, locked_until
+		FROM login_throttles WHERE throttle_key = $1`
+
+	err := r.db.GetContext(ctx, throttle, query, key)
+	if err == sql.ErrNoRows {
+		return nil, ErrLoginThrottleNotFound
+	}
+	return throttle, err
+}
+
+// RecordLoginFailure increments the failure counter, restarting it if the
+// previous failure happened before windowStart
+func (r *PostgresRepository) RecordLoginFailure(ctx context.Context, key string, windowStart time.Time) (*LoginThrottle, error) {
+	throttle := &LoginThrottle{}
+	query := `
+		INSERT INTO login_throttles (throttle_key, failed_count, last_failed_at)
+		VALUES ($1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failed_count = CASE WHEN login_throttles.last_failed_at < $2 THEN 1 ELSE login_throttles.failed_count + 1 END,
+			last_failed_at = CURRENT_TIMESTAMP
+		RETURNING throttle_key, failed_count, last_failed_at, locked_until`
+
+	err := r.db.GetContext(ctx, throttle, query, key, windowStart)
+	return throttle, err
+}
+
+// LockLoginThrottle blocks logins for a throttle key until the given time
+func (r *PostgresRepository) LockLoginThrottle(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = $2 WHERE throttle_key = $1`
+	_, err := r.db.ExecContext(ctx, query, key, until)
+	return err
+}
+
+// ClearLoginThrottle resets the failure counter and any lock
+func (r *PostgresRepository) ClearLoginThrottle(ctx context.Context, key string) error {
+	query := `DELETE FROM login_throttles WHERE throttle_key = $1`
+	_, err := r.db.ExecContext(ctx, query, key)
+	return err
+}
+
+// RecordLoginAttempt appends an entry to the login history
+func (r *PostgresRepository) RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	query := `
+		INSERT INTO login_history (user_id, identifier, ip_address, user_agent, success, failure_reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowxContext(ctx, query,
+		attempt.UserID, attempt.Identifier, attempt.IPAddress, attempt.UserAgent, attempt.Success, attempt.FailureReason,
+	).Scan(&attempt.ID, &attempt.CreatedAt)
+}
+
+// GetLoginHistory lists a user's login attempts, newest first
+func (r *PostgresRepository) GetLoginHistory(ctx context.Context, userID int64, limit, offset int) ([]*LoginAttempt, int64, error) {
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM login_history WHERE user_id = $1`
+	if err := r.db.GetContext(ctx, &total, countQuery, userID); err != nil {
+		return nil, 0, err
+	}
+
+	var attempts []*LoginAttempt
+	query := `
+		SELECT id, user_id, identifier, ip_address, user_agent, success, failure_reason, created_at
+		FROM login_history WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`
+
+	err := r.db.SelectContext(ctx, &attempts, query, userID, limit, offset)
+	return attempts, total, err
+}
+
+// GetRoles lists all roles
+func (r *PostgresRepository) GetRoles(ctx context.Context) ([]*Role, error) {
+	var roles []*Role
+	query := `SELECT id, name, description, created_at FROM roles ORDER BY name`
+	err := r.db.SelectContext(ctx, &roles, query)
+	return roles, err
+}
+
+// GetRoleByName retrieves a role by name
+func (r *PostgresRepository) GetRoleByName(ctx context.Context, name string) (*Role, error) {
+	role := &Role{}
+	query := `SELECT id, name, description, created_at FROM roles WHERE name = $1`
+	err := r.db.GetContext(ctx, role, query, name)
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+// GetRolePermissions maps every role name to its permission names
+func (r *PostgresRepository) GetRolePermissions(ctx context.Context) (map[string][]string, error) {
+	var rows []struct {
+		Role       string `db:"role"`
+		Permission string `db:"permission"`
+	}
+	query := `
+		SELECT r.name AS role, p.name AS permission
+		FROM role_permissions rp
+		JOIN roles r ON r.id = rp.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.name, p.name`
+
+	if err := r.db.SelectContext(ctx, &rows, query); err != nil {
+		return nil, err
+	}
+
+	perms := make(map[string][]string)
+	for _, row := range rows {
+		perms[row.Role] = append(perms[row.Role], row.Permission)
+	}
+	return perms, nil
+}
+
+// GetUserRoles lists the roles granted to a user
+func (r *PostgresRepository) GetUserRoles(ctx context.Context, userID int64) ([]*UserRole, error) {
+	var roles []*UserRole
+	query := `
+		SELECT ur.user_id, r.name AS role, ur.granted_by, ur.granted_at
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY r.name`
+
+	err := r.db.SelectContext(ctx, &roles, query, userID)
+	return roles, err
+}
+
+// GetUserRoleNames lists the names of the roles granted to a user
+func (r *PostgresRepository) GetUserRoleNames(ctx context.Context, userID int64) ([]string, error) {
+	var names []string
+	query := `
+		SELECT r.name FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY r.name`
+
+	err := r.db.SelectContext(ctx, &names, query, userID)
+	return names, err
+}
+
+// GrantRole grants a role to a user; granting an existing role is a no-op
+func (r *PostgresRepository) GrantRole(ctx context.Context, userID, roleID int64, grantedBy *int64) error {
+	query := `
+		INSERT INTO user_roles (user_id, role_id, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role_id) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, userID, roleID, grantedBy)
+	return err
+}
+
+// RevokeRole removes a role from a user, reporting whether it was granted
+func (r *PostgresRepository) RevokeRole(ctx context.Context, userID, roleID int64) (bool, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role_id = $2
+			AND user_id IN (SELECT id FROM users WHERE tenant_id = $3)`
+	result, err := r.db.ExecContext(ctx, query, userID, roleID, tenantID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+const impersonationColumns = `id, admin_id, target_user_id, session_key, reason, ip_address, user_agent, expires_at, ended_at, created_at`
+
+// CreateImpersonationSession stores a new impersonation session
+func (r *PostgresRepository) CreateImpersonationSession(ctx context.Context, session *ImpersonationSession) error {
+	query := `
+		INSERT INTO impersonation_sessions (admin_id, target_user_id, session_key, reason, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+	return r.db.QueryRowxContext(ctx, query,
+		session.AdminID, session.TargetUserID, session.SessionKey, session.Reason,
+		session.IPAddress, session.UserAgent, session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt)
+}
+
+// GetImpersonationSessionByKey retrieves an impersonation session by its session key
+func (r *PostgresRepository) GetImpersonationSessionByKey(ctx context.Context, sessionKey string) (*ImpersonationSession, error) {
+	session := &ImpersonationSession{}
+	query := `SELECT ` + impersonationColumns + ` FROM impersonation_sessions WHERE session_key = $1`
+	err := r.db.GetContext(ctx, session, query, sessionKey)
+	if err == sql.ErrNoRows {
+		return nil, ErrImpersonationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// EndImpersonationSession marks an impersonation session as ended
+func (r *PostgresRepository) EndImpersonationSession(ctx context.Context, id int64) error {
+	query := `UPDATE impersonation_sessions SET ended_at = CURRENT_TIMESTAMP WHERE id = $1 AND ended_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// GetImpersonationSessions lists impersonation sessions, newest first
+func (r *PostgresRepository) GetImpersonationSessions(ctx context.Context, filter ImpersonationFilter, limit, offset int) ([]*ImpersonationSession, int64, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := `WHERE ($1 = 0 OR admin_id = $1) AND ($2 = 0 OR target_user_id = $2)
+		AND target_user_id IN (SELECT id FROM users WHERE tenant_id = $3)`
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM impersonation_sessions ` + where
+	if err := r.db.GetContext(ctx, &total, countQuery, filter.AdminID, filter.TargetUserID, tenantID); err != nil {
+		return nil, 0, err
+	}
+
+	sessions := []*ImpersonationSession{}
+	query := `SELECT ` + impersonationColumns + ` FROM impersonation_sessions ` + where + `
+		ORDER BY created_at DESC
+		LIMIT $4 OFFSET $5`
+	err = r.db.SelectContext(ctx, &sessions, query, filter.AdminID, filter.TargetUserID, tenantID, limit, offset)
+	return sessions, total, err
+}
+
+// CreateImpersonationAuditEntry records a request made while impersonating
+func (r *PostgresRepository) CreateImpersonationAuditEntry(ctx context.Context, entry *ImpersonationAuditEntry) error {
+	query := `
+		INSERT INTO impersonation_audit_log (impersonation_id, admin_id, target_user_id, method, path, status_code, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+	return r.db.QueryRowxContext(ctx, query,
+		entry.ImpersonationID, entry.AdminID, entry.TargetUserID, entry.Method, entry.Path, entry.StatusCode, entry.IPAddress,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetImpersonationAuditLog lists the requests made in an impersonation session, oldest first
+func (r *PostgresRepository) GetImpersonationAuditLog(ctx context.Context, impersonationID int64, limit, offset int) ([]*ImpersonationAuditEntry, int64, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := `WHERE impersonation_id = $1
+		AND target_user_id IN (SELECT id FROM users WHERE tenant_id = $2)`
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM impersonation_audit_log ` + where
+	if err := r.db.GetContext(ctx, &total, countQuery, impersonationID, tenantID); err != nil {
+		return nil, 0, err
+	}
+
+	entries := []*ImpersonationAuditEntry{}
+	query := `
+		SELECT id, impersonation_id, admin_id, target_user_id, method, path, status_code, ip_address, created_at
+		FROM impersonation_audit_log ` + where + `
+		ORDER BY created_at, id
+		LIMIT $3 OFFSET $4`
+	err = r.db.SelectContext(ctx, &entries, query, impersonationID, tenantID, limit, offset)
+	return entries, total, err
+}
+
+// CreateOAuthState stores a pending authorization request and prunes expired ones
+func (r *PostgresRepository) CreateOAuthState(ctx context.Context, state *OAuthState) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oauth_states WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oauth_states (state_hash, provider, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`
+
+	return r.db.QueryRowxContext(ctx, query,
+		state.StateHash, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt,
+	).Scan(&state.CreatedAt)
+}
+
+// ConsumeOAuthState deletes and returns an unexpired pending authorization request
+func (r *PostgresRepository) ConsumeOAuthState(ctx context.Context, stateHash, provider string) (*OAuthState, error) {
+	state := &OAuthState{}
+	query := `
+		DELETE FROM oauth_states
+		WHERE state_hash = $1 AND provider = $2 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING state_hash, provider, code_verifier, nonce, expires_at, created_at`
+
+	err := r.db.GetContext(ctx, state, query, stateHash, provider)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidOAuthState
+	}
+	return state, err
+}
+
+// GetIdentity retrieves a linked identity by provider and subject
+func (r *PostgresRepository) GetIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &UserIdentity{}
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities WHERE tenant_id = $3 AND provider = $1 AND subject = $2`
+
+	err = r.db.GetContext(ctx, identity, query, provider, subject, tenantID)
+	if err == sql.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	return identity, err
+}
+
+// CreateIdentity links an external identity to a user
+func (r *PostgresRepository) CreateIdentity(ctx context.Context, identity *UserIdentity) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_identities (tenant_id, user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, last_login_at`
+
+	return r.db.QueryRowxContext(ctx, query,
+		tenantID, identity.UserID, identity.Provider, identity.Subject, identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+}
+
+// UpdateIdentityLogin records a sign-in and refreshes the provider email
+func (r *PostgresRepository) UpdateIdentityLogin(ctx context.Context, identityID int64, email *string) error {
+	query := `UPDATE user_identities SET email = $2, last_login_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, identityID, email)
+	return err
+}
+
+// GetUserIdentities lists the identities linked to a user
+func (r *PostgresRepository) GetUserIdentities(ctx context.Context, userID int64) ([]*UserIdentity, error) {
+	var identities []*UserIdentity
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = $1
+		ORDER BY created_at`
+
+	err := r.db.SelectContext(ctx, &identities, query, userID)
+	return identities, err
+}
+
+// CreateWebAuthnChallenge stores a pending passkey ceremony and prunes expired ones
+func (r *PostgresRepository) CreateWebAuthnChallenge(ctx context.Context, challenge *WebAuthnChallenge) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webauthn_challenges (challenge_hash, user_id, purpose, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at`
+
+	return r.db.QueryRowxContext(ctx, query,
+		challenge.ChallengeHash, challenge.UserID, challenge.Purpose, challenge.ExpiresAt,
+	).Scan(&challenge.CreatedAt)
+}
+
+// ConsumeWebAuthnChallenge deletes and returns an unexpired pending ceremony
+func (r *PostgresRepository) ConsumeWebAuthnChallenge(ctx context.Context, challengeHash, purpose string) (*WebAuthnChallenge, error) {
+	challenge := &WebAuthnChallenge{}
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE challenge_hash = $1 AND purpose = $2 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING challenge_hash, user_id, purpose, expires_at, created_at`
+
+	err := r.db.GetContext(ctx, challenge, query, challengeHash, purpose)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+	return challenge, err
+}
+
+// CreatePasskey stores a verified WebAuthn credential
+func (r *PostgresRepository) CreatePasskey(ctx context.Context, passkey *Passkey) error {
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, aaguid, transports, name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (credential_id) DO NOTHING
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowxContext(ctx, query,
+		passkey.UserID, passkey.CredentialID, passkey.PublicKey, passkey.SignCount,
+		passkey.AAGUID, passkey.Transports, passkey.Name,
+	).Scan(&passkey.ID, &passkey.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrPasskeyExists
+	}
+	return err
+}
+
+// GetPasskeyByCredentialID retrieves a passkey by its authenticator credential ID
+func (r *PostgresRepository) GetPasskeyByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error) {
+	passkey := &Passkey{}
+	query := `
+		SELECT id, user_id, credential_id, public_key, sign_count, aaguid, transports, name, created_at, last_used_at
+		FROM webauthn_credentials WHERE credential_id = $1`
+
+	err := r.db.GetContext(ctx, passkey, query, credentialID)
+	if err == sql.ErrNoRows {
+		return nil, ErrPasskeyNotFound
+	}
+	return passkey, err
+}
+
+// GetUserPasskeys lists a user's passkeys
+func (r *PostgresRepository) GetUserPasskeys(ctx context.Context, userID int64) ([]*Passkey, error) {
+	var passkeys []*Passkey
+	query := `
+		SELECT id, user_id, credential_id, public_key, sign_count, aaguid, transports, name, created_at, last_used_at
+		FROM webauthn_credentials WHERE user_id = $1
+		ORDER BY created_at`
+
+	err := r.db.SelectContext(ctx, &passkeys, query, userID)
+	return passkeys, err
+}
+
+// UpdatePasskeyUsage stores the latest signature counter and use time
+func (r *PostgresRepository) UpdatePasskeyUsage(ctx context.Context, passkeyID int64, signCount int64) error {
+	query := `UPDATE webauthn_credentials SET sign_count = $2, last_used_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, passkeyID, signCount)
+	return err
+}
+
+// RenamePasskey renames a passkey owned by the user
+func (r *PostgresRepository) RenamePasskey(ctx context.Context, passkeyID, userID int64, name string) (bool, error) {
+	query := `UPDATE webauthn_credentials SET name = $3 WHERE id = $1 AND user_id = $2`
+	result, err := r.db.ExecContext(ctx, query, passkeyID, userID, name)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// DeletePasskey removes a passkey owned by the user
+func (r *PostgresRepository) DeletePasskey(ctx context.Context, passkeyID, userID int64) (bool, error) {
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+	result, err := r.db.ExecContext(ctx, query, passkeyID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// CreatePersonalAccessToken stores a new personal access token
+func (r *PostgresRepository) CreatePersonalAccessToken(ctx context.Context, token *PersonalAccessToken) error {
+	token.ScopeList = strings.Join(token.Scopes, ",")
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowxContext(ctx, query,
+		token.UserID, token.Name, token.TokenHash, token.TokenPrefix, token.ScopeList, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetPersonalAccessTokenByHash retrieves a token by its hash, including revoked
+// ones, with the tenant of the user it belongs to
+func (r *PostgresRepository) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	token := &PersonalAccessToken{}
+	query := `
+		SELECT t.id, t.user_id, u.tenant_id, t.name, t.token_hash, t.token_prefix, t.scopes,
+		       t.expires_at, t.last_used_at, t.revoked_at, t.created_at
+		FROM personal_access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1`
+
+	err := r.db.GetContext(ctx, token, query, tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.Scopes = splitScopes(token.ScopeList)
+	return token, nil
+}
+
+// GetUserPersonalAccessTokens lists a user's unrevoked tokens
+func (r *PostgresRepository) GetUserPersonalAccessTokens(ctx context.Context, userID int64) ([]*PersonalAccessToken, error) {
+	var tokens []*PersonalAccessToken
+	query := `
+		SELECT id, user_id, name, token_hash, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM personal_access_tokens WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`
+
+	if err := r.db.SelectContext(ctx, &tokens, query, userID); err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		t.Scopes = splitScopes(t.ScopeList)
+	}
+	return tokens, nil
+}
+
+// CountActivePersonalAccessTokens counts a user's unrevoked, unexpired tokens
+func (r *PostgresRepository) CountActivePersonalAccessTokens(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`
+	err := r.db.GetContext(ctx, &count, query, userID)
+	return count, err
+}
+
+// UpdatePersonalAccessTokenLastUsed records that a token was used
+func (r *PostgresRepository) UpdatePersonalAccessTokenLastUsed(ctx context.Context, tokenID int64) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, tokenID)
+	return err
+}
+
+// RevokePersonalAccessToken revokes a token owned by the user
+func (r *PostgresRepository) RevokePersonalAccessToken(ctx context.Context, tokenID, userID int64) (bool, error) {
+	query := `
+		UPDATE personal_access_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// RevokeAllPersonalAccessTokens revokes every token the user owns
+func (r *PostgresRepository) RevokeAllPersonalAccessTokens(ctx context.Context, userID int64) error {
+	query := `UPDATE personal_access_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+func splitScopes(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
+
+// CreateUserWithInvite redeems an invite code and registers the user it
+// invites in one transaction, recording the referral. The code is only
+// redeemed if it is unrevoked, unexpired and has uses left.
+func (r *PostgresRepository) CreateUserWithInvite(ctx context.Context, user *User, code string) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	user.TenantID = tenantID
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inviteID, inviterID int64
+	query := `
+		UPDATE invite_codes SET uses_count = uses_count + 1
+		WHERE tenant_id = $1 AND code = $2 AND revoked_at IS NULL
+			AND expires_at > CURRENT_TIMESTAMP AND uses_count < max_uses
+		RETURNING id, created_by`
+	err = tx.QueryRowxContext(ctx, query, tenantID, code).Scan(&inviteID, &inviterID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidInvite
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO referrals (tenant_id, invite_id, inviter_id, invitee_id)
+		VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, tenantID, inviteID, inviterID, user.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateInvite creates an invite code in the current tenant
+func (r *PostgresRepository) CreateInvite(ctx context.Context, invite *Invite) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	invite.TenantID = tenantID
+
+	query := `
+		INSERT INTO invite_codes (tenant_id, code, created_by, max_uses, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, uses_count, created_at`
+
+	return r.db.QueryRowxContext(ctx, query,
+		invite.TenantID, invite.Code, invite.CreatedBy, invite.MaxUses, invite.ExpiresAt,
+	).Scan(&invite.ID, &invite.UsesCount, &invite.CreatedAt)
+}
+
+const inviteColumns = `i.id, i.tenant_id, i.code, i.created_by, i.max_uses, i.uses_count, i.expires_at, i.revoked_at, i.created_at`
+
+// GetInviteByCode retrieves an invite by its code, including unusable ones,
+// with its creator's username
+func (r *PostgresRepository) GetInviteByCode(ctx context.Context, code string) (*Invite, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &Invite{}
+	query := `
+		SELECT ` + inviteColumns + `, u.username AS inviter_username
+		FROM invite_codes i
+		JOIN users u ON u.id = i.created_by
+		WHERE i.tenant_id = $1 AND i.code = $2`
+
+	err = r.db.GetContext(ctx, invite, query, tenantID, code)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	return invite, err
+}
+
+// GetUserInvites lists a user's unrevoked invites, newest first
+func (r *PostgresRepository) GetUserInvites(ctx context.Context, userID int64) ([]*Invite, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invites := []*Invite{}
+	query := `
+		SELECT ` + inviteColumns + `
+		FROM invite_codes i
+		WHERE i.tenant_id = $1 AND i.created_by = $2 AND i.revoked_at IS NULL
+		ORDER BY i.created_at DESC`
+
+	err = r.db.SelectContext(ctx, &invites, query, tenantID, userID)
+	return invites, err
+}
+
+// GetInvites lists every invite in the tenant, newest first
+func (r *PostgresRepository) GetInvites(ctx context.Context, filter InviteFilter, limit, offset int) ([]*Invite, int64, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := `WHERE i.tenant_id = $1 AND ($2 = 0 OR i.created_by = $2)`
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM invite_codes i ` + where
+	if err := r.db.GetContext(ctx, &total, countQuery, tenantID, filter.CreatedBy); err != nil {
+		return nil, 0, err
+	}
+
+	invites := []*Invite{}
+	query := `SELECT ` + inviteColumns + ` FROM invite_codes i ` + where + `
+		ORDER BY i.created_at DESC
+		LIMIT $3 OFFSET $4`
+	err = r.db.SelectContext(ctx, &invites, query, tenantID, filter.CreatedBy, limit, offset)
+	return invites, total, err
+}
+
+// CountActiveInvites counts a user's invites that can still be redeemed
+func (r *PostgresRepository) CountActiveInvites(ctx context.Context, userID int64) (int, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	query := `
+		SELECT COUNT(*) FROM invite_codes
+		WHERE tenant_id = $1 AND created_by = $2 AND revoked_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP AND uses_count < max_uses`
+	err = r.db.GetContext(ctx, &count, query, tenantID, userID)
+	return count, err
+}
+
+// RevokeInvite revokes an invite created by the user, or any invite in the
+// tenant when userID is 0
+func (r *PostgresRepository) RevokeInvite(ctx context.Context, inviteID, userID int64) (bool, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		UPDATE invite_codes SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND tenant_id = $2 AND ($3 = 0 OR created_by = $3) AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, inviteID, tenantID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+const referredUserColumns = `u.id, u.username, u.display_name, u.profile_picture`
+
+// GetReferrals lists the accounts a user invited directly, newest first
+func (r *PostgresRepository) GetReferrals(ctx context.Context, inviterID int64, limit, offset int) ([]*ReferredUser, int64, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM referrals WHERE tenant_id = $1 AND inviter_id = $2`
+	if err := r.db.GetContext(ctx, &total, countQuery, tenantID, inviterID); err != nil {
+		return nil, 0, err
+	}
+
+	referrals := []*ReferredUser{}
+	query := `
+		SELECT ` + referredUserColumns + `, rf.inviter_id, 1 AS depth, rf.created_at AS referred_at
+		FROM referrals rf
+		JOIN users u ON u.id = rf.invitee_id
+		WHERE rf.tenant_id = $1 AND rf.inviter_id = $2
+		ORDER BY rf.created_at DESC
+		LIMIT $3 OFFSET $4`
+	err = r.db.SelectContext(ctx, &referrals, query, tenantID, inviterID, limit, offset)
+	return referrals, total, err
+}
+
+// GetReferralTree lists everyone who joined through the user's invites, or
+// through the invites of those people, up to maxDepth levels down. Rows come
+// ordered by depth, so inviters always precede the accounts they invited.
+func (r *PostgresRepository) GetReferralTree(ctx context.Context, userID int64, maxDepth, limit int) ([]*ReferredUser, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	referrals := []*ReferredUser{}
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT invitee_id, inviter_id, created_at, 1 AS depth
+			FROM referrals WHERE tenant_id = $1 AND inviter_id = $2
+			UNION ALL
+			SELECT rf.invitee_id, rf.inviter_id, rf.created_at, t.depth + 1
+			FROM referrals rf
+			JOIN tree t ON rf.inviter_id = t.invitee_id
+			WHERE t.depth < $3
+		)
+		SELECT ` + referredUserColumns + `, t.inviter_id, t.depth, t.created_at AS referred_at
+		FROM tree t
+		JOIN users u ON u.id = t.invitee_id
+		ORDER BY t.depth, t.created_at
+		LIMIT $4`
+	err = r.db.SelectContext(ctx, &referrals, query, tenantID, userID, maxDepth, limit)
+	return referrals, err
+}
+
+// GetReferralStats counts a user's invites and the accounts in their referral tree
+func (r *PostgresRepository) GetReferralStats(ctx context.Context, userID int64) (*ReferralStats, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ReferralStats{}
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT invitee_id, 1 AS depth
+			FROM referrals WHERE tenant_id = $1 AND inviter_id = $2
+			UNION ALL
+			SELECT rf.invitee_id, t.depth + 1
+			FROM referrals rf
+			JOIN tree t ON rf.inviter_id = t.invitee_id
+		)
+		SELECT
+			(SELECT COUNT(*) FROM tree WHERE depth = 1) AS direct_referrals,
+			(SELECT COUNT(*) FROM tree) AS total_referrals,
+			(SELECT COALESCE(MAX(depth), 0) FROM tree) AS tree_depth,
+			(SELECT COUNT(*) FROM invite_codes WHERE tenant_id = $1 AND created_by = $2) AS invites_created,
+			(SELECT COUNT(*) FROM invite_codes
+				WHERE tenant_id = $1 AND created_by = $2 AND revoked_at IS NULL
+				AND expires_at > CURRENT_TIMESTAMP AND uses_count < max_uses) AS active_invites,
+			(SELECT inviter_id FROM referrals WHERE tenant_id = $1 AND invitee_id = $2) AS invited_by`
+
+	if err := r.db.GetContext(ctx, stats, query, tenantID, userID); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// EmailExists checks if email is already registered
+func (r *PostgresRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE tenant_id = $2 AND LOWER(email) = LOWER($1))`
+	err = r.db.GetContext(ctx, &exists, query, email, tenantID)
+	return exists, err
+}
+
+// UsernameExists checks if username is already taken
+func (r *PostgresRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE tenant_id = $2 AND LOWER(username) = LOWER($1))`
+	err = r.db.GetContext(ctx, &exists, query, username, tenantID)
+	return exists, err
+}
+
+// PhoneExists checks if a phone number belongs to another user
+func (r *PostgresRepository) PhoneExists(ctx context.Context, phone string, excludeUserID int64) (bool, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
 	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))`
-	err := r.db.GetContext(ctx, &exists, query, username)
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE tenant_id = $3 AND phone = $1 AND id != $2)`
+	err = r.db.GetContext(ctx, &exists, query, phone, excludeUserID, tenantID)
 	return exists, err
 }
@@ -0,0 +1,396 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+// memoryRepository is an in-memory Repository for service tests. It
+// implements the operations the tested flows use; calling any other
+// method panics through the nil embedded Repository.
+type memoryRepository struct {
+	Repository
+
+	mu            sync.Mutex
+	nextID        int64
+	users         map[int64]*User
+	resetRequired map[int64]bool
+	otps          []*OTP
+	sessions      []*Session
+	attempts      []*LoginAttempt
+	invites       []*Invite
+	invitedBy     map[int64]int64 // Invitee to inviter
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		users:         make(map[int64]*User),
+		resetRequired: make(map[int64]bool),
+		invitedBy:     make(map[int64]int64),
+	}
+}
+
+func (r *memoryRepository) id() int64 {
+	r.nextID++
+	return r.nextID
+}
+
+func (r *memoryRepository) CreateUser(ctx context.Context, user *User) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user.ID = r.id()
+	user.TenantID = tenantID
+	user.AccountStatus = AccountStatusActive
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *memoryRepository) CreateUserWithInvite(ctx context.Context, user *User, code string) error {
+	r.mu.Lock()
+	var invite *Invite
+	for _, i := range r.invites {
+		if i.Code == code && i.Usable() {
+			invite = i
+		}
+	}
+	if invite == nil {
+		r.mu.Unlock()
+		return ErrInvalidInvite
+	}
+	invite.UsesCount++
+	r.mu.Unlock()
+
+	if err := r.CreateUser(ctx, user); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invitedBy[user.ID] = invite.CreatedBy
+	return nil
+}
+
+func (r *memoryRepository) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *memoryRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r *memoryRepository) UpdateEmail(ctx context.Context, userID int64, email string, verified bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.ID != userID && strings.EqualFold(user.Email, email) {
+			return ErrEmailExists
+		}
+	}
+	if user, ok := r.users[userID]; ok {
+		user.Email = email
+		user.EmailVerified = verified
+		user.IsVerified = user.IsVerified || verified
+	}
+	return nil
+}
+
+func (r *memoryRepository) UpdateVerificationStatus(ctx context.Context, userID int64, field string, status bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil
+	}
+	switch field {
+	case "email":
+		user.IsVerified = user.EmailVerified || status
+		user.EmailVerified = status
+	case "phone":
+		user.PhoneVerified = status
+	}
+	return nil
+}
+
+func (r *memoryRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	_, err := r.GetUserByEmail(ctx, email)
+	return err == nil, nil
+}
+
+func (r *memoryRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Username, username) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) PhoneExists(ctx context.Context, phone string, excludeUserID int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Phone != nil && *user.Phone == phone && user.ID != excludeUserID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) CreateOTP(ctx context.Context, otp *OTP) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	otp.ID = r.id()
+	otp.CreatedAt = time.Now()
+	stored := *otp
+	r.otps = append(r.otps, &stored)
+	return nil
+}
+
+func (r *memoryRepository) GetLatestOTP(ctx context.Context, identifier, identifierType, purpose string) (*OTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.otps) - 1; i >= 0; i-- {
+		otp := r.otps[i]
+		if strings.EqualFold(otp.Identifier, identifier) && otp.IdentifierType == identifierType &&
+			otp.Purpose == purpose && !otp.IsUsed {
+			copied := *otp
+			return &copied, nil
+		}
+	}
+	return nil, ErrOTPNotFound
+}
+
+func (r *memoryRepository) ClaimOTPAttempt(ctx context.Context, otpID int64) (int, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, otp := range r.otps {
+		if otp.ID == otpID {
+			if otp.Attempts >= otp.MaxAttempts {
+				return 0, false, nil
+			}
+			otp.Attempts++
+			return otp.Attempts, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (r *memoryRepository) ConsumeOTP(ctx context.Context, otpID int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, otp := range r.otps {
+		if otp.ID == otpID && !otp.IsUsed {
+			otp.IsUsed = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) InvalidateOTPs(ctx context.Context, identifier, identifierType, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, otp := range r.otps {
+		if strings.EqualFold(otp.Identifier, identifier) && otp.IdentifierType == identifierType && otp.Purpose == purpose {
+			otp.IsUsed = true
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) CountRecentOTPs(ctx context.Context, identifier, identifierType, purpose string, since time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, otp := range r.otps {
+		if strings.EqualFold(otp.Identifier, identifier) && otp.IdentifierType == identifierType &&
+			otp.Purpose == purpose && otp.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryRepository) CountRecentUserOTPs(ctx context.Context, userID int64, purpose string, since time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, otp := range r.otps {
+		if otp.UserID != nil && *otp.UserID == userID && otp.Purpose == purpose && otp.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryRepository) CreateSession(ctx context.Context, session *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session.ID = r.id()
+	session.IsActive = true
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+	stored := *session
+	r.sessions = append(r.sessions, &stored)
+	return nil
+}
+
+func (r *memoryRepository) GetUserSessions(ctx context.Context, userID int64) ([]*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []*Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.IsActive {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *memoryRepository) InvalidateAllUserSessions(ctx context.Context, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			session.IsActive = false
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) UpdateOnlineStatus(ctx context.Context, userID int64, isOnline bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[userID]; ok {
+		user.IsOnline = isOnline
+	}
+	return nil
+}
+
+// TouchUserDevice reports every device as already known, so no new device
+// alerts are sent
+func (r *memoryRepository) TouchUserDevice(ctx context.Context, device *UserDevice) (bool, error) {
+	return false, nil
+}
+
+func (r *memoryRepository) SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resetRequired[userID] = required
+	return nil
+}
+
+func (r *memoryRepository) IsPasswordResetRequired(ctx context.Context, userID int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.resetRequired[userID], nil
+}
+
+func (r *memoryRepository) GetUserRoleNames(ctx context.Context, userID int64) ([]string, error) {
+	return nil, nil
+}
+
+func (r *memoryRepository) RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt.ID = r.id()
+	stored := *attempt
+	r.attempts = append(r.attempts, &stored)
+	return nil
+}
+
+// GetRolePermissions grants invites:manage to admins
+func (r *memoryRepository) GetRolePermissions(ctx context.Context) (map[string][]string, error) {
+	return map[string][]string{"admin": {PermissionInvitesManage}}, nil
+}
+
+func (r *memoryRepository) CreateInvite(ctx context.Context, invite *Invite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invite.ID = r.id()
+	invite.CreatedAt = time.Now()
+	stored := *invite
+	r.invites = append(r.invites, &stored)
+	return nil
+}
+
+func (r *memoryRepository) GetInviteByCode(ctx context.Context, code string) (*Invite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, invite := range r.invites {
+		if invite.Code == code {
+			copied := *invite
+			if inviter, ok := r.users[invite.CreatedBy]; ok {
+				copied.InviterUsername = inviter.Username
+			}
+			return &copied, nil
+		}
+	}
+	return nil, ErrInviteNotFound
+}
+
+func (r *memoryRepository) CountActiveInvites(ctx context.Context, userID int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, invite := range r.invites {
+		if invite.CreatedBy == userID && invite.Usable() {
+			count++
+		}
+	}
+	return count, nil
+}
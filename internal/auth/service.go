@@ -11,15 +11,47 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/email"
+	"github.com/tommygebru/kiekky-backend/pkg/oauth"
+	"github.com/tommygebru/kiekky-backend/pkg/passhash"
+	"github.com/tommygebru/kiekky-backend/pkg/passpolicy"
+	"github.com/tommygebru/kiekky-backend/pkg/sms"
+	"github.com/tommygebru/kiekky-backend/pkg/storage"
+	"github.com/tommygebru/kiekky-backend/pkg/webauthn"
 )
 
 // Config holds auth configuration
 type Config struct {
-	JWTSecret          string
-	AccessTokenExpiry  time.Duration
-	RefreshTokenExpiry time.Duration
-	BCryptCost         int
+	JWTSecret             string
+	Keys                  *KeySet // Falls back to HS256 with JWTSecret when nil
+	AccessTokenExpiry     time.Duration
+	RefreshTokenExpiry    time.Duration
+	PasswordHasher        *passhash.Hasher   // Defaults to argon2id with passhash.DefaultParams when nil
+	PasswordPolicy        *passpolicy.Policy // Defaults to length and strength rules only when nil
+	OTPLength             int
+	OTPExpiry             time.Duration
+	MaxOTPAttempts        int
+	MagicLinkExpiry       time.Duration
+	FrontendURL           string // Base URL for links sent by email
+	Enable2FA             bool
+	MaxLoginAttempts      int           // Failures per account before a lockout
+	MaxLoginAttemptsPerIP int           // Failures per IP address before a lockout
+	LoginLockoutDuration  time.Duration // Lock length; failures older than this are forgotten
+	OAuthProviders        map[string]oauth.Provider
+	DeletionGracePeriod   time.Duration          // Time before a requested deletion is carried out
+	ImpersonationExpiry   time.Duration          // Lifetime of an admin impersonation token
+	InviteOnly            bool                   // Registration requires an invite code
+	InviteExpiry          time.Duration          // Default lifetime of an invite code
+	MaxActiveInvites      int                    // Open invites a member may hold; admins are exempt
+	MaxInviteUses         int                    // Most sign-ups a member's invite may allow
+	Storage               storage.Storage        // Media storage, for erasing deleted accounts' uploads
+	WebAuthn              *webauthn.RelyingParty // Defaults to localhost and FrontendURL when nil
+}
+
+// NotificationService interface for notification operations
+type NotificationService interface {
+	NotifySecurityAlert(ctx context.Context, userID int64, title, message string, data map[string]interface{}) error
 }
 
 // Service defines auth business operations
@@ -30,41 +62,192 @@ type Service interface {
 	Logout(ctx context.Context, userID int64, sessionID string) error
 	LogoutAll(ctx context.Context, userID int64) error
 	RefreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error)
-	
+
+	// Verification
+	VerifyEmail(ctx context.Context, email, code string) error
+	ResendEmailVerification(ctx context.Context, email string) error
+	SendPhoneVerification(ctx context.Context, userID int64, phone string) error
+	VerifyPhone(ctx context.Context, userID int64, phone, code string) error
+
+	// Two-factor authentication
+	SetupTwoFactor(ctx context.Context, userID int64) (*TwoFactorSetupResponse, error)
+	EnableTwoFactor(ctx context.Context, userID int64, code string) (*RecoveryCodesResponse, error)
+	DisableTwoFactor(ctx context.Context, userID int64, password, code string) error
+	GetTwoFactorStatus(ctx context.Context, userID int64) (*TwoFactorStatusResponse, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) (*RecoveryCodesResponse, error)
+	CompleteTwoFactorLogin(ctx context.Context, req *TwoFactorLoginRequest, ipAddress, userAgent string) (*LoginResponse, error)
+
+	// Passwordless login
+	RequestMagicLink(ctx context.Context, email string) error
+	LoginWithMagicLink(ctx context.Context, req *MagicLinkLoginRequest, ipAddress, userAgent string) (*LoginResponse, error)
+
+	// Passkeys
+	BeginPasskeyRegistration(ctx context.Context, userID int64) (*webauthn.CreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, userID int64, req *PasskeyRegistrationRequest) (*Passkey, error)
+	BeginPasskeyLogin(ctx context.Context, identifier string) (*webauthn.RequestOptions, error)
+	FinishPasskeyLogin(ctx context.Context, req *PasskeyLoginRequest, ipAddress, userAgent string) (*LoginResponse, error)
+	GetPasskeys(ctx context.Context, userID int64) ([]*Passkey, error)
+	RenamePasskey(ctx context.Context, userID, passkeyID int64, name string) error
+	DeletePasskey(ctx context.Context, userID, passkeyID int64) error
+
+	// Personal access tokens
+	CreatePersonalAccessToken(ctx context.Context, userID int64, req *CreateTokenRequest) (*CreateTokenResponse, error)
+	GetPersonalAccessTokens(ctx context.Context, userID int64) ([]*PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, userID, tokenID int64) error
+	ValidatePersonalAccessToken(ctx context.Context, token string) (*TokenClaims, error)
+
+	// Invites and referrals
+	CreateInvite(ctx context.Context, userID int64, req *CreateInviteRequest) (*Invite, error)
+	GetUserInvites(ctx context.Context, userID int64) ([]*Invite, error)
+	RevokeInvite(ctx context.Context, userID, inviteID int64) error
+	ValidateInvite(ctx context.Context, code string) (*InvitePreview, error)
+	GetInvites(ctx context.Context, filter InviteFilter, limit, offset int) ([]*Invite, int64, error)
+	AdminRevokeInvite(ctx context.Context, adminID, inviteID int64) error
+	GetReferrals(ctx context.Context, userID int64, limit, offset int) ([]*ReferredUser, int64, error)
+	GetReferralTree(ctx context.Context, userID int64, depth int) ([]*ReferredUser, error)
+	GetReferralStats(ctx context.Context, userID int64) (*ReferralStats, error)
+
+	// Social login
+	StartOAuthLogin(ctx context.Context, provider string) (*OAuthStartResponse, error)
+	CompleteOAuthLogin(ctx context.Context, provider string, req *OAuthCallbackRequest, ipAddress, userAgent string) (*LoginResponse, error)
+	GetUserIdentities(ctx context.Context, userID int64) ([]*UserIdentity, error)
+
+	// Login protection
+	RequestAccountUnlock(ctx context.Context, email string) error
+	UnlockAccount(ctx context.Context, email, code string) error
+	GetLoginHistory(ctx context.Context, userID int64, limit, offset int) ([]*LoginAttempt, int64, error)
+
+	// Roles and permissions
+	HasPermission(ctx context.Context, roles []string, permission string) (bool, error)
+	GetRoles(ctx context.Context) ([]*Role, error)
+	GetUserRoles(ctx context.Context, userID int64) ([]*UserRole, error)
+	GrantRole(ctx context.Context, actorID, userID int64, role string) error
+	RevokeRole(ctx context.Context, actorID, userID int64, role string) error
+
+	// Account lifecycle
+	DeactivateAccount(ctx context.Context, userID int64, password string) error
+	RequestAccountDeletion(ctx context.Context, userID int64, password string) (*AccountDeletionResponse, error)
+	RegisterDataEraser(eraser UserDataEraser)
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
+
+	// Email change
+	RequestEmailChange(ctx context.Context, userID int64, newEmail, password string) error
+	ConfirmEmailChange(ctx context.Context, userID int64, newEmail, code string) error
+	RevertEmailChange(ctx context.Context, token string) error
+
 	// Password management
 	ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword string) error
-	
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, email, code, newPassword string) error
+
 	// Token validation
 	ValidateAccessToken(token string) (*TokenClaims, error)
 	ValidateRefreshToken(token string) (*TokenClaims, error)
-	
+	ValidateSession(ctx context.Context, userID int64, sessionID string) ([]string, error)
+	JWKS() *JWKS
+
 	// User retrieval
 	GetUserByID(ctx context.Context, id int64) (*User, error)
 	GetUserWithStats(ctx context.Context, id int64) (*UserWithStats, error)
-	
+
 	// Session management
-	GetUserSessions(ctx context.Context, userID int64) ([]*Session, error)
+	GetUserSessions(ctx context.Context, userID int64, currentSessionID string) ([]*Session, error)
+	ReportSession(ctx context.Context, token string) error
 	InvalidateSession(ctx context.Context, userID int64, sessionID int64) error
-	
+
+	// Impersonation
+	StartImpersonation(ctx context.Context, adminID, targetUserID int64, reason, ipAddress, userAgent string) (*ImpersonationResponse, error)
+	ValidateImpersonation(ctx context.Context, claims *TokenClaims) ([]string, error)
+	EndImpersonation(ctx context.Context, impersonationID int64) error
+	RecordImpersonatedRequest(ctx context.Context, entry *ImpersonationAuditEntry)
+	GetImpersonationSessions(ctx context.Context, filter ImpersonationFilter, limit, offset int) ([]*ImpersonationSession, int64, error)
+	GetImpersonationAuditLog(ctx context.Context, impersonationID int64, limit, offset int) ([]*ImpersonationAuditEntry, int64, error)
+
 	// Online status
 	UpdateOnlineStatus(ctx context.Context, userID int64, isOnline bool) error
 }
 
 type service struct {
-	repo   Repository
-	config *Config
+	repo        Repository
+	config      *Config
+	mailer      email.Sender
+	sms         sms.Sender
+	notifySvc   NotificationService
+	sessions    *sessionCache
+	permissions *rolePermissionCache
+	erasers     []UserDataEraser
+	dummyHash   string // Checked for unknown identifiers so they take as long as real ones
 }
 
 // NewService creates a new auth service
-func NewService(repo Repository, config *Config) Service {
+func NewService(repo Repository, config *Config, mailer email.Sender, smsSender sms.Sender, notifySvc NotificationService) Service {
+	if config.Keys == nil {
+		config.Keys = NewHMACKeySet(config.JWTSecret)
+	}
+	if config.PasswordHasher == nil {
+		config.PasswordHasher = passhash.New(passhash.DefaultParams)
+	}
+	if config.PasswordPolicy == nil {
+		config.PasswordPolicy = passpolicy.New(2, nil)
+	}
+	if config.WebAuthn == nil {
+		rp, err := webauthn.New(webauthn.Config{RPID: "localhost", RPName: "Kiekky", Origins: []string{config.FrontendURL}})
+		if err != nil {
+			rp, _ = webauthn.New(webauthn.Config{RPID: "localhost", RPName: "Kiekky", Origins: []string{"http://localhost:3000"}})
+		}
+		config.WebAuthn = rp
+	}
+	if config.DeletionGracePeriod <= 0 {
+		config.DeletionGracePeriod = 30 * 24 * time.Hour
+	}
+	if config.MagicLinkExpiry <= 0 {
+		config.MagicLinkExpiry = 15 * time.Minute
+	}
+	if config.ImpersonationExpiry <= 0 {
+		config.ImpersonationExpiry = 15 * time.Minute
+	}
+	if config.InviteExpiry <= 0 {
+		config.InviteExpiry = 7 * 24 * time.Hour
+	}
+	if config.MaxActiveInvites <= 0 {
+		config.MaxActiveInvites = 10
+	}
+	if config.MaxInviteUses <= 0 {
+		config.MaxInviteUses = 10
+	}
+	if config.MaxLoginAttempts <= 0 {
+		config.MaxLoginAttempts = 5
+	}
+	if config.MaxLoginAttemptsPerIP <= 0 {
+		config.MaxLoginAttemptsPerIP = 50
+	}
+	if config.LoginLockoutDuration <= 0 {
+		config.LoginLockoutDuration = 15 * time.Minute
+	}
+	dummyHash, err := config.PasswordHasher.Hash(generateSecureToken(32))
+	if err != nil {
+		fmt.Printf("WARNING: Failed to create dummy password hash: %v\n", err)
+	}
 	return &service{
-		repo:   repo,
-		config: config,
+		repo:        repo,
+		config:      config,
+		mailer:      mailer,
+		sms:         smsSender,
+		notifySvc:   notifySvc,
+		sessions:    newSessionCache(sessionCacheTTL),
+		permissions: &rolePermissionCache{},
+		dummyHash:   dummyHash,
 	}
 }
 
 // Register creates a new user account
 func (s *service) Register(ctx context.Context, req *RegisterRequest) (*User, error) {
+	inviteCode := normalizeInviteCode(req.InviteCode)
+	if s.config.InviteOnly && inviteCode == "" {
+		return nil, ErrInviteRequired
+	}
+
 	// Check if email exists
 	exists, err := s.repo.EmailExists(ctx, req.Email)
 	if err != nil {
@@ -83,8 +266,23 @@ func (s *service) Register(ctx context.Context, req *RegisterRequest) (*User, er
 		return nil, ErrUsernameExists
 	}
 
+	// Check if phone exists
+	if req.Phone != "" {
+		exists, err = s.repo.PhoneExists(ctx, req.Phone, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check phone: %w", err)
+		}
+		if exists {
+			return nil, ErrPhoneExists
+		}
+	}
+
+	if err := s.validateNewPassword(req.Password, req.Username, req.Email); err != nil {
+		return nil, err
+	}
+
 	// Hash password
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), s.config.BCryptCost)
+	passwordHash, err := s.hashPassword(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -93,45 +291,168 @@ func (s *service) Register(ctx context.Context, req *RegisterRequest) (*User, er
 	user := &User{
 		Email:        req.Email,
 		Username:     req.Username,
-		PasswordHash: string(passwordHash),
+		PasswordHash: passwordHash,
 	}
 	if req.Phone != "" {
 		user.Phone = &req.Phone
 	}
 
-	if err := s.repo.CreateUser(ctx, user); err != nil {
+	// A code is honoured whenever one is given, so referrals are also
+	// tracked while registration is open
+	if inviteCode != "" {
+		err = s.repo.CreateUserWithInvite(ctx, user, inviteCode)
+	} else {
+		err = s.repo.CreateUser(ctx, user)
+	}
+	if errors.Is(err, ErrInvalidInvite) {
+		return nil, err
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	// Send email verification code (user can request a resend if this fails)
+	if err := s.sendEmailVerification(ctx, user); err != nil {
+		fmt.Printf("ERROR: Failed to send verification email to user %d: %v\n", user.ID, err)
+	}
+	if user.Phone != nil {
+		if err := s.sendPhoneVerification(ctx, user.ID, *user.Phone); err != nil {
+			fmt.Printf("ERROR: Failed to send verification sms to user %d: %v\n", user.ID, err)
+		}
+	}
+
 	return user, nil
 }
 
 // Login authenticates a user and returns tokens
 func (s *service) Login(ctx context.Context, req *LoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
-	// Find user
+	// Refuse early while the client IP is locked out
+	ipKey := ipThrottleKey(ipAddress)
+	if err := s.checkLoginThrottle(ctx, ipKey); err != nil {
+		s.recordLoginAttempt(ctx, nil, req.Identifier, ipAddress, userAgent, loginFailureLocked)
+		return nil, err
+	}
+
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find user; unknown identifiers are throttled like real accounts
+	var userID *int64
+	accountKey := identifierThrottleKey(tenantID, req.Identifier)
 	user, err := s.repo.GetUserByIdentifier(ctx, req.Identifier)
 	if err != nil {
-		if errors.Is(err, ErrUserNotFound) {
-			return nil, ErrInvalidCredentials
+		if !errors.Is(err, ErrUserNotFound) {
+			return nil, fmt.Errorf("failed to find user: %w", err)
 		}
-		return nil, fmt.Errorf("failed to find user: %w", err)
+	} else {
+		userID = &user.ID
+		accountKey = userThrottleKey(user.ID)
 	}
 
-	// Check account status
-	if user.AccountStatus != "active" {
-		return nil, errors.New("account is not active")
+	if err := s.checkLoginThrottle(ctx, accountKey); err != nil {
+		s.recordLoginAttempt(ctx, userID, req.Identifier, ipAddress, userAgent, loginFailureLocked)
+		return nil, err
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	if !s.checkPassword(user, req.Password) {
+		s.recordLoginAttempt(ctx, userID, req.Identifier, ipAddress, userAgent, loginFailureInvalidCredentials)
+		s.registerLoginFailure(ctx, ipKey, s.config.MaxLoginAttemptsPerIP, false)
+		if lock := s.registerLoginFailure(ctx, accountKey, s.config.MaxLoginAttempts, true); lock != nil && lock.RetryAfter >= s.config.LoginLockoutDuration {
+			return nil, lock
+		}
 		return nil, ErrInvalidCredentials
 	}
 
+	// Check account status
+	if !canLogin(user) {
+		s.recordLoginAttempt(ctx, userID, req.Identifier, ipAddress, userAgent, loginFailureInactive)
+		return nil, ErrAccountInactive
+	}
+
+	// Checked here too so the attempt is recorded and no two-factor
+	// challenge is issued; createSession enforces it for every login method
+	if err := s.checkPasswordReset(ctx, user.ID); err != nil {
+		if errors.Is(err, ErrPasswordResetRequired) {
+			s.recordLoginAttempt(ctx, userID, req.Identifier, ipAddress, userAgent, loginFailureResetRequired)
+		}
+		return nil, err
+	}
+
+	s.recordLoginAttempt(ctx, userID, req.Identifier, ipAddress, userAgent, "")
+	s.upgradePasswordHash(ctx, user, req.Password)
+
+	response, err := s.completeLogin(ctx, user, req.DeviceInfo, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	// With a second factor pending, failures stay counted until it succeeds
+	if !response.TwoFactorRequired {
+		if err := s.repo.ClearLoginThrottle(ctx, accountKey); err != nil {
+			fmt.Printf("ERROR: Failed to reset login throttle for user %d: %v\n", user.ID, err)
+		}
+	}
+	return response, nil
+}
+
+// completeLogin finishes a first-factor login, issuing a two-factor
+// challenge if the user enrolled one and a session otherwise
+func (s *service) completeLogin(ctx context.Context, user *User, deviceInfo, ipAddress, userAgent string) (*LoginResponse, error) {
+	// Require a second factor if the user enrolled one
+	if s.config.Enable2FA {
+		tf, err := s.repo.GetTwoFactor(ctx, user.ID)
+		if err != nil && !errors.Is(err, ErrTwoFactorNotFound) {
+			return nil, fmt.Errorf("failed to check two-factor status: %w", err)
+		}
+		if tf != nil && tf.IsEnabled {
+			return s.createTwoFactorChallenge(ctx, user)
+		}
+	}
+
+	return s.createSession(ctx, user, deviceInfo, ipAddress, userAgent)
+}
+
+// checkPasswordReset fails with ErrPasswordResetRequired while a reported
+// sign-in or reverted email change has locked the account until its password
+// is reset
+func (s *service) checkPasswordReset(ctx context.Context, userID int64) error {
+	resetRequired, err := s.repo.IsPasswordResetRequired(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check password status: %w", err)
+	}
+	if resetRequired {
+		return ErrPasswordResetRequired
+	}
+	return nil
+}
+
+// createSession issues tokens and stores a new session for an authenticated
+// user. No login method signs in an account awaiting a password reset.
+func (s *service) createSession(ctx context.Context, user *User, deviceInfo, ipAddress, userAgent string) (*LoginResponse, error) {
+	if err := s.checkPasswordReset(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	// Signing in restores a deactivated account or cancels a pending deletion
+	if user.AccountStatus != AccountStatusActive {
+		if err := s.reactivateAccount(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
 	// Generate session ID
 	sessionID := generateSecureToken(32)
 
+	roles, err := s.repo.GetUserRoleNames(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
 	// Generate tokens
-	accessToken, err := s.generateAccessToken(user, sessionID)
+	accessToken, err := s.generateAccessToken(user, sessionID, roles)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -146,18 +467,22 @@ func (s *service) Login(ctx context.Context, req *LoginRequest, ipAddress, userA
 		UserID:           user.ID,
 		TokenHash:        hashToken(accessToken),
 		RefreshTokenHash: hashToken(refreshToken),
+		SessionKey:       hashToken(sessionID),
+		FamilyID:         generateSecureToken(16),
 		IPAddress:        &ipAddress,
 		UserAgent:        &userAgent,
 		ExpiresAt:        time.Now().Add(s.config.RefreshTokenExpiry),
 	}
-	if req.DeviceInfo != "" {
-		session.DeviceInfo = &req.DeviceInfo
+	if deviceInfo != "" {
+		session.DeviceInfo = &deviceInfo
 	}
 
 	if err := s.repo.CreateSession(ctx, session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
+	s.checkNewDevice(ctx, user, session, ipAddress, userAgent)
+
 	// Update online status
 	_ = s.repo.UpdateOnlineStatus(ctx, user.ID, true)
 
@@ -171,34 +496,43 @@ func (s *service) Login(ctx context.Context, req *LoginRequest, ipAddress, userA
 
 // Logout invalidates the current session
 func (s *service) Logout(ctx context.Context, userID int64, sessionID string) error {
-	// Get session by token hash
-	sessions, err := s.repo.GetUserSessions(ctx, userID)
+	key := hashToken(sessionID)
+	session, err := s.repo.GetSessionByKey(ctx, key)
 	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil // Already ended
+		}
 		return err
 	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
 
-	// Find and invalidate the session
-	for _, session := range sessions {
-		if err := s.repo.InvalidateSession(ctx, session.ID); err != nil {
-			return err
-		}
+	if err := s.repo.InvalidateSession(ctx, session.ID); err != nil {
+		return err
 	}
+	s.sessions.evict(key)
 
-	// Update online status
-	_ = s.repo.UpdateOnlineStatus(ctx, userID, false)
+	// Update online status once no other sessions remain
+	remaining, err := s.repo.GetUserSessions(ctx, userID)
+	if err == nil && len(remaining) == 0 {
+		_ = s.repo.UpdateOnlineStatus(ctx, userID, false)
+	}
 
 	return nil
 }
 
 // LogoutAll invalidates all user sessions
 func (s *service) LogoutAll(ctx context.Context, userID int64) error {
-	if err := s.repo.InvalidateAllUserSessions(ctx, userID); err != nil {
+	if err := s.revokeAllUserSessions(ctx, userID); err != nil {
 		return err
 	}
 	return s.repo.UpdateOnlineStatus(ctx, userID, false)
 }
 
-// RefreshToken generates new tokens using a refresh token
+// RefreshToken generates new tokens using a refresh token.
+// Each refresh token can be exchanged once; presenting a rotated token again
+// revokes every session in its family.
 func (s *service) RefreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error) {
 	// Validate refresh token
 	claims, err := s.ValidateRefreshToken(refreshToken)
@@ -206,11 +540,40 @@ func (s *service) RefreshToken(ctx context.Context, refreshToken string) (*Login
 		return nil, err
 	}
 
+	// Refresh tokens issued before tenants existed keep the request's tenant
+	if claims.TenantID != 0 {
+		if ctx, err = common.ScopeToTokenTenant(ctx, claims.TenantID); err != nil {
+			return nil, ErrSessionNotFound
+		}
+	}
+
 	// Get session
 	session, err := s.repo.GetSessionByRefreshToken(ctx, hashToken(refreshToken))
 	if err != nil {
 		return nil, ErrSessionNotFound
 	}
+	if session.UserID != claims.UserID {
+		return nil, ErrSessionNotFound
+	}
+
+	if !session.IsActive {
+		if session.RotatedAt != nil {
+			s.handleRefreshTokenReuse(ctx, session)
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrSessionNotFound
+	}
+
+	// Retire the old session; losing this race means the token was already used
+	rotated, err := s.repo.RotateSession(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions.evict(session.SessionKey)
+	if !rotated {
+		s.handleRefreshTokenReuse(ctx, session)
+		return nil, ErrRefreshTokenReused
+	}
 
 	// Get user
 	user, err := s.repo.GetUserByID(ctx, claims.UserID)
@@ -221,8 +584,14 @@ func (s *service) RefreshToken(ctx context.Context, refreshToken string) (*Login
 	// Generate new session ID
 	newSessionID := generateSecureToken(32)
 
+	// Roles are re-read so grants and revocations apply on refresh
+	roles, err := s.repo.GetUserRoleNames(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate new tokens
-	newAccessToken, err := s.generateAccessToken(user, newSessionID)
+	newAccessToken, err := s.generateAccessToken(user, newSessionID, roles)
 	if err != nil {
 		return nil, err
 	}
@@ -232,14 +601,13 @@ func (s *service) RefreshToken(ctx context.Context, refreshToken string) (*Login
 		return nil, err
 	}
 
-	// Invalidate old session
-	_ = s.repo.InvalidateSession(ctx, session.ID)
-
-	// Create new session
+	// Create new session in the same family
 	newSession := &Session{
 		UserID:           user.ID,
 		TokenHash:        hashToken(newAccessToken),
 		RefreshTokenHash: hashToken(newRefreshToken),
+		SessionKey:       hashToken(newSessionID),
+		FamilyID:         session.FamilyID,
 		DeviceInfo:       session.DeviceInfo,
 		IPAddress:        session.IPAddress,
 		UserAgent:        session.UserAgent,
@@ -258,6 +626,127 @@ func (s *service) RefreshToken(ctx context.Context, refreshToken string) (*Login
 	}, nil
 }
 
+// handleRefreshTokenReuse revokes a compromised session family and alerts the user
+func (s *service) handleRefreshTokenReuse(ctx context.Context, session *Session) {
+	fmt.Printf("WARNING: Refresh token reuse detected - UserID: %d, SessionID: %d\n", session.UserID, session.ID)
+
+	if err := s.repo.InvalidateSessionFamily(ctx, session.FamilyID); err != nil {
+		fmt.Printf("ERROR: Failed to revoke session family for user %d: %v\n", session.UserID, err)
+	}
+	s.sessions.evictUser(session.UserID)
+
+	if s.notifySvc != nil {
+		data := map[string]interface{}{
+			"reason": "refresh_token_reuse",
+		}
+		if session.DeviceInfo != nil {
+			data["device_info"] = *session.DeviceInfo
+		}
+		go s.notifySvc.NotifySecurityAlert(context.WithoutCancel(ctx), session.UserID,
+			"Suspicious sign-in activity",
+			"A refresh token for one of your sessions was used more than once, so that session has been signed out. If this wasn't you, change your password.",
+			data,
+		)
+	}
+}
+
+// VerifyEmail checks an email verification code and marks the email as verified
+func (s *service) VerifyEmail(ctx context.Context, email, code string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidOTP
+		}
+		return err
+	}
+
+	// Answer like an unknown address, so the endpoint does not reveal
+	// which emails are registered and verified
+	if user.EmailVerified {
+		return ErrInvalidOTP
+	}
+
+	if _, err := s.verifyOTP(ctx, user.Email, "email", OTPPurposeVerification, code); err != nil {
+		return err
+	}
+
+	return s.repo.UpdateVerificationStatus(ctx, user.ID, "email", true)
+}
+
+// ResendEmailVerification issues a fresh email verification code
+func (s *service) ResendEmailVerification(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil // Don't reveal whether the email is registered
+		}
+		return err
+	}
+
+	if user.EmailVerified {
+		return nil // Nothing to send; answer as for unknown addresses
+	}
+
+	return s.sendEmailVerification(ctx, user)
+}
+
+// SendPhoneVerification texts a verification code to a phone number for the user
+func (s *service) SendPhoneVerification(ctx context.Context, userID int64, phone string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Nothing to send; answer as if a code went out so the response does
+	// not reveal the number's state
+	if user.PhoneVerified && user.Phone != nil && *user.Phone == phone {
+		return nil
+	}
+
+	exists, err := s.repo.PhoneExists(ctx, phone, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check phone: %w", err)
+	}
+	if exists {
+		return ErrPhoneExists
+	}
+
+	return s.sendPhoneVerification(ctx, userID, phone)
+}
+
+// VerifyPhone checks a phone verification code and stores the phone as verified
+func (s *service) VerifyPhone(ctx context.Context, userID int64, phone, code string) error {
+	otp, err := s.verifyOTP(ctx, phone, "phone", OTPPurposeVerification, code)
+	if err != nil {
+		return err
+	}
+	if otp.UserID == nil || *otp.UserID != userID {
+		return ErrInvalidOTP
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Store the number if it differs from the one on file
+	if user.Phone == nil || *user.Phone != phone {
+		exists, err := s.repo.PhoneExists(ctx, phone, userID)
+		if err != nil {
+			return fmt.Errorf("failed to check phone: %w", err)
+		}
+		if exists {
+			return ErrPhoneExists
+		}
+		user.Phone = &phone
+		if err := s.repo.UpdateUser(ctx, user); err != nil {
+			return fmt.Errorf("failed to update phone: %w", err)
+		}
+	}
+
+	return s.repo.UpdateVerificationStatus(ctx, userID, "phone", true)
+}
+
 // ChangePassword changes user password
 func (s *service) ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword string) error {
 	user, err := s.repo.GetUserByID(ctx, userID)
@@ -266,23 +755,83 @@ func (s *service) ChangePassword(ctx context.Context, userID int64, currentPassw
 	}
 
 	// Verify current password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+	if !s.checkPassword(user, currentPassword) {
 		return errors.New("current password is incorrect")
 	}
 
+	if err := s.validateNewPassword(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
 	// Hash new password
-	newHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), s.config.BCryptCost)
+	newHash, err := s.hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 
 	// Update password
-	if err := s.repo.UpdatePassword(ctx, userID, string(newHash)); err != nil {
+	if err := s.repo.UpdatePassword(ctx, userID, newHash); err != nil {
 		return err
 	}
 
 	// Invalidate all sessions (force re-login)
-	return s.repo.InvalidateAllUserSessions(ctx, userID)
+	return s.revokeAllUserSessions(ctx, userID)
+}
+
+// RequestPasswordReset emails a reset code if the address belongs to an account.
+// It never reports whether the email is registered.
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := s.sendPasswordReset(ctx, user); err != nil {
+		if errors.Is(err, ErrOTPRateLimited) {
+			fmt.Printf("WARNING: Password reset rate limit reached for user %d\n", user.ID)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using an emailed reset code
+func (s *service) ResetPassword(ctx context.Context, email, code, newPassword string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidOTP
+		}
+		return err
+	}
+
+	if err := s.validateNewPassword(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	if _, err := s.verifyOTP(ctx, user.Email, "email", OTPPurposePasswordReset, code); err != nil {
+		return err
+	}
+
+	newHash, err := s.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdatePassword(ctx, user.ID, newHash); err != nil {
+		return err
+	}
+
+	// Proving ownership of the email also lifts any login lock
+	_ = s.repo.ClearLoginThrottle(ctx, userThrottleKey(user.ID))
+
+	// Invalidate all sessions (force re-login everywhere)
+	return s.revokeAllUserSessions(ctx, user.ID)
 }
 
 // ValidateAccessToken validates an access token
@@ -305,14 +854,79 @@ func (s *service) GetUserWithStats(ctx context.Context, id int64) (*UserWithStat
 	return s.repo.GetUserWithStats(ctx, id)
 }
 
-// GetUserSessions retrieves all sessions for a user
-func (s *service) GetUserSessions(ctx context.Context, userID int64) ([]*Session, error) {
-	return s.repo.GetUserSessions(ctx, userID)
+// GetUserSessions retrieves all sessions for a user, flagging the one
+// identified by currentSessionID
+func (s *service) GetUserSessions(ctx context.Context, userID int64, currentSessionID string) ([]*Session, error) {
+	sessions, err := s.repo.GetUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	describeSessions(sessions, currentSessionID)
+	return sessions, nil
+}
+
+// ValidateSession reports whether the session behind an access token is
+// still active and returns the user's current roles. Roles are looked up
+// rather than taken from the token, so a revoked role stops working at once.
+func (s *service) ValidateSession(ctx context.Context, userID int64, sessionID string) ([]string, error) {
+	key := hashToken(sessionID)
+
+	entry, ok := s.sessions.get(key)
+	if !ok {
+		session, err := s.repo.GetSessionByKey(ctx, key)
+		switch {
+		case errors.Is(err, ErrSessionNotFound):
+			entry = &sessionCacheEntry{userID: userID, active: false}
+		case err != nil:
+			return nil, err
+		default:
+			roles, err := s.repo.GetUserRoleNames(ctx, session.UserID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load roles: %w", err)
+			}
+			entry = &sessionCacheEntry{userID: session.UserID, active: true, expiresAt: session.ExpiresAt, roles: roles}
+		}
+		entry.checkedAt = time.Now()
+		s.sessions.set(key, entry)
+	}
+
+	if !entry.active || entry.userID != userID || time.Now().After(entry.expiresAt) {
+		return nil, ErrSessionRevoked
+	}
+	return entry.roles, nil
+}
+
+// JWKS returns the public keys that verify issued tokens
+func (s *service) JWKS() *JWKS {
+	return s.config.Keys.JWKS()
 }
 
 // InvalidateSession invalidates a specific session
 func (s *service) InvalidateSession(ctx context.Context, userID int64, sessionID int64) error {
-	return s.repo.InvalidateSession(ctx, sessionID)
+	sessions, err := s.repo.GetUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			if err := s.repo.InvalidateSession(ctx, sessionID); err != nil {
+				return err
+			}
+			s.sessions.evictUser(userID)
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+// revokeAllUserSessions invalidates every session and drops them from the cache
+func (s *service) revokeAllUserSessions(ctx context.Context, userID int64) error {
+	if err := s.repo.InvalidateAllUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	s.sessions.evictUser(userID)
+	return nil
 }
 
 // UpdateOnlineStatus updates user online status
@@ -322,19 +936,20 @@ func (s *service) UpdateOnlineStatus(ctx context.Context, userID int64, isOnline
 
 // Helper functions
 
-func (s *service) generateAccessToken(user *User, sessionID string) (string, error) {
+func (s *service) generateAccessToken(user *User, sessionID string, roles []string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":    user.ID,
 		"username":   user.Username,
 		"email":      user.Email,
 		"session_id": sessionID,
+		"roles":      roles,
+		"tenant_id":  user.TenantID,
 		"type":       "access",
 		"exp":        time.Now().Add(s.config.AccessTokenExpiry).Unix(),
 		"iat":        time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	return s.config.Keys.Sign(claims)
 }
 
 func (s *service) generateRefreshToken(user *User, sessionID string) (string, error) {
@@ -343,22 +958,17 @@ func (s *service) generateRefreshToken(user *User, sessionID string) (string, er
 		"username":   user.Username,
 		"email":      user.Email,
 		"session_id": sessionID,
+		"tenant_id":  user.TenantID,
 		"type":       "refresh",
 		"exp":        time.Now().Add(s.config.RefreshTokenExpiry).Unix(),
 		"iat":        time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	return s.config.Keys.Sign(claims)
 }
 
 func (s *service) validateToken(tokenString string, expectedType string) (*TokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.JWTSecret), nil
-	})
+	token, err := s.config.Keys.Parse(tokenString)
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
@@ -375,13 +985,45 @@ func (s *service) validateToken(tokenString string, expectedType string) (*Token
 		return nil, fmt.Errorf("invalid token type: expected %s, got %s", expectedType, tokenType)
 	}
 
-	return &TokenClaims{
+	var roles []string
+	if raw, ok := claims["roles"].([]interface{}); ok {
+		for _, r := range raw {
+			if role, ok := r.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	result := &TokenClaims{
 		UserID:    int64(claims["user_id"].(float64)),
 		Username:  claims["username"].(string),
 		Email:     claims["email"].(string),
 		SessionID: claims["session_id"].(string),
+		Roles:     roles,
 		Type:      tokenType,
-	}, nil
+	}
+	if tenantID, ok := claims["tenant_id"].(float64); ok {
+		result.TenantID = int64(tenantID)
+	}
+
+	// Impersonation tokens also name the admin acting as the user
+	if impersonatorID, ok := claims["impersonator_id"].(float64); ok {
+		result.ImpersonatorID = int64(impersonatorID)
+		impersonationID, _ := claims["impersonation_id"].(float64)
+		result.ImpersonationID = int64(impersonationID)
+	}
+
+	return result, nil
+}
+
+// scopeToLinkTenant scopes ctx to the tenant an emailed link was issued in.
+// Links signed before tenants existed carry no tenant and keep the request's.
+func scopeToLinkTenant(ctx context.Context, claims jwt.MapClaims) (context.Context, error) {
+	tenantID, ok := claims["tenant_id"].(float64)
+	if !ok {
+		return ctx, nil
+	}
+	return common.ScopeToTokenTenant(ctx, int64(tenantID))
 }
 
 func generateSecureToken(length int) string {
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionCacheTTL bounds how long a revoked session's access tokens keep
+// working on instances other than the one that revoked it
+const sessionCacheTTL = 30 * time.Second
+
+// sessionCacheSweepSize is the entry count above which stale entries are pruned
+const sessionCacheSweepSize = 10000
+
+type sessionCacheEntry struct {
+	userID    int64
+	active    bool
+	expiresAt time.Time
+	checkedAt time.Time
+	roles     []string
+}
+
+// sessionCache remembers recent session lookups by session key so the
+// middleware does not query the database on every request
+type sessionCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]*sessionCacheEntry
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		ttl:     ttl,
+		entries: make(map[string]*sessionCacheEntry),
+	}
+}
+
+// get returns a cached entry if it was checked within the TTL
+func (c *sessionCache) get(key string) (*sessionCacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.checkedAt) > c.ttl {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *sessionCache) set(key string, entry *sessionCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= sessionCacheSweepSize {
+		for k, e := range c.entries {
+			if time.Since(e.checkedAt) > c.ttl {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = entry
+}
+
+// evict drops a single session
+func (c *sessionCache) evict(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// evictUser drops every cached session belonging to a user
+func (c *sessionCache) evictUser(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if e.userID == userID {
+			delete(c.entries, k)
+		}
+	}
+}
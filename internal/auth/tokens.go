@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told apart from JWTs
+const PersonalAccessTokenPrefix = "kpat_"
+
+// Token limits
+const (
+	maxPersonalAccessTokens = 50
+	tokenLastUsedInterval   = time.Minute // Minimum gap between last_used_at writes
+	tokenDisplayPrefixLen   = len(PersonalAccessTokenPrefix) + 8
+)
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// CreatePersonalAccessToken issues a scoped token. The plaintext is returned once and only its hash is stored.
+func (s *service) CreatePersonalAccessToken(ctx context.Context, userID int64, req *CreateTokenRequest) (*CreateTokenResponse, error) {
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if !common.ValidScope(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	count, err := s.repo.CountActivePersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	if count >= maxPersonalAccessTokens {
+		return nil, ErrTokenLimitReached
+	}
+
+	plaintext := PersonalAccessTokenPrefix + strings.TrimRight(generateSecureToken(32), "=")
+	token := &PersonalAccessToken{
+		UserID:      userID,
+		Name:        strings.TrimSpace(req.Name),
+		TokenHash:   hashToken(plaintext),
+		TokenPrefix: plaintext[:tokenDisplayPrefixLen],
+		Scopes:      scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.CreatePersonalAccessToken(ctx, token); err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return &CreateTokenResponse{Token: plaintext, PersonalAccessToken: token}, nil
+}
+
+// GetPersonalAccessTokens lists a user's active and expired tokens
+func (s *service) GetPersonalAccessTokens(ctx context.Context, userID int64) ([]*PersonalAccessToken, error) {
+	return s.repo.GetUserPersonalAccessTokens(ctx, userID)
+}
+
+// RevokePersonalAccessToken revokes one of the user's tokens
+func (s *service) RevokePersonalAccessToken(ctx context.Context, userID, tokenID int64) error {
+	ok, err := s.repo.RevokePersonalAccessToken(ctx, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// ValidatePersonalAccessToken checks a personal access token and returns its claims
+func (s *service) ValidatePersonalAccessToken(ctx context.Context, plaintext string) (*TokenClaims, error) {
+	token, err := s.repo.GetPersonalAccessTokenByHash(ctx, hashToken(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil {
+		return nil, errors.New("token has been revoked")
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return nil, errors.New("token has expired")
+	}
+
+	// The token works only within its owner's tenant
+	ctx, err = common.ScopeToTokenTenant(ctx, token.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.AccountStatus != AccountStatusActive {
+		return nil, ErrAccountInactive
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > tokenLastUsedInterval {
+		if err := s.repo.UpdatePersonalAccessTokenLastUsed(ctx, token.ID); err != nil {
+			fmt.Printf("WARNING: Failed to update last use of token %d: %v\n", token.ID, err)
+		}
+	}
+
+	return &TokenClaims{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Scopes:   token.Scopes,
+		TokenID:  token.ID,
+		TenantID: user.TenantID,
+		Type:     "personal_access",
+	}, nil
+}
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/pkg/totp"
+)
+
+const (
+	totpIssuer              = "Kiekky"
+	totpSkew                = 1 // accept codes one step either side for clock drift
+	recoveryCodeCount       = 10
+	twoFactorChallengeTTL   = 5 * time.Minute
+	twoFactorChallengeTries = 5
+)
+
+// SetupTwoFactor generates a new TOTP secret for the user to confirm
+func (s *service) SetupTwoFactor(ctx context.Context, userID int64) (*TwoFactorSetupResponse, error) {
+	if !s.config.Enable2FA {
+		return nil, ErrTwoFactorUnavailable
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil && !errors.Is(err, ErrTwoFactorNotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.IsEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	if err := s.repo.SaveTwoFactorSecret(ctx, userID, secret); err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+
+	return &TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirms enrollment with a TOTP code and returns recovery codes
+func (s *service) EnableTwoFactor(ctx context.Context, userID int64, code string) (*RecoveryCodesResponse, error) {
+	if !s.config.Enable2FA {
+		return nil, ErrTwoFactorUnavailable
+	}
+
+	tf, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf.IsEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(tf.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	if err := s.repo.EnableTwoFactor(ctx, userID, step); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor: %w", err)
+	}
+
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// DisableTwoFactor turns off 2FA after checking the password and a second factor
+func (s *service) DisableTwoFactor(ctx context.Context, userID int64, password, code string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !s.checkPassword(user, password) {
+		return ErrInvalidCredentials
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+
+	return s.repo.DisableTwoFactor(ctx, userID)
+}
+
+// GetTwoFactorStatus reports whether the user has 2FA enabled
+func (s *service) GetTwoFactorStatus(ctx context.Context, userID int64) (*TwoFactorStatusResponse, error) {
+	tf, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorNotFound) {
+			return &TwoFactorStatusResponse{}, nil
+		}
+		return nil, err
+	}
+
+	status := &TwoFactorStatusResponse{
+		Enabled:   tf.IsEnabled,
+		EnabledAt: tf.EnabledAt,
+	}
+	if tf.IsEnabled {
+		remaining, err := s.repo.CountRecoveryCodes(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		status.RecoveryCodesRemaining = remaining
+	}
+	return status, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a TOTP code
+func (s *service) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) (*RecoveryCodesResponse, error) {
+	tf, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorNotFound) {
+			return nil, ErrTwoFactorNotEnabled
+		}
+		return nil, err
+	}
+	if !tf.IsEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, tf, code); err != nil {
+		return nil, err
+	}
+
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// CompleteTwoFactorLogin exchanges a login challenge and second factor for session tokens
+func (s *service) CompleteTwoFactorLogin(ctx context.Context, req *TwoFactorLoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	challenge, err := s.repo.GetLatestOTP(ctx, hashToken(req.ChallengeToken), "challenge", OTPPurposeTwoFactor)
+	if err != nil {
+		if errors.Is(err, ErrOTPNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	if challenge.UserID == nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidChallenge
+	}
+
+	// Failed codes count against the account like failed passwords, so
+	// fresh challenges from repeated password logins cannot reset the count
+	ipKey := ipThrottleKey(ipAddress)
+	accountKey := userThrottleKey(*challenge.UserID)
+	for _, key := range []string{ipKey, accountKey} {
+		if err := s.checkLoginThrottle(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	_, ok, err := s.repo.ClaimOTPAttempt(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTooManyAttempts
+	}
+
+	user, err := s.repo.GetUserByID(ctx, *challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !canLogin(user) {
+		return nil, ErrAccountInactive
+	}
+
+	if err := s.verifySecondFactor(ctx, user.ID, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.registerLoginFailure(ctx, ipKey, s.config.MaxLoginAttemptsPerIP, false)
+			if lock := s.registerLoginFailure(ctx, accountKey, s.config.MaxLoginAttempts, true); lock != nil && lock.RetryAfter >= s.config.LoginLockoutDuration {
+				return nil, lock
+			}
+		}
+		return nil, err
+	}
+
+	consumed, err := s.repo.ConsumeOTP(ctx, challenge.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := s.repo.ClearLoginThrottle(ctx, accountKey); err != nil {
+		fmt.Printf("ERROR: Failed to reset login throttle for user %d: %v\n", user.ID, err)
+	}
+
+	return s.createSession(ctx, user, req.DeviceInfo, ipAddress, userAgent)
+}
+
+// createTwoFactorChallenge stores a short-lived, single-use login challenge
+func (s *service) createTwoFactorChallenge(ctx context.Context, user *User) (*LoginResponse, error) {
+	token := generateSecureToken(32)
+
+	challenge := &OTP{
+		UserID:         &user.ID,
+		Identifier:     hashToken(token),
+		IdentifierType: "challenge",
+		Code:           "-",
+		Purpose:        OTPPurposeTwoFactor,
+		MaxAttempts:    twoFactorChallengeTries,
+		ExpiresAt:      time.Now().Add(twoFactorChallengeTTL),
+	}
+	if err := s.repo.CreateOTP(ctx, challenge); err != nil {
+		return nil, fmt.Errorf("failed to create login challenge: %w", err)
+	}
+
+	return &LoginResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int64(twoFactorChallengeTTL.Seconds()),
+	}, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func (s *service) verifySecondFactor(ctx context.Context, userID int64, code string) error {
+	tf, err := s.repo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorNotFound) {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+	if !tf.IsEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.verifyTOTP(ctx, tf, code)
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// verifyTOTP checks a TOTP code and rejects replays of an already used step
+func (s *service) verifyTOTP(ctx context.Context, tf *TwoFactor, code string) error {
+	step, ok := totp.Validate(tf.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	fresh, err := s.repo.UpdateTwoFactorStep(ctx, tf.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// issueRecoveryCodes generates, stores (hashed) and returns new recovery codes
+func (s *service) issueRecoveryCodes(ctx context.Context, userID int64) (*RecoveryCodesResponse, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return raw[:5] + "-" + raw[5:], nil
+}
+
+// normalizeRecoveryCode strips formatting so codes match regardless of case or dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,95 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/webhook"
+)
+
+// maxWebhookBody caps the size of a billing webhook request
+const maxWebhookBody = 64 << 10
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(http.Handler) http.Handler) {
+	// Webhooks are signed by the billing provider, so they work without a login
+	router.HandleFunc("/api/v1/billing/webhook", handler.Webhook).Methods("POST")
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(authMiddleware)
+	api.Use(common.RequireScopeByMethod(common.ScopeUsersRead, common.ScopeUsersWrite))
+
+	api.HandleFunc("/billing/plans", handler.GetPlans).Methods("GET")
+	api.HandleFunc("/billing/entitlements", handler.GetEntitlements).Methods("GET")
+}
+
+// GetPlans lists the plans an account can subscribe to
+func (h *Handler) GetPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.service.GetPlans(r.Context())
+	if err != nil {
+		common.InternalError(w, "Failed to get plans")
+		return
+	}
+
+	common.Success(w, "", plans)
+}
+
+// GetEntitlements returns the current user's plan, limits and usage
+func (h *Handler) GetEntitlements(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	entitlements, err := h.service.GetEntitlements(r.Context(), userID)
+	if err != nil {
+		common.InternalError(w, "Failed to get entitlements")
+		return
+	}
+
+	common.Success(w, "", entitlements)
+}
+
+// Webhook receives plan changes from the billing provider. Failures other
+// than bad requests answer with an error status so the provider retries.
+func (h *Handler) Webhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		common.BadRequest(w, "Failed to read request body")
+		return
+	}
+
+	err = h.service.HandleWebhook(r.Context(), payload, r.Header.Get(webhook.SignatureHeader))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWebhookDisabled):
+			common.NotFound(w, "Billing webhook is not configured")
+		case errors.Is(err, ErrInvalidSignature):
+			common.Unauthorized(w, "Invalid signature")
+		case errors.Is(err, ErrInvalidEvent):
+			common.BadRequest(w, err.Error())
+		case errors.Is(err, ErrPlanNotFound):
+			common.BadRequest(w, "Unknown plan")
+		case errors.Is(err, ErrUserNotFound):
+			common.NotFound(w, "User not found")
+		default:
+			fmt.Printf("ERROR: Failed to handle billing webhook: %v\n", err)
+			common.InternalError(w, "Failed to handle event")
+		}
+		return
+	}
+
+	common.Success(w, "Event received", nil)
+}
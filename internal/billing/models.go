@@ -0,0 +1,102 @@
+package billing
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+// Subscription statuses
+const (
+	StatusActive   = "active"
+	StatusTrialing = "trialing"
+	StatusPastDue  = "past_due" // Payment failed; the plan stays until the period ends
+	StatusCanceled = "canceled"
+)
+
+// Webhook event types
+const (
+	EventSubscriptionCreated  = "subscription.created"
+	EventSubscriptionUpdated  = "subscription.updated"
+	EventSubscriptionCanceled = "subscription.canceled"
+)
+
+// Plan is a set of limits an account can subscribe to
+type Plan struct {
+	ID               int64     `json:"id" db:"id"`
+	Code             string    `json:"code" db:"code"`
+	Name             string    `json:"name" db:"name"`
+	Position         int       `json:"-" db:"position"`
+	MaxPostMedia     int64     `json:"max_post_media" db:"max_post_media"`
+	MaxStoryDuration int64     `json:"max_story_duration" db:"max_story_duration"`
+	MaxGroupChatSize int64     `json:"max_group_chat_size" db:"max_group_chat_size"`
+	StorageQuota     int64     `json:"storage_quota" db:"storage_quota"`
+	IsDefault        bool      `json:"is_default" db:"is_default"`
+	CreatedAt        time.Time `json:"-" db:"created_at"`
+	UpdatedAt        time.Time `json:"-" db:"updated_at"`
+}
+
+// Limit returns the plan's value for one of the common.Limit* names
+func (p *Plan) Limit(name string) (int64, bool) {
+	switch name {
+	case common.LimitPostMedia:
+		return p.MaxPostMedia, true
+	case common.LimitStoryDuration:
+		return p.MaxStoryDuration, true
+	case common.LimitGroupChatSize:
+		return p.MaxGroupChatSize, true
+	case common.LimitStorage:
+		return p.StorageQuota, true
+	}
+	return 0, false
+}
+
+// Subscription links an account to a paid plan
+type Subscription struct {
+	ID               int64      `json:"id" db:"id"`
+	TenantID         int64      `json:"-" db:"tenant_id"`
+	UserID           int64      `json:"user_id" db:"user_id"`
+	PlanID           int64      `json:"plan_id" db:"plan_id"`
+	PlanCode         string     `json:"plan" db:"plan_code"`
+	Status           string     `json:"status" db:"status"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty" db:"current_period_end"`
+	CustomerID       *string    `json:"customer_id,omitempty" db:"customer_id"`
+	ExternalID       *string    `json:"external_id,omitempty" db:"external_id"`
+	LastEventAt      time.Time  `json:"-" db:"last_event_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Entitles reports whether the subscription still grants its plan
+func (s *Subscription) Entitles() bool {
+	if s.Status == StatusCanceled {
+		return false
+	}
+	return s.CurrentPeriodEnd == nil || time.Now().Before(*s.CurrentPeriodEnd)
+}
+
+// Entitlements is the plan that applies to an account and what it has used
+type Entitlements struct {
+	Plan         *Plan         `json:"plan"`
+	Subscription *Subscription `json:"subscription,omitempty"`
+	StorageUsed  int64         `json:"storage_used"`
+}
+
+// WebhookEvent is a notification from the billing provider
+type WebhookEvent struct {
+	ID        string          `json:"id" validate:"required,max=255"`
+	Type      string          `json:"type" validate:"required,max=50"`
+	CreatedAt time.Time       `json:"created_at" validate:"required"`
+	Data      json.RawMessage `json:"data" validate:"required"`
+}
+
+// SubscriptionEventData is the data of subscription events
+type SubscriptionEventData struct {
+	UserID           int64      `json:"user_id" validate:"required"`
+	Plan             string     `json:"plan" validate:"required,max=50"`
+	Status           string     `json:"status" validate:"required,oneof=active trialing past_due canceled"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty"`
+	CustomerID       *string    `json:"customer_id,omitempty" validate:"omitempty,max=255"`
+	SubscriptionID   *string    `json:"subscription_id,omitempty" validate:"omitempty,max=255"`
+}
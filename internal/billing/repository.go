@@ -0,0 +1,245 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+var (
+	ErrPlanNotFound         = errors.New("plan not found")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrDuplicateEvent       = errors.New("event already processed")
+	ErrStorageExceeded      = errors.New("storage quota exceeded")
+	ErrNoDefaultPlan        = errors.New("no default plan configured")
+)
+
+// Repository defines billing data operations
+type Repository interface {
+	// Plans
+	GetPlans(ctx context.Context) ([]*Plan, error)
+	GetPlanByCode(ctx context.Context, code string) (*Plan, error)
+	GetUserPlan(ctx context.Context, userID int64) (*Plan, *Subscription, error)
+
+	// Subscriptions
+	GetSubscription(ctx context.Context, userID int64) (*Subscription, error)
+	ApplySubscriptionEvent(ctx context.Context, event *WebhookEvent, sub *Subscription) error
+
+	// Storage usage
+	GetStorageUsed(ctx context.Context, userID int64) (int64, error)
+	ReserveStorage(ctx context.Context, userID, bytes, quota int64) error
+	ReleaseStorage(ctx context.Context, userID, bytes int64) error
+
+	// Account deletion
+	EraseUserData(ctx context.Context, userID int64) error
+}
+
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresRepository(db *sqlx.DB) Repository {
+	return &PostgresRepository{db: db}
+}
+
+const planColumns = `p.id, p.code, p.name, p.position, p.max_post_media, p.max_story_duration,
+	p.max_group_chat_size, p.storage_quota, p.is_default, p.created_at, p.updated_at`
+
+// GetPlans lists every plan in upgrade order
+func (r *PostgresRepository) GetPlans(ctx context.Context) ([]*Plan, error) {
+	plans := []*Plan{}
+	query := `SELECT ` + planColumns + ` FROM plans p ORDER BY p.position, p.id`
+	err := r.db.SelectContext(ctx, &plans, query)
+	return plans, err
+}
+
+func (r *PostgresRepository) GetPlanByCode(ctx context.Context, code string) (*Plan, error) {
+	plan := &Plan{}
+	query := `SELECT ` + planColumns + ` FROM plans p WHERE p.code = $1`
+	err := r.db.GetContext(ctx, plan, query, code)
+	if err == sql.ErrNoRows {
+		return nil, ErrPlanNotFound
+	}
+	return plan, err
+}
+
+// GetUserPlan returns the plan that applies to the user: the subscribed plan
+// while the subscription entitles them to it, otherwise the default plan.
+// The subscription is returned whenever one exists, even if it has lapsed.
+func (r *PostgresRepository) GetUserPlan(ctx context.Context, userID int64) (*Plan, *Subscription, error) {
+	sub, err := r.GetSubscription(ctx, userID)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		sub = nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	plan := &Plan{}
+	if sub != nil && sub.Entitles() {
+		query := `SELECT ` + planColumns + ` FROM plans p WHERE p.id = $1`
+		err = r.db.GetContext(ctx, plan, query, sub.PlanID)
+	} else {
+		query := `SELECT ` + planColumns + ` FROM plans p WHERE p.is_default`
+		err = r.db.GetContext(ctx, plan, query)
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrNoDefaultPlan
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, sub, nil
+}
+
+// GetSubscription returns the user's subscription, including a lapsed one
+func (r *PostgresRepository) GetSubscription(ctx context.Context, userID int64) (*Subscription, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscription{}
+	query := `
+		SELECT s.id, s.tenant_id, s.user_id, s.plan_id, p.code AS plan_code, s.status, s.current_period_end,
+		       s.customer_id, s.external_id, s.last_event_at, s.created_at, s.updated_at
+		FROM user_subscriptions s
+		JOIN plans p ON p.id = s.plan_id
+		WHERE s.tenant_id = $1 AND s.user_id = $2`
+	err = r.db.GetContext(ctx, sub, query, tenantID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrSubscriptionNotFound
+	}
+	return sub, err
+}
+
+// ApplySubscriptionEvent records a webhook event and stores the subscription
+// it describes in one transaction. It returns ErrDuplicateEvent for events
+// already processed, and leaves the subscription alone if a newer event has
+// already been applied to it.
+func (r *PostgresRepository) ApplySubscriptionEvent(ctx context.Context, event *WebhookEvent, sub *Subscription) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	sub.TenantID = tenantID
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND tenant_id = $2)`
+	if err := tx.GetContext(ctx, &exists, query, sub.UserID, tenantID); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	query = `
+		INSERT INTO billing_events (tenant_id, event_id, event_type, user_id, payload)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, event_id) DO NOTHING`
+	result, err := tx.ExecContext(ctx, query, tenantID, event.ID, event.Type, sub.UserID, string(event.Data))
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrDuplicateEvent
+	}
+
+	query = `
+		INSERT INTO user_subscriptions (tenant_id, user_id, plan_id, status, current_period_end, customer_id, external_id, last_event_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET
+			plan_id = EXCLUDED.plan_id, status = EXCLUDED.status, current_period_end = EXCLUDED.current_period_end,
+			customer_id = COALESCE(EXCLUDED.customer_id, user_subscriptions.customer_id),
+			external_id = COALESCE(EXCLUDED.external_id, user_subscriptions.external_id),
+			last_event_at = EXCLUDED.last_event_at
+		WHERE user_subscriptions.last_event_at < EXCLUDED.last_event_at`
+	if _, err := tx.ExecContext(ctx, query,
+		sub.TenantID, sub.UserID, sub.PlanID, sub.Status, sub.CurrentPeriodEnd, sub.CustomerID, sub.ExternalID, sub.LastEventAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetStorageUsed returns the bytes of media the user has stored
+func (r *PostgresRepository) GetStorageUsed(ctx context.Context, userID int64) (int64, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	query := `SELECT bytes_used FROM storage_usage WHERE tenant_id = $1 AND user_id = $2`
+	err = r.db.GetContext(ctx, &used, query, tenantID, userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return used, err
+}
+
+// ReserveStorage adds bytes to the user's usage if that keeps it within
+// quota, and returns ErrStorageExceeded otherwise
+func (r *PostgresRepository) ReserveStorage(ctx context.Context, userID, bytes, quota int64) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO storage_usage (tenant_id, user_id, bytes_used)
+		SELECT $1, $2, $3 WHERE $3 <= $4
+		ON CONFLICT (user_id) DO UPDATE SET
+			bytes_used = storage_usage.bytes_used + EXCLUDED.bytes_used, updated_at = CURRENT_TIMESTAMP
+		WHERE storage_usage.bytes_used + EXCLUDED.bytes_used <= $4`
+	result, err := r.db.ExecContext(ctx, query, tenantID, userID, bytes, quota)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrStorageExceeded
+	}
+	return nil
+}
+
+// ReleaseStorage gives back bytes of deleted media
+func (r *PostgresRepository) ReleaseStorage(ctx context.Context, userID, bytes int64) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE storage_usage SET bytes_used = GREATEST(bytes_used - $3, 0), updated_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND user_id = $2`
+	_, err = r.db.ExecContext(ctx, query, tenantID, userID, bytes)
+	return err
+}
+
+// EraseUserData removes a deleted account's subscription and usage. The
+// billing provider keeps its own records.
+func (r *PostgresRepository) EraseUserData(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"user_subscriptions", "storage_usage", "billing_events"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
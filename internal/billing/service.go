@@ -0,0 +1,221 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/webhook"
+)
+
+var (
+	ErrWebhookDisabled  = errors.New("billing webhook is not configured")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidEvent     = errors.New("invalid webhook event")
+)
+
+// Config holds billing settings
+type Config struct {
+	WebhookSecret    string        // Empty disables the webhook
+	WebhookTolerance time.Duration // Accepted age of a webhook signature
+}
+
+// Service defines plan and entitlement operations
+type Service interface {
+	GetPlans(ctx context.Context) ([]*Plan, error)
+	GetEntitlements(ctx context.Context, userID int64) (*Entitlements, error)
+
+	// CheckLimit returns a *common.UpgradeRequiredError if requested goes
+	// beyond the user's plan. For common.LimitStorage, requested is the
+	// number of bytes about to be added to what the user already stores.
+	CheckLimit(ctx context.Context, userID int64, limit string, requested int64) error
+	ReserveStorage(ctx context.Context, userID, bytes int64) error
+	ReleaseStorage(ctx context.Context, userID, bytes int64) error
+
+	HandleWebhook(ctx context.Context, payload []byte, signature string) error
+
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
+}
+
+type service struct {
+	repo   Repository
+	config *Config
+}
+
+func NewService(repo Repository, config *Config) Service {
+	if config.WebhookTolerance <= 0 {
+		config.WebhookTolerance = 5 * time.Minute
+	}
+	return &service{repo: repo, config: config}
+}
+
+func (s *service) GetPlans(ctx context.Context) ([]*Plan, error) {
+	return s.repo.GetPlans(ctx)
+}
+
+// GetEntitlements returns the user's plan, subscription and storage use
+func (s *service) GetEntitlements(ctx context.Context, userID int64) (*Entitlements, error) {
+	plan, sub, err := s.repo.GetUserPlan(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.repo.GetStorageUsed(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Entitlements{Plan: plan, Subscription: sub, StorageUsed: used}, nil
+}
+
+func (s *service) CheckLimit(ctx context.Context, userID int64, limit string, requested int64) error {
+	plan, _, err := s.repo.GetUserPlan(ctx, userID)
+	if err != nil {
+		return err
+	}
+	allowed, ok := plan.Limit(limit)
+	if !ok {
+		return fmt.Errorf("unknown plan limit %q", limit)
+	}
+
+	if limit == common.LimitStorage {
+		used, err := s.repo.GetStorageUsed(ctx, userID)
+		if err != nil {
+			return err
+		}
+		requested += used
+	}
+
+	if requested <= allowed {
+		return nil
+	}
+	return s.upgradeRequired(ctx, plan, limit, allowed, requested)
+}
+
+// ReserveStorage counts bytes about to be stored against the user's quota
+func (s *service) ReserveStorage(ctx context.Context, userID, bytes int64) error {
+	plan, _, err := s.repo.GetUserPlan(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.ReserveStorage(ctx, userID, bytes, plan.StorageQuota)
+	if !errors.Is(err, ErrStorageExceeded) {
+		return err
+	}
+
+	used, err := s.repo.GetStorageUsed(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.upgradeRequired(ctx, plan, common.LimitStorage, plan.StorageQuota, used+bytes)
+}
+
+// ReleaseStorage gives back the quota of deleted media
+func (s *service) ReleaseStorage(ctx context.Context, userID, bytes int64) error {
+	return s.repo.ReleaseStorage(ctx, userID, bytes)
+}
+
+// upgradeRequired builds the error for a breached limit, naming the cheapest
+// plan above the current one that allows the request
+func (s *service) upgradeRequired(ctx context.Context, plan *Plan, limit string, allowed, requested int64) error {
+	upgradeErr := common.NewUpgradeRequiredError(limit, plan.Code, allowed, requested, "")
+
+	plans, err := s.repo.GetPlans(ctx)
+	if err != nil {
+		fmt.Printf("WARNING: Failed to load plans for upgrade suggestion: %v\n", err)
+		return upgradeErr
+	}
+	for _, p := range plans {
+		if value, _ := p.Limit(limit); p.Position > plan.Position && value >= requested {
+			upgradeErr.UpgradeTo = p.Code
+			break
+		}
+	}
+	return upgradeErr
+}
+
+// HandleWebhook verifies and applies an event from the billing provider.
+// Redelivered and unknown events are accepted without effect.
+func (s *service) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	if s.config.WebhookSecret == "" {
+		return ErrWebhookDisabled
+	}
+	if err := webhook.Verify(s.config.WebhookSecret, signature, payload, s.config.WebhookTolerance, time.Now()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if errs := common.ValidateStruct(&event); errs != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, errs)
+	}
+
+	switch event.Type {
+	case EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionCanceled:
+		return s.applySubscriptionEvent(ctx, &event)
+	default:
+		fmt.Printf("INFO: Ignoring billing event - ID: %s, Type: %s\n", event.ID, event.Type)
+		return nil
+	}
+}
+
+func (s *service) applySubscriptionEvent(ctx context.Context, event *WebhookEvent) error {
+	var data SubscriptionEventData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if event.Type == EventSubscriptionCanceled {
+		data.Status = StatusCanceled
+	}
+	if errs := common.ValidateStruct(&data); errs != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, errs)
+	}
+
+	plan, err := s.repo.GetPlanByCode(ctx, data.Plan)
+	if err != nil {
+		return err
+	}
+
+	sub := &Subscription{
+		UserID:           data.UserID,
+		PlanID:           plan.ID,
+		Status:           data.Status,
+		CurrentPeriodEnd: data.CurrentPeriodEnd,
+		CustomerID:       data.CustomerID,
+		ExternalID:       data.SubscriptionID,
+		LastEventAt:      event.CreatedAt,
+	}
+	if err := s.repo.ApplySubscriptionEvent(ctx, event, sub); err != nil {
+		if errors.Is(err, ErrDuplicateEvent) {
+			fmt.Printf("INFO: Skipping redelivered billing event - ID: %s\n", event.ID)
+			return nil
+		}
+		return err
+	}
+
+	fmt.Printf("INFO: Subscription updated - UserID: %d, Plan: %s, Status: %s, Event: %s\n",
+		data.UserID, plan.Code, data.Status, event.ID)
+	return nil
+}
+
+// EraseUserData removes a deleted account's subscription and storage usage
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	return nil, s.repo.EraseUserData(ctx, userID)
+}
+
+// ExportUserData returns the user's plan and subscription for a personal data export
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	entitlements, err := s.GetEntitlements(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export billing: %w", err)
+	}
+
+	return map[string]interface{}{
+		"billing": entitlements,
+	}, nil
+}
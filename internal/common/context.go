@@ -13,8 +13,35 @@ const (
 	UsernameKey  contextKey = "username"
 	EmailKey     contextKey = "email"
 	SessionIDKey contextKey = "session_id"
+	RolesKey     contextKey = "roles"
+	ScopesKey    contextKey = "scopes"   // Only set for personal access tokens
+	TokenIDKey   contextKey = "token_id" // Only set for personal access tokens
+
+	ImpersonatorIDKey  contextKey = "impersonator_id"  // Only set while an admin impersonates the user
+	ImpersonationIDKey contextKey = "impersonation_id" // Only set while an admin impersonates the user
+
+	TenantIDKey       contextKey = "tenant_id"
+	TenantFromHostKey contextKey = "tenant_from_host" // True when the Host header chose the tenant
+
+	ClientIPKey contextKey = "client_ip" // Set by ClientIPResolver
+
+	AuthCheckKey contextKey = "auth_check" // Set by authentication, see RecheckAuth
 )
 
+// AuthCheck re-checks the credentials a request was authenticated with
+type AuthCheck func(ctx context.Context) error
+
+// RecheckAuth reports whether the session or token the request was
+// authenticated with is still valid, for connections that outlive the
+// request such as WebSockets
+func RecheckAuth(ctx context.Context) error {
+	check, ok := ctx.Value(AuthCheckKey).(AuthCheck)
+	if !ok {
+		return errors.New("request was not authenticated")
+	}
+	return check(ctx)
+}
+
 // GetUserID extracts user ID from context
 func GetUserID(ctx context.Context) (int64, error) {
 	userID, ok := ctx.Value(UserIDKey).(int64)
@@ -51,6 +78,28 @@ func GetSessionID(ctx context.Context) (string, error) {
 	return sessionID, nil
 }
 
+// GetRoles extracts the user's roles from context
+func GetRoles(ctx context.Context) []string {
+	roles, _ := ctx.Value(RolesKey).([]string)
+	return roles
+}
+
+// HasRole reports whether the user in context has the given role
+func HasRole(ctx context.Context, role string) bool {
+	for _, r := range GetRoles(ctx) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTokenID returns the personal access token that authenticated the request
+func GetTokenID(ctx context.Context) (int64, bool) {
+	tokenID, ok := ctx.Value(TokenIDKey).(int64)
+	return tokenID, ok
+}
+
 // SetUserContext creates a new context with user information
 func SetUserContext(ctx context.Context, userID int64, username, email string) context.Context {
 	ctx = context.WithValue(ctx, UserIDKey, userID)
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Plan limits a service checks before acting
+const (
+	LimitPostMedia     = "max_post_media"      // Media items on one post
+	LimitStoryDuration = "max_story_duration"  // Story display time in seconds
+	LimitGroupChatSize = "max_group_chat_size" // Participants in a group conversation, creator included
+	LimitStorage       = "storage_quota"       // Bytes of uploaded media
+)
+
+// UpgradeRequiredError reports that an action goes beyond what the user's
+// plan allows. It is sent to clients as is, so they can offer an upgrade.
+type UpgradeRequiredError struct {
+	Code      string `json:"code"` // Always "upgrade_required"
+	Limit     string `json:"limit"`
+	Plan      string `json:"plan"`
+	Allowed   int64  `json:"allowed"`
+	Requested int64  `json:"requested"`
+	UpgradeTo string `json:"upgrade_to,omitempty"` // Cheapest plan that allows the action, if any
+}
+
+// NewUpgradeRequiredError creates an UpgradeRequiredError
+func NewUpgradeRequiredError(limit, plan string, allowed, requested int64, upgradeTo string) *UpgradeRequiredError {
+	return &UpgradeRequiredError{
+		Code:      "upgrade_required",
+		Limit:     limit,
+		Plan:      plan,
+		Allowed:   allowed,
+		Requested: requested,
+		UpgradeTo: upgradeTo,
+	}
+}
+
+func (e *UpgradeRequiredError) Error() string {
+	return fmt.Sprintf("%s plan allows %s of %d, %d requested", e.Plan, e.Limit, e.Allowed, e.Requested)
+}
+
+// UpgradeRequired sends a 402 error describing the limit that was reached
+func UpgradeRequired(w http.ResponseWriter, err *UpgradeRequiredError) {
+	JSON(w, http.StatusPaymentRequired, Response{
+		Success: false,
+		Error:   "Your plan does not allow this, upgrade to continue",
+		Data:    err,
+	})
+}
+
+// WriteUpgradeRequired sends an UpgradeRequired response if err is an
+// UpgradeRequiredError, reporting whether it did
+func WriteUpgradeRequired(w http.ResponseWriter, err error) bool {
+	var upgradeErr *UpgradeRequiredError
+	if !errors.As(err, &upgradeErr) {
+		return false
+	}
+	UpgradeRequired(w, upgradeErr)
+	return true
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"context"
+	"net/http"
+)
+
+// GetImpersonatorID returns the admin acting as the user. ok is false unless
+// the request was made with an impersonation token.
+func GetImpersonatorID(ctx context.Context) (adminID int64, ok bool) {
+	adminID, ok = ctx.Value(ImpersonatorIDKey).(int64)
+	return adminID, ok
+}
+
+// GetImpersonationID returns the impersonation session behind the request
+func GetImpersonationID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(ImpersonationIDKey).(int64)
+	return id, ok
+}
+
+// IsImpersonating reports whether an admin is acting as the user
+func IsImpersonating(ctx context.Context) bool {
+	_, ok := GetImpersonatorID(ctx)
+	return ok
+}
+
+// BlockImpersonation refuses the request while an admin is impersonating the
+// user, for destructive or account-changing endpoints. It must run after
+// authentication.
+func BlockImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsImpersonating(r.Context()) {
+			Forbidden(w, "Not allowed while impersonating a user")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
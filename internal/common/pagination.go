@@ -0,0 +1,17 @@
+package common
+
+// CollectPages calls fetch with growing offsets until it returns a short page
+// and returns every item. It turns limit/offset list methods into full reads.
+func CollectPages[T any](pageSize int, fetch func(limit, offset int) ([]T, error)) ([]T, error) {
+	var all []T
+	for offset := 0; ; offset += pageSize {
+		page, err := fetch(pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < pageSize {
+			return all, nil
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"net/http"
+)
+
+// Personal access token scopes. A write scope also grants the matching read scope.
+const (
+	ScopeUsersRead          = "users:read"
+	ScopeUsersWrite         = "users:write"
+	ScopePostsRead          = "posts:read"
+	ScopePostsWrite         = "posts:write"
+	ScopeStoriesRead        = "stories:read"
+	ScopeStoriesWrite       = "stories:write"
+	ScopeMessagesRead       = "messages:read"
+	ScopeMessagesWrite      = "messages:write"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeNotificationsWrite = "notifications:write"
+	ScopeGroupsRead         = "groups:read"
+	ScopeGroupsWrite        = "groups:write"
+)
+
+// impliedScopes maps each write scope to the read scope it includes
+var impliedScopes = map[string]string{
+	ScopeUsersWrite:         ScopeUsersRead,
+	ScopePostsWrite:         ScopePostsRead,
+	ScopeStoriesWrite:       ScopeStoriesRead,
+	ScopeMessagesWrite:      ScopeMessagesRead,
+	ScopeNotificationsWrite: ScopeNotificationsRead,
+	ScopeGroupsWrite:        ScopeGroupsRead,
+}
+
+// AllScopes lists every scope a token can be granted
+var AllScopes = []string{
+	ScopeUsersRead, ScopeUsersWrite,
+	ScopePostsRead, ScopePostsWrite,
+	ScopeStoriesRead, ScopeStoriesWrite,
+	ScopeMessagesRead, ScopeMessagesWrite,
+	ScopeNotificationsRead, ScopeNotificationsWrite,
+	ScopeGroupsRead, ScopeGroupsWrite,
+}
+
+// ValidScope reports whether scope is a known scope
+func ValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GetScopes returns the scopes of a token-authenticated request. ok is false
+// for session logins, which are not limited by scopes.
+func GetScopes(ctx context.Context) (scopes []string, ok bool) {
+	scopes, ok = ctx.Value(ScopesKey).([]string)
+	return scopes, ok
+}
+
+// HasScope reports whether the request may act within scope
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, ok := GetScopes(ctx)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope || impliedScopes[s] == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope allows the request only if it holds every given scope.
+// It must run after authentication.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, scope := range scopes {
+				if !HasScope(r.Context(), scope) {
+					Forbidden(w, "Token is missing the "+scope+" scope")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScopeByMethod requires readScope for safe methods and writeScope for
+// everything else. It must run after authentication.
+func RequireScopeByMethod(readScope, writeScope string) func(http.Handler) http.Handler {
+	read, write := RequireScope(readScope), RequireScope(writeScope)
+	return func(next http.Handler) http.Handler {
+		readNext, writeNext := read(next), write(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				readNext.ServeHTTP(w, r)
+			default:
+				writeNext.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"context"
+	"errors"
+)
+
+// Tenant errors
+var (
+	ErrNoTenant       = errors.New("tenant not found in context")
+	ErrTenantMismatch = errors.New("token belongs to another tenant")
+)
+
+// WithTenant scopes ctx to a tenant. fromHost records that the tenant was
+// matched from the request's Host header, so a token cannot override it.
+func WithTenant(ctx context.Context, tenantID int64, fromHost bool) context.Context {
+	ctx = context.WithValue(ctx, TenantIDKey, tenantID)
+	return context.WithValue(ctx, TenantFromHostKey, fromHost)
+}
+
+// GetTenantID returns the tenant the request or job is scoped to. Tenant-scoped
+// reads and writes fail with ErrNoTenant rather than run unscoped.
+func GetTenantID(ctx context.Context) (int64, error) {
+	tenantID, ok := ctx.Value(TenantIDKey).(int64)
+	if !ok || tenantID == 0 {
+		return 0, ErrNoTenant
+	}
+	return tenantID, nil
+}
+
+// ScopeToTokenTenant scopes ctx to the tenant a token was issued for. The
+// token replaces a fallback tenant but must agree with one matched by Host.
+func ScopeToTokenTenant(ctx context.Context, tenantID int64) (context.Context, error) {
+	if tenantID == 0 {
+		return ctx, ErrNoTenant
+	}
+	if current, err := GetTenantID(ctx); err == nil && current == tenantID {
+		return ctx, nil
+	}
+	if fromHost, _ := ctx.Value(TenantFromHostKey).(bool); fromHost {
+		return ctx, ErrTenantMismatch
+	}
+	return WithTenant(ctx, tenantID, false), nil
+}
@@ -0,0 +1,136 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// buildArchive writes every registered module's data for the user to a new
+// ZIP file and returns its path and size
+func (s *service) buildArchive(ctx context.Context, exportID, userID int64) (path string, size int64, err error) {
+	if err := os.MkdirAll(s.config.Dir, 0o700); err != nil {
+		return "", 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	path = s.archivePath(exportID)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(path)
+		}
+	}()
+
+	zw := zip.NewWriter(file)
+	written := map[string]bool{}
+	for _, exporter := range s.exporters {
+		sections, err := exporter.ExportUserData(ctx, userID)
+		if err != nil {
+			return "", 0, err
+		}
+
+		names := make([]string, 0, len(sections))
+		for name := range sections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if written[name] {
+				return "", 0, fmt.Errorf("duplicate export section %q", name)
+			}
+			written[name] = true
+			if err := writeJSON(zw, name+".json", sections[name]); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+
+	if err := writeJSON(zw, "export.json", map[string]interface{}{
+		"export_id":    exportID,
+		"user_id":      userID,
+		"generated_at": time.Now().UTC(),
+	}); err != nil {
+		return "", 0, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", 0, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+// archivePath returns where an export's archive is written
+func (s *service) archivePath(exportID int64) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("export-%d-%s.zip", exportID, randomSuffix()))
+}
+
+// writeJSON adds one indented JSON file to the archive
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// sign returns the download link signature for an export's download token
+// and expiry time
+func (s *service) sign(token string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	mac.Write([]byte("export:" + token + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks a download link signature in constant time
+func (s *service) verifySignature(token string, expires int64, signature string) bool {
+	expected := s.sign(token, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// newDownloadToken returns the random name an export's download link uses
+func newDownloadToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate download token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomSuffix makes archive file names unguessable
+func randomSuffix() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(http.Handler) http.Handler) {
+	// Download links are signed and name the export by a random token, so
+	// they work without a login
+	router.HandleFunc("/api/v1/exports/{token}/download", handler.Download).Methods("GET")
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(authMiddleware)
+	// An archive holds everything the account can read, so tokens need every read scope
+	api.Use(common.RequireScope(common.ScopeUsersRead, common.ScopePostsRead, common.ScopeStoriesRead,
+		common.ScopeMessagesRead, common.ScopeNotificationsRead, common.ScopeGroupsRead))
+	// An admin impersonating a user must not take their data, or the signed
+	// links to it
+	api.Use(common.BlockImpersonation)
+
+	api.HandleFunc("/exports", handler.RequestExport).Methods("POST")
+	api.HandleFunc("/exports", handler.GetExports).Methods("GET")
+	api.HandleFunc("/exports/{id}", handler.GetExport).Methods("GET")
+}
+
+// RequestExport starts building an archive of the user's data
+func (h *Handler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	export, err := h.service.RequestExport(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrExportInProgress) {
+			common.Conflict(w, "An export is already being prepared")
+			return
+		}
+		common.InternalError(w, "Failed to start export")
+		return
+	}
+
+	common.JSON(w, http.StatusAccepted, common.Response{
+		Success: true,
+		Message: "Your export is being prepared. You will be notified when it is ready.",
+		Data:    export,
+	})
+}
+
+// GetExports lists the user's recent exports
+func (h *Handler) GetExports(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	exports, err := h.service.GetExports(r.Context(), userID)
+	if err != nil {
+		common.InternalError(w, "Failed to get exports")
+		return
+	}
+
+	common.Success(w, "", exports)
+}
+
+// GetExport returns an export's status and, once ready, its download link
+func (h *Handler) GetExport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	exportID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid export ID")
+		return
+	}
+
+	export, err := h.service.GetExport(r.Context(), userID, exportID)
+	if err != nil {
+		if errors.Is(err, ErrExportNotFound) {
+			common.NotFound(w, "Export not found")
+			return
+		}
+		common.InternalError(w, "Failed to get export")
+		return
+	}
+
+	common.Success(w, "", export)
+}
+
+// Download serves an export archive through its signed link
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		common.Forbidden(w, ErrInvalidSignature.Error())
+		return
+	}
+
+	file, export, err := h.service.OpenDownload(r.Context(), mux.Vars(r)["token"], expires, r.URL.Query().Get("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidSignature):
+			common.Forbidden(w, "Download link is invalid or has expired")
+		case errors.Is(err, ErrExportNotFound), errors.Is(err, ErrExportNotReady):
+			common.NotFound(w, "Export not found")
+		default:
+			common.InternalError(w, "Failed to download export")
+		}
+		return
+	}
+	defer file.Close()
+
+	modified := export.CreatedAt
+	if export.CompletedAt != nil {
+		modified = *export.CompletedAt
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="kiekky-data-%d.zip"`, export.ID))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", modified, file)
+}
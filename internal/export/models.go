@@ -0,0 +1,29 @@
+package export
+
+import (
+	"time"
+)
+
+// Export statuses
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusExpired    = "expired"
+)
+
+// Export is a personal data export job and its archive
+type Export struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	Status      string     `json:"status" db:"status"`
+	Token       *string    `json:"-" db:"download_token"` // Names the export in its download link
+	FilePath    *string    `json:"-" db:"file_path"`
+	FileSize    *int64     `json:"file_size,omitempty" db:"file_size"`
+	Error       *string    `json:"-" db:"error"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	DownloadURL string     `json:"download_url,omitempty" db:"-"` // Signed link, set once completed
+}
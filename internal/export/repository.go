@@ -0,0 +1,154 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrExportNotFound   = errors.New("export not found")
+	ErrExportInProgress = errors.New("an export is already in progress")
+	ErrExportNotReady   = errors.New("export is not ready")
+	ErrInvalidSignature = errors.New("download link is invalid or has expired")
+)
+
+// Repository defines data export job operations
+type Repository interface {
+	CreateExport(ctx context.Context, userID int64, token string) (*Export, error)
+	GetExportByID(ctx context.Context, id int64) (*Export, error)
+	GetExportByToken(ctx context.Context, token string) (*Export, error)
+	GetUserExports(ctx context.Context, userID int64, limit int) ([]*Export, error)
+	MarkProcessing(ctx context.Context, id int64) error
+	MarkCompleted(ctx context.Context, id int64, filePath string, fileSize int64, expiresAt time.Time) error
+	MarkFailed(ctx context.Context, id int64, reason string) error
+	GetExpiredExports(ctx context.Context, limit int) ([]*Export, error)
+	MarkExpired(ctx context.Context, id int64) error
+	DeleteUserExports(ctx context.Context, userID int64) ([]string, error)
+}
+
+// PostgresRepository implements Repository for PostgreSQL
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+// NewPostgresRepository creates a new PostgreSQL repository
+func NewPostgresRepository(db *sqlx.DB) Repository {
+	return &PostgresRepository{db: db}
+}
+
+const exportColumns = `id, user_id, status, download_token, file_path, file_size, error, expires_at, completed_at, created_at`
+
+// CreateExport queues an export unless the user already has one running. Jobs
+// older than an hour are treated as abandoned, e.g. after a restart.
+func (r *PostgresRepository) CreateExport(ctx context.Context, userID int64, token string) (*Export, error) {
+	export := &Export{}
+	query := `
+		INSERT INTO data_exports (user_id, status, download_token)
+		SELECT $1, 'pending', $2
+		WHERE NOT EXISTS(
+			SELECT 1 FROM data_exports
+			WHERE user_id = $1 AND status IN ('pending', 'processing')
+				AND created_at > CURRENT_TIMESTAMP - INTERVAL '1 hour'
+		)
+		RETURNING ` + exportColumns
+	err := r.db.GetContext(ctx, export, query, userID, token)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetExportByID retrieves an export job
+func (r *PostgresRepository) GetExportByID(ctx context.Context, id int64) (*Export, error) {
+	export := &Export{}
+	err := r.db.GetContext(ctx, export, `SELECT `+exportColumns+` FROM data_exports WHERE id = $1`, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetExportByToken retrieves the export a download link names
+func (r *PostgresRepository) GetExportByToken(ctx context.Context, token string) (*Export, error) {
+	export := &Export{}
+	err := r.db.GetContext(ctx, export, `SELECT `+exportColumns+` FROM data_exports WHERE download_token = $1`, token)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetUserExports lists a user's most recent exports
+func (r *PostgresRepository) GetUserExports(ctx context.Context, userID int64, limit int) ([]*Export, error) {
+	exports := []*Export{}
+	query := `SELECT ` + exportColumns + ` FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2`
+	err := r.db.SelectContext(ctx, &exports, query, userID, limit)
+	return exports, err
+}
+
+// MarkProcessing records that the export job has started
+func (r *PostgresRepository) MarkProcessing(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE data_exports SET status = 'processing' WHERE id = $1`, id)
+	return err
+}
+
+// MarkCompleted records the finished archive and when its link expires
+func (r *PostgresRepository) MarkCompleted(ctx context.Context, id int64, filePath string, fileSize int64, expiresAt time.Time) error {
+	query := `
+		UPDATE data_exports SET status = 'completed', file_path = $2, file_size = $3,
+			expires_at = $4, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, filePath, fileSize, expiresAt)
+	return err
+}
+
+// MarkFailed records why an export job failed
+func (r *PostgresRepository) MarkFailed(ctx context.Context, id int64, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE data_exports SET status = 'failed', error = $2, completed_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		id, reason)
+	return err
+}
+
+// GetExpiredExports lists completed exports whose download link has expired
+func (r *PostgresRepository) GetExpiredExports(ctx context.Context, limit int) ([]*Export, error) {
+	exports := []*Export{}
+	query := `
+		SELECT ` + exportColumns + ` FROM data_exports
+		WHERE status = 'completed' AND expires_at <= CURRENT_TIMESTAMP
+		ORDER BY expires_at
+		LIMIT $1`
+	err := r.db.SelectContext(ctx, &exports, query, limit)
+	return exports, err
+}
+
+// MarkExpired records that an export's archive was removed
+func (r *PostgresRepository) MarkExpired(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE data_exports SET status = 'expired', file_path = NULL WHERE id = $1`, id)
+	return err
+}
+
+// DeleteUserExports removes all of a user's export jobs and returns their archive paths
+func (r *PostgresRepository) DeleteUserExports(ctx context.Context, userID int64) ([]string, error) {
+	var paths []string
+	query := `DELETE FROM data_exports WHERE user_id = $1 AND file_path IS NOT NULL RETURNING file_path`
+	if err := r.db.SelectContext(ctx, &paths, query, userID); err != nil {
+		return nil, err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM data_exports WHERE user_id = $1`, userID)
+	return paths, err
+}
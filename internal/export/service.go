@@ -0,0 +1,214 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// jobTimeout bounds how long one archive may take to build
+const jobTimeout = 10 * time.Minute
+
+// cleanupBatchSize bounds how many archives one CleanupExpiredExports run removes
+const cleanupBatchSize = 100
+
+// Config holds data export configuration
+type Config struct {
+	Dir        string        // Directory archives are written to; not served publicly
+	SigningKey string        // HMAC key for download links
+	LinkExpiry time.Duration // How long a finished archive can be downloaded
+	BaseURL    string        // Public API URL used to build download links
+}
+
+// Exporter contributes one module's data to an export archive. Each key of
+// the returned map is written to the archive as <key>.json.
+type Exporter interface {
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
+}
+
+// NotificationService interface for notification operations
+type NotificationService interface {
+	NotifyDataExportReady(ctx context.Context, userID, exportID int64) error
+}
+
+// Service defines data export operations
+type Service interface {
+	RequestExport(ctx context.Context, userID int64) (*Export, error)
+	GetExport(ctx context.Context, userID, exportID int64) (*Export, error)
+	GetExports(ctx context.Context, userID int64) ([]*Export, error)
+	OpenDownload(ctx context.Context, token string, expires int64, signature string) (*os.File, *Export, error)
+	RegisterExporter(exporter Exporter)
+	CleanupExpiredExports(ctx context.Context) (int, error)
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+}
+
+type service struct {
+	repo      Repository
+	config    *Config
+	notifySvc NotificationService
+	exporters []Exporter
+}
+
+// NewService creates a new data export service
+func NewService(repo Repository, config *Config, notifySvc NotificationService) Service {
+	if config.LinkExpiry <= 0 {
+		config.LinkExpiry = 48 * time.Hour
+	}
+	if config.Dir == "" {
+		config.Dir = "./exports"
+	}
+	return &service{repo: repo, config: config, notifySvc: notifySvc}
+}
+
+// RegisterExporter adds a module whose data is included in exports
+func (s *service) RegisterExporter(exporter Exporter) {
+	s.exporters = append(s.exporters, exporter)
+}
+
+// RequestExport queues a new export and builds it in the background
+func (s *service) RequestExport(ctx context.Context, userID int64) (*Export, error) {
+	token, err := newDownloadToken()
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := s.repo.CreateExport(ctx, userID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.runExport(context.WithoutCancel(ctx), export.ID, userID)
+
+	return export, nil
+}
+
+// GetExport returns one of the user's exports, with a download link once it is ready
+func (s *service) GetExport(ctx context.Context, userID, exportID int64) (*Export, error) {
+	export, err := s.repo.GetExportByID(ctx, exportID)
+	if err != nil {
+		return nil, err
+	}
+	if export.UserID != userID {
+		return nil, ErrExportNotFound
+	}
+	s.setDownloadURL(export)
+	return export, nil
+}
+
+// GetExports lists the user's recent exports
+func (s *service) GetExports(ctx context.Context, userID int64) ([]*Export, error) {
+	exports, err := s.repo.GetUserExports(ctx, userID, 10)
+	if err != nil {
+		return nil, err
+	}
+	for _, export := range exports {
+		s.setDownloadURL(export)
+	}
+	return exports, nil
+}
+
+// OpenDownload checks a signed download link and opens the archive it points to
+func (s *service) OpenDownload(ctx context.Context, token string, expires int64, signature string) (*os.File, *Export, error) {
+	if !s.verifySignature(token, expires, signature) || time.Now().Unix() > expires {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	export, err := s.repo.GetExportByToken(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if export.Status != StatusCompleted || export.FilePath == nil {
+		return nil, nil, ErrExportNotReady
+	}
+
+	file, err := os.Open(*export.FilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open export archive: %w", err)
+	}
+	return file, export, nil
+}
+
+// CleanupExpiredExports deletes archives whose download link has expired and
+// returns how many were removed
+func (s *service) CleanupExpiredExports(ctx context.Context) (int, error) {
+	exports, err := s.repo.GetExpiredExports(ctx, cleanupBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, export := range exports {
+		if export.FilePath != nil {
+			if err := os.Remove(*export.FilePath); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("WARNING: Failed to remove export archive %s: %v\n", *export.FilePath, err)
+				continue
+			}
+		}
+		if err := s.repo.MarkExpired(ctx, export.ID); err != nil {
+			fmt.Printf("ERROR: Failed to mark export %d expired: %v\n", export.ID, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// EraseUserData deletes a deleted account's exports and their archives
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	paths, err := s.repo.DeleteUserExports(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("WARNING: Failed to remove export archive %s: %v\n", path, err)
+		}
+	}
+	return nil, nil
+}
+
+// runExport builds the archive for a queued export and records the outcome.
+// ctx carries the tenant the export was requested in.
+func (s *service) runExport(ctx context.Context, exportID, userID int64) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	if err := s.repo.MarkProcessing(ctx, exportID); err != nil {
+		fmt.Printf("ERROR: Failed to start export %d: %v\n", exportID, err)
+		return
+	}
+
+	path, size, err := s.buildArchive(ctx, exportID, userID)
+	if err != nil {
+		fmt.Printf("ERROR: Export %d for user %d failed: %v\n", exportID, userID, err)
+		if err := s.repo.MarkFailed(ctx, exportID, err.Error()); err != nil {
+			fmt.Printf("ERROR: Failed to mark export %d failed: %v\n", exportID, err)
+		}
+		return
+	}
+
+	if err := s.repo.MarkCompleted(ctx, exportID, path, size, time.Now().Add(s.config.LinkExpiry)); err != nil {
+		fmt.Printf("ERROR: Failed to complete export %d: %v\n", exportID, err)
+		os.Remove(path)
+		return
+	}
+
+	fmt.Printf("INFO: Export %d for user %d completed (%d bytes)\n", exportID, userID, size)
+
+	if s.notifySvc != nil {
+		if err := s.notifySvc.NotifyDataExportReady(ctx, userID, exportID); err != nil {
+			fmt.Printf("WARNING: Failed to notify user %d about export %d: %v\n", userID, exportID, err)
+		}
+	}
+}
+
+// setDownloadURL adds a signed link to a downloadable export
+func (s *service) setDownloadURL(export *Export) {
+	if export.Status != StatusCompleted || export.Token == nil || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		return
+	}
+	expires := export.ExpiresAt.Unix()
+	export.DownloadURL = fmt.Sprintf("%s/api/v1/exports/%s/download?expires=%d&signature=%s",
+		s.config.BaseURL, *export.Token, expires, s.sign(*export.Token, expires))
+}
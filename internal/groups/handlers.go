@@ -0,0 +1,468 @@
+package groups
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(http.Handler) http.Handler) {
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(authMiddleware)
+	api.Use(common.RequireScopeByMethod(common.ScopeGroupsRead, common.ScopeGroupsWrite))
+
+	// IMPORTANT: Specific routes must be registered BEFORE wildcard {id} routes
+	api.HandleFunc("/groups", handler.SearchGroups).Methods("GET")
+	api.HandleFunc("/groups", handler.CreateGroup).Methods("POST")
+	api.HandleFunc("/groups/mine", handler.GetMyGroups).Methods("GET")
+
+	api.HandleFunc("/groups/{id}", handler.GetGroup).Methods("GET")
+	api.HandleFunc("/groups/{id}", handler.UpdateGroup).Methods("PUT")
+
+	// Membership
+	api.HandleFunc("/groups/{id}/join", handler.JoinGroup).Methods("POST")
+	api.HandleFunc("/groups/{id}/leave", handler.LeaveGroup).Methods("POST")
+	api.HandleFunc("/groups/{id}/members", handler.GetMembers).Methods("GET")
+	api.HandleFunc("/groups/{id}/members", handler.AddMember).Methods("POST")
+	api.HandleFunc("/groups/{id}/members/{userId}", handler.UpdateMemberRole).Methods("PUT")
+
+	// Join requests (moderators)
+	api.HandleFunc("/groups/{id}/requests", handler.GetJoinRequests).Methods("GET")
+	api.HandleFunc("/groups/{id}/requests/{requestId}/approve", handler.ApproveJoinRequest).Methods("POST")
+	api.HandleFunc("/groups/{id}/requests/{requestId}/reject", handler.RejectJoinRequest).Methods("POST")
+
+	// An admin impersonating a user must not delete their groups or members
+	deletes := api.NewRoute().Subrouter()
+	deletes.Use(common.BlockImpersonation)
+	deletes.HandleFunc("/groups/{id}", handler.DeleteGroup).Methods("DELETE")
+	deletes.HandleFunc("/groups/{id}/members/{userId}", handler.RemoveMember).Methods("DELETE")
+}
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	var req CreateGroupRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	group, err := h.service.CreateGroup(r.Context(), userID, &req)
+	if err != nil {
+		common.InternalError(w, "Failed to create group")
+		return
+	}
+
+	common.Created(w, "Group created successfully", group)
+}
+
+func (h *Handler) SearchGroups(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	query := common.SanitizeString(r.URL.Query().Get("q"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	groups, total, err := h.service.SearchGroups(r.Context(), query, userID, limit, offset)
+	if err != nil {
+		common.InternalError(w, "Failed to get groups")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", groups, &common.Meta{Total: total})
+}
+
+func (h *Handler) GetMyGroups(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	groups, total, err := h.service.GetUserGroups(r.Context(), userID, limit, offset)
+	if err != nil {
+		common.InternalError(w, "Failed to get groups")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", groups, &common.Meta{Total: total})
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	group, err := h.service.GetGroup(r.Context(), groupID, userID)
+	if err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to get group")
+		}
+		return
+	}
+
+	common.Success(w, "", group)
+}
+
+func (h *Handler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	var req UpdateGroupRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	group, err := h.service.UpdateGroup(r.Context(), userID, groupID, &req)
+	if err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to update group")
+		}
+		return
+	}
+
+	common.Success(w, "Group updated", group)
+}
+
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	if err := h.service.DeleteGroup(r.Context(), userID, groupID); err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to delete group")
+		}
+		return
+	}
+
+	common.Success(w, "Group deleted", nil)
+}
+
+func (h *Handler) JoinGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	// The message for the moderators is optional
+	var req JoinGroupRequest
+	if r.ContentLength != 0 {
+		if errs := common.DecodeAndValidate(r, &req); errs != nil {
+			common.ValidationError(w, errs)
+			return
+		}
+	}
+
+	joinReq, err := h.service.JoinGroup(r.Context(), userID, groupID, &req)
+	if err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to join group")
+		}
+		return
+	}
+
+	if joinReq != nil {
+		common.Created(w, "Join request sent", joinReq)
+		return
+	}
+	common.Success(w, "Joined group", nil)
+}
+
+func (h *Handler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	if err := h.service.LeaveGroup(r.Context(), userID, groupID); err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to leave group")
+		}
+		return
+	}
+
+	common.Success(w, "Left group", nil)
+}
+
+func (h *Handler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	members, total, err := h.service.GetMembers(r.Context(), groupID, userID, limit, offset)
+	if err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to get members")
+		}
+		return
+	}
+
+	common.SuccessWithMeta(w, "", members, &common.Meta{Total: total})
+}
+
+func (h *Handler) AddMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	var req AddMemberRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.AddMember(r.Context(), userID, groupID, req.UserID); err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to add member")
+		}
+		return
+	}
+
+	common.Success(w, "Member added", nil)
+}
+
+func (h *Handler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	groupID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+	memberID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	var req UpdateMemberRoleRequest
+	if errs := common.DecodeAndValidate(r, &req); errs != nil {
+		common.ValidationError(w, errs)
+		return
+	}
+
+	if err := h.service.UpdateMemberRole(r.Context(), userID, groupID, memberID, req.Role); err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to update member role")
+		}
+		return
+	}
+
+	common.Success(w, "Member role updated", nil)
+}
+
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	groupID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+	memberID, err := strconv.ParseInt(vars["userId"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid user ID")
+		return
+	}
+
+	if err := h.service.RemoveMember(r.Context(), userID, groupID, memberID); err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to remove member")
+		}
+		return
+	}
+
+	common.Success(w, "Member removed", nil)
+}
+
+func (h *Handler) GetJoinRequests(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	requests, total, err := h.service.GetJoinRequests(r.Context(), userID, groupID, limit, offset)
+	if err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to get join requests")
+		}
+		return
+	}
+
+	common.SuccessWithMeta(w, "", requests, &common.Meta{Total: total})
+}
+
+func (h *Handler) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	h.reviewJoinRequest(w, r, true)
+}
+
+func (h *Handler) RejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	h.reviewJoinRequest(w, r, false)
+}
+
+func (h *Handler) reviewJoinRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	groupID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+	requestID, err := strconv.ParseInt(vars["requestId"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid request ID")
+		return
+	}
+
+	if approve {
+		err = h.service.ApproveJoinRequest(r.Context(), userID, groupID, requestID)
+	} else {
+		err = h.service.RejectJoinRequest(r.Context(), userID, groupID, requestID)
+	}
+	if err != nil {
+		if !writeGroupError(w, err) {
+			common.InternalError(w, "Failed to review join request")
+		}
+		return
+	}
+
+	if approve {
+		common.Success(w, "Join request approved", nil)
+		return
+	}
+	common.Success(w, "Join request rejected", nil)
+}
+
+// writeGroupError maps group errors to responses, reporting whether it handled err
+func writeGroupError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrGroupNotFound):
+		common.NotFound(w, "Group not found")
+	case errors.Is(err, ErrJoinRequestNotFound):
+		common.NotFound(w, "Join request not found")
+	case errors.Is(err, ErrUserNotFound):
+		common.NotFound(w, "User not found")
+	case errors.Is(err, ErrMemberNotFound):
+		common.NotFound(w, "Member not found")
+	case errors.Is(err, ErrNotMember):
+		common.Forbidden(w, "Not a member of this group")
+	case errors.Is(err, ErrUnauthorized):
+		common.Forbidden(w, "Not authorized to manage this group")
+	case errors.Is(err, ErrAlreadyMember):
+		common.Conflict(w, "Already a member of this group")
+	case errors.Is(err, ErrRequestPending):
+		common.Conflict(w, "Join request already pending")
+	case errors.Is(err, ErrOwnerCannotLeave):
+		common.BadRequest(w, "The owner cannot leave the group")
+	default:
+		return false
+	}
+	return true
+}
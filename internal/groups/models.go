@@ -0,0 +1,134 @@
+package groups
+
+import (
+	"time"
+)
+
+// Group privacy levels
+const (
+	PrivacyPublic  = "public"  // Listed, anyone can join and read
+	PrivacyPrivate = "private" // Listed, joining needs a moderator's approval
+	PrivacySecret  = "secret"  // Only members can see the group
+)
+
+// Member roles
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Join request statuses
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+)
+
+// Group represents a community group
+type Group struct {
+	ID           int64     `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	Description  *string   `json:"description,omitempty" db:"description"`
+	CoverURL     *string   `json:"cover_url,omitempty" db:"cover_url"`
+	Privacy      string    `json:"privacy" db:"privacy"`
+	CreatedBy    *int64    `json:"created_by,omitempty" db:"created_by"`
+	MembersCount int64     `json:"members_count" db:"members_count"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	Role         *string   `json:"role,omitempty" db:"role"`                   // Current user's role, nil when not a member
+	HasRequested bool      `json:"has_requested,omitempty" db:"has_requested"` // Whether current user has a pending join request
+}
+
+// IsMember reports whether the current user belongs to the group
+func (g *Group) IsMember() bool {
+	return g.Role != nil
+}
+
+// CanModerate reports whether the current user may approve members and remove content
+func (g *Group) CanModerate() bool {
+	return g.Role != nil && (*g.Role == RoleOwner || *g.Role == RoleModerator)
+}
+
+// IsOwner reports whether the current user owns the group
+func (g *Group) IsOwner() bool {
+	return g.Role != nil && *g.Role == RoleOwner
+}
+
+// ContentVisible reports whether the current user may read the group's posts and members
+func (g *Group) ContentVisible() bool {
+	return g.Privacy == PrivacyPublic || g.IsMember()
+}
+
+// Member represents a user in a group's member list
+type Member struct {
+	ID             int64     `json:"id" db:"id"`
+	Username       string    `json:"username" db:"username"`
+	DisplayName    *string   `json:"display_name,omitempty" db:"display_name"`
+	ProfilePicture *string   `json:"profile_picture,omitempty" db:"profile_picture"`
+	IsVerified     bool      `json:"is_verified" db:"is_verified"`
+	Role           string    `json:"role" db:"role"`
+	JoinedAt       time.Time `json:"joined_at" db:"joined_at"`
+}
+
+// JoinRequest represents a request to join a private group
+type JoinRequest struct {
+	ID         int64        `json:"id" db:"id"`
+	GroupID    int64        `json:"group_id" db:"group_id"`
+	UserID     int64        `json:"user_id" db:"user_id"`
+	Message    *string      `json:"message,omitempty" db:"message"`
+	Status     string       `json:"status" db:"status"`
+	ReviewedBy *int64       `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt *time.Time   `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+	User       *RequestUser `json:"user,omitempty"`
+}
+
+// RequestUser represents the user behind a join request
+type RequestUser struct {
+	ID             int64   `json:"id" db:"id"`
+	Username       string  `json:"username" db:"username"`
+	DisplayName    *string `json:"display_name,omitempty" db:"display_name"`
+	ProfilePicture *string `json:"profile_picture,omitempty" db:"profile_picture"`
+	IsVerified     bool    `json:"is_verified" db:"is_verified"`
+}
+
+// PostMedia is a file uploaded to one of a group's posts. The posts are
+// deleted with their group, so the files are removed and the storage given
+// back to their authors.
+type PostMedia struct {
+	UserID     int64  `db:"user_id"`
+	StorageKey string `db:"storage_key"`
+	SizeBytes  int64  `db:"size_bytes"`
+}
+
+// CreateGroupRequest represents a request to create a group
+type CreateGroupRequest struct {
+	Name        string  `json:"name" validate:"required,min=1,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+	CoverURL    *string `json:"cover_url" validate:"omitempty,url,max=500"`
+	Privacy     string  `json:"privacy" validate:"omitempty,oneof=public private secret"`
+}
+
+// UpdateGroupRequest represents a request to update a group
+type UpdateGroupRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+	CoverURL    *string `json:"cover_url" validate:"omitempty,url,max=500"`
+	Privacy     *string `json:"privacy" validate:"omitempty,oneof=public private secret"`
+}
+
+// JoinGroupRequest represents a request to join a group
+type JoinGroupRequest struct {
+	Message *string `json:"message" validate:"omitempty,max=500"`
+}
+
+// AddMemberRequest represents a moderator adding a user to a group
+type AddMemberRequest struct {
+	UserID int64 `json:"user_id" validate:"required"`
+}
+
+// UpdateMemberRoleRequest represents a request to change a member's role
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=moderator member"`
+}
@@ -0,0 +1,562 @@
+package groups
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+var (
+	ErrGroupNotFound       = errors.New("group not found")
+	ErrNotMember           = errors.New("not a member of this group")
+	ErrMemberNotFound      = errors.New("member not found")
+	ErrAlreadyMember       = errors.New("already a member of this group")
+	ErrRequestPending      = errors.New("join request already pending")
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrOwnerCannotLeave    = errors.New("the owner cannot leave the group")
+	ErrUnauthorized        = errors.New("unauthorized")
+)
+
+// Repository defines group data operations
+type Repository interface {
+	// Groups
+	CreateGroup(ctx context.Context, group *Group) error
+	GetGroupByID(ctx context.Context, groupID, currentUserID int64) (*Group, error)
+	UpdateGroup(ctx context.Context, group *Group) error
+	DeleteGroup(ctx context.Context, groupID int64) ([]PostMedia, error)
+	SearchGroups(ctx context.Context, query string, currentUserID int64, limit, offset int) ([]*Group, int64, error)
+	GetUserGroups(ctx context.Context, userID int64, limit, offset int) ([]*Group, int64, error)
+
+	// Members
+	AddMember(ctx context.Context, groupID, userID int64, role string) error
+	UpdateMemberRole(ctx context.Context, groupID, userID int64, role string) error
+	RemoveMember(ctx context.Context, groupID, userID int64) error
+	GetMemberRole(ctx context.Context, groupID, userID int64) (string, error)
+	GetMembers(ctx context.Context, groupID int64, limit, offset int) ([]*Member, int64, error)
+
+	// Join requests
+	CreateJoinRequest(ctx context.Context, req *JoinRequest) error
+	GetJoinRequest(ctx context.Context, requestID int64) (*JoinRequest, error)
+	GetPendingJoinRequests(ctx context.Context, groupID int64, limit, offset int) ([]*JoinRequest, int64, error)
+	ReviewJoinRequest(ctx context.Context, requestID, reviewerID int64, approve bool) error
+
+	// Account deletion
+	EraseUserData(ctx context.Context, userID int64) ([]PostMedia, error)
+}
+
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+func NewPostgresRepository(db *sqlx.DB) Repository {
+	return &PostgresRepository{db: db}
+}
+
+// CreateGroup inserts a group with its creator as owner
+func (r *PostgresRepository) CreateGroup(ctx context.Context, group *Group) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO groups (tenant_id, name, description, cover_url, privacy, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`,
+		tenantID, group.Name, group.Description, group.CoverURL, group.Privacy, group.CreatedBy,
+	).Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO group_members (tenant_id, group_id, user_id, role) VALUES ($1, $2, $3, $4)`,
+		tenantID, group.ID, group.CreatedBy, RoleOwner); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	role := RoleOwner
+	group.Role = &role
+	group.MembersCount = 1
+	return nil
+}
+
+// GetGroupByID retrieves a group with the current user's role in it
+func (r *PostgresRepository) GetGroupByID(ctx context.Context, groupID, currentUserID int64) (*Group, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &Group{}
+	query := `
+		SELECT g.id, g.name, g.description, g.cover_url, g.privacy, g.created_by, g.members_count,
+			g.created_at, g.updated_at, gm.role,
+			EXISTS(SELECT 1 FROM group_join_requests WHERE group_id = g.id AND user_id = $2 AND status = 'pending') as has_requested
+		FROM groups g
+		LEFT JOIN group_members gm ON gm.group_id = g.id AND gm.user_id = $2
+		WHERE g.id = $1 AND g.tenant_id = $3`
+
+	err = r.db.GetContext(ctx, group, query, groupID, currentUserID, tenantID)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	return group, err
+}
+
+func (r *PostgresRepository) UpdateGroup(ctx context.Context, group *Group) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE groups SET name = $2, description = $3, cover_url = $4, privacy = $5 WHERE id = $1 AND tenant_id = $6
+		RETURNING updated_at`
+	err = r.db.QueryRowxContext(ctx, query,
+		group.ID, group.Name, group.Description, group.CoverURL, group.Privacy, tenantID,
+	).Scan(&group.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrGroupNotFound
+	}
+	return err
+}
+
+// DeleteGroup deletes a group with its members, join requests and posts,
+// and returns the files uploaded to the posts
+func (r *PostgresRepository) DeleteGroup(ctx context.Context, groupID int64) ([]PostMedia, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.GetContext(ctx, &id, `SELECT id FROM groups WHERE id = $1 AND tenant_id = $2 FOR UPDATE`, groupID, tenantID)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := deleteGroup(ctx, tx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// deleteGroup deletes a group in tx and returns the files uploaded to its
+// posts. The posts are locked first, so no upload can be added to them
+// between reading their media and the cascade deleting them.
+func deleteGroup(ctx context.Context, tx *sqlx.Tx, groupID int64) ([]PostMedia, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM posts WHERE group_id = $1 FOR UPDATE`, groupID); err != nil {
+		return nil, err
+	}
+
+	media := []PostMedia{}
+	err := tx.SelectContext(ctx, &media, `
+		SELECT p.user_id, pm.storage_key, pm.size_bytes FROM post_media pm
+		JOIN posts p ON pm.post_id = p.id
+		WHERE p.group_id = $1 AND pm.storage_key IS NOT NULL`, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, groupID); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// SearchGroups lists groups by name. Secret groups are only listed for their members.
+func (r *PostgresRepository) SearchGroups(ctx context.Context, query string, currentUserID int64, limit, offset int) ([]*Group, int64, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := `
+		FROM groups g
+		LEFT JOIN group_members gm ON gm.group_id = g.id AND gm.user_id = $2
+		WHERE g.tenant_id = $3 AND ($1 = '' OR g.name ILIKE '%' || $1 || '%')
+			AND (g.privacy <> 'secret' OR gm.user_id IS NOT NULL)`
+
+	var total int64
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*)`+filter, query, currentUserID, tenantID); err != nil {
+		return nil, 0, err
+	}
+
+	groups := []*Group{}
+	err = r.db.SelectContext(ctx, &groups, `
+		SELECT g.id, g.name, g.description, g.cover_url, g.privacy, g.created_by, g.members_count,
+			g.created_at, g.updated_at, gm.role,
+			EXISTS(SELECT 1 FROM group_join_requests WHERE group_id = g.id AND user_id = $2 AND status = 'pending') as has_requested`+
+		filter+`
+		ORDER BY g.members_count DESC, g.id DESC
+		LIMIT $4 OFFSET $5`,
+		query, currentUserID, tenantID, limit, offset)
+	return groups, total, err
+}
+
+// GetUserGroups lists the groups a user belongs to, most recently joined first
+func (r *PostgresRepository) GetUserGroups(ctx context.Context, userID int64, limit, offset int) ([]*Group, int64, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	countQuery := `SELECT COUNT(*) FROM group_members WHERE user_id = $1 AND tenant_id = $2`
+	if err := r.db.GetContext(ctx, &total, countQuery, userID, tenantID); err != nil {
+		return nil, 0, err
+	}
+
+	groups := []*Group{}
+	query := `
+		SELECT g.id, g.name, g.description, g.cover_url, g.privacy, g.created_by, g.members_count,
+			g.created_at, g.updated_at, gm.role, FALSE as has_requested
+		FROM group_members gm
+		JOIN groups g ON g.id = gm.group_id
+		WHERE gm.user_id = $1 AND gm.tenant_id = $4
+		ORDER BY gm.joined_at DESC
+		LIMIT $2 OFFSET $3`
+
+	err = r.db.SelectContext(ctx, &groups, query, userID, limit, offset, tenantID)
+	return groups, total, err
+}
+
+// AddMember adds a user to a group. Users of another tenant are reported as not found.
+func (r *PostgresRepository) AddMember(ctx context.Context, groupID, userID int64, role string) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = r.db.GetContext(ctx, &exists,
+		`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND tenant_id = $2 AND account_status = 'active')`,
+		userID, tenantID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO group_members (tenant_id, group_id, user_id, role) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, user_id) DO NOTHING`,
+		tenantID, groupID, userID, role)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrAlreadyMember
+	}
+	return nil
+}
+
+func (r *PostgresRepository) UpdateMemberRole(ctx context.Context, groupID, userID int64, role string) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE group_members SET role = $3 WHERE group_id = $1 AND user_id = $2 AND tenant_id = $4`,
+		groupID, userID, role, tenantID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+func (r *PostgresRepository) RemoveMember(ctx context.Context, groupID, userID int64) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM group_members WHERE group_id = $1 AND user_id = $2 AND tenant_id = $3`,
+		groupID, userID, tenantID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// GetMemberRole returns a user's role in a group, or ErrNotMember
+func (r *PostgresRepository) GetMemberRole(ctx context.Context, groupID, userID int64) (string, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return "", err
+	}
+	var role string
+	err = r.db.GetContext(ctx, &role,
+		`SELECT role FROM group_members WHERE group_id = $1 AND user_id = $2 AND tenant_id = $3`,
+		groupID, userID, tenantID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotMember
+	}
+	return role, err
+}
+
+// GetMembers lists a group's members, owner and moderators first
+func (r *PostgresRepository) GetMembers(ctx context.Context, groupID int64, limit, offset int) ([]*Member, int64, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	countQuery := `
+		SELECT COUNT(*) FROM group_members gm
+		JOIN users u ON gm.user_id = u.id
+		WHERE gm.group_id = $1 AND gm.tenant_id = $2 AND u.account_status = 'active'`
+	if err := r.db.GetContext(ctx, &total, countQuery, groupID, tenantID); err != nil {
+		return nil, 0, err
+	}
+
+	members := []*Member{}
+	query := `
+		SELECT u.id, u.username, u.display_name, u.profile_picture, u.is_verified,
+			gm.role, gm.joined_at
+		FROM group_members gm
+		JOIN users u ON gm.user_id = u.id
+		WHERE gm.group_id = $1 AND gm.tenant_id = $4 AND u.account_status = 'active'
+		ORDER BY CASE gm.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END, gm.joined_at DESC
+		LIMIT $2 OFFSET $3`
+
+	err = r.db.SelectContext(ctx, &members, query, groupID, limit, offset, tenantID)
+	return members, total, err
+}
+
+// CreateJoinRequest records a pending request to join a group
+func (r *PostgresRepository) CreateJoinRequest(ctx context.Context, req *JoinRequest) error {
+	query := `
+		INSERT INTO group_join_requests (group_id, user_id, message)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING id, status, created_at`
+
+	err := r.db.QueryRowxContext(ctx, query, req.GroupID, req.UserID, req.Message).
+		Scan(&req.ID, &req.Status, &req.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrRequestPending
+	}
+	return err
+}
+
+func (r *PostgresRepository) GetJoinRequest(ctx context.Context, requestID int64) (*JoinRequest, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &JoinRequest{}
+	err = r.db.GetContext(ctx, req, `
+		SELECT jr.id, jr.group_id, jr.user_id, jr.message, jr.status, jr.reviewed_by, jr.reviewed_at, jr.created_at
+		FROM group_join_requests jr
+		JOIN groups g ON g.id = jr.group_id
+		WHERE jr.id = $1 AND g.tenant_id = $2`, requestID, tenantID)
+	if err == sql.ErrNoRows {
+		return nil, ErrJoinRequestNotFound
+	}
+	return req, err
+}
+
+// GetPendingJoinRequests lists a group's open join requests, oldest first
+func (r *PostgresRepository) GetPendingJoinRequests(ctx context.Context, groupID int64, limit, offset int) ([]*JoinRequest, int64, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	countQuery := `
+		SELECT COUNT(*) FROM group_join_requests jr
+		JOIN users u ON jr.user_id = u.id
+		WHERE jr.group_id = $1 AND jr.status = 'pending' AND u.tenant_id = $2 AND u.account_status = 'active'`
+	if err := r.db.GetContext(ctx, &total, countQuery, groupID, tenantID); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT jr.id, jr.group_id, jr.user_id, jr.message, jr.status, jr.created_at,
+			u.id, u.username, u.display_name, u.profile_picture, u.is_verified
+		FROM group_join_requests jr
+		JOIN users u ON jr.user_id = u.id
+		WHERE jr.group_id = $1 AND jr.status = 'pending' AND u.tenant_id = $4 AND u.account_status = 'active'
+		ORDER BY jr.created_at
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.QueryxContext(ctx, query, groupID, limit, offset, tenantID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	requests := []*JoinRequest{}
+	for rows.Next() {
+		req := &JoinRequest{User: &RequestUser{}}
+		if err := rows.Scan(&req.ID, &req.GroupID, &req.UserID, &req.Message, &req.Status, &req.CreatedAt,
+			&req.User.ID, &req.User.Username, &req.User.DisplayName, &req.User.ProfilePicture, &req.User.IsVerified); err != nil {
+			continue
+		}
+		requests = append(requests, req)
+	}
+	return requests, total, nil
+}
+
+// ReviewJoinRequest closes a pending join request, adding the user to the
+// group when it is approved
+func (r *PostgresRepository) ReviewJoinRequest(ctx context.Context, requestID, reviewerID int64, approve bool) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := RequestRejected
+	if approve {
+		status = RequestApproved
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var groupID, userID int64
+	err = tx.QueryRowxContext(ctx, `
+		UPDATE group_join_requests jr SET status = $2, reviewed_by = $3, reviewed_at = $4
+		FROM groups g
+		WHERE jr.id = $1 AND jr.status = 'pending' AND g.id = jr.group_id AND g.tenant_id = $5
+		RETURNING jr.group_id, jr.user_id`,
+		requestID, status, reviewerID, time.Now(), tenantID,
+	).Scan(&groupID, &userID)
+	if err == sql.ErrNoRows {
+		return ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if approve {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO group_members (tenant_id, group_id, user_id, role) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (group_id, user_id) DO NOTHING`,
+			tenantID, groupID, userID, RoleMember); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// EraseUserData removes a user's memberships and join requests. Groups they
+// own pass to their longest-standing moderator, or member, and groups
+// nobody else belongs to are deleted. Returns the files uploaded to the
+// deleted groups' posts.
+func (r *PostgresRepository) EraseUserData(ctx context.Context, userID int64) ([]PostMedia, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE group_members gm SET role = 'owner'
+		FROM (
+			SELECT DISTINCT ON (m.group_id) m.id
+			FROM group_members m
+			JOIN group_members o ON o.group_id = m.group_id AND o.user_id = $1 AND o.role = 'owner'
+			WHERE m.user_id <> $1
+			ORDER BY m.group_id, m.role = 'moderator' DESC, m.joined_at
+		) heir
+		WHERE gm.id = heir.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var groupIDs []int64
+	err = tx.SelectContext(ctx, &groupIDs, `
+		SELECT g.id FROM groups g
+		WHERE EXISTS(SELECT 1 FROM group_members WHERE group_id = g.id AND user_id = $1 AND role = 'owner')
+			AND NOT EXISTS(SELECT 1 FROM group_members WHERE group_id = g.id AND user_id <> $1)
+		FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var media []PostMedia
+	for _, groupID := range groupIDs {
+		groupMedia, err := deleteGroup(ctx, tx, groupID)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, groupMedia...)
+	}
+
+	queries := []string{
+		`DELETE FROM group_members WHERE user_id = $1`,
+		`DELETE FROM group_join_requests WHERE user_id = $1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
@@ -0,0 +1,381 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/storage"
+)
+
+// EntitlementService accounts for the storage uploads use
+type EntitlementService interface {
+	ReleaseStorage(ctx context.Context, userID, bytes int64) error
+}
+
+// Service defines group business operations
+type Service interface {
+	CreateGroup(ctx context.Context, userID int64, req *CreateGroupRequest) (*Group, error)
+	GetGroup(ctx context.Context, groupID, currentUserID int64) (*Group, error)
+	UpdateGroup(ctx context.Context, userID, groupID int64, req *UpdateGroupRequest) (*Group, error)
+	DeleteGroup(ctx context.Context, userID, groupID int64) error
+	SearchGroups(ctx context.Context, query string, currentUserID int64, limit, offset int) ([]*Group, int64, error)
+	GetUserGroups(ctx context.Context, userID int64, limit, offset int) ([]*Group, int64, error)
+
+	JoinGroup(ctx context.Context, userID, groupID int64, req *JoinGroupRequest) (*JoinRequest, error)
+	LeaveGroup(ctx context.Context, userID, groupID int64) error
+	GetMembers(ctx context.Context, groupID, currentUserID int64, limit, offset int) ([]*Member, int64, error)
+	AddMember(ctx context.Context, moderatorID, groupID, userID int64) error
+	UpdateMemberRole(ctx context.Context, ownerID, groupID, userID int64, role string) error
+	RemoveMember(ctx context.Context, moderatorID, groupID, userID int64) error
+
+	GetJoinRequests(ctx context.Context, moderatorID, groupID int64, limit, offset int) ([]*JoinRequest, int64, error)
+	ApproveJoinRequest(ctx context.Context, moderatorID, groupID, requestID int64) error
+	RejectJoinRequest(ctx context.Context, moderatorID, groupID, requestID int64) error
+
+	// Access checks for group posts
+	CanView(ctx context.Context, groupID, userID int64) (bool, error)
+	CanPost(ctx context.Context, groupID, userID int64) (bool, error)
+	CanModerate(ctx context.Context, groupID, userID int64) (bool, error)
+
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
+}
+
+type service struct {
+	repo         Repository
+	entitlements EntitlementService
+	store        storage.Storage
+}
+
+func NewService(repo Repository, entitlements EntitlementService, store storage.Storage) Service {
+	return &service{repo: repo, entitlements: entitlements, store: store}
+}
+
+func (s *service) CreateGroup(ctx context.Context, userID int64, req *CreateGroupRequest) (*Group, error) {
+	privacy := req.Privacy
+	if privacy == "" {
+		privacy = PrivacyPublic
+	}
+
+	group := &Group{
+		Name:        req.Name,
+		Description: req.Description,
+		CoverURL:    req.CoverURL,
+		Privacy:     privacy,
+		CreatedBy:   &userID,
+	}
+	if err := s.repo.CreateGroup(ctx, group); err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+
+	fmt.Printf("INFO: Group created - GroupID: %d, UserID: %d, Privacy: %s\n", group.ID, userID, privacy)
+	return group, nil
+}
+
+// GetGroup returns a group as the current user sees it. Secret groups do
+// not exist for non-members.
+func (s *service) GetGroup(ctx context.Context, groupID, currentUserID int64) (*Group, error) {
+	group, err := s.repo.GetGroupByID(ctx, groupID, currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	if group.Privacy == PrivacySecret && !group.IsMember() {
+		return nil, ErrGroupNotFound
+	}
+	return group, nil
+}
+
+func (s *service) UpdateGroup(ctx context.Context, userID, groupID int64, req *UpdateGroupRequest) (*Group, error) {
+	group, err := s.GetGroup(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !group.IsOwner() {
+		return nil, ErrUnauthorized
+	}
+
+	if req.Name != nil {
+		group.Name = *req.Name
+	}
+	if req.Description != nil {
+		group.Description = req.Description
+	}
+	if req.CoverURL != nil {
+		group.CoverURL = req.CoverURL
+	}
+	if req.Privacy != nil {
+		group.Privacy = *req.Privacy
+	}
+
+	if err := s.repo.UpdateGroup(ctx, group); err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+	return group, nil
+}
+
+func (s *service) DeleteGroup(ctx context.Context, userID, groupID int64) error {
+	group, err := s.GetGroup(ctx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if !group.IsOwner() {
+		return ErrUnauthorized
+	}
+
+	media, err := s.repo.DeleteGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	s.removeMedia(ctx, media)
+	fmt.Printf("INFO: Group deleted - GroupID: %d, UserID: %d\n", groupID, userID)
+	return nil
+}
+
+func (s *service) SearchGroups(ctx context.Context, query string, currentUserID int64, limit, offset int) ([]*Group, int64, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	return s.repo.SearchGroups(ctx, query, currentUserID, limit, offset)
+}
+
+func (s *service) GetUserGroups(ctx context.Context, userID int64, limit, offset int) ([]*Group, int64, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	return s.repo.GetUserGroups(ctx, userID, limit, offset)
+}
+
+// JoinGroup adds the user to a public group right away. For a private group
+// it files a join request for the moderators and returns it.
+func (s *service) JoinGroup(ctx context.Context, userID, groupID int64, req *JoinGroupRequest) (*JoinRequest, error) {
+	group, err := s.GetGroup(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if group.IsMember() {
+		return nil, ErrAlreadyMember
+	}
+
+	if group.Privacy == PrivacyPublic {
+		return nil, s.repo.AddMember(ctx, groupID, userID, RoleMember)
+	}
+
+	joinReq := &JoinRequest{
+		GroupID: groupID,
+		UserID:  userID,
+		Message: req.Message,
+	}
+	if err := s.repo.CreateJoinRequest(ctx, joinReq); err != nil {
+		return nil, err
+	}
+	return joinReq, nil
+}
+
+func (s *service) LeaveGroup(ctx context.Context, userID, groupID int64) error {
+	role, err := s.repo.GetMemberRole(ctx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role == RoleOwner {
+		return ErrOwnerCannotLeave
+	}
+	return s.repo.RemoveMember(ctx, groupID, userID)
+}
+
+// GetMembers lists a group's members. Only members see who is in a private group.
+func (s *service) GetMembers(ctx context.Context, groupID, currentUserID int64, limit, offset int) ([]*Member, int64, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+
+	group, err := s.GetGroup(ctx, groupID, currentUserID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !group.ContentVisible() {
+		return nil, 0, ErrNotMember
+	}
+	return s.repo.GetMembers(ctx, groupID, limit, offset)
+}
+
+// AddMember lets a moderator add a user directly, the only way into a secret group
+func (s *service) AddMember(ctx context.Context, moderatorID, groupID, userID int64) error {
+	if _, err := s.moderatedGroup(ctx, groupID, moderatorID); err != nil {
+		return err
+	}
+	return s.repo.AddMember(ctx, groupID, userID, RoleMember)
+}
+
+// UpdateMemberRole lets the owner promote members to moderator and back
+func (s *service) UpdateMemberRole(ctx context.Context, ownerID, groupID, userID int64, role string) error {
+	group, err := s.GetGroup(ctx, groupID, ownerID)
+	if err != nil {
+		return err
+	}
+	if !group.IsOwner() || userID == ownerID {
+		return ErrUnauthorized
+	}
+	if err := s.repo.UpdateMemberRole(ctx, groupID, userID, role); err != nil {
+		if errors.Is(err, ErrNotMember) {
+			return ErrMemberNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveMember lets a moderator remove a member. Moderators can only be
+// removed by the owner, and the owner by nobody.
+func (s *service) RemoveMember(ctx context.Context, moderatorID, groupID, userID int64) error {
+	group, err := s.moderatedGroup(ctx, groupID, moderatorID)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.repo.GetMemberRole(ctx, groupID, userID)
+	if errors.Is(err, ErrNotMember) {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if role == RoleOwner || (role == RoleModerator && !group.IsOwner()) {
+		return ErrUnauthorized
+	}
+
+	if err := s.repo.RemoveMember(ctx, groupID, userID); err != nil {
+		return err
+	}
+	fmt.Printf("INFO: Group member removed - GroupID: %d, UserID: %d, By: %d\n", groupID, userID, moderatorID)
+	return nil
+}
+
+func (s *service) GetJoinRequests(ctx context.Context, moderatorID, groupID int64, limit, offset int) ([]*JoinRequest, int64, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if _, err := s.moderatedGroup(ctx, groupID, moderatorID); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.GetPendingJoinRequests(ctx, groupID, limit, offset)
+}
+
+func (s *service) ApproveJoinRequest(ctx context.Context, moderatorID, groupID, requestID int64) error {
+	return s.reviewJoinRequest(ctx, moderatorID, groupID, requestID, true)
+}
+
+func (s *service) RejectJoinRequest(ctx context.Context, moderatorID, groupID, requestID int64) error {
+	return s.reviewJoinRequest(ctx, moderatorID, groupID, requestID, false)
+}
+
+func (s *service) reviewJoinRequest(ctx context.Context, moderatorID, groupID, requestID int64, approve bool) error {
+	if _, err := s.moderatedGroup(ctx, groupID, moderatorID); err != nil {
+		return err
+	}
+
+	req, err := s.repo.GetJoinRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	if req.GroupID != groupID || req.Status != RequestPending {
+		return ErrJoinRequestNotFound
+	}
+
+	return s.repo.ReviewJoinRequest(ctx, requestID, moderatorID, approve)
+}
+
+// moderatedGroup loads a group the user moderates
+func (s *service) moderatedGroup(ctx context.Context, groupID, userID int64) (*Group, error) {
+	group, err := s.GetGroup(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !group.CanModerate() {
+		return nil, ErrUnauthorized
+	}
+	return group, nil
+}
+
+// CanView reports whether the user may read the group's posts
+func (s *service) CanView(ctx context.Context, groupID, userID int64) (bool, error) {
+	group, err := s.repo.GetGroupByID(ctx, groupID, userID)
+	if errors.Is(err, ErrGroupNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return group.ContentVisible(), nil
+}
+
+// CanPost reports whether the user may post in the group
+func (s *service) CanPost(ctx context.Context, groupID, userID int64) (bool, error) {
+	_, err := s.repo.GetMemberRole(ctx, groupID, userID)
+	if errors.Is(err, ErrNotMember) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CanModerate reports whether the user may remove content from the group
+func (s *service) CanModerate(ctx context.Context, groupID, userID int64) (bool, error) {
+	role, err := s.repo.GetMemberRole(ctx, groupID, userID)
+	if errors.Is(err, ErrNotMember) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role == RoleOwner || role == RoleModerator, nil
+}
+
+// EraseUserData removes a deleted account's memberships, handing their groups on
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	media, err := s.repo.EraseUserData(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.removeMedia(ctx, media)
+	return nil, nil
+}
+
+// removeMedia deletes the files of deleted group posts and gives their
+// storage back to the authors
+func (s *service) removeMedia(ctx context.Context, media []PostMedia) {
+	released := make(map[int64]int64)
+	for _, item := range media {
+		if err := s.store.Delete(ctx, item.StorageKey); err != nil {
+			fmt.Printf("WARNING: Failed to delete media %s: %v\n", item.StorageKey, err)
+		}
+		released[item.UserID] += item.SizeBytes
+	}
+
+	for userID, bytes := range released {
+		if bytes <= 0 {
+			continue
+		}
+		if err := s.entitlements.ReleaseStorage(ctx, userID, bytes); err != nil {
+			fmt.Printf("WARNING: Failed to release %d bytes of storage for user %d: %v\n", bytes, userID, err)
+		}
+	}
+}
+
+// exportPageSize is how many rows each read fetches while building a data export
+const exportPageSize = 100
+
+// ExportUserData returns the groups the user belongs to for a personal data export
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	groups, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*Group, error) {
+		groups, _, err := s.repo.GetUserGroups(ctx, userID, limit, offset)
+		return groups, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export groups: %w", err)
+	}
+
+	return map[string]interface{}{
+		"groups": groups,
+	}, nil
+}
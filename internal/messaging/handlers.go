@@ -1,6 +1,7 @@
 package messaging
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -37,20 +38,43 @@ func NewHandler(svc Service, hub *Hub) *Handler {
 func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(http.Handler) http.Handler) {
 	api := router.PathPrefix("/api/v1").Subrouter()
 	api.Use(authMiddleware)
+	api.Use(common.RequireScopeByMethod(common.ScopeMessagesRead, common.ScopeMessagesWrite))
 
 	api.HandleFunc("/conversations", handler.CreateConversation).Methods("POST")
 	api.HandleFunc("/conversations", handler.GetConversations).Methods("GET")
 	api.HandleFunc("/conversations/{id}", handler.GetConversation).Methods("GET")
 	api.HandleFunc("/conversations/{id}/leave", handler.LeaveConversation).Methods("POST")
 	api.HandleFunc("/conversations/direct/{user_id}", handler.GetOrCreateDirect).Methods("POST")
-	api.HandleFunc("/conversations/{id}/messages", handler.SendMessage).Methods("POST")
 	api.HandleFunc("/conversations/{id}/messages", handler.GetMessages).Methods("GET")
 	api.HandleFunc("/conversations/{id}/read", handler.MarkAsRead).Methods("POST")
-	api.HandleFunc("/messages/{id}", handler.EditMessage).Methods("PUT")
-	api.HandleFunc("/messages/{id}", handler.DeleteMessage).Methods("DELETE")
 	api.HandleFunc("/messages/unread", handler.GetUnreadCount).Methods("GET")
 
-	router.HandleFunc("/ws", handler.HandleWebSocket)
+	// An admin impersonating a user must not speak for them
+	writes := api.NewRoute().Subrouter()
+	writes.Use(common.BlockImpersonation)
+	writes.HandleFunc("/conversations/{id}/messages", handler.SendMessage).Methods("POST")
+	writes.HandleFunc("/messages/{id}", handler.EditMessage).Methods("PUT")
+	writes.HandleFunc("/messages/{id}", handler.DeleteMessage).Methods("DELETE")
+
+	// Browsers cannot set headers on WebSocket requests, so the access token
+	// may come in the query string; it is then checked like any other
+	ws := router.NewRoute().Subrouter()
+	ws.Use(tokenFromQuery, authMiddleware, common.RequireScope(common.ScopeMessagesRead))
+	ws.HandleFunc("/ws", handler.HandleWebSocket)
+}
+
+// tokenFromQuery moves a ?token= access token into the Authorization header
+// and out of the URL
+func tokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if token := query.Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+			query.Del("token")
+			r.URL.RawQuery = query.Encode()
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (h *Handler) CreateConversation(w http.ResponseWriter, r *http.Request) {
@@ -62,6 +86,9 @@ func (h *Handler) CreateConversation(w http.ResponseWriter, r *http.Request) {
 	}
 	conv, err := h.service.CreateConversation(r.Context(), userID, &req)
 	if err != nil {
+		if common.WriteUpgradeRequired(w, err) {
+			return
+		}
 		common.InternalError(w, "Failed to create conversation")
 		return
 	}
@@ -189,19 +216,12 @@ func (h *Handler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, "", map[string]int64{"unread_count": count})
 }
 
+// HandleWebSocket upgrades an authenticated request to a WebSocket for the
+// user in the token, within the token's tenant
 func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		http.Error(w, "Token required", http.StatusUnauthorized)
-		return
-	}
-
-	// TODO: Validate token and get userID
-	// For now, get from query param (in production, validate JWT)
-	userIDStr := r.URL.Query().Get("user_id")
-	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	userID, err := common.GetUserID(r.Context())
 	if err != nil {
-		http.Error(w, "Invalid user", http.StatusUnauthorized)
+		common.Unauthorized(w, "Unauthorized")
 		return
 	}
 
@@ -220,11 +240,15 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	h.hub.Register(client)
 
-	go client.writePump()
-	go client.readPump()
+	// The connection outlives the request, but keeps its tenant and login
+	ctx := context.WithoutCancel(r.Context())
+	go h.writePump(ctx, client)
+	go h.readPump(ctx, client)
 }
 
-func (c *Client) readPump() {
+// readPump handles the client's frames. Subscribing and typing are only
+// allowed in conversations the user is a participant of in their tenant.
+func (h *Handler) readPump(ctx context.Context, c *Client) {
 	defer func() {
 		c.Hub.Unregister(c)
 		c.Conn.Close()
@@ -243,26 +267,35 @@ func (c *Client) readPump() {
 
 		switch incoming.Type {
 		case "subscribe":
-			c.Hub.Subscribe(c, incoming.ConversationID)
+			if h.isParticipant(ctx, incoming.ConversationID, c.UserID) {
+				c.Hub.Subscribe(c, incoming.ConversationID)
+			}
 		case "unsubscribe":
 			c.Hub.Unsubscribe(c, incoming.ConversationID)
-		case "typing":
-			c.Hub.BroadcastToConversation(incoming.ConversationID, &WSEvent{
-				Type:           WSEventTyping,
-				ConversationID: incoming.ConversationID,
-				UserID:         c.UserID,
-			})
-		case "stop_typing":
-			c.Hub.BroadcastToConversation(incoming.ConversationID, &WSEvent{
-				Type:           WSEventStopTyping,
-				ConversationID: incoming.ConversationID,
-				UserID:         c.UserID,
-			})
+		case "typing", "stop_typing":
+			err := h.service.NotifyTyping(ctx, incoming.ConversationID, c.UserID, incoming.Type == "typing")
+			if err != nil && !errors.Is(err, ErrNotParticipant) {
+				log.Printf("Failed to send typing status of user %d: %v", c.UserID, err)
+			}
 		}
 	}
 }
 
-func (c *Client) writePump() {
+// isParticipant reports whether the user is in the conversation, treating
+// errors as not
+func (h *Handler) isParticipant(ctx context.Context, convID, userID int64) bool {
+	ok, err := h.service.IsParticipant(ctx, convID, userID)
+	if err != nil {
+		log.Printf("Failed to check participant %d in conversation %d: %v", userID, convID, err)
+		return false
+	}
+	return ok
+}
+
+// writePump sends the client's events and pings. On every ping it checks that
+// the login the connection was opened with has not been revoked, and closes
+// the connection if it has.
+func (h *Handler) writePump(ctx context.Context, c *Client) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
 		ticker.Stop()
@@ -278,6 +311,11 @@ func (c *Client) writePump() {
 			}
 			c.Conn.WriteMessage(websocket.TextMessage, message)
 		case <-ticker.C:
+			if err := common.RecheckAuth(ctx); err != nil {
+				log.Printf("Closing WebSocket of user %d: %v", c.UserID, err)
+				c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Session has expired or been revoked"))
+				return
+			}
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -57,6 +57,7 @@ type Subscription struct {
 // BroadcastMessage represents a message to broadcast
 type BroadcastMessage struct {
 	ConversationID int64
+	Recipients     map[int64]bool // Users still in the conversation
 	Event          *WSEvent
 }
 
@@ -155,18 +156,32 @@ func (h *Hub) unsubscribeFromConversation(sub *Subscription) {
 	}
 }
 
+// broadcastToConversation sends the event to the conversation's subscribers.
+// Subscribers who are no longer recipients have left and are unsubscribed.
 func (h *Hub) broadcastToConversation(msg *BroadcastMessage) {
-	h.mu.RLock()
-	clients := h.conversations[msg.ConversationID]
-	h.mu.RUnlock()
-
 	data, err := json.Marshal(msg.Event)
 	if err != nil {
 		log.Printf("Failed to marshal event: %v", err)
 		return
 	}
 
+	h.mu.Lock()
+	clients := h.conversations[msg.ConversationID]
+	targets := make([]*Client, 0, len(clients))
 	for client := range clients {
+		if !msg.Recipients[client.UserID] {
+			delete(clients, client)
+			log.Printf("User %d unsubscribed from conversation %d they are no longer in", client.UserID, msg.ConversationID)
+			continue
+		}
+		targets = append(targets, client)
+	}
+	if clients != nil && len(clients) == 0 {
+		delete(h.conversations, msg.ConversationID)
+	}
+	h.mu.Unlock()
+
+	for _, client := range targets {
 		select {
 		case client.Send <- data:
 		default:
@@ -176,10 +191,16 @@ func (h *Hub) broadcastToConversation(msg *BroadcastMessage) {
 	}
 }
 
-// BroadcastToConversation sends an event to all participants in a conversation
-func (h *Hub) BroadcastToConversation(convID int64, event *WSEvent) {
+// BroadcastToConversation sends an event to the subscribers of a conversation
+// who are among its current participants
+func (h *Hub) BroadcastToConversation(convID int64, participantIDs []int64, event *WSEvent) {
+	recipients := make(map[int64]bool, len(participantIDs))
+	for _, id := range participantIDs {
+		recipients[id] = true
+	}
 	h.broadcast <- &BroadcastMessage{
 		ConversationID: convID,
+		Recipients:     recipients,
 		Event:          event,
 	}
 }
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 var (
@@ -41,6 +43,9 @@ type Repository interface {
 	DeleteMessage(ctx context.Context, msgID int64) error
 	MarkAsRead(ctx context.Context, convID, userID int64, messageID int64) error
 	GetUnreadCount(ctx context.Context, userID int64) (int64, error)
+
+	// Account deletion
+	EraseUserData(ctx context.Context, userID int64) error
 }
 
 type PostgresRepository struct {
@@ -52,13 +57,18 @@ func NewPostgresRepository(db *sqlx.DB) Repository {
 }
 
 func (r *PostgresRepository) CreateConversation(ctx context.Context, conv *Conversation) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO conversations (type, name, image_url, created_by)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO conversations (tenant_id, type, name, image_url, created_by)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, last_message_id, last_message_at, created_at, updated_at`
 
 	return r.db.QueryRowxContext(ctx, query,
-		conv.Type, conv.Name, conv.ImageURL, conv.CreatedBy,
+		tenantID, conv.Type, conv.Name, conv.ImageURL, conv.CreatedBy,
 	).Scan(&conv.ID, &conv.LastMessageID, &conv.LastMessageAt, &conv.CreatedAt, &conv.UpdatedAt)
 }
 
@@ -71,6 +81,10 @@ func (r *PostgresRepository) GetConversationByID(ctx context.Context, convID, us
 	if !isParticipant {
 		return nil, ErrNotParticipant
 	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	conv := &Conversation{}
 	query := `
@@ -79,9 +93,9 @@ func (r *PostgresRepository) GetConversationByID(ctx context.Context, convID, us
 			COALESCE(cp.unread_count, 0) as unread_count
 		FROM conversations c
 		LEFT JOIN conversation_participants cp ON c.id = cp.conversation_id AND cp.user_id = $2
-		WHERE c.id = $1`
+		WHERE c.id = $1 AND c.tenant_id = $3`
 
-	err = r.db.QueryRowxContext(ctx, query, convID, userID).Scan(
+	err = r.db.QueryRowxContext(ctx, query, convID, userID, tenantID).Scan(
 		&conv.ID, &conv.Type, &conv.Name, &conv.ImageURL, &conv.CreatedBy,
 		&conv.LastMessageID, &conv.LastMessageAt, &conv.CreatedAt, &conv.UpdatedAt,
 		&conv.UnreadCount,
@@ -101,15 +115,20 @@ func (r *PostgresRepository) GetConversationByID(ctx context.Context, convID, us
 }
 
 func (r *PostgresRepository) GetDirectConversation(ctx context.Context, userID1, userID2 int64) (*Conversation, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var convID int64
 	query := `
 		SELECT c.id FROM conversations c
 		JOIN conversation_participants cp1 ON c.id = cp1.conversation_id AND cp1.user_id = $1
 		JOIN conversation_participants cp2 ON c.id = cp2.conversation_id AND cp2.user_id = $2
-		WHERE c.type = 'direct'
+		WHERE c.type = 'direct' AND c.tenant_id = $3
 		LIMIT 1`
 
-	err := r.db.GetContext(ctx, &convID, query, userID1, userID2)
+	err = r.db.GetContext(ctx, &convID, query, userID1, userID2, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrConversationNotFound
 	}
@@ -124,10 +143,14 @@ func (r *PostgresRepository) GetUserConversations(ctx context.Context, userID in
 	if limit <= 0 {
 		limit = 20
 	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	var total int64
 	r.db.GetContext(ctx, &total,
-		`SELECT COUNT(*) FROM conversation_participants WHERE user_id = $1 AND left_at IS NULL`, userID)
+		`SELECT COUNT(*) FROM conversation_participants WHERE user_id = $1 AND tenant_id = $2 AND left_at IS NULL`, userID, tenantID)
 
 	conversations := []*Conversation{}
 	query := `
@@ -136,11 +159,11 @@ func (r *PostgresRepository) GetUserConversations(ctx context.Context, userID in
 			COALESCE(cp.unread_count, 0) as unread_count
 		FROM conversations c
 		JOIN conversation_participants cp ON c.id = cp.conversation_id
-		WHERE cp.user_id = $1 AND cp.left_at IS NULL AND cp.is_archived = FALSE
+		WHERE cp.user_id = $1 AND cp.tenant_id = $4 AND cp.left_at IS NULL AND cp.is_archived = FALSE
 		ORDER BY COALESCE(c.last_message_at, c.created_at) DESC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset)
+	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset, tenantID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -181,10 +204,16 @@ func (r *PostgresRepository) AddParticipant(ctx context.Context, convID, userID
 	if role == "" {
 		role = "member"
 	}
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO conversation_participants (conversation_id, user_id, role) VALUES ($1, $2, $3)
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The tenant foreign keys reject conversations and users of another tenant
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO conversation_participants (tenant_id, conversation_id, user_id, role) VALUES ($1, $2, $3, $4)
 		ON CONFLICT (conversation_id, user_id) DO UPDATE SET left_at = NULL`,
-		convID, userID, role)
+		tenantID, convID, userID, role)
 	return err
 }
 
@@ -228,10 +257,15 @@ func (r *PostgresRepository) GetParticipants(ctx context.Context, convID int64)
 }
 
 func (r *PostgresRepository) IsParticipant(ctx context.Context, convID, userID int64) (bool, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
 	var exists bool
-	err := r.db.GetContext(ctx, &exists,
-		`SELECT EXISTS(SELECT 1 FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL)`,
-		convID, userID)
+	err = r.db.GetContext(ctx, &exists,
+		`SELECT EXISTS(SELECT 1 FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2 AND tenant_id = $3 AND left_at IS NULL)`,
+		convID, userID, tenantID)
 	return exists, err
 }
 
@@ -272,14 +306,21 @@ func (r *PostgresRepository) CreateMessage(ctx context.Context, msg *Message) er
 }
 
 func (r *PostgresRepository) GetMessageByID(ctx context.Context, msgID int64) (*Message, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	msg := &Message{}
 	query := `
 		SELECT m.id, m.conversation_id, m.sender_id, m.parent_message_id, m.content, m.message_type,
 			m.media_url, m.media_thumbnail_url, m.media_size, m.media_duration,
 			m.is_edited, m.edited_at, m.is_deleted, m.deleted_at, m.created_at
-		FROM messages m WHERE m.id = $1`
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE m.id = $1 AND c.tenant_id = $2`
 
-	err := r.db.GetContext(ctx, msg, query, msgID)
+	err = r.db.GetContext(ctx, msg, query, msgID, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrMessageNotFound
 	}
@@ -363,9 +404,40 @@ func (r *PostgresRepository) MarkAsRead(ctx context.Context, convID, userID int6
 }
 
 func (r *PostgresRepository) GetUnreadCount(ctx context.Context, userID int64) (int64, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
 	var count int64
-	err := r.db.GetContext(ctx, &count,
-		`SELECT COALESCE(SUM(unread_count), 0) FROM conversation_participants WHERE user_id = $1 AND left_at IS NULL`,
-		userID)
+	err = r.db.GetContext(ctx, &count,
+		`SELECT COALESCE(SUM(unread_count), 0) FROM conversation_participants WHERE user_id = $1 AND tenant_id = $2 AND left_at IS NULL`,
+		userID, tenantID)
 	return count, err
 }
+
+// EraseUserData blanks a deleted user's messages and removes them from their
+// conversations. Message rows stay so other participants' threads and replies
+// remain consistent.
+func (r *PostgresRepository) EraseUserData(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`UPDATE messages SET content = NULL, media_url = NULL, media_thumbnail_url = NULL, media_size = NULL,
+			is_deleted = TRUE, deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP)
+		WHERE sender_id = $1`,
+		`DELETE FROM message_receipts WHERE user_id = $1`,
+		`UPDATE conversation_participants SET left_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND left_at IS NULL`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -3,14 +3,23 @@ package messaging
 import (
 	"context"
 	"fmt"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
+// EntitlementService checks actions against the user's plan
+type EntitlementService interface {
+	CheckLimit(ctx context.Context, userID int64, limit string, requested int64) error
+}
+
 type Service interface {
 	// Conversations
 	CreateConversation(ctx context.Context, userID int64, req *CreateConversationRequest) (*Conversation, error)
 	GetConversation(ctx context.Context, convID, userID int64) (*Conversation, error)
 	GetOrCreateDirectConversation(ctx context.Context, userID, otherUserID int64) (*Conversation, error)
 	GetUserConversations(ctx context.Context, userID int64, limit, offset int) ([]*Conversation, int64, error)
+	IsParticipant(ctx context.Context, convID, userID int64) (bool, error)
+	NotifyTyping(ctx context.Context, convID, userID int64, typing bool) error
 	LeaveConversation(ctx context.Context, convID, userID int64) error
 
 	// Messages
@@ -20,15 +29,20 @@ type Service interface {
 	DeleteMessage(ctx context.Context, userID, msgID int64) error
 	MarkAsRead(ctx context.Context, convID, userID int64, messageID int64) error
 	GetUnreadCount(ctx context.Context, userID int64) (int64, error)
+
+	// Account data
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
 }
 
 type service struct {
-	repo Repository
-	hub  *Hub
+	repo         Repository
+	hub          *Hub
+	entitlements EntitlementService
 }
 
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+func NewService(repo Repository, entitlements EntitlementService) Service {
+	return &service{repo: repo, entitlements: entitlements}
 }
 
 func (s *service) SetHub(hub *Hub) {
@@ -45,6 +59,17 @@ func (s *service) CreateConversation(ctx context.Context, userID int64, req *Cre
 		}
 	}
 
+	// Group chats are capped by the creator's plan
+	if req.Type == "group" {
+		members := map[int64]bool{userID: true}
+		for _, participantID := range req.ParticipantIDs {
+			members[participantID] = true
+		}
+		if err := s.entitlements.CheckLimit(ctx, userID, common.LimitGroupChatSize, int64(len(members))); err != nil {
+			return nil, err
+		}
+	}
+
 	conv := &Conversation{
 		Type:      req.Type,
 		Name:      req.Name,
@@ -97,6 +122,51 @@ func (s *service) GetUserConversations(ctx context.Context, userID int64, limit,
 	return s.repo.GetUserConversations(ctx, userID, limit, offset)
 }
 
+// IsParticipant reports whether the user is in the conversation in the current tenant
+func (s *service) IsParticipant(ctx context.Context, convID, userID int64) (bool, error) {
+	return s.repo.IsParticipant(ctx, convID, userID)
+}
+
+// NotifyTyping tells the other participants that the user started or stopped typing
+func (s *service) NotifyTyping(ctx context.Context, convID, userID int64, typing bool) error {
+	isParticipant, err := s.repo.IsParticipant(ctx, convID, userID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		return ErrNotParticipant
+	}
+
+	eventType := WSEventStopTyping
+	if typing {
+		eventType = WSEventTyping
+	}
+	s.broadcast(ctx, convID, &WSEvent{
+		Type:           eventType,
+		ConversationID: convID,
+		UserID:         userID,
+	})
+	return nil
+}
+
+// broadcast sends an event to the conversation's WebSocket subscribers who
+// are still participants, so users who left stop receiving it
+func (s *service) broadcast(ctx context.Context, convID int64, event *WSEvent) {
+	if s.hub == nil {
+		return
+	}
+	participants, err := s.repo.GetParticipants(ctx, convID)
+	if err != nil {
+		fmt.Printf("WARNING: Failed to load participants of conversation %d for broadcast: %v\n", convID, err)
+		return
+	}
+	ids := make([]int64, len(participants))
+	for i, p := range participants {
+		ids[i] = p.UserID
+	}
+	s.hub.BroadcastToConversation(convID, ids, event)
+}
+
 func (s *service) LeaveConversation(ctx context.Context, convID, userID int64) error {
 	return s.repo.RemoveParticipant(ctx, convID, userID)
 }
@@ -124,15 +194,13 @@ func (s *service) SendMessage(ctx context.Context, userID, convID int64, req *Se
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
-	// Broadcast via WebSocket if hub is available
-	if s.hub != nil {
-		s.hub.BroadcastToConversation(convID, &WSEvent{
-			Type:           WSEventNewMessage,
-			ConversationID: convID,
-			UserID:         userID,
-			Message:        msg,
-		})
-	}
+	// Broadcast via WebSocket
+	s.broadcast(ctx, convID, &WSEvent{
+		Type:           WSEventNewMessage,
+		ConversationID: convID,
+		UserID:         userID,
+		Message:        msg,
+	})
 
 	return msg, nil
 }
@@ -160,13 +228,11 @@ func (s *service) EditMessage(ctx context.Context, userID, msgID int64, req *Upd
 	}
 
 	// Broadcast edit
-	if s.hub != nil {
-		s.hub.BroadcastToConversation(msg.ConversationID, &WSEvent{
-			Type:           WSEventMessageEdited,
-			ConversationID: msg.ConversationID,
-			Message:        msg,
-		})
-	}
+	s.broadcast(ctx, msg.ConversationID, &WSEvent{
+		Type:           WSEventMessageEdited,
+		ConversationID: msg.ConversationID,
+		Message:        msg,
+	})
 
 	return msg, nil
 }
@@ -186,13 +252,11 @@ func (s *service) DeleteMessage(ctx context.Context, userID, msgID int64) error
 	}
 
 	// Broadcast delete
-	if s.hub != nil {
-		s.hub.BroadcastToConversation(msg.ConversationID, &WSEvent{
-			Type:           WSEventMessageDeleted,
-			ConversationID: msg.ConversationID,
-			Data:           map[string]int64{"message_id": msgID},
-		})
-	}
+	s.broadcast(ctx, msg.ConversationID, &WSEvent{
+		Type:           WSEventMessageDeleted,
+		ConversationID: msg.ConversationID,
+		Data:           map[string]int64{"message_id": msgID},
+	})
 
 	return nil
 }
@@ -203,14 +267,12 @@ func (s *service) MarkAsRead(ctx context.Context, convID, userID int64, messageI
 	}
 
 	// Broadcast read status
-	if s.hub != nil {
-		s.hub.BroadcastToConversation(convID, &WSEvent{
-			Type:           WSEventRead,
-			ConversationID: convID,
-			UserID:         userID,
-			Data:           map[string]int64{"message_id": messageID},
-		})
-	}
+	s.broadcast(ctx, convID, &WSEvent{
+		Type:           WSEventRead,
+		ConversationID: convID,
+		UserID:         userID,
+		Data:           map[string]int64{"message_id": messageID},
+	})
 
 	return nil
 }
@@ -218,3 +280,44 @@ func (s *service) MarkAsRead(ctx context.Context, convID, userID int64, messageI
 func (s *service) GetUnreadCount(ctx context.Context, userID int64) (int64, error) {
 	return s.repo.GetUnreadCount(ctx, userID)
 }
+
+// EraseUserData removes a deleted account's message content and conversation memberships
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	return nil, s.repo.EraseUserData(ctx, userID)
+}
+
+// exportPageSize is how many rows each read fetches while building a data export
+const exportPageSize = 100
+
+// exportedConversation is a conversation with its messages in a data export
+type exportedConversation struct {
+	*Conversation
+	Messages []*Message `json:"messages"`
+}
+
+// ExportUserData returns the user's conversations and their messages for a personal data export
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	conversations, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*Conversation, error) {
+		convs, _, err := s.repo.GetUserConversations(ctx, userID, limit, offset)
+		return convs, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export conversations: %w", err)
+	}
+
+	exported := make([]*exportedConversation, 0, len(conversations))
+	for _, conv := range conversations {
+		messages, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*Message, error) {
+			messages, _, err := s.repo.GetConversationMessages(ctx, conv.ID, userID, limit, offset)
+			return messages, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to export messages of conversation %d: %w", conv.ID, err)
+		}
+		exported = append(exported, &exportedConversation{Conversation: conv, Messages: messages})
+	}
+
+	return map[string]interface{}{
+		"conversations": exported,
+	}, nil
+}
@@ -19,6 +19,7 @@ func NewHandler(service Service) *Handler {
 func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(http.Handler) http.Handler) {
 	api := router.PathPrefix("/api/v1").Subrouter()
 	api.Use(authMiddleware)
+	api.Use(common.RequireScopeByMethod(common.ScopeNotificationsRead, common.ScopeNotificationsWrite))
 
 	// Notifications
 	api.HandleFunc("/notifications", handler.GetNotifications).Methods("GET")
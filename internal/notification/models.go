@@ -15,21 +15,23 @@ const (
 	TypeMessage    NotificationType = "message"
 	TypeStoryView  NotificationType = "story_view"
 	TypeStoryReply NotificationType = "story_reply"
+	TypeSecurity   NotificationType = "security"
+	TypeDataExport NotificationType = "data_export"
 )
 
 // Notification represents a notification
 type Notification struct {
-	ID        int64            `json:"id" db:"id"`
-	UserID    int64            `json:"user_id" db:"user_id"`
-	Type      NotificationType `json:"type" db:"type"`
-	Title     string           `json:"title" db:"title"`
-	Message   string           `json:"message" db:"message"`
+	ID        int64                  `json:"id" db:"id"`
+	UserID    int64                  `json:"user_id" db:"user_id"`
+	Type      NotificationType       `json:"type" db:"type"`
+	Title     string                 `json:"title" db:"title"`
+	Message   string                 `json:"message" db:"message"`
 	Data      map[string]interface{} `json:"data,omitempty" db:"data"`
-	ActionURL *string          `json:"action_url,omitempty" db:"action_url"`
-	IsRead    bool             `json:"is_read" db:"is_read"`
-	ReadAt    *time.Time       `json:"read_at,omitempty" db:"read_at"`
-	CreatedAt time.Time        `json:"created_at" db:"created_at"`
-	Actor     *NotificationActor `json:"actor,omitempty"`
+	ActionURL *string                `json:"action_url,omitempty" db:"action_url"`
+	IsRead    bool                   `json:"is_read" db:"is_read"`
+	ReadAt    *time.Time             `json:"read_at,omitempty" db:"read_at"`
+	CreatedAt time.Time              `json:"created_at" db:"created_at"`
+	Actor     *NotificationActor     `json:"actor,omitempty"`
 }
 
 // NotificationActor represents the user who triggered the notification
@@ -42,39 +44,39 @@ type NotificationActor struct {
 
 // PushToken represents a device push token
 type PushToken struct {
-	ID         int64     `json:"id" db:"id"`
-	UserID     int64     `json:"user_id" db:"user_id"`
-	Token      string    `json:"token" db:"token"`
-	Platform   string    `json:"platform" db:"platform"` // ios, android, web
-	DeviceID   *string   `json:"device_id,omitempty" db:"device_id"`
-	IsActive   bool      `json:"is_active" db:"is_active"`
+	ID         int64      `json:"id" db:"id"`
+	UserID     int64      `json:"user_id" db:"user_id"`
+	Token      string     `json:"token" db:"token"`
+	Platform   string     `json:"platform" db:"platform"` // ios, android, web
+	DeviceID   *string    `json:"device_id,omitempty" db:"device_id"`
+	IsActive   bool       `json:"is_active" db:"is_active"`
 	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // NotificationPreferences represents user notification settings
 type NotificationPreferences struct {
-	UserID            int64 `json:"user_id" db:"user_id"`
-	PushEnabled       bool  `json:"push_enabled" db:"push_enabled"`
-	EmailEnabled      bool  `json:"email_enabled" db:"email_enabled"`
-	Likes             bool  `json:"likes" db:"likes"`
-	Comments          bool  `json:"comments" db:"comments"`
-	Follows           bool  `json:"follows" db:"follows"`
-	Messages          bool  `json:"messages" db:"messages"`
-	StoryViews        bool  `json:"story_views" db:"story_views"`
-	Mentions          bool  `json:"mentions" db:"mentions"`
+	UserID       int64 `json:"user_id" db:"user_id"`
+	PushEnabled  bool  `json:"push_enabled" db:"push_enabled"`
+	EmailEnabled bool  `json:"email_enabled" db:"email_enabled"`
+	Likes        bool  `json:"likes" db:"likes"`
+	Comments     bool  `json:"comments" db:"comments"`
+	Follows      bool  `json:"follows" db:"follows"`
+	Messages     bool  `json:"messages" db:"messages"`
+	StoryViews   bool  `json:"story_views" db:"story_views"`
+	Mentions     bool  `json:"mentions" db:"mentions"`
 }
 
 // CreateNotificationRequest for creating a notification
 type CreateNotificationRequest struct {
-	UserID    int64            `json:"user_id" validate:"required"`
-	Type      NotificationType `json:"type" validate:"required"`
-	Title     string           `json:"title" validate:"required,max=200"`
-	Message   string           `json:"message" validate:"required,max=500"`
+	UserID    int64                  `json:"user_id" validate:"required"`
+	Type      NotificationType       `json:"type" validate:"required"`
+	Title     string                 `json:"title" validate:"required,max=200"`
+	Message   string                 `json:"message" validate:"required,max=500"`
 	Data      map[string]interface{} `json:"data,omitempty"`
-	ActionURL *string          `json:"action_url,omitempty"`
-	ActorID   *int64           `json:"actor_id,omitempty"`
+	ActionURL *string                `json:"action_url,omitempty"`
+	ActorID   *int64                 `json:"actor_id,omitempty"`
 }
 
 // RegisterTokenRequest for registering push token
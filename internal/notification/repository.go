@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 var (
@@ -35,6 +37,9 @@ type Repository interface {
 	// Preferences
 	GetPreferences(ctx context.Context, userID int64) (*NotificationPreferences, error)
 	UpdatePreferences(ctx context.Context, prefs *NotificationPreferences) error
+
+	// Account deletion
+	EraseUserData(ctx context.Context, userID int64) error
 }
 
 type PostgresRepository struct {
@@ -46,6 +51,11 @@ func NewPostgresRepository(db *sqlx.DB) Repository {
 }
 
 func (r *PostgresRepository) Create(ctx context.Context, n *Notification) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
 	var dataStr string
 	if n.Data != nil {
 		dataJSON, err := json.Marshal(n.Data)
@@ -60,14 +70,14 @@ func (r *PostgresRepository) Create(ctx context.Context, n *Notification) error
 	}
 
 	query := `
-		INSERT INTO notifications (user_id, type, title, message, data, action_url)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO notifications (tenant_id, user_id, type, title, message, data, action_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, is_read, created_at`
 
-	err := r.db.QueryRowxContext(ctx, query,
-		n.UserID, n.Type, n.Title, n.Message, dataStr, n.ActionURL,
+	err = r.db.QueryRowxContext(ctx, query,
+		tenantID, n.UserID, n.Type, n.Title, n.Message, dataStr, n.ActionURL,
 	).Scan(&n.ID, &n.IsRead, &n.CreatedAt)
-	
+
 	if err != nil {
 		fmt.Printf("ERROR: notification insert failed - UserID: %d, Type: %s, Error: %v\n", n.UserID, n.Type, err)
 	}
@@ -75,13 +85,18 @@ func (r *PostgresRepository) Create(ctx context.Context, n *Notification) error
 }
 
 func (r *PostgresRepository) GetByID(ctx context.Context, id int64) (*Notification, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	n := &Notification{}
 	var dataJSON []byte
 
 	query := `SELECT id, user_id, type, title, message, data, action_url, is_read, read_at, created_at
-		FROM notifications WHERE id = $1`
+		FROM notifications WHERE id = $1 AND tenant_id = $2`
 
-	err := r.db.QueryRowxContext(ctx, query, id).Scan(
+	err = r.db.QueryRowxContext(ctx, query, id, tenantID).Scan(
 		&n.ID, &n.UserID, &n.Type, &n.Title, &n.Message, &dataJSON, &n.ActionURL, &n.IsRead, &n.ReadAt, &n.CreatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -103,8 +118,13 @@ func (r *PostgresRepository) GetUserNotifications(ctx context.Context, userID in
 		limit = 20
 	}
 
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var total int64
-	err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM notifications WHERE user_id = $1`, userID)
+	err = r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND tenant_id = $2`, userID, tenantID)
 	if err != nil {
 		fmt.Printf("ERROR: Failed to count notifications for user %d: %v\n", userID, err)
 	}
@@ -114,11 +134,11 @@ func (r *PostgresRepository) GetUserNotifications(ctx context.Context, userID in
 	query := `
 		SELECT n.id, n.user_id, n.type, n.title, n.message, n.data, n.action_url, n.is_read, n.read_at, n.created_at
 		FROM notifications n
-		WHERE n.user_id = $1
+		WHERE n.user_id = $1 AND n.tenant_id = $4
 		ORDER BY n.created_at DESC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset)
+	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset, tenantID)
 	if err != nil {
 		fmt.Printf("ERROR: Failed to query notifications: %v\n", err)
 		return nil, 0, err
@@ -180,9 +200,14 @@ func (r *PostgresRepository) DeleteAll(ctx context.Context, userID int64) error
 }
 
 func (r *PostgresRepository) GetUnreadCount(ctx context.Context, userID int64) (int64, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
 	var count int64
-	err := r.db.GetContext(ctx, &count,
-		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = FALSE`, userID)
+	err = r.db.GetContext(ctx, &count,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND tenant_id = $2 AND is_read = FALSE`, userID, tenantID)
 	return count, err
 }
 
@@ -237,3 +262,25 @@ func (r *PostgresRepository) UpdatePreferences(ctx context.Context, prefs *Notif
 	// In a real implementation, upsert to preferences table
 	return nil
 }
+
+// EraseUserData deletes a user's notifications and push tokens, along with
+// notifications other users received about their activity
+func (r *PostgresRepository) EraseUserData(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM notifications WHERE user_id = $1 OR data->>'actor_id' = $1::text`,
+		`DELETE FROM push_tokens WHERE user_id = $1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
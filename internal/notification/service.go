@@ -3,6 +3,8 @@ package notification
 import (
 	"context"
 	"fmt"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 type Service interface {
@@ -28,6 +30,12 @@ type Service interface {
 	NotifyLike(ctx context.Context, likerID, postOwnerID, postID int64, likerUsername string) error
 	NotifyComment(ctx context.Context, commenterID, postOwnerID, postID, commentID int64, commenterUsername, commentPreview string) error
 	NotifyMention(ctx context.Context, mentionerID, mentionedID, postID int64, mentionerUsername string) error
+	NotifySecurityAlert(ctx context.Context, userID int64, title, message string, data map[string]interface{}) error
+	NotifyDataExportReady(ctx context.Context, userID, exportID int64) error
+
+	// Account data
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
 }
 
 type service struct {
@@ -230,3 +238,52 @@ func (s *service) NotifyMention(ctx context.Context, mentionerID, mentionedID, p
 	})
 	return err
 }
+
+func (s *service) NotifySecurityAlert(ctx context.Context, userID int64, title, message string, data map[string]interface{}) error {
+	actionURL := "/settings/security"
+	_, err := s.Create(ctx, &CreateNotificationRequest{
+		UserID:    userID,
+		Type:      TypeSecurity,
+		Title:     title,
+		Message:   message,
+		ActionURL: &actionURL,
+		Data:      data,
+	})
+	return err
+}
+
+func (s *service) NotifyDataExportReady(ctx context.Context, userID, exportID int64) error {
+	actionURL := "/settings/data-export"
+	_, err := s.Create(ctx, &CreateNotificationRequest{
+		UserID:    userID,
+		Type:      TypeDataExport,
+		Title:     "Your data export is ready",
+		Message:   "The archive of your data is ready to download.",
+		ActionURL: &actionURL,
+		Data:      map[string]interface{}{"export_id": exportID},
+	})
+	return err
+}
+
+// EraseUserData removes a deleted account's notifications and push tokens
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	return nil, s.repo.EraseUserData(ctx, userID)
+}
+
+// exportPageSize is how many rows each read fetches while building a data export
+const exportPageSize = 100
+
+// ExportUserData returns the user's notifications for a personal data export
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	notifications, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*Notification, error) {
+		notifications, _, err := s.repo.GetUserNotifications(ctx, userID, limit, offset)
+		return notifications, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export notifications: %w", err)
+	}
+
+	return map[string]interface{}{
+		"notifications": notifications,
+	}, nil
+}
@@ -2,13 +2,26 @@ package posts
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
+const (
+	// maxMediaUpload caps one uploaded photo or video; plan storage quotas apply on top
+	maxMediaUpload = 100 << 20
+	// uploadMemory is how much of a multipart upload is held in memory before
+	// spilling to a temporary file
+	uploadMemory = 10 << 20
+	// uploadTimeout replaces the server's read and write timeouts for media
+	// uploads, so a maxMediaUpload file arrives over slow connections
+	uploadTimeout = 10 * time.Minute
+)
+
 type Handler struct {
 	service Service
 }
@@ -20,9 +33,10 @@ func NewHandler(service Service) *Handler {
 func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(http.Handler) http.Handler) {
 	api := router.PathPrefix("/api/v1").Subrouter()
 	api.Use(authMiddleware)
+	api.Use(common.RequireScopeByMethod(common.ScopePostsRead, common.ScopePostsWrite))
 
 	// IMPORTANT: Specific routes must be registered BEFORE wildcard {id} routes
-	
+
 	// Feed routes (no post {id})
 	api.HandleFunc("/feed", handler.GetFeed).Methods("GET")
 	api.HandleFunc("/posts", handler.CreatePost).Methods("POST")
@@ -31,10 +45,13 @@ func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(ht
 	// User posts
 	api.HandleFunc("/users/{id}/posts", handler.GetUserPosts).Methods("GET")
 
+	// Group feed
+	api.HandleFunc("/groups/{id}/posts", handler.GetGroupPosts).Methods("GET")
+
 	// Post CRUD with {id} - MUST come after /posts/saved
 	api.HandleFunc("/posts/{id}", handler.GetPost).Methods("GET")
 	api.HandleFunc("/posts/{id}", handler.UpdatePost).Methods("PUT")
-	api.HandleFunc("/posts/{id}", handler.DeletePost).Methods("DELETE")
+	api.HandleFunc("/posts/{id}/media", handler.UploadPostMedia).Methods("POST")
 
 	// Post interactions
 	api.HandleFunc("/posts/{id}/like", handler.LikePost).Methods("POST")
@@ -45,7 +62,12 @@ func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(ht
 	// Comments
 	api.HandleFunc("/posts/{id}/comments", handler.CreateComment).Methods("POST")
 	api.HandleFunc("/posts/{id}/comments", handler.GetPostComments).Methods("GET")
-	api.HandleFunc("/comments/{id}", handler.DeleteComment).Methods("DELETE")
+
+	// An admin impersonating a user must not delete their content
+	deletes := api.NewRoute().Subrouter()
+	deletes.Use(common.BlockImpersonation)
+	deletes.HandleFunc("/posts/{id}", handler.DeletePost).Methods("DELETE")
+	deletes.HandleFunc("/comments/{id}", handler.DeleteComment).Methods("DELETE")
 }
 
 func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -63,6 +85,10 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 
 	post, err := h.service.CreatePost(r.Context(), userID, &req)
 	if err != nil {
+		if errors.Is(err, ErrNotGroupMember) {
+			common.Forbidden(w, "Not a member of this group")
+			return
+		}
 		common.InternalError(w, "Failed to create post")
 		return
 	}
@@ -161,6 +187,80 @@ func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, "Post deleted", nil)
 }
 
+// UploadPostMedia attaches a photo or video, sent as the multipart field
+// "file", to the end of a post
+func (h *Handler) UploadPostMedia(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	postID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid post ID")
+		return
+	}
+
+	// The server's timeouts are sized for API calls, not large files
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(uploadTimeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		fmt.Printf("WARNING: Failed to extend upload read deadline: %v\n", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		fmt.Printf("WARNING: Failed to extend upload write deadline: %v\n", err)
+	}
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaUpload+(1<<20))
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			common.Error(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		common.BadRequest(w, "Failed to parse form data")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		common.BadRequest(w, "No file provided")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxMediaUpload {
+		common.Error(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+
+	media, err := h.service.UploadPostMedia(r.Context(), userID, postID, file, header.Size)
+	if err != nil {
+		if common.WriteUpgradeRequired(w, err) {
+			return
+		}
+		if errors.Is(err, ErrUnsupportedMedia) {
+			common.Error(w, http.StatusUnsupportedMediaType, "Only JPEG, PNG, GIF and WebP images and MP4 videos are supported")
+			return
+		}
+		if errors.Is(err, ErrPostNotFound) {
+			common.NotFound(w, "Post not found")
+			return
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			common.Forbidden(w, "Not authorized to add media to this post")
+			return
+		}
+		fmt.Printf("ERROR: Failed to upload media - PostID: %d: %v\n", postID, err)
+		common.InternalError(w, "Failed to upload media")
+		return
+	}
+
+	common.Created(w, "Media uploaded", media)
+}
+
 func (h *Handler) GetFeed(w http.ResponseWriter, r *http.Request) {
 	userID, err := common.GetUserID(r.Context())
 	if err != nil {
@@ -208,6 +308,35 @@ func (h *Handler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	common.SuccessWithMeta(w, "", posts, &common.Meta{Total: total})
 }
 
+func (h *Handler) GetGroupPosts(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserID(r.Context())
+	if err != nil {
+		common.Unauthorized(w, "Unauthorized")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		common.BadRequest(w, "Invalid group ID")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	posts, total, err := h.service.GetGroupPosts(r.Context(), groupID, userID, limit, offset)
+	if err != nil {
+		if errors.Is(err, ErrGroupNotFound) {
+			common.NotFound(w, "Group not found")
+			return
+		}
+		common.InternalError(w, "Failed to get group posts")
+		return
+	}
+
+	common.SuccessWithMeta(w, "", posts, &common.Meta{Total: total})
+}
+
 func (h *Handler) LikePost(w http.ResponseWriter, r *http.Request) {
 	userID, err := common.GetUserID(r.Context())
 	if err != nil {
@@ -369,6 +498,10 @@ func (h *Handler) GetPostComments(w http.ResponseWriter, r *http.Request) {
 
 	comments, total, err := h.service.GetPostComments(r.Context(), postID, userID, limit, offset)
 	if err != nil {
+		if errors.Is(err, ErrPostNotFound) {
+			common.NotFound(w, "Post not found")
+			return
+		}
 		common.InternalError(w, "Failed to get comments")
 		return
 	}
@@ -8,6 +8,7 @@ import (
 type Post struct {
 	ID            int64       `json:"id" db:"id"`
 	UserID        int64       `json:"user_id" db:"user_id"`
+	GroupID       *int64      `json:"group_id,omitempty" db:"group_id"`
 	Caption       *string     `json:"caption,omitempty" db:"caption"`
 	Location      *string     `json:"location,omitempty" db:"location"`
 	Latitude      *float64    `json:"latitude,omitempty" db:"latitude"`
@@ -37,6 +38,8 @@ type PostMedia struct {
 	Height       *int      `json:"height,omitempty" db:"height"`
 	Duration     *int      `json:"duration,omitempty" db:"duration"`
 	Position     int       `json:"position" db:"position"`
+	StorageKey   *string   `json:"-" db:"storage_key"` // Set for uploaded files
+	Size         int64     `json:"size,omitempty" db:"size_bytes"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -51,18 +54,18 @@ type PostUser struct {
 
 // Comment represents a comment on a post
 type Comment struct {
-	ID         int64        `json:"id" db:"id"`
-	PostID     int64        `json:"post_id" db:"post_id"`
-	UserID     int64        `json:"user_id" db:"user_id"`
-	ParentID   *int64       `json:"parent_id,omitempty" db:"parent_id"`
-	Content    string       `json:"content" db:"content"`
-	LikesCount int          `json:"likes_count" db:"likes_count"`
-	IsEdited   bool         `json:"is_edited" db:"is_edited"`
-	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time    `json:"updated_at" db:"updated_at"`
-	User       *PostUser    `json:"user,omitempty"`
-	Replies    []Comment    `json:"replies,omitempty"`
-	IsLiked    bool         `json:"is_liked,omitempty"`
+	ID         int64     `json:"id" db:"id"`
+	PostID     int64     `json:"post_id" db:"post_id"`
+	UserID     int64     `json:"user_id" db:"user_id"`
+	ParentID   *int64    `json:"parent_id,omitempty" db:"parent_id"`
+	Content    string    `json:"content" db:"content"`
+	LikesCount int       `json:"likes_count" db:"likes_count"`
+	IsEdited   bool      `json:"is_edited" db:"is_edited"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	User       *PostUser `json:"user,omitempty"`
+	Replies    []Comment `json:"replies,omitempty"`
+	IsLiked    bool      `json:"is_liked,omitempty"`
 }
 
 // PostLike represents a like on a post
@@ -88,6 +91,7 @@ type CreatePostRequest struct {
 	Latitude   *float64 `json:"latitude" validate:"omitempty"`
 	Longitude  *float64 `json:"longitude" validate:"omitempty"`
 	Visibility string   `json:"visibility" validate:"omitempty,oneof=public followers private"`
+	GroupID    *int64   `json:"group_id" validate:"omitempty"` // Post in a group instead of the profile
 }
 
 // UpdatePostRequest represents a request to update a post
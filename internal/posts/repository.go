@@ -6,6 +6,8 @@ import (
 	"errors"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 var (
@@ -16,6 +18,8 @@ var (
 	ErrAlreadySaved    = errors.New("already saved")
 	ErrNotSaved        = errors.New("not saved")
 	ErrUnauthorized    = errors.New("unauthorized")
+	ErrGroupNotFound   = errors.New("group not found")
+	ErrNotGroupMember  = errors.New("not a member of this group")
 )
 
 // Repository defines post data operations
@@ -26,7 +30,8 @@ type Repository interface {
 	DeletePost(ctx context.Context, postID int64) error
 	GetUserPosts(ctx context.Context, userID, currentUserID int64, limit, offset int) ([]*Post, int64, error)
 	GetFeed(ctx context.Context, userID int64, feedType string, limit, offset int) ([]*Post, error)
-	AddPostMedia(ctx context.Context, media *PostMedia) error
+	GetGroupPosts(ctx context.Context, groupID, currentUserID int64, limit, offset int) ([]*Post, int64, error)
+	AddPostMedia(ctx context.Context, media *PostMedia, allow func(items int) error) error
 	GetPostMedia(ctx context.Context, postID int64) ([]PostMedia, error)
 	LikePost(ctx context.Context, postID, userID int64) error
 	UnlikePost(ctx context.Context, postID, userID int64) error
@@ -35,8 +40,18 @@ type Repository interface {
 	GetSavedPosts(ctx context.Context, userID int64, limit, offset int) ([]*Post, int64, error)
 	CreateComment(ctx context.Context, comment *Comment) error
 	GetPostComments(ctx context.Context, postID, currentUserID int64, limit, offset int) ([]*Comment, int64, error)
+	GetUserComments(ctx context.Context, userID int64, limit, offset int) ([]*Comment, error)
 	DeleteComment(ctx context.Context, commentID int64) error
 	GetCommentByID(ctx context.Context, commentID int64) (*Comment, error)
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+}
+
+// groupVisible limits posts p to profile posts and posts of groups the user
+// in the given parameter can read
+func groupVisible(userParam string) string {
+	return `(p.group_id IS NULL
+		OR EXISTS(SELECT 1 FROM groups WHERE id = p.group_id AND privacy = 'public')
+		OR EXISTS(SELECT 1 FROM group_members WHERE group_id = p.group_id AND user_id = ` + userParam + `))`
 }
 
 type PostgresRepository struct {
@@ -48,27 +63,37 @@ func NewPostgresRepository(db *sqlx.DB) Repository {
 }
 
 func (r *PostgresRepository) CreatePost(ctx context.Context, post *Post) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
 	query := `
-		INSERT INTO posts (user_id, caption, location, latitude, longitude, visibility)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO posts (tenant_id, user_id, group_id, caption, location, latitude, longitude, visibility)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, is_pinned, is_archived, likes_count, comments_count, shares_count, created_at, updated_at`
 	return r.db.QueryRowxContext(ctx, query,
-		post.UserID, post.Caption, post.Location, post.Latitude, post.Longitude, post.Visibility,
+		tenantID, post.UserID, post.GroupID, post.Caption, post.Location, post.Latitude, post.Longitude, post.Visibility,
 	).Scan(&post.ID, &post.IsPinned, &post.IsArchived, &post.LikesCount, &post.CommentsCount, &post.SharesCount, &post.CreatedAt, &post.UpdatedAt)
 }
 
 func (r *PostgresRepository) GetPostByID(ctx context.Context, postID, currentUserID int64) (*Post, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	post := &Post{}
 	query := `
-		SELECT p.id, p.user_id, p.caption, p.location, p.latitude, p.longitude,
+		SELECT p.id, p.user_id, p.group_id, p.caption, p.location, p.latitude, p.longitude,
 			p.visibility, p.is_pinned, p.is_archived, p.likes_count, p.comments_count, p.shares_count,
 			p.created_at, p.updated_at,
 			EXISTS(SELECT 1 FROM post_likes WHERE post_id = p.id AND user_id = $2) as is_liked,
 			EXISTS(SELECT 1 FROM saved_posts WHERE post_id = p.id AND user_id = $2) as is_saved
-		FROM posts p WHERE p.id = $1 AND p.is_archived = FALSE`
+		FROM posts p
+		WHERE p.id = $1 AND p.tenant_id = $3 AND p.is_archived = FALSE
+			AND EXISTS(SELECT 1 FROM users WHERE id = p.user_id AND account_status = 'active')`
 
-	err := r.db.QueryRowxContext(ctx, query, postID, currentUserID).Scan(
-		&post.ID, &post.UserID, &post.Caption, &post.Location, &post.Latitude, &post.Longitude,
+	err = r.db.QueryRowxContext(ctx, query, postID, currentUserID, tenantID).Scan(
+		&post.ID, &post.UserID, &post.GroupID, &post.Caption, &post.Location, &post.Latitude, &post.Longitude,
 		&post.Visibility, &post.IsPinned, &post.IsArchived, &post.LikesCount, &post.CommentsCount, &post.SharesCount,
 		&post.CreatedAt, &post.UpdatedAt, &post.IsLiked, &post.IsSaved,
 	)
@@ -89,13 +114,21 @@ func (r *PostgresRepository) GetPostByID(ctx context.Context, postID, currentUse
 }
 
 func (r *PostgresRepository) UpdatePost(ctx context.Context, post *Post) error {
-	query := `UPDATE posts SET caption = $2, location = $3, visibility = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, post.ID, post.Caption, post.Location, post.Visibility)
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE posts SET caption = $2, location = $3, visibility = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant_id = $5`
+	_, err = r.db.ExecContext(ctx, query, post.ID, post.Caption, post.Location, post.Visibility, tenantID)
 	return err
 }
 
 func (r *PostgresRepository) DeletePost(ctx context.Context, postID int64) error {
-	result, err := r.db.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, postID)
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx, `DELETE FROM posts WHERE id = $1 AND tenant_id = $2`, postID, tenantID)
 	if err != nil {
 		return err
 	}
@@ -110,21 +143,28 @@ func (r *PostgresRepository) GetUserPosts(ctx context.Context, userID, currentUs
 	if limit <= 0 {
 		limit = 20
 	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 	var total int64
-	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM posts WHERE user_id = $1 AND is_archived = FALSE`, userID)
+	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM posts p WHERE p.user_id = $1 AND p.tenant_id = $2 AND p.is_archived = FALSE AND EXISTS(SELECT 1 FROM users WHERE id = p.user_id AND account_status = 'active')
+		AND (p.user_id = $3 OR `+groupVisible("$3")+`)`, userID, tenantID, currentUserID)
 
 	posts := []*Post{}
 	query := `
-		SELECT p.id, p.user_id, p.caption, p.location, p.visibility, p.is_pinned,
+		SELECT p.id, p.user_id, p.group_id, p.caption, p.location, p.visibility, p.is_pinned,
 			p.likes_count, p.comments_count, p.created_at,
 			EXISTS(SELECT 1 FROM post_likes WHERE post_id = p.id AND user_id = $2) as is_liked,
 			EXISTS(SELECT 1 FROM saved_posts WHERE post_id = p.id AND user_id = $2) as is_saved
 		FROM posts p
-		WHERE p.user_id = $1 AND p.is_archived = FALSE
+		WHERE p.user_id = $1 AND p.tenant_id = $5 AND p.is_archived = FALSE
+			AND EXISTS(SELECT 1 FROM users WHERE id = p.user_id AND account_status = 'active')
+			AND (p.user_id = $2 OR ` + groupVisible("$2") + `)
 		ORDER BY p.is_pinned DESC, p.created_at DESC
 		LIMIT $3 OFFSET $4`
 
-	rows, err := r.db.QueryxContext(ctx, query, userID, currentUserID, limit, offset)
+	rows, err := r.db.QueryxContext(ctx, query, userID, currentUserID, limit, offset, tenantID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -132,7 +172,7 @@ func (r *PostgresRepository) GetUserPosts(ctx context.Context, userID, currentUs
 
 	for rows.Next() {
 		post := &Post{}
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Caption, &post.Location, &post.Visibility, &post.IsPinned,
+		if err := rows.Scan(&post.ID, &post.UserID, &post.GroupID, &post.Caption, &post.Location, &post.Visibility, &post.IsPinned,
 			&post.LikesCount, &post.CommentsCount, &post.CreatedAt, &post.IsLiked, &post.IsSaved); err != nil {
 			continue
 		}
@@ -147,6 +187,10 @@ func (r *PostgresRepository) GetFeed(ctx context.Context, userID int64, feedType
 	if limit <= 0 {
 		limit = 20
 	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	var query string
 	if feedType == "following" {
@@ -159,7 +203,8 @@ func (r *PostgresRepository) GetFeed(ctx context.Context, userID int64, feedType
 			FROM posts p
 			JOIN users u ON p.user_id = u.id
 			JOIN follows f ON p.user_id = f.following_id
-			WHERE f.follower_id = $1 AND p.is_archived = FALSE AND p.visibility IN ('public', 'followers')
+			WHERE f.follower_id = $1 AND p.tenant_id = $4 AND p.group_id IS NULL AND p.is_archived = FALSE AND p.visibility IN ('public', 'followers')
+				AND u.account_status = 'active'
 			ORDER BY p.created_at DESC
 			LIMIT $2 OFFSET $3`
 	} else {
@@ -171,14 +216,14 @@ func (r *PostgresRepository) GetFeed(ctx context.Context, userID int64, feedType
 				EXISTS(SELECT 1 FROM saved_posts WHERE post_id = p.id AND user_id = $1) as is_saved
 			FROM posts p
 			JOIN users u ON p.user_id = u.id
-			WHERE p.is_archived = FALSE AND p.visibility = 'public'
+			WHERE p.tenant_id = $4 AND p.group_id IS NULL AND p.is_archived = FALSE AND p.visibility = 'public' AND u.account_status = 'active'
 				AND NOT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = p.user_id AND blocked_id = $1)
 				AND NOT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = $1 AND blocked_id = p.user_id)
 			ORDER BY p.created_at DESC
 			LIMIT $2 OFFSET $3`
 	}
 
-	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset)
+	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset, tenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -200,19 +245,101 @@ func (r *PostgresRepository) GetFeed(ctx context.Context, userID int64, feedType
 	return posts, nil
 }
 
-func (r *PostgresRepository) AddPostMedia(ctx context.Context, media *PostMedia) error {
+// GetGroupPosts returns a group's feed, pinned posts first
+func (r *PostgresRepository) GetGroupPosts(ctx context.Context, groupID, currentUserID int64, limit, offset int) ([]*Post, int64, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM posts p JOIN users u ON p.user_id = u.id WHERE p.group_id = $1 AND p.tenant_id = $2 AND p.is_archived = FALSE AND (p.visibility <> 'private' OR p.user_id = $3) AND u.account_status = 'active'`, groupID, tenantID, currentUserID)
+
 	query := `
-		INSERT INTO post_media (post_id, media_url, media_type, thumbnail_url, width, height, duration, position)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		SELECT p.id, p.user_id, p.group_id, p.caption, p.location, p.visibility, p.is_pinned,
+			p.likes_count, p.comments_count, p.created_at,
+			u.id, u.username, u.display_name, u.profile_picture, u.is_verified,
+			EXISTS(SELECT 1 FROM post_likes WHERE post_id = p.id AND user_id = $2) as is_liked,
+			EXISTS(SELECT 1 FROM saved_posts WHERE post_id = p.id AND user_id = $2) as is_saved
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.group_id = $1 AND p.tenant_id = $5 AND p.is_archived = FALSE
+			AND (p.visibility <> 'private' OR p.user_id = $2) AND u.account_status = 'active'
+		ORDER BY p.is_pinned DESC, p.created_at DESC
+		LIMIT $3 OFFSET $4`
+
+	rows, err := r.db.QueryxContext(ctx, query, groupID, currentUserID, limit, offset, tenantID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+	for rows.Next() {
+		post := &Post{User: &PostUser{}}
+		if err := rows.Scan(&post.ID, &post.UserID, &post.GroupID, &post.Caption, &post.Location, &post.Visibility, &post.IsPinned,
+			&post.LikesCount, &post.CommentsCount, &post.CreatedAt,
+			&post.User.ID, &post.User.Username, &post.User.DisplayName, &post.User.ProfilePicture, &post.User.IsVerified,
+			&post.IsLiked, &post.IsSaved); err != nil {
+			continue
+		}
+		media, _ := r.GetPostMedia(ctx, post.ID)
+		post.Media = media
+		posts = append(posts, post)
+	}
+	return posts, total, nil
+}
+
+// AddPostMedia appends media to the end of its post. The post stays locked
+// while allow checks how many items the post will have, so concurrent uploads
+// can neither go past the limit nor share a position.
+func (r *PostgresRepository) AddPostMedia(ctx context.Context, media *PostMedia, allow func(items int) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var postID int64
+	err = tx.GetContext(ctx, &postID, `SELECT id FROM posts WHERE id = $1 FOR UPDATE`, media.PostID)
+	if err == sql.ErrNoRows {
+		return ErrPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var count, next int
+	err = tx.QueryRowxContext(ctx,
+		`SELECT COUNT(*), COALESCE(MAX(position) + 1, 0) FROM post_media WHERE post_id = $1`, media.PostID,
+	).Scan(&count, &next)
+	if err != nil {
+		return err
+	}
+	if err := allow(count + 1); err != nil {
+		return err
+	}
+	media.Position = next
+
+	query := `
+		INSERT INTO post_media (post_id, media_url, media_type, thumbnail_url, width, height, duration, position, storage_key, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at`
-	return r.db.QueryRowxContext(ctx, query,
+	err = tx.QueryRowxContext(ctx, query,
 		media.PostID, media.MediaURL, media.MediaType, media.ThumbnailURL, media.Width, media.Height, media.Duration, media.Position,
+		media.StorageKey, media.Size,
 	).Scan(&media.ID, &media.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (r *PostgresRepository) GetPostMedia(ctx context.Context, postID int64) ([]PostMedia, error) {
 	media := []PostMedia{}
-	query := `SELECT id, post_id, media_url, media_type, thumbnail_url, width, height, duration, position, created_at
+	query := `SELECT id, post_id, media_url, media_type, thumbnail_url, width, height, duration, position, storage_key, size_bytes, created_at
 		FROM post_media WHERE post_id = $1 ORDER BY position`
 	err := r.db.SelectContext(ctx, &media, query, postID)
 	return media, err
@@ -256,20 +383,24 @@ func (r *PostgresRepository) GetSavedPosts(ctx context.Context, userID int64, li
 	if limit <= 0 {
 		limit = 20
 	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 	var total int64
-	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM saved_posts WHERE user_id = $1`, userID)
+	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM saved_posts sp JOIN posts p ON p.id = sp.post_id WHERE sp.user_id = $1 AND p.tenant_id = $2 AND `+groupVisible("$1"), userID, tenantID)
 
 	posts := []*Post{}
 	query := `
-		SELECT p.id, p.user_id, p.caption, p.location, p.visibility,
+		SELECT p.id, p.user_id, p.group_id, p.caption, p.location, p.visibility,
 			p.likes_count, p.comments_count, p.created_at, TRUE as is_saved
 		FROM posts p
 		JOIN saved_posts sp ON p.id = sp.post_id
-		WHERE sp.user_id = $1 AND p.is_archived = FALSE
+		WHERE sp.user_id = $1 AND p.tenant_id = $4 AND p.is_archived = FALSE AND ` + groupVisible("$1") + `
 		ORDER BY sp.created_at DESC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset)
+	rows, err := r.db.QueryxContext(ctx, query, userID, limit, offset, tenantID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -277,7 +408,7 @@ func (r *PostgresRepository) GetSavedPosts(ctx context.Context, userID int64, li
 
 	for rows.Next() {
 		post := &Post{}
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Caption, &post.Location, &post.Visibility,
+		if err := rows.Scan(&post.ID, &post.UserID, &post.GroupID, &post.Caption, &post.Location, &post.Visibility,
 			&post.LikesCount, &post.CommentsCount, &post.CreatedAt, &post.IsSaved); err != nil {
 			continue
 		}
@@ -293,13 +424,19 @@ func (r *PostgresRepository) CreateComment(ctx context.Context, comment *Comment
 		INSERT INTO comments (post_id, user_id, parent_id, content)
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, likes_count, is_edited, created_at, updated_at`
-	return r.db.QueryRowxContext(ctx, query, comment.PostID, comment.UserID, comment.ParentID, comment.Content,
-	).Scan(&comment.ID, &comment.LikesCount, &comment.IsEdited, &comment.CreatedAt, &comment.UpdatedAt)
+	return r.db.QueryRowxContext(ctx, query, comment.PostID, comment.UserID, comment.ParentID, comment.Content).Scan(&comment.ID, &comment.LikesCount, &comment.IsEdited, &comment.CreatedAt, &comment.UpdatedAt)
 }
 
 func (r *PostgresRepository) GetCommentByID(ctx context.Context, commentID int64) (*Comment, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	comment := &Comment{}
-	err := r.db.GetContext(ctx, comment, `SELECT id, post_id, user_id, parent_id, content, likes_count, is_edited, created_at, updated_at FROM comments WHERE id = $1`, commentID)
+	err = r.db.GetContext(ctx, comment, `
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.likes_count, c.is_edited, c.created_at, c.updated_at
+		FROM comments c JOIN posts p ON p.id = c.post_id
+		WHERE c.id = $1 AND p.tenant_id = $2`, commentID, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrCommentNotFound
 	}
@@ -310,8 +447,12 @@ func (r *PostgresRepository) GetPostComments(ctx context.Context, postID, curren
 	if limit <= 0 {
 		limit = 20
 	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 	var total int64
-	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM comments WHERE post_id = $1 AND parent_id IS NULL`, postID)
+	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM comments c JOIN users u ON c.user_id = u.id WHERE c.post_id = $1 AND u.tenant_id = $2 AND c.parent_id IS NULL AND u.account_status = 'active'`, postID, tenantID)
 
 	comments := []*Comment{}
 	query := `
@@ -319,11 +460,11 @@ func (r *PostgresRepository) GetPostComments(ctx context.Context, postID, curren
 			u.id, u.username, u.display_name, u.profile_picture, u.is_verified
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = $1 AND c.parent_id IS NULL
+		WHERE c.post_id = $1 AND u.tenant_id = $4 AND c.parent_id IS NULL AND u.account_status = 'active'
 		ORDER BY c.created_at DESC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.QueryxContext(ctx, query, postID, limit, offset)
+	rows, err := r.db.QueryxContext(ctx, query, postID, limit, offset, tenantID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -340,6 +481,24 @@ func (r *PostgresRepository) GetPostComments(ctx context.Context, postID, curren
 	return comments, total, nil
 }
 
+// GetUserComments lists every comment and reply the user wrote, oldest first
+func (r *PostgresRepository) GetUserComments(ctx context.Context, userID int64, limit, offset int) ([]*Comment, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	comments := []*Comment{}
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.likes_count, c.is_edited, c.created_at, c.updated_at
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.user_id = $1 AND u.tenant_id = $2
+		ORDER BY c.created_at, c.id
+		LIMIT $3 OFFSET $4`
+	err = r.db.SelectContext(ctx, &comments, query, userID, tenantID, limit, offset)
+	return comments, err
+}
+
 func (r *PostgresRepository) DeleteComment(ctx context.Context, commentID int64) error {
 	result, err := r.db.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, commentID)
 	if err != nil {
@@ -351,3 +510,41 @@ func (r *PostgresRepository) DeleteComment(ctx context.Context, commentID int64)
 	}
 	return nil
 }
+
+// EraseUserData deletes a user's posts, comments and interactions and returns
+// the storage keys of the files uploaded to their posts
+func (r *PostgresRepository) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var keys []string
+	err = tx.SelectContext(ctx, &keys, `
+		SELECT pm.storage_key FROM post_media pm
+		JOIN posts p ON pm.post_id = p.id
+		WHERE p.user_id = $1 AND pm.storage_key IS NOT NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []string{
+		`DELETE FROM comment_likes WHERE user_id = $1`,
+		`DELETE FROM post_likes WHERE user_id = $1`,
+		`DELETE FROM comments WHERE user_id = $1`,
+		`DELETE FROM saved_posts WHERE user_id = $1`,
+		`DELETE FROM mentions WHERE user_id = $1 OR mentioned_by = $1`,
+		`DELETE FROM posts WHERE user_id = $1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/storage"
 )
 
 // NotificationService interface for notification operations
@@ -12,6 +16,21 @@ type NotificationService interface {
 	NotifyComment(ctx context.Context, commenterID, postOwnerID, postID, commentID int64, commenterUsername, commentPreview string) error
 }
 
+// GroupService interface for access checks on group posts
+type GroupService interface {
+	CanView(ctx context.Context, groupID, userID int64) (bool, error)
+	CanPost(ctx context.Context, groupID, userID int64) (bool, error)
+	CanModerate(ctx context.Context, groupID, userID int64) (bool, error)
+}
+
+// EntitlementService checks actions against the user's plan and accounts
+// for the storage uploads use
+type EntitlementService interface {
+	CheckLimit(ctx context.Context, userID int64, limit string, requested int64) error
+	ReserveStorage(ctx context.Context, userID, bytes int64) error
+	ReleaseStorage(ctx context.Context, userID, bytes int64) error
+}
+
 // Service defines post business operations
 type Service interface {
 	CreatePost(ctx context.Context, userID int64, req *CreatePostRequest) (*Post, error)
@@ -20,7 +39,9 @@ type Service interface {
 	DeletePost(ctx context.Context, userID, postID int64) error
 	GetUserPosts(ctx context.Context, userID, currentUserID int64, limit, offset int) ([]*Post, int64, error)
 	GetFeed(ctx context.Context, userID int64, feedType string, limit, offset int) ([]*Post, error)
+	GetGroupPosts(ctx context.Context, groupID, currentUserID int64, limit, offset int) ([]*Post, int64, error)
 	AddPostMedia(ctx context.Context, userID, postID int64, media *PostMedia) error
+	UploadPostMedia(ctx context.Context, userID, postID int64, file io.ReaderAt, size int64) (*PostMedia, error)
 	LikePost(ctx context.Context, userID, postID int64, username string) error
 	UnlikePost(ctx context.Context, userID, postID int64) error
 	SavePost(ctx context.Context, userID, postID int64) error
@@ -29,15 +50,20 @@ type Service interface {
 	CreateComment(ctx context.Context, userID, postID int64, username string, req *CreateCommentRequest) (*Comment, error)
 	GetPostComments(ctx context.Context, postID, currentUserID int64, limit, offset int) ([]*Comment, int64, error)
 	DeleteComment(ctx context.Context, userID, commentID int64) error
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
 }
 
 type service struct {
-	repo        Repository
-	notifySvc   NotificationService
+	repo         Repository
+	notifySvc    NotificationService
+	groupSvc     GroupService
+	entitlements EntitlementService
+	store        storage.Storage
 }
 
-func NewService(repo Repository, notifySvc NotificationService) Service {
-	return &service{repo: repo, notifySvc: notifySvc}
+func NewService(repo Repository, notifySvc NotificationService, groupSvc GroupService, entitlements EntitlementService, store storage.Storage) Service {
+	return &service{repo: repo, notifySvc: notifySvc, groupSvc: groupSvc, entitlements: entitlements, store: store}
 }
 
 func (s *service) CreatePost(ctx context.Context, userID int64, req *CreatePostRequest) (*Post, error) {
@@ -46,8 +72,19 @@ func (s *service) CreatePost(ctx context.Context, userID int64, req *CreatePostR
 		visibility = "public"
 	}
 
+	if req.GroupID != nil {
+		canPost, err := s.groupSvc.CanPost(ctx, *req.GroupID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !canPost {
+			return nil, ErrNotGroupMember
+		}
+	}
+
 	post := &Post{
 		UserID:     userID,
+		GroupID:    req.GroupID,
 		Caption:    req.Caption,
 		Location:   req.Location,
 		Latitude:   req.Latitude,
@@ -63,7 +100,7 @@ func (s *service) CreatePost(ctx context.Context, userID int64, req *CreatePostR
 }
 
 func (s *service) GetPost(ctx context.Context, postID, currentUserID int64) (*Post, error) {
-	post, err := s.repo.GetPostByID(ctx, postID, currentUserID)
+	post, err := s.getVisiblePost(ctx, postID, currentUserID)
 	if err != nil {
 		return nil, err
 	}
@@ -109,11 +146,25 @@ func (s *service) DeletePost(ctx context.Context, userID, postID int64) error {
 		return err
 	}
 
+	// Group moderators can remove any post in their group
 	if post.UserID != userID {
-		return ErrUnauthorized
+		canModerate, err := s.canModerate(ctx, post, userID)
+		if err != nil {
+			return err
+		}
+		if !canModerate {
+			return ErrUnauthorized
+		}
+		fmt.Printf("INFO: Group post removed by moderator - PostID: %d, GroupID: %d, By: %d\n", postID, *post.GroupID, userID)
 	}
 
-	return s.repo.DeletePost(ctx, postID)
+	if err := s.repo.DeletePost(ctx, postID); err != nil {
+		return err
+	}
+
+	// Uploaded files count against the author's storage, whoever deletes the post
+	s.removeMedia(ctx, post.UserID, post.Media)
+	return nil
 }
 
 func (s *service) GetUserPosts(ctx context.Context, userID, currentUserID int64, limit, offset int) ([]*Post, int64, error) {
@@ -133,6 +184,21 @@ func (s *service) GetFeed(ctx context.Context, userID int64, feedType string, li
 	return s.repo.GetFeed(ctx, userID, feedType, limit, offset)
 }
 
+// GetGroupPosts returns a group's feed to users who can read the group
+func (s *service) GetGroupPosts(ctx context.Context, groupID, currentUserID int64, limit, offset int) ([]*Post, int64, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	canView, err := s.groupSvc.CanView(ctx, groupID, currentUserID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !canView {
+		return nil, 0, ErrGroupNotFound
+	}
+	return s.repo.GetGroupPosts(ctx, groupID, currentUserID, limit, offset)
+}
+
 func (s *service) AddPostMedia(ctx context.Context, userID, postID int64, media *PostMedia) error {
 	post, err := s.repo.GetPostByID(ctx, postID, userID)
 	if err != nil {
@@ -144,30 +210,37 @@ func (s *service) AddPostMedia(ctx context.Context, userID, postID int64, media
 	}
 
 	media.PostID = postID
-	return s.repo.AddPostMedia(ctx, media)
+	return s.repo.AddPostMedia(ctx, media, s.allowPostMedia(ctx, userID))
+}
+
+// allowPostMedia checks a post's media count against its owner's plan
+func (s *service) allowPostMedia(ctx context.Context, userID int64) func(items int) error {
+	return func(items int) error {
+		return s.entitlements.CheckLimit(ctx, userID, common.LimitPostMedia, int64(items))
+	}
 }
 
 func (s *service) LikePost(ctx context.Context, userID, postID int64, username string) error {
-	post, err := s.repo.GetPostByID(ctx, postID, userID)
+	post, err := s.getVisiblePost(ctx, postID, userID)
 	if err != nil {
 		return err
 	}
-	
+
 	if err := s.repo.LikePost(ctx, postID, userID); err != nil {
 		return err
 	}
-	
+
 	// Send notification to post owner (if not self)
 	if s.notifySvc != nil && post.UserID != userID {
 		go func() {
-			if err := s.notifySvc.NotifyLike(context.Background(), userID, post.UserID, postID, username); err != nil {
+			if err := s.notifySvc.NotifyLike(context.WithoutCancel(ctx), userID, post.UserID, postID, username); err != nil {
 				fmt.Printf("ERROR: Failed to send like notification: %v\n", err)
 			} else {
 				fmt.Printf("INFO: Like notification sent from %d to %d for post %d\n", userID, post.UserID, postID)
 			}
 		}()
 	}
-	
+
 	return nil
 }
 
@@ -176,7 +249,7 @@ func (s *service) UnlikePost(ctx context.Context, userID, postID int64) error {
 }
 
 func (s *service) SavePost(ctx context.Context, userID, postID int64) error {
-	_, err := s.repo.GetPostByID(ctx, postID, userID)
+	_, err := s.getVisiblePost(ctx, postID, userID)
 	if err != nil {
 		return err
 	}
@@ -195,7 +268,7 @@ func (s *service) GetSavedPosts(ctx context.Context, userID int64, limit, offset
 }
 
 func (s *service) CreateComment(ctx context.Context, userID, postID int64, username string, req *CreateCommentRequest) (*Comment, error) {
-	post, err := s.repo.GetPostByID(ctx, postID, userID)
+	post, err := s.getVisiblePost(ctx, postID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -218,7 +291,7 @@ func (s *service) CreateComment(ctx context.Context, userID, postID int64, usern
 			preview = preview[:47] + "..."
 		}
 		go func() {
-			if err := s.notifySvc.NotifyComment(context.Background(), userID, post.UserID, postID, comment.ID, username, preview); err != nil {
+			if err := s.notifySvc.NotifyComment(context.WithoutCancel(ctx), userID, post.UserID, postID, comment.ID, username, preview); err != nil {
 				fmt.Printf("ERROR: Failed to send comment notification: %v\n", err)
 			} else {
 				fmt.Printf("INFO: Comment notification sent from %d to %d for post %d\n", userID, post.UserID, postID)
@@ -233,6 +306,9 @@ func (s *service) GetPostComments(ctx context.Context, postID, currentUserID int
 	if limit <= 0 || limit > 50 {
 		limit = 20
 	}
+	if _, err := s.getVisiblePost(ctx, postID, currentUserID); err != nil {
+		return nil, 0, err
+	}
 	return s.repo.GetPostComments(ctx, postID, currentUserID, limit, offset)
 }
 
@@ -249,8 +325,91 @@ func (s *service) DeleteComment(ctx context.Context, userID, commentID int64) er
 	}
 
 	if comment.UserID != userID && (post == nil || post.UserID != userID) {
-		return ErrUnauthorized
+		canModerate, err := s.canModerate(ctx, post, userID)
+		if err != nil {
+			return err
+		}
+		if !canModerate {
+			return ErrUnauthorized
+		}
 	}
 
 	return s.repo.DeleteComment(ctx, commentID)
 }
+
+// getVisiblePost loads a post, hiding posts of groups the user cannot read
+func (s *service) getVisiblePost(ctx context.Context, postID, userID int64) (*Post, error) {
+	post, err := s.repo.GetPostByID(ctx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if post.GroupID == nil {
+		return post, nil
+	}
+
+	canView, err := s.groupSvc.CanView(ctx, *post.GroupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !canView {
+		return nil, ErrPostNotFound
+	}
+	return post, nil
+}
+
+// canModerate reports whether the user moderates the group a post was made in
+func (s *service) canModerate(ctx context.Context, post *Post, userID int64) (bool, error) {
+	if post == nil || post.GroupID == nil {
+		return false, nil
+	}
+	return s.groupSvc.CanModerate(ctx, *post.GroupID, userID)
+}
+
+// EraseUserData deletes everything a deleted account posted
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	return s.repo.EraseUserData(ctx, userID)
+}
+
+// exportPageSize is how many rows each read fetches while building a data export
+const exportPageSize = 100
+
+// ExportUserData returns the user's posts with media, every comment and reply
+// they wrote, and their saved posts
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	posts, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*Post, error) {
+		posts, _, err := s.repo.GetUserPosts(ctx, userID, userID, limit, offset)
+		return posts, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export posts: %w", err)
+	}
+
+	for _, post := range posts {
+		media, err := s.repo.GetPostMedia(ctx, post.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export media of post %d: %w", post.ID, err)
+		}
+		post.Media = media
+	}
+
+	comments, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*Comment, error) {
+		return s.repo.GetUserComments(ctx, userID, limit, offset)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export comments: %w", err)
+	}
+
+	saved, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*Post, error) {
+		posts, _, err := s.repo.GetSavedPosts(ctx, userID, limit, offset)
+		return posts, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export saved posts: %w", err)
+	}
+
+	return map[string]interface{}{
+		"posts":       posts,
+		"comments":    comments,
+		"saved_posts": saved,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package posts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+	"github.com/tommygebru/kiekky-backend/pkg/media"
+)
+
+// ErrUnsupportedMedia is returned for uploads that are not an accepted image or video
+var ErrUnsupportedMedia = errors.New("unsupported media")
+
+// UploadPostMedia stores an uploaded file and attaches it to the end of the
+// post. The type comes from the file's content, and its dimensions, duration
+// and position are filled in. The file counts against the user's storage.
+// The media count is checked up front to fail fast, and again when the item
+// is added, where it cannot race other uploads.
+func (s *service) UploadPostMedia(ctx context.Context, userID, postID int64, file io.ReaderAt, size int64) (*PostMedia, error) {
+	post, err := s.repo.GetPostByID(ctx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.UserID != userID {
+		return nil, ErrUnauthorized
+	}
+
+	if err := s.entitlements.CheckLimit(ctx, userID, common.LimitPostMedia, int64(len(post.Media)+1)); err != nil {
+		return nil, err
+	}
+
+	info, err := media.Probe(file, size)
+	if err != nil {
+		if errors.Is(err, media.ErrUnsupportedType) || errors.Is(err, media.ErrMalformed) {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedMedia, err)
+		}
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	key, err := mediaKey(postID, info.Ext)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.entitlements.ReserveStorage(ctx, userID, size); err != nil {
+		return nil, err
+	}
+
+	mediaURL, err := s.store.Put(ctx, key, io.NewSectionReader(file, 0, size), size, info.ContentType)
+	if err != nil {
+		s.releaseStorage(ctx, userID, size)
+		return nil, fmt.Errorf("failed to store media: %w", err)
+	}
+
+	item := &PostMedia{
+		PostID:     postID,
+		MediaURL:   mediaURL,
+		MediaType:  info.Kind,
+		Width:      &info.Width,
+		Height:     &info.Height,
+		StorageKey: &key,
+		Size:       size,
+	}
+	if info.Kind == media.KindVideo {
+		item.Duration = &info.Duration
+	}
+
+	if err := s.repo.AddPostMedia(ctx, item, s.allowPostMedia(ctx, userID)); err != nil {
+		s.removeMedia(ctx, userID, []PostMedia{*item})
+		return nil, fmt.Errorf("failed to add media: %w", err)
+	}
+
+	fmt.Printf("INFO: Media uploaded - PostID: %d, Type: %s, Size: %d\n", postID, info.ContentType, size)
+	return item, nil
+}
+
+// removeMedia deletes uploaded files of the owner's media and gives back
+// their storage. Failures are logged: the rows are already gone.
+func (s *service) removeMedia(ctx context.Context, ownerID int64, items []PostMedia) {
+	var released int64
+	for _, item := range items {
+		if item.StorageKey == nil {
+			continue
+		}
+		if err := s.store.Delete(ctx, *item.StorageKey); err != nil {
+			fmt.Printf("WARNING: Failed to delete media %s: %v\n", *item.StorageKey, err)
+		}
+		released += item.Size
+	}
+	s.releaseStorage(ctx, ownerID, released)
+}
+
+func (s *service) releaseStorage(ctx context.Context, userID, bytes int64) {
+	if bytes <= 0 {
+		return
+	}
+	if err := s.entitlements.ReleaseStorage(ctx, userID, bytes); err != nil {
+		fmt.Printf("WARNING: Failed to release %d bytes of storage for user %d: %v\n", bytes, userID, err)
+	}
+}
+
+// mediaKey names a new object for a post's media. The random part keeps
+// URLs unguessable and unique.
+func mediaKey(postID int64, ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate media key: %w", err)
+	}
+	return fmt.Sprintf("posts/%d/%s%s", postID, hex.EncodeToString(b), ext), nil
+}
@@ -20,21 +20,26 @@ func NewHandler(service Service) *Handler {
 func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(http.Handler) http.Handler) {
 	api := router.PathPrefix("/api/v1").Subrouter()
 	api.Use(authMiddleware)
+	api.Use(common.RequireScopeByMethod(common.ScopeStoriesRead, common.ScopeStoriesWrite))
 
 	// Stories
 	api.HandleFunc("/stories", handler.CreateStory).Methods("POST")
 	api.HandleFunc("/stories/feed", handler.GetFeedStories).Methods("GET")
 	api.HandleFunc("/stories/{id}", handler.GetStory).Methods("GET")
-	api.HandleFunc("/stories/{id}", handler.DeleteStory).Methods("DELETE")
 	api.HandleFunc("/stories/{id}/view", handler.ViewStory).Methods("POST")
 	api.HandleFunc("/stories/{id}/viewers", handler.GetStoryViewers).Methods("GET")
 	api.HandleFunc("/users/{id}/stories", handler.GetUserStories).Methods("GET")
 
 	// Highlights
 	api.HandleFunc("/highlights", handler.CreateHighlight).Methods("POST")
-	api.HandleFunc("/highlights/{id}", handler.DeleteHighlight).Methods("DELETE")
 	api.HandleFunc("/highlights/{id}/stories", handler.AddToHighlight).Methods("POST")
 	api.HandleFunc("/users/{id}/highlights", handler.GetUserHighlights).Methods("GET")
+
+	// An admin impersonating a user must not delete their content
+	deletes := api.NewRoute().Subrouter()
+	deletes.Use(common.BlockImpersonation)
+	deletes.HandleFunc("/stories/{id}", handler.DeleteStory).Methods("DELETE")
+	deletes.HandleFunc("/highlights/{id}", handler.DeleteHighlight).Methods("DELETE")
 }
 
 func (h *Handler) CreateStory(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +57,9 @@ func (h *Handler) CreateStory(w http.ResponseWriter, r *http.Request) {
 
 	story, err := h.service.CreateStory(r.Context(), userID, &req)
 	if err != nil {
+		if common.WriteUpgradeRequired(w, err) {
+			return
+		}
 		common.InternalError(w, "Failed to create story")
 		return
 	}
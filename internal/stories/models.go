@@ -6,19 +6,19 @@ import (
 
 // Story represents a 24-hour story
 type Story struct {
-	ID           int64      `json:"id" db:"id"`
-	UserID       int64      `json:"user_id" db:"user_id"`
-	MediaURL     string     `json:"media_url" db:"media_url"`
-	MediaType    string     `json:"media_type" db:"media_type"` // image, video
-	ThumbnailURL *string    `json:"thumbnail_url,omitempty" db:"thumbnail_url"`
-	Caption      *string    `json:"caption,omitempty" db:"caption"`
-	Duration     int        `json:"duration" db:"duration"` // display duration in seconds
-	ViewsCount   int        `json:"views_count" db:"views_count"`
-	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
-	IsHighlighted bool      `json:"is_highlighted" db:"is_highlighted"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	User         *StoryUser `json:"user,omitempty"`
-	IsViewed     bool       `json:"is_viewed,omitempty"`
+	ID            int64      `json:"id" db:"id"`
+	UserID        int64      `json:"user_id" db:"user_id"`
+	MediaURL      string     `json:"media_url" db:"media_url"`
+	MediaType     string     `json:"media_type" db:"media_type"` // image, video
+	ThumbnailURL  *string    `json:"thumbnail_url,omitempty" db:"thumbnail_url"`
+	Caption       *string    `json:"caption,omitempty" db:"caption"`
+	Duration      int        `json:"duration" db:"duration"` // display duration in seconds
+	ViewsCount    int        `json:"views_count" db:"views_count"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	IsHighlighted bool       `json:"is_highlighted" db:"is_highlighted"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	User          *StoryUser `json:"user,omitempty"`
+	IsViewed      bool       `json:"is_viewed,omitempty"`
 }
 
 // StoryUser represents user info in story
@@ -32,19 +32,19 @@ type StoryUser struct {
 
 // StoryView represents a story view
 type StoryView struct {
-	ID        int64     `json:"id" db:"id"`
-	StoryID   int64     `json:"story_id" db:"story_id"`
-	ViewerID  int64     `json:"viewer_id" db:"viewer_id"`
-	ViewedAt  time.Time `json:"viewed_at" db:"viewed_at"`
-	Viewer    *StoryUser `json:"viewer,omitempty"`
+	ID       int64      `json:"id" db:"id"`
+	StoryID  int64      `json:"story_id" db:"story_id"`
+	ViewerID int64      `json:"viewer_id" db:"viewer_id"`
+	ViewedAt time.Time  `json:"viewed_at" db:"viewed_at"`
+	Viewer   *StoryUser `json:"viewer,omitempty"`
 }
 
 // UserStories represents a user's stories grouped
 type UserStories struct {
-	User      *StoryUser `json:"user"`
-	Stories   []*Story   `json:"stories"`
-	HasUnread bool       `json:"has_unread"`
-	LastStoryAt time.Time `json:"last_story_at"`
+	User        *StoryUser `json:"user"`
+	Stories     []*Story   `json:"stories"`
+	HasUnread   bool       `json:"has_unread"`
+	LastStoryAt time.Time  `json:"last_story_at"`
 }
 
 // StoryHighlight represents a highlight collection
@@ -64,7 +64,7 @@ type CreateStoryRequest struct {
 	MediaType    string  `json:"media_type" validate:"required,oneof=image video"`
 	ThumbnailURL *string `json:"thumbnail_url" validate:"omitempty,url"`
 	Caption      *string `json:"caption" validate:"omitempty,max=500"`
-	Duration     int     `json:"duration" validate:"omitempty,min=1,max=30"`
+	Duration     int     `json:"duration" validate:"omitempty,min=1,max=300"` // Capped further by the user's plan
 }
 
 // CreateHighlightRequest represents request to create a highlight
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 var (
@@ -41,6 +43,7 @@ type Repository interface {
 
 	// Cleanup
 	DeleteExpiredStories(ctx context.Context) (int64, error)
+	EraseUserData(ctx context.Context, userID int64) error
 }
 
 type PostgresRepository struct {
@@ -56,28 +59,36 @@ func (r *PostgresRepository) CreateStory(ctx context.Context, story *Story) erro
 		story.Duration = 5
 	}
 	story.ExpiresAt = time.Now().Add(24 * time.Hour)
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
 
 	query := `
-		INSERT INTO stories (user_id, media_url, media_type, thumbnail_url, caption, duration, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO stories (tenant_id, user_id, media_url, media_type, thumbnail_url, caption, duration, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, views_count, is_highlighted, created_at`
 
 	return r.db.QueryRowxContext(ctx, query,
-		story.UserID, story.MediaURL, story.MediaType, story.ThumbnailURL,
+		tenantID, story.UserID, story.MediaURL, story.MediaType, story.ThumbnailURL,
 		story.Caption, story.Duration, story.ExpiresAt,
 	).Scan(&story.ID, &story.ViewsCount, &story.IsHighlighted, &story.CreatedAt)
 }
 
 func (r *PostgresRepository) GetStoryByID(ctx context.Context, storyID, currentUserID int64) (*Story, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	story := &Story{}
 	query := `
 		SELECT s.id, s.user_id, s.media_url, s.media_type, s.thumbnail_url, s.caption,
 			s.duration, s.views_count, s.expires_at, s.is_highlighted, s.created_at,
 			EXISTS(SELECT 1 FROM story_views WHERE story_id = s.id AND viewer_id = $2) as is_viewed
 		FROM stories s
-		WHERE s.id = $1`
+		WHERE s.id = $1 AND s.tenant_id = $3 AND EXISTS(SELECT 1 FROM users WHERE id = s.user_id AND account_status = 'active')`
 
-	err := r.db.QueryRowxContext(ctx, query, storyID, currentUserID).Scan(
+	err = r.db.QueryRowxContext(ctx, query, storyID, currentUserID, tenantID).Scan(
 		&story.ID, &story.UserID, &story.MediaURL, &story.MediaType, &story.ThumbnailURL,
 		&story.Caption, &story.Duration, &story.ViewsCount, &story.ExpiresAt,
 		&story.IsHighlighted, &story.CreatedAt, &story.IsViewed,
@@ -101,7 +112,11 @@ func (r *PostgresRepository) GetStoryByID(ctx context.Context, storyID, currentU
 }
 
 func (r *PostgresRepository) DeleteStory(ctx context.Context, storyID int64) error {
-	result, err := r.db.ExecContext(ctx, `DELETE FROM stories WHERE id = $1`, storyID)
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx, `DELETE FROM stories WHERE id = $1 AND tenant_id = $2`, storyID, tenantID)
 	if err != nil {
 		return err
 	}
@@ -113,16 +128,21 @@ func (r *PostgresRepository) DeleteStory(ctx context.Context, storyID int64) err
 }
 
 func (r *PostgresRepository) GetUserStories(ctx context.Context, userID, currentUserID int64) ([]*Story, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	stories := []*Story{}
 	query := `
 		SELECT s.id, s.user_id, s.media_url, s.media_type, s.thumbnail_url, s.caption,
 			s.duration, s.views_count, s.expires_at, s.is_highlighted, s.created_at,
 			EXISTS(SELECT 1 FROM story_views WHERE story_id = s.id AND viewer_id = $2) as is_viewed
 		FROM stories s
-		WHERE s.user_id = $1 AND s.expires_at > CURRENT_TIMESTAMP
+		WHERE s.user_id = $1 AND s.tenant_id = $3 AND s.expires_at > CURRENT_TIMESTAMP
+			AND EXISTS(SELECT 1 FROM users WHERE id = s.user_id AND account_status = 'active')
 		ORDER BY s.created_at ASC`
 
-	rows, err := r.db.QueryxContext(ctx, query, userID, currentUserID)
+	rows, err := r.db.QueryxContext(ctx, query, userID, currentUserID, tenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -141,6 +161,11 @@ func (r *PostgresRepository) GetUserStories(ctx context.Context, userID, current
 }
 
 func (r *PostgresRepository) GetFeedStories(ctx context.Context, userID int64) ([]*UserStories, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get users with active stories that the current user follows
 	// Simplified query to avoid prepared statement parameter issues
 	query := `
@@ -157,14 +182,14 @@ func (r *PostgresRepository) GetFeedStories(ctx context.Context, userID int64) (
 		FROM users u
 		JOIN stories s ON u.id = s.user_id
 		LEFT JOIN follows f ON u.id = f.following_id AND f.follower_id = $1
-		WHERE s.expires_at > CURRENT_TIMESTAMP
+		WHERE s.tenant_id = $2 AND s.expires_at > CURRENT_TIMESTAMP AND u.account_status = 'active'
 			AND (f.follower_id = $1 OR u.id = $1)
 			AND NOT EXISTS(SELECT 1 FROM blocks b1 WHERE b1.blocker_id = u.id AND b1.blocked_id = $1)
 			AND NOT EXISTS(SELECT 1 FROM blocks b2 WHERE b2.blocker_id = $1 AND b2.blocked_id = u.id)
 		GROUP BY u.id, u.username, u.display_name, u.profile_picture, u.is_verified
 		ORDER BY all_viewed ASC, last_story_at DESC`
 
-	rows, err := r.db.QueryxContext(ctx, query, userID)
+	rows, err := r.db.QueryxContext(ctx, query, userID, tenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -210,9 +235,13 @@ func (r *PostgresRepository) GetFeedStories(ctx context.Context, userID int64) (
 }
 
 func (r *PostgresRepository) GetActiveStoryCount(ctx context.Context, userID int64) (int, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
 	var count int
-	err := r.db.GetContext(ctx, &count,
-		`SELECT COUNT(*) FROM stories WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP`, userID)
+	err = r.db.GetContext(ctx, &count,
+		`SELECT COUNT(*) FROM stories WHERE user_id = $1 AND tenant_id = $2 AND expires_at > CURRENT_TIMESTAMP`, userID, tenantID)
 	return count, err
 }
 
@@ -227,9 +256,13 @@ func (r *PostgresRepository) GetStoryViewers(ctx context.Context, storyID int64,
 	if limit <= 0 {
 		limit = 20
 	}
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	var total int64
-	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM story_views WHERE story_id = $1`, storyID)
+	r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM story_views sv JOIN users u ON sv.viewer_id = u.id WHERE sv.story_id = $1 AND u.tenant_id = $2`, storyID, tenantID)
 
 	views := []*StoryView{}
 	query := `
@@ -237,11 +270,11 @@ func (r *PostgresRepository) GetStoryViewers(ctx context.Context, storyID int64,
 			u.id, u.username, u.display_name, u.profile_picture, u.is_verified
 		FROM story_views sv
 		JOIN users u ON sv.viewer_id = u.id
-		WHERE sv.story_id = $1
+		WHERE sv.story_id = $1 AND u.tenant_id = $4
 		ORDER BY sv.viewed_at DESC
 		LIMIT $2 OFFSET $3`
 
-	rows, err := r.db.QueryxContext(ctx, query, storyID, limit, offset)
+	rows, err := r.db.QueryxContext(ctx, query, storyID, limit, offset, tenantID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -280,10 +313,15 @@ func (r *PostgresRepository) CreateHighlight(ctx context.Context, highlight *Sto
 }
 
 func (r *PostgresRepository) GetHighlightByID(ctx context.Context, highlightID int64) (*StoryHighlight, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	highlight := &StoryHighlight{}
-	err := r.db.GetContext(ctx, highlight,
-		`SELECT id, user_id, title, cover_image, created_at, updated_at 
-		FROM story_highlights WHERE id = $1`, highlightID)
+	err = r.db.GetContext(ctx, highlight,
+		`SELECT h.id, h.user_id, h.title, h.cover_image, h.created_at, h.updated_at 
+		FROM story_highlights h JOIN users u ON u.id = h.user_id
+		WHERE h.id = $1 AND u.tenant_id = $2`, highlightID, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrHighlightNotFound
 	}
@@ -291,10 +329,16 @@ func (r *PostgresRepository) GetHighlightByID(ctx context.Context, highlightID i
 }
 
 func (r *PostgresRepository) GetUserHighlights(ctx context.Context, userID int64) ([]*StoryHighlight, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	highlights := []*StoryHighlight{}
-	err := r.db.SelectContext(ctx, &highlights,
+	err = r.db.SelectContext(ctx, &highlights,
 		`SELECT id, user_id, title, cover_image, created_at, updated_at 
-		FROM story_highlights WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+		FROM story_highlights h
+		WHERE h.user_id = $1 AND EXISTS(SELECT 1 FROM users WHERE id = h.user_id AND tenant_id = $2 AND account_status = 'active')
+		ORDER BY created_at DESC`, userID, tenantID)
 	return highlights, err
 }
 
@@ -318,15 +362,23 @@ func (r *PostgresRepository) DeleteHighlight(ctx context.Context, highlightID in
 }
 
 func (r *PostgresRepository) AddStoriesToHighlight(ctx context.Context, highlightID int64, storyIDs []int64) error {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Stories of other tenants are skipped
 	for i, storyID := range storyIDs {
 		_, err := r.db.ExecContext(ctx,
-			`INSERT INTO highlight_stories (highlight_id, story_id, position) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
-			highlightID, storyID, i)
+			`INSERT INTO highlight_stories (highlight_id, story_id, position)
+			SELECT $1, id, $3 FROM stories WHERE id = $2 AND tenant_id = $4
+			ON CONFLICT DO NOTHING`,
+			highlightID, storyID, i, tenantID)
 		if err != nil {
 			return err
 		}
 		// Mark story as highlighted
-		r.db.ExecContext(ctx, `UPDATE stories SET is_highlighted = TRUE WHERE id = $1`, storyID)
+		r.db.ExecContext(ctx, `UPDATE stories SET is_highlighted = TRUE WHERE id = $1 AND tenant_id = $2`, storyID, tenantID)
 	}
 	return nil
 }
@@ -338,6 +390,7 @@ func (r *PostgresRepository) RemoveStoryFromHighlight(ctx context.Context, highl
 	return err
 }
 
+// DeleteExpiredStories removes expired, unhighlighted stories of every tenant
 func (r *PostgresRepository) DeleteExpiredStories(ctx context.Context) (int64, error) {
 	result, err := r.db.ExecContext(ctx,
 		`DELETE FROM stories WHERE expires_at < CURRENT_TIMESTAMP AND is_highlighted = FALSE`)
@@ -346,3 +399,25 @@ func (r *PostgresRepository) DeleteExpiredStories(ctx context.Context) (int64, e
 	}
 	return result.RowsAffected()
 }
+
+// EraseUserData deletes a user's stories, highlights and story views
+func (r *PostgresRepository) EraseUserData(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM story_views WHERE viewer_id = $1`,
+		`DELETE FROM story_highlights WHERE user_id = $1`,
+		`DELETE FROM stories WHERE user_id = $1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
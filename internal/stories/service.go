@@ -4,8 +4,15 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
+// EntitlementService checks actions against the user's plan
+type EntitlementService interface {
+	CheckLimit(ctx context.Context, userID int64, limit string, requested int64) error
+}
+
 type Service interface {
 	CreateStory(ctx context.Context, userID int64, req *CreateStoryRequest) (*Story, error)
 	GetStory(ctx context.Context, storyID, currentUserID int64) (*Story, error)
@@ -19,14 +26,17 @@ type Service interface {
 	DeleteHighlight(ctx context.Context, userID, highlightID int64) error
 	AddToHighlight(ctx context.Context, userID, highlightID int64, req *AddToHighlightRequest) error
 	CleanupExpiredStories(ctx context.Context) (int64, error)
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
 }
 
 type service struct {
-	repo Repository
+	repo         Repository
+	entitlements EntitlementService
 }
 
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+func NewService(repo Repository, entitlements EntitlementService) Service {
+	return &service{repo: repo, entitlements: entitlements}
 }
 
 func (s *service) CreateStory(ctx context.Context, userID int64, req *CreateStoryRequest) (*Story, error) {
@@ -34,6 +44,9 @@ func (s *service) CreateStory(ctx context.Context, userID int64, req *CreateStor
 	if duration <= 0 {
 		duration = 5
 	}
+	if err := s.entitlements.CheckLimit(ctx, userID, common.LimitStoryDuration, int64(duration)); err != nil {
+		return nil, err
+	}
 
 	story := &Story{
 		UserID:       userID,
@@ -177,3 +190,26 @@ func (s *service) AddToHighlight(ctx context.Context, userID, highlightID int64,
 func (s *service) CleanupExpiredStories(ctx context.Context) (int64, error) {
 	return s.repo.DeleteExpiredStories(ctx)
 }
+
+// EraseUserData deletes everything a deleted account shared as stories
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	return nil, s.repo.EraseUserData(ctx, userID)
+}
+
+// ExportUserData returns the user's current stories and highlights for a personal data export
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	stories, err := s.repo.GetUserStories(ctx, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export stories: %w", err)
+	}
+
+	highlights, err := s.repo.GetUserHighlights(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export highlights: %w", err)
+	}
+
+	return map[string]interface{}{
+		"stories":    stories,
+		"highlights": highlights,
+	}, nil
+}
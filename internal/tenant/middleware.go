@@ -0,0 +1,52 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
+)
+
+type contextKey string
+
+const tenantKey contextKey = "tenant"
+
+// Middleware scopes requests to a tenant
+type Middleware struct {
+	service Service
+}
+
+// NewMiddleware creates a new tenant middleware
+func NewMiddleware(service Service) *Middleware {
+	return &Middleware{service: service}
+}
+
+// Resolve scopes each request to the tenant its Host header is mapped to, or
+// the default tenant. Requests no tenant can serve are rejected.
+func (m *Middleware) Resolve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, fromHost, err := m.service.Resolve(r.Context(), r.Host)
+		if err != nil {
+			if errors.Is(err, ErrTenantNotFound) || errors.Is(err, ErrTenantInactive) {
+				common.NotFound(w, "Unknown tenant")
+				return
+			}
+			fmt.Printf("ERROR: Failed to resolve tenant for host %q: %v\n", r.Host, err)
+			common.InternalError(w, "Failed to resolve tenant")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantKey, tenant)
+		ctx = common.WithTenant(ctx, tenant.ID, fromHost)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FromContext returns the tenant resolved for the request's host. A token
+// may scope the request to another tenant; use common.GetTenantID for data access.
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, ok := ctx.Value(tenantKey).(*Tenant)
+	return tenant, ok
+}
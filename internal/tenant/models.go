@@ -0,0 +1,28 @@
+package tenant
+
+import (
+	"time"
+)
+
+// Tenant is a workspace served by the deployment. Accounts and content
+// belong to exactly one tenant and are never visible from another.
+type Tenant struct {
+	ID             int64     `json:"id" db:"id"`
+	Slug           string    `json:"slug" db:"slug"`
+	Name           string    `json:"name" db:"name"`
+	AllowedOrigins []string  `json:"allowed_origins" db:"-"`
+	OriginList     string    `json:"-" db:"allowed_origins"` // Comma-separated as stored
+	IsActive       bool      `json:"is_active" db:"is_active"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// AllowsOrigin reports whether a CORS origin belongs to one of the tenant's frontends
+func (t *Tenant) AllowsOrigin(origin string) bool {
+	for _, allowed := range t.AllowedOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+)
+
+// Repository defines tenant lookups
+type Repository interface {
+	GetTenantByHost(ctx context.Context, host string) (*Tenant, error)
+	GetTenantBySlug(ctx context.Context, slug string) (*Tenant, error)
+}
+
+// PostgresRepository implements Repository for PostgreSQL
+type PostgresRepository struct {
+	db *sqlx.DB
+}
+
+// NewPostgresRepository creates a new PostgreSQL repository
+func NewPostgresRepository(db *sqlx.DB) Repository {
+	return &PostgresRepository{db: db}
+}
+
+// GetTenantByHost finds the tenant a domain is mapped to
+func (r *PostgresRepository) GetTenantByHost(ctx context.Context, host string) (*Tenant, error) {
+	tenant := &Tenant{}
+	query := `
+		SELECT t.id, t.slug, t.name, t.allowed_origins, t.is_active, t.created_at, t.updated_at
+		FROM tenants t
+		JOIN tenant_domains d ON d.tenant_id = t.id
+		WHERE d.host = $1`
+
+	err := r.db.GetContext(ctx, tenant, query, host)
+	if err == sql.ErrNoRows {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant by host: %w", err)
+	}
+	tenant.AllowedOrigins = splitOrigins(tenant.OriginList)
+	return tenant, nil
+}
+
+// GetTenantBySlug finds a tenant by its slug
+func (r *PostgresRepository) GetTenantBySlug(ctx context.Context, slug string) (*Tenant, error) {
+	tenant := &Tenant{}
+	query := `
+		SELECT id, slug, name, allowed_origins, is_active, created_at, updated_at
+		FROM tenants WHERE slug = $1`
+
+	err := r.db.GetContext(ctx, tenant, query, slug)
+	if err == sql.ErrNoRows {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant by slug: %w", err)
+	}
+	tenant.AllowedOrigins = splitOrigins(tenant.OriginList)
+	return tenant, nil
+}
+
+func splitOrigins(list string) []string {
+	origins := []string{}
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
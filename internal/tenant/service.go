@@ -0,0 +1,116 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheTTL bounds how long tenant and domain changes take to reach every instance
+const cacheTTL = time.Minute
+
+var (
+	ErrTenantInactive = errors.New("tenant is inactive")
+)
+
+// Service defines tenant resolution
+type Service interface {
+	Resolve(ctx context.Context, host string) (*Tenant, bool, error)
+}
+
+type cacheEntry struct {
+	tenant    *Tenant
+	err       error
+	checkedAt time.Time
+}
+
+type service struct {
+	repo          Repository
+	defaultTenant string
+
+	mu    sync.RWMutex
+	cache map[string]*cacheEntry
+}
+
+// NewService creates a new tenant service. defaultTenant is the slug of the
+// tenant served on hosts that are not mapped to one; empty disables the fallback.
+func NewService(repo Repository, defaultTenant string) Service {
+	return &service{
+		repo:          repo,
+		defaultTenant: defaultTenant,
+		cache:         make(map[string]*cacheEntry),
+	}
+}
+
+// Resolve finds the tenant a request is served for from its Host header. It
+// also reports whether the host itself matched, as opposed to the default
+// tenant. A host mapped to an inactive tenant never falls back.
+func (s *service) Resolve(ctx context.Context, host string) (*Tenant, bool, error) {
+	host = normalizeHost(host)
+	if host != "" {
+		tenant, err := s.cached(ctx, "host:"+host, func() (*Tenant, error) {
+			return s.repo.GetTenantByHost(ctx, host)
+		})
+		if err == nil {
+			if !tenant.IsActive {
+				return nil, true, ErrTenantInactive
+			}
+			return tenant, true, nil
+		}
+		if !errors.Is(err, ErrTenantNotFound) {
+			return nil, false, err
+		}
+	}
+
+	if s.defaultTenant == "" {
+		return nil, false, ErrTenantNotFound
+	}
+	tenant, err := s.cached(ctx, "slug:"+s.defaultTenant, func() (*Tenant, error) {
+		return s.repo.GetTenantBySlug(ctx, s.defaultTenant)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !tenant.IsActive {
+		return nil, false, ErrTenantInactive
+	}
+	return tenant, false, nil
+}
+
+// cached returns a recent lookup result, including not-found results so
+// unmapped hosts do not query the database on every request
+func (s *service) cached(ctx context.Context, key string, lookup func() (*Tenant, error)) (*Tenant, error) {
+	s.mu.RLock()
+	entry, ok := s.cache[key]
+	s.mu.RUnlock()
+	if ok && time.Since(entry.checkedAt) <= cacheTTL {
+		return entry.tenant, entry.err
+	}
+
+	tenant, err := lookup()
+	if err != nil && !errors.Is(err, ErrTenantNotFound) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.cache {
+		if time.Since(e.checkedAt) > cacheTTL {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = &cacheEntry{tenant: tenant, err: err, checkedAt: time.Now()}
+	return tenant, err
+}
+
+// normalizeHost lowercases a Host header and strips its port
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -25,10 +25,11 @@ func RegisterRoutes(router *mux.Router, handler *Handler, authMiddleware func(ht
 	// All user routes require authentication
 	api := router.PathPrefix("/api/v1").Subrouter()
 	api.Use(authMiddleware)
+	api.Use(common.RequireScopeByMethod(common.ScopeUsersRead, common.ScopeUsersWrite))
 
 	// IMPORTANT: Specific routes must be registered BEFORE wildcard {id} routes
 	// Otherwise /users/suggestions matches /users/{id} with id="suggestions"
-	
+
 	// Specific user routes (no {id} wildcard)
 	api.HandleFunc("/users/search", handler.SearchUsers).Methods("GET")
 	api.HandleFunc("/users/suggestions", handler.GetSuggestedUsers).Methods("GET")
@@ -424,19 +425,25 @@ func (h *Handler) UploadProfilePicture(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, _, err := r.FormFile("picture")
+	file, header, err := r.FormFile("picture")
 	if err != nil {
 		common.BadRequest(w, "No picture file provided")
 		return
 	}
 	defer file.Close()
 
+	if err := h.service.CheckUpload(r.Context(), currentUserID, header.Size); err != nil {
+		if common.WriteUpgradeRequired(w, err) {
+			return
+		}
+		common.InternalError(w, "Failed to check storage quota")
+		return
+	}
+
 	// TODO: Upload to Cloudinary and get URL
 	// For now, return a placeholder response
 	// In production, this would upload to Cloudinary and save the URL
 
-	_ = currentUserID // Will be used when saving URL to database
-
 	common.Success(w, "Profile picture upload endpoint - Cloudinary integration pending", map[string]string{
 		"message": "Profile picture upload will be available after Cloudinary integration",
 	})
@@ -7,6 +7,8 @@ import (
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 var (
@@ -28,7 +30,7 @@ type Repository interface {
 	GetUserWithStats(ctx context.Context, id int64, currentUserID int64) (*UserWithStats, error)
 	SearchUsers(ctx context.Context, query string, currentUserID int64, limit, offset int) ([]*FollowUser, error)
 	UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileRequest) (*User, error)
-	
+
 	// Follow operations
 	Follow(ctx context.Context, followerID, followingID int64) error
 	Unfollow(ctx context.Context, followerID, followingID int64) error
@@ -37,16 +39,19 @@ type Repository interface {
 	GetFollowing(ctx context.Context, userID, currentUserID int64, limit, offset int) ([]*FollowUser, int64, error)
 	GetFollowStats(ctx context.Context, userID int64) (*FollowStats, error)
 	GetMutualFollowers(ctx context.Context, userID, otherUserID int64, limit, offset int) ([]*FollowUser, error)
-	
+
 	// Block operations
 	Block(ctx context.Context, blockerID, blockedID int64, reason *string) error
 	Unblock(ctx context.Context, blockerID, blockedID int64) error
 	IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error)
 	IsBlockedEither(ctx context.Context, userID1, userID2 int64) (bool, error)
 	GetBlockedUsers(ctx context.Context, userID int64, limit, offset int) ([]*BlockedUser, int64, error)
-	
+
 	// Suggestions
 	GetSuggestedUsers(ctx context.Context, userID int64, limit int) ([]*FollowUser, error)
+
+	// Account deletion
+	EraseUserData(ctx context.Context, userID int64) error
 }
 
 // PostgresRepository implements Repository for PostgreSQL
@@ -61,12 +66,17 @@ func NewPostgresRepository(db *sqlx.DB) Repository {
 
 // GetUserByID retrieves a user by ID
 func (r *PostgresRepository) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &User{}
 	query := `
 		SELECT id, username, display_name, profile_picture, bio, is_verified, is_online
-		FROM users WHERE id = $1 AND account_status = 'active'`
+		FROM users WHERE id = $1 AND tenant_id = $2 AND account_status = 'active'`
 
-	err := r.db.GetContext(ctx, user, query, id)
+	err = r.db.GetContext(ctx, user, query, id, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -75,12 +85,17 @@ func (r *PostgresRepository) GetUserByID(ctx context.Context, id int64) (*User,
 
 // GetUserByUsername retrieves a user by username
 func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &User{}
 	query := `
 		SELECT id, username, display_name, profile_picture, bio, is_verified, is_online
-		FROM users WHERE LOWER(username) = LOWER($1) AND account_status = 'active'`
+		FROM users WHERE LOWER(username) = LOWER($1) AND tenant_id = $2 AND account_status = 'active'`
 
-	err := r.db.GetContext(ctx, user, query, username)
+	err = r.db.GetContext(ctx, user, query, username, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -89,6 +104,11 @@ func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username str
 
 // GetUserWithStats retrieves a user with follow stats
 func (r *PostgresRepository) GetUserWithStats(ctx context.Context, id int64, currentUserID int64) (*UserWithStats, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &UserWithStats{}
 	query := `
 		SELECT 
@@ -99,9 +119,9 @@ func (r *PostgresRepository) GetUserWithStats(ctx context.Context, id int64, cur
 			EXISTS(SELECT 1 FROM follows WHERE follower_id = $2 AND following_id = u.id) as is_following,
 			EXISTS(SELECT 1 FROM follows WHERE follower_id = u.id AND following_id = $2) as is_followed_by
 		FROM users u
-		WHERE u.id = $1 AND u.account_status = 'active'`
+		WHERE u.id = $1 AND u.tenant_id = $3 AND u.account_status = 'active'`
 
-	err := r.db.GetContext(ctx, user, query, id, currentUserID)
+	err = r.db.GetContext(ctx, user, query, id, currentUserID, tenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -114,6 +134,11 @@ func (r *PostgresRepository) SearchUsers(ctx context.Context, query string, curr
 		limit = 20
 	}
 
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	users := []*FollowUser{}
 	sqlQuery := `
 		SELECT 
@@ -122,6 +147,7 @@ func (r *PostgresRepository) SearchUsers(ctx context.Context, query string, curr
 			u.created_at as followed_at
 		FROM users u
 		WHERE u.account_status = 'active'
+			AND u.tenant_id = $6
 			AND u.id != $2
 			AND NOT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = u.id AND blocked_id = $2)
 			AND NOT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = $2 AND blocked_id = u.id)
@@ -136,7 +162,7 @@ func (r *PostgresRepository) SearchUsers(ctx context.Context, query string, curr
 		LIMIT $4 OFFSET $5`
 
 	searchPattern := "%" + query + "%"
-	err := r.db.SelectContext(ctx, &users, sqlQuery, searchPattern, currentUserID, query, limit, offset)
+	err = r.db.SelectContext(ctx, &users, sqlQuery, searchPattern, currentUserID, query, limit, offset, tenantID)
 	return users, err
 }
 
@@ -164,15 +190,26 @@ func (r *PostgresRepository) Follow(ctx context.Context, followerID, followingID
 		return ErrAlreadyFollowing
 	}
 
-	query := `INSERT INTO follows (follower_id, following_id) VALUES ($1, $2)`
-	_, err = r.db.ExecContext(ctx, query, followerID, followingID)
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The tenant foreign keys reject users of another tenant
+	query := `INSERT INTO follows (tenant_id, follower_id, following_id) VALUES ($1, $2, $3)`
+	_, err = r.db.ExecContext(ctx, query, tenantID, followerID, followingID)
 	return err
 }
 
 // Unfollow removes a follow relationship
 func (r *PostgresRepository) Unfollow(ctx context.Context, followerID, followingID int64) error {
-	query := `DELETE FROM follows WHERE follower_id = $1 AND following_id = $2`
-	result, err := r.db.ExecContext(ctx, query, followerID, followingID)
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM follows WHERE follower_id = $1 AND following_id = $2 AND tenant_id = $3`
+	result, err := r.db.ExecContext(ctx, query, followerID, followingID, tenantID)
 	if err != nil {
 		return err
 	}
@@ -189,9 +226,14 @@ func (r *PostgresRepository) Unfollow(ctx context.Context, followerID, following
 
 // IsFollowing checks if a user is following another
 func (r *PostgresRepository) IsFollowing(ctx context.Context, followerID, followingID int64) (bool, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
 	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = $1 AND following_id = $2)`
-	err := r.db.GetContext(ctx, &exists, query, followerID, followingID)
+	query := `SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = $1 AND following_id = $2 AND tenant_id = $3)`
+	err = r.db.GetContext(ctx, &exists, query, followerID, followingID, tenantID)
 	return exists, err
 }
 
@@ -201,10 +243,15 @@ func (r *PostgresRepository) GetFollowers(ctx context.Context, userID, currentUs
 		limit = 20
 	}
 
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	// Get total count
 	var total int64
-	countQuery := `SELECT COUNT(*) FROM follows WHERE following_id = $1`
-	if err := r.db.GetContext(ctx, &total, countQuery, userID); err != nil {
+	countQuery := `SELECT COUNT(*) FROM follows WHERE following_id = $1 AND tenant_id = $2`
+	if err := r.db.GetContext(ctx, &total, countQuery, userID, tenantID); err != nil {
 		return nil, 0, err
 	}
 
@@ -217,11 +264,11 @@ func (r *PostgresRepository) GetFollowers(ctx context.Context, userID, currentUs
 			f.created_at as followed_at
 		FROM follows f
 		JOIN users u ON f.follower_id = u.id
-		WHERE f.following_id = $1 AND u.account_status = 'active'
+		WHERE f.following_id = $1 AND f.tenant_id = $5 AND u.account_status = 'active'
 		ORDER BY f.created_at DESC
 		LIMIT $3 OFFSET $4`
 
-	err := r.db.SelectContext(ctx, &followers, query, userID, currentUserID, limit, offset)
+	err = r.db.SelectContext(ctx, &followers, query, userID, currentUserID, limit, offset, tenantID)
 	return followers, total, err
 }
 
@@ -231,10 +278,15 @@ func (r *PostgresRepository) GetFollowing(ctx context.Context, userID, currentUs
 		limit = 20
 	}
 
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	// Get total count
 	var total int64
-	countQuery := `SELECT COUNT(*) FROM follows WHERE follower_id = $1`
-	if err := r.db.GetContext(ctx, &total, countQuery, userID); err != nil {
+	countQuery := `SELECT COUNT(*) FROM follows WHERE follower_id = $1 AND tenant_id = $2`
+	if err := r.db.GetContext(ctx, &total, countQuery, userID, tenantID); err != nil {
 		return nil, 0, err
 	}
 
@@ -247,23 +299,28 @@ func (r *PostgresRepository) GetFollowing(ctx context.Context, userID, currentUs
 			f.created_at as followed_at
 		FROM follows f
 		JOIN users u ON f.following_id = u.id
-		WHERE f.follower_id = $1 AND u.account_status = 'active'
+		WHERE f.follower_id = $1 AND f.tenant_id = $5 AND u.account_status = 'active'
 		ORDER BY f.created_at DESC
 		LIMIT $3 OFFSET $4`
 
-	err := r.db.SelectContext(ctx, &following, query, userID, currentUserID, limit, offset)
+	err = r.db.SelectContext(ctx, &following, query, userID, currentUserID, limit, offset, tenantID)
 	return following, total, err
 }
 
 // GetFollowStats gets follow statistics for a user
 func (r *PostgresRepository) GetFollowStats(ctx context.Context, userID int64) (*FollowStats, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	stats := &FollowStats{}
 	query := `
 		SELECT 
-			(SELECT COUNT(*) FROM follows WHERE following_id = $1) as followers_count,
-			(SELECT COUNT(*) FROM follows WHERE follower_id = $1) as following_count`
+			(SELECT COUNT(*) FROM follows WHERE following_id = $1 AND tenant_id = $2) as followers_count,
+			(SELECT COUNT(*) FROM follows WHERE follower_id = $1 AND tenant_id = $2) as following_count`
 
-	err := r.db.GetContext(ctx, stats, query, userID)
+	err = r.db.GetContext(ctx, stats, query, userID, tenantID)
 	return stats, err
 }
 
@@ -273,6 +330,11 @@ func (r *PostgresRepository) GetMutualFollowers(ctx context.Context, userID, oth
 		limit = 20
 	}
 
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	mutuals := []*FollowUser{}
 	query := `
 		SELECT 
@@ -284,11 +346,12 @@ func (r *PostgresRepository) GetMutualFollowers(ctx context.Context, userID, oth
 		JOIN users u ON f1.follower_id = u.id
 		WHERE f1.following_id = $1 
 			AND f2.following_id = $2
+			AND f1.tenant_id = $5
 			AND u.account_status = 'active'
 		ORDER BY f1.created_at DESC
 		LIMIT $3 OFFSET $4`
 
-	err := r.db.SelectContext(ctx, &mutuals, query, userID, otherUserID, limit, offset)
+	err = r.db.SelectContext(ctx, &mutuals, query, userID, otherUserID, limit, offset, tenantID)
 	return mutuals, err
 }
 
@@ -403,6 +466,11 @@ func (r *PostgresRepository) GetSuggestedUsers(ctx context.Context, userID int64
 		limit = 10
 	}
 
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	suggestions := []*FollowUser{}
 	query := `
 		SELECT 
@@ -412,6 +480,7 @@ func (r *PostgresRepository) GetSuggestedUsers(ctx context.Context, userID int64
 			u.created_at as followed_at
 		FROM users u
 		WHERE u.id != $1
+			AND u.tenant_id = $3
 			AND u.account_status = 'active'
 			AND NOT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = $1 AND blocked_id = u.id)
 			AND NOT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = u.id AND blocked_id = $1)
@@ -421,12 +490,17 @@ func (r *PostgresRepository) GetSuggestedUsers(ctx context.Context, userID int64
 			(SELECT COUNT(*) FROM follows WHERE following_id = u.id) DESC
 		LIMIT $2`
 
-	err := r.db.SelectContext(ctx, &suggestions, query, userID, limit)
+	err = r.db.SelectContext(ctx, &suggestions, query, userID, limit, tenantID)
 	return suggestions, err
 }
 
 // UpdateProfile updates a user's profile
 func (r *PostgresRepository) UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileRequest) (*User, error) {
+	tenantID, err := common.GetTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build dynamic UPDATE query
 	query := `UPDATE users SET updated_at = NOW()`
 	args := []interface{}{}
@@ -458,11 +532,11 @@ func (r *PostgresRepository) UpdateProfile(ctx context.Context, userID int64, re
 		argNum++
 	}
 
-	query += fmt.Sprintf(" WHERE id = $%d RETURNING id, username, display_name, profile_picture, bio, is_verified, is_online", argNum)
-	args = append(args, userID)
+	query += fmt.Sprintf(" WHERE id = $%d AND tenant_id = $%d RETURNING id, username, display_name, profile_picture, bio, is_verified, is_online", argNum, argNum+1)
+	args = append(args, userID, tenantID)
 
 	user := &User{}
-	err := r.db.QueryRowxContext(ctx, query, args...).Scan(
+	err = r.db.QueryRowxContext(ctx, query, args...).Scan(
 		&user.ID, &user.Username, &user.DisplayName, &user.ProfilePicture,
 		&user.Bio, &user.IsVerified, &user.IsOnline,
 	)
@@ -472,3 +546,25 @@ func (r *PostgresRepository) UpdateProfile(ctx context.Context, userID int64, re
 
 	return user, nil
 }
+
+// EraseUserData removes a deleted account's social graph
+func (r *PostgresRepository) EraseUserData(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM follows WHERE follower_id = $1 OR following_id = $1`,
+		`DELETE FROM blocks WHERE blocker_id = $1 OR blocked_id = $1`,
+		`DELETE FROM profile_views WHERE viewer_id = $1 OR profile_id = $1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
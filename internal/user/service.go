@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+
+	"github.com/tommygebru/kiekky-backend/internal/common"
 )
 
 // NotificationService interface for notification operations
@@ -11,6 +13,11 @@ type NotificationService interface {
 	NotifyFollow(ctx context.Context, followerID, followedID int64, followerUsername string) error
 }
 
+// EntitlementService checks actions against the user's plan
+type EntitlementService interface {
+	CheckLimit(ctx context.Context, userID int64, limit string, requested int64) error
+}
+
 // Service defines user business operations
 type Service interface {
 	// User operations
@@ -19,7 +26,8 @@ type Service interface {
 	GetUserProfile(ctx context.Context, userID, currentUserID int64) (*UserWithStats, error)
 	SearchUsers(ctx context.Context, query string, currentUserID int64, limit, offset int) ([]*FollowUser, error)
 	UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileRequest) (*User, error)
-	
+	CheckUpload(ctx context.Context, userID, size int64) error
+
 	// Follow operations
 	Follow(ctx context.Context, followerID, followingID int64, followerUsername string) error
 	Unfollow(ctx context.Context, followerID, followingID int64) error
@@ -27,24 +35,29 @@ type Service interface {
 	GetFollowing(ctx context.Context, userID, currentUserID int64, limit, offset int) ([]*FollowUser, int64, error)
 	GetFollowStats(ctx context.Context, userID int64) (*FollowStats, error)
 	CheckFollowStatus(ctx context.Context, followerID, followingID int64) (bool, error)
-	
+
 	// Block operations
 	Block(ctx context.Context, blockerID, blockedID int64, reason *string) error
 	Unblock(ctx context.Context, blockerID, blockedID int64) error
 	GetBlockedUsers(ctx context.Context, userID int64, limit, offset int) ([]*BlockedUser, int64, error)
-	
+
 	// Suggestions
 	GetSuggestedUsers(ctx context.Context, userID int64, limit int) ([]*FollowUser, error)
+
+	// Account data
+	EraseUserData(ctx context.Context, userID int64) ([]string, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
 }
 
 type service struct {
-	repo      Repository
-	notifySvc NotificationService
+	repo         Repository
+	notifySvc    NotificationService
+	entitlements EntitlementService
 }
 
 // NewService creates a new user service
-func NewService(repo Repository, notifySvc NotificationService) Service {
-	return &service{repo: repo, notifySvc: notifySvc}
+func NewService(repo Repository, notifySvc NotificationService, entitlements EntitlementService) Service {
+	return &service{repo: repo, notifySvc: notifySvc, entitlements: entitlements}
 }
 
 // GetUserByID retrieves a user by ID
@@ -94,7 +107,7 @@ func (s *service) SearchUsers(ctx context.Context, query string, currentUserID i
 	if query == "" {
 		return []*FollowUser{}, nil
 	}
-	
+
 	if limit <= 0 || limit > 50 {
 		limit = 20
 	}
@@ -121,7 +134,7 @@ func (s *service) Follow(ctx context.Context, followerID, followingID int64, fol
 	// Send notification to the followed user
 	if s.notifySvc != nil {
 		go func() {
-			if err := s.notifySvc.NotifyFollow(context.Background(), followerID, followingID, followerUsername); err != nil {
+			if err := s.notifySvc.NotifyFollow(context.WithoutCancel(ctx), followerID, followingID, followerUsername); err != nil {
 				fmt.Printf("ERROR: Failed to send follow notification: %v\n", err)
 			} else {
 				fmt.Printf("INFO: Follow notification sent from %d to %d\n", followerID, followingID)
@@ -205,3 +218,51 @@ func (s *service) GetSuggestedUsers(ctx context.Context, userID int64, limit int
 func (s *service) UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileRequest) (*User, error) {
 	return s.repo.UpdateProfile(ctx, userID, req)
 }
+
+// CheckUpload checks that a file of size bytes fits in the user's storage quota
+func (s *service) CheckUpload(ctx context.Context, userID, size int64) error {
+	return s.entitlements.CheckLimit(ctx, userID, common.LimitStorage, size)
+}
+
+// EraseUserData removes a deleted account's follows, blocks and profile views
+func (s *service) EraseUserData(ctx context.Context, userID int64) ([]string, error) {
+	return nil, s.repo.EraseUserData(ctx, userID)
+}
+
+// exportPageSize is how many rows each read fetches while building a data export
+const exportPageSize = 100
+
+// ExportUserData returns the user's follows and blocks for a personal data export
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	followers, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*FollowUser, error) {
+		users, _, err := s.repo.GetFollowers(ctx, userID, userID, limit, offset)
+		return users, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export followers: %w", err)
+	}
+
+	following, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*FollowUser, error) {
+		users, _, err := s.repo.GetFollowing(ctx, userID, userID, limit, offset)
+		return users, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export following: %w", err)
+	}
+
+	blocked, err := common.CollectPages(exportPageSize, func(limit, offset int) ([]*BlockedUser, error) {
+		users, _, err := s.repo.GetBlockedUsers(ctx, userID, limit, offset)
+		return users, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export blocks: %w", err)
+	}
+
+	return map[string]interface{}{
+		"follows": map[string]interface{}{
+			"followers": followers,
+			"following": following,
+		},
+		"blocks": blocked,
+	}, nil
+}
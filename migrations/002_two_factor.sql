@@ -0,0 +1,31 @@
+-- Two-factor authentication (TOTP) and recovery codes
+
+-- ============================================
+-- 26. USER TWO FACTOR TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS user_two_factor (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    is_enabled BOOLEAN DEFAULT FALSE,
+    last_used_step BIGINT DEFAULT 0, -- last accepted TOTP step, prevents code replay
+    enabled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ============================================
+-- 27. RECOVERY CODES TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(255) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);
+
+CREATE TRIGGER update_user_two_factor_updated_at
+    BEFORE UPDATE ON user_two_factor
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,11 @@
+-- Refresh token rotation: sessions created by rotating a refresh token share a family
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS family_id VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP WITH TIME ZONE;
+
+-- Existing sessions each become their own family
+UPDATE sessions SET family_id = 'legacy-' || id WHERE family_id IS NULL;
+ALTER TABLE sessions ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_refresh_token ON sessions(refresh_token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_family ON sessions(family_id);
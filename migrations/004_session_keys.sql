@@ -0,0 +1,11 @@
+-- Session keys: the hashed session_id claim carried by access tokens, so the
+-- auth middleware can tell whether the session behind a token is still active
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS session_key VARCHAR(64);
+
+-- Sessions created before this migration get a key no token can match;
+-- their clients obtain a keyed session on the next refresh
+UPDATE sessions SET session_key = 'legacy-' || id WHERE session_key IS NULL;
+ALTER TABLE sessions ALTER COLUMN session_key SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_session_key ON sessions(session_key);
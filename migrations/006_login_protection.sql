@@ -0,0 +1,27 @@
+-- ============================================
+-- 30. LOGIN THROTTLES TABLE (consecutive failures per account / IP)
+-- ============================================
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key VARCHAR(300) PRIMARY KEY, -- 'user:<id>', 'identifier:<value>' or 'ip:<address>'
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+-- ============================================
+-- 31. LOGIN HISTORY TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS login_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, -- NULL when the identifier matched no user
+    identifier VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    success BOOLEAN NOT NULL,
+    failure_reason VARCHAR(50), -- 'invalid_credentials', 'locked', 'inactive'
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_history_user ON login_history(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_history_identifier ON login_history(identifier, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_history_ip ON login_history(ip_address, created_at DESC);
@@ -0,0 +1,70 @@
+-- ============================================
+-- 32. ROLES TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ============================================
+-- 33. PERMISSIONS TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL, -- '<resource>:<action>'
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ============================================
+-- 34. ROLE PERMISSIONS TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- ============================================
+-- 35. USER ROLES TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    granted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    granted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_role ON user_roles(role_id);
+
+-- Seed roles and permissions
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full administrative access'),
+    ('moderator', 'Reviews and moderates user content')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('roles:manage', 'Grant and revoke user roles'),
+    ('users:read', 'View any user account'),
+    ('users:manage', 'Suspend, restore and edit user accounts'),
+    ('posts:moderate', 'Hide or remove any post'),
+    ('comments:moderate', 'Hide or remove any comment'),
+    ('stories:moderate', 'Remove any story')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p
+WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p
+    ON p.name IN ('users:read', 'posts:moderate', 'comments:moderate', 'stories:moderate')
+WHERE r.name = 'moderator'
+ON CONFLICT DO NOTHING;
+
+-- Bootstrap the first administrator by hand, e.g.
+-- INSERT INTO user_roles (user_id, role_id) SELECT <user id>, id FROM roles WHERE name = 'admin';
@@ -0,0 +1,17 @@
+-- ============================================
+-- 38. PERSONAL ACCESS TOKENS TABLE (integrations)
+-- ============================================
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the token
+    token_prefix VARCHAR(20) NOT NULL, -- Shown in listings to tell tokens apart
+    scopes VARCHAR(500) NOT NULL, -- Comma separated, e.g. 'posts:read,messages:write'
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL never expires
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON personal_access_tokens(user_id);
@@ -0,0 +1,11 @@
+-- ============================================
+-- ACCOUNT DEACTIVATION AND DELETION
+-- ============================================
+-- account_status gains 'pending_deletion' (deletion requested, still restorable
+-- by logging in) and 'deleted' (data erased, row kept as an anonymous tombstone
+-- so conversations and message threads stay intact for other participants).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled ON users(deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
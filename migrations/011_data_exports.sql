@@ -0,0 +1,17 @@
+-- ============================================
+-- 39. DATA EXPORTS TABLE (personal data takeout)
+-- ============================================
+CREATE TABLE IF NOT EXISTS data_exports (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'processing', 'completed', 'failed', 'expired'
+    file_path TEXT, -- ZIP archive on local disk, removed when the export expires
+    file_size BIGINT,
+    error TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE, -- Download link and archive lifetime
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_data_exports_expires ON data_exports(expires_at) WHERE status = 'completed';
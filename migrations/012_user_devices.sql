@@ -0,0 +1,20 @@
+-- ============================================
+-- 40. USER DEVICES TABLE (new-device login alerts)
+-- ============================================
+CREATE TABLE IF NOT EXISTS user_devices (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint VARCHAR(64) NOT NULL, -- SHA-256 of browser, OS, device type and IP /24 or /48
+    browser VARCHAR(50) NOT NULL,
+    os VARCHAR(50) NOT NULL,
+    device_type VARCHAR(20) NOT NULL, -- 'desktop', 'mobile', 'tablet', 'bot', 'unknown'
+    last_ip VARCHAR(45),
+    first_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT unique_user_device UNIQUE(user_id, fingerprint)
+);
+
+-- Set when the user reports a login as not theirs; logins are refused until
+-- the password is reset
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN DEFAULT FALSE;
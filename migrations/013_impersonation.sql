@@ -0,0 +1,46 @@
+-- ============================================
+-- 41. IMPERSONATION SESSIONS TABLE (support staff acting as a user)
+-- ============================================
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id SERIAL PRIMARY KEY,
+    admin_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_key VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the token's session ID
+    reason TEXT NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_admin ON impersonation_sessions(admin_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_target ON impersonation_sessions(target_user_id, created_at DESC);
+
+-- ============================================
+-- 42. IMPERSONATION AUDIT LOG TABLE (every request made while impersonating)
+-- ============================================
+CREATE TABLE IF NOT EXISTS impersonation_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    impersonation_id INTEGER NOT NULL REFERENCES impersonation_sessions(id) ON DELETE CASCADE,
+    admin_id INTEGER NOT NULL,
+    target_user_id INTEGER NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    ip_address VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_session ON impersonation_audit_log(impersonation_id, created_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Sign in as another user for support'),
+    ('audit:read', 'View the impersonation audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p
+    ON p.name IN ('users:impersonate', 'audit:read')
+WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
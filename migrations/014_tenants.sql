@@ -0,0 +1,103 @@
+-- Multi-tenant workspaces: every community served by the deployment is a
+-- tenant, and every account and piece of content belongs to exactly one.
+-- Existing data moves to the 'default' tenant.
+
+-- ============================================
+-- 43. TENANTS TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS tenants (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    allowed_origins TEXT NOT NULL DEFAULT '', -- Comma-separated CORS origins of the tenant's frontends
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_tenants_updated_at
+    BEFORE UPDATE ON tenants
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================
+-- 44. TENANT DOMAINS TABLE (Host header to tenant)
+-- ============================================
+CREATE TABLE IF NOT EXISTS tenant_domains (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    host VARCHAR(255) UNIQUE NOT NULL, -- Lowercase, without port
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_domains_tenant ON tenant_domains(tenant_id);
+
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'Kiekky')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval('tenants_id_seq', GREATEST((SELECT MAX(id) FROM tenants), 1));
+
+-- ============================================
+-- Tenant ownership
+-- ============================================
+-- Columns are backfilled with the default tenant, then lose their default so
+-- every new row must name its tenant.
+
+-- Users: emails, usernames and phone numbers are unique within a tenant
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_phone_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users(tenant_id, email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username ON users(tenant_id, username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_phone ON users(tenant_id, phone);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_id ON users(tenant_id, id); -- Target of composite tenant foreign keys
+
+-- Content and relationships. Composite foreign keys make a row referencing a
+-- user of another tenant impossible to insert.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE posts ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE stories ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE stories ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE follows ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE follows ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE notifications ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE conversations ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_tenant_id ON conversations(tenant_id, id);
+ALTER TABLE conversation_participants ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE conversation_participants ALTER COLUMN tenant_id DROP DEFAULT;
+
+DO $$
+BEGIN
+    ALTER TABLE posts ADD CONSTRAINT posts_tenant_user_fkey
+        FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE;
+    ALTER TABLE stories ADD CONSTRAINT stories_tenant_user_fkey
+        FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE;
+    ALTER TABLE follows ADD CONSTRAINT follows_tenant_follower_fkey
+        FOREIGN KEY (tenant_id, follower_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE;
+    ALTER TABLE follows ADD CONSTRAINT follows_tenant_following_fkey
+        FOREIGN KEY (tenant_id, following_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE;
+    ALTER TABLE notifications ADD CONSTRAINT notifications_tenant_user_fkey
+        FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE;
+    ALTER TABLE conversation_participants ADD CONSTRAINT participants_tenant_conversation_fkey
+        FOREIGN KEY (tenant_id, conversation_id) REFERENCES conversations(tenant_id, id) ON DELETE CASCADE;
+    ALTER TABLE conversation_participants ADD CONSTRAINT participants_tenant_user_fkey
+        FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_posts_tenant_created ON posts(tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_stories_tenant_expires ON stories(tenant_id, expires_at);
+
+-- Verification codes and social logins are looked up by email or provider
+-- account, which may exist in several tenants
+ALTER TABLE otps ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE otps ALTER COLUMN tenant_id DROP DEFAULT;
+DROP INDEX IF EXISTS idx_otps_identifier;
+CREATE INDEX IF NOT EXISTS idx_otps_tenant_identifier ON otps(tenant_id, identifier, identifier_type);
+
+ALTER TABLE user_identities ADD COLUMN IF NOT EXISTS tenant_id INTEGER NOT NULL DEFAULT 1 REFERENCES tenants(id);
+ALTER TABLE user_identities ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE user_identities DROP CONSTRAINT IF EXISTS user_identities_provider_subject_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_tenant_subject ON user_identities(tenant_id, provider, subject);
@@ -0,0 +1,92 @@
+-- Community groups: public groups anyone can join, private groups whose
+-- members are approved by the group's moderators, and secret groups that
+-- only members can see.
+
+-- ============================================
+-- 45. GROUPS TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS groups (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL REFERENCES tenants(id),
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    cover_url TEXT,
+    privacy VARCHAR(20) NOT NULL DEFAULT 'public' CHECK (privacy IN ('public', 'private', 'secret')),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    members_count INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_groups_tenant_privacy ON groups(tenant_id, privacy);
+
+CREATE TRIGGER update_groups_updated_at
+    BEFORE UPDATE ON groups
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================
+-- 46. GROUP MEMBERS TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS group_members (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'moderator', 'member')),
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (group_id, user_id),
+    FOREIGN KEY (tenant_id, group_id) REFERENCES groups(tenant_id, id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_group_members_group_joined ON group_members(group_id, joined_at DESC);
+
+-- ============================================
+-- 47. GROUP JOIN REQUESTS TABLE (private groups)
+-- ============================================
+CREATE TABLE IF NOT EXISTS group_join_requests (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One open request per user and group
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_join_requests_pending ON group_join_requests(group_id, user_id) WHERE status = 'pending';
+
+-- ============================================
+-- Group posts
+-- ============================================
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS group_id INTEGER;
+
+DO $$
+BEGIN
+    ALTER TABLE posts ADD CONSTRAINT posts_tenant_group_fkey
+        FOREIGN KEY (tenant_id, group_id) REFERENCES groups(tenant_id, id) ON DELETE CASCADE;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_posts_group_created ON posts(group_id, created_at DESC) WHERE group_id IS NOT NULL;
+
+-- Function to update group members count
+CREATE OR REPLACE FUNCTION update_group_members_count()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE groups SET members_count = members_count + 1 WHERE id = NEW.group_id;
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE groups SET members_count = members_count - 1 WHERE id = OLD.group_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_group_members_count
+    AFTER INSERT OR DELETE ON group_members
+    FOR EACH ROW EXECUTE FUNCTION update_group_members_count();
@@ -0,0 +1,48 @@
+-- Invite codes and referrals: members and admins hand out codes that let
+-- people register, which is required when the deployment runs invite-only,
+-- and every redeemed code records who invited whom.
+
+-- ============================================
+-- 48. INVITE CODES TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS invite_codes (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    code VARCHAR(32) NOT NULL, -- Kept in plain text so its creator can share it again
+    created_by INTEGER NOT NULL,
+    max_uses INTEGER NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+    uses_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, code),
+    FOREIGN KEY (tenant_id, created_by) REFERENCES users(tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_codes_creator ON invite_codes(created_by, created_at DESC);
+
+-- ============================================
+-- 49. REFERRALS TABLE (who invited whom)
+-- ============================================
+CREATE TABLE IF NOT EXISTS referrals (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    invite_id INTEGER REFERENCES invite_codes(id) ON DELETE SET NULL,
+    inviter_id INTEGER NOT NULL,
+    invitee_id INTEGER NOT NULL UNIQUE, -- An account is invited at most once
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id, inviter_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id, invitee_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_referrals_inviter ON referrals(inviter_id, created_at DESC);
+
+INSERT INTO permissions (name, description) VALUES
+    ('invites:manage', 'View and revoke every invite code and inspect referrals')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p
+    ON p.name = 'invites:manage'
+WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,80 @@
+-- Plans and entitlements: every account is on a plan that caps media per
+-- post, story duration, group chat size and storage. Paid plans are set by
+-- signed webhooks from the billing provider; everyone else gets the default plan.
+
+-- ============================================
+-- 50. PLANS TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS plans (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL, -- Identifier used by the billing provider
+    name VARCHAR(100) NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0, -- Upgrade order, cheapest first
+    max_post_media INTEGER NOT NULL,
+    max_story_duration INTEGER NOT NULL, -- Seconds
+    max_group_chat_size INTEGER NOT NULL, -- Participants, creator included
+    storage_quota BIGINT NOT NULL, -- Bytes
+    is_default BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Exactly one plan applies to accounts without a subscription
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plans_default ON plans(is_default) WHERE is_default;
+
+CREATE TRIGGER update_plans_updated_at
+    BEFORE UPDATE ON plans
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO plans (code, name, position, max_post_media, max_story_duration, max_group_chat_size, storage_quota, is_default) VALUES
+    ('free', 'Free', 0, 4, 15, 10, 1073741824, TRUE),
+    ('plus', 'Plus', 1, 10, 30, 50, 10737418240, FALSE),
+    ('pro', 'Pro', 2, 20, 60, 250, 107374182400, FALSE)
+ON CONFLICT (code) DO NOTHING;
+
+-- ============================================
+-- 51. USER SUBSCRIPTIONS TABLE (one per account)
+-- ============================================
+CREATE TABLE IF NOT EXISTS user_subscriptions (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL UNIQUE,
+    plan_id INTEGER NOT NULL REFERENCES plans(id),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('active', 'trialing', 'past_due', 'canceled')),
+    current_period_end TIMESTAMP WITH TIME ZONE, -- NULL for subscriptions that do not lapse
+    customer_id VARCHAR(255), -- Billing provider's customer reference
+    external_id VARCHAR(255), -- Billing provider's subscription reference
+    last_event_at TIMESTAMP WITH TIME ZONE NOT NULL, -- Older webhook events are ignored
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER update_user_subscriptions_updated_at
+    BEFORE UPDATE ON user_subscriptions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================
+-- 52. BILLING EVENTS TABLE (processed webhooks)
+-- ============================================
+CREATE TABLE IF NOT EXISTS billing_events (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL REFERENCES tenants(id),
+    event_id VARCHAR(255) NOT NULL, -- Billing provider's event ID; redeliveries are skipped
+    event_type VARCHAR(50) NOT NULL,
+    user_id INTEGER,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, event_id)
+);
+
+-- ============================================
+-- 53. STORAGE USAGE TABLE
+-- ============================================
+CREATE TABLE IF NOT EXISTS storage_usage (
+    user_id INTEGER PRIMARY KEY,
+    tenant_id INTEGER NOT NULL,
+    bytes_used BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+-- Post media uploads: each uploaded file records where it is stored and its
+-- size, so deleting a post can remove the file and give back storage quota.
+-- Media added before uploads existed has neither and is left alone.
+
+ALTER TABLE post_media ADD COLUMN IF NOT EXISTS storage_key TEXT;
+ALTER TABLE post_media ADD COLUMN IF NOT EXISTS size_bytes BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Export download links name the export by a random token instead of its
+-- sequential id, so a link for one export cannot be turned into another's.
+-- Exports created before this have no token and get no download link.
+
+ALTER TABLE data_exports ADD COLUMN IF NOT EXISTS download_token TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_download_token ON data_exports(download_token);
@@ -0,0 +1,12 @@
+-- Post media positions are unique within a post. Uploads that raced before
+-- this could share one, so positions are renumbered in their current order
+-- first.
+
+UPDATE post_media pm SET position = ranked.new_position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY position, id) - 1 AS new_position
+    FROM post_media
+) ranked
+WHERE pm.id = ranked.id AND pm.position IS DISTINCT FROM ranked.new_position;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_media_position ON post_media(post_id, position);
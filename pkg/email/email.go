@@ -0,0 +1,43 @@
+package email
+
+import (
+	"context"
+	"fmt"
+)
+
+// Message represents an outgoing email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email messages
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Config holds email provider configuration
+type Config struct {
+	Provider     string // "smtp", "mock"
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// NewSender creates a Sender for the configured provider
+func NewSender(cfg *Config) (Sender, error) {
+	switch cfg.Provider {
+	case "", "mock":
+		return NewMockSender(), nil
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for smtp email provider")
+		}
+		return NewSMTPSender(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported email provider: %s", cfg.Provider)
+	}
+}
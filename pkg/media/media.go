@@ -0,0 +1,114 @@
+// Package media identifies uploaded images and videos by their content and
+// reads their dimensions without decoding them.
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+)
+
+// Media kinds
+const (
+	KindImage = "image"
+	KindVideo = "video"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrMalformed       = errors.New("malformed media file")
+)
+
+// sniffLen is how much of a file content sniffing looks at
+const sniffLen = 512
+
+// formats are the accepted content types with their kind and file extension
+var formats = map[string]struct{ kind, ext string }{
+	"image/jpeg": {KindImage, ".jpg"},
+	"image/png":  {KindImage, ".png"},
+	"image/gif":  {KindImage, ".gif"},
+	"image/webp": {KindImage, ".webp"},
+	"video/mp4":  {KindVideo, ".mp4"},
+}
+
+// Info describes a media file
+type Info struct {
+	ContentType string
+	Kind        string // KindImage or KindVideo
+	Ext         string // File extension, with the dot
+	Width       int
+	Height      int
+	Duration    int // Seconds, for videos
+}
+
+// Probe sniffs the content type of the size bytes in r and reads the
+// dimensions of the image or video. The name and Content-Type a client sent
+// are never trusted.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	head := make([]byte, sniffLen)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	format, ok := formats[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	info := &Info{ContentType: contentType, Kind: format.kind, Ext: format.ext}
+
+	switch contentType {
+	case "image/webp":
+		err = probeWebP(head, info)
+	case "video/mp4":
+		err = probeMP4(io.NewSectionReader(r, 0, size), info)
+	default:
+		var cfg image.Config
+		cfg, _, err = image.DecodeConfig(io.NewSectionReader(r, 0, size))
+		info.Width, info.Height = cfg.Width, cfg.Height
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if info.Width <= 0 || info.Height <= 0 {
+		return nil, fmt.Errorf("%w: no dimensions", ErrMalformed)
+	}
+	return info, nil
+}
+
+// probeWebP reads the canvas size from the first chunk of a WebP file
+func probeWebP(head []byte, info *Info) error {
+	if len(head) < 30 {
+		return io.ErrUnexpectedEOF
+	}
+	data := head[20:]
+	switch string(head[12:16]) {
+	case "VP8 ": // Lossy: a keyframe header follows the 3-byte frame tag
+		if data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+			return errors.New("missing VP8 start code")
+		}
+		info.Width = int(binary.LittleEndian.Uint16(data[6:]) & 0x3fff)
+		info.Height = int(binary.LittleEndian.Uint16(data[8:]) & 0x3fff)
+	case "VP8L": // Lossless: 14-bit width-1 and height-1 after the signature
+		if data[0] != 0x2f {
+			return errors.New("missing VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(data[1:])
+		info.Width = int(bits&0x3fff) + 1
+		info.Height = int(bits>>14&0x3fff) + 1
+	case "VP8X": // Extended: 24-bit canvas width-1 and height-1
+		info.Width = int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1
+		info.Height = int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1
+	default:
+		return fmt.Errorf("unknown WebP chunk %q", head[12:16])
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// maxBoxes bounds how many MP4 boxes are read, so a crafted file cannot make
+// probing walk forever
+const maxBoxes = 10000
+
+// mp4Probe collects what probeMP4 finds while walking the box tree
+type mp4Probe struct {
+	r         *io.SectionReader
+	boxes     int
+	timescale uint32
+	duration  uint64
+	width     int
+	height    int
+}
+
+// probeMP4 reads the duration from the movie header and the display size
+// from the first video track header. Tracks rotated by a quarter turn, as
+// phones record portrait video, report their width and height swapped.
+func probeMP4(r *io.SectionReader, info *Info) error {
+	p := &mp4Probe{r: r}
+	if err := p.walk(0, r.Size()); err != nil {
+		return err
+	}
+	if p.width == 0 {
+		return errors.New("no video track")
+	}
+
+	info.Width, info.Height = p.width, p.height
+	if p.timescale > 0 {
+		info.Duration = int((p.duration + uint64(p.timescale)/2) / uint64(p.timescale))
+	}
+	return nil
+}
+
+// walk reads the boxes between start and end, descending into containers
+func (p *mp4Probe) walk(start, end int64) error {
+	var header [16]byte
+	for offset := start; offset+8 <= end; {
+		if p.boxes++; p.boxes > maxBoxes {
+			return errors.New("too many boxes")
+		}
+		if _, err := p.r.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		kind := string(header[4:8])
+		headerLen := int64(8)
+		switch size {
+		case 0: // Extends to the end of the file
+			size = end - offset
+		case 1: // 64-bit size follows the type
+			if _, err := p.r.ReadAt(header[8:16], offset+8); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || offset+size > end {
+			return errors.New("box overruns its parent")
+		}
+
+		body, bodyLen := offset+headerLen, size-headerLen
+		var err error
+		switch kind {
+		case "moov", "trak":
+			err = p.walk(body, body+bodyLen)
+		case "mvhd":
+			err = p.readMovieHeader(body, bodyLen)
+		case "tkhd":
+			err = p.readTrackHeader(body, bodyLen)
+		}
+		if err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+// readMovieHeader reads the timescale and duration of an mvhd box
+func (p *mp4Probe) readMovieHeader(offset, length int64) error {
+	buf, err := p.read(offset, length, 32)
+	if err != nil {
+		return err
+	}
+	if buf[0] == 1 { // 64-bit creation and modification times and duration
+		p.timescale = binary.BigEndian.Uint32(buf[20:])
+		p.duration = binary.BigEndian.Uint64(buf[24:])
+	} else {
+		p.timescale = binary.BigEndian.Uint32(buf[12:])
+		p.duration = uint64(binary.BigEndian.Uint32(buf[16:]))
+	}
+	return nil
+}
+
+// readTrackHeader takes the size of the first track with one; audio tracks
+// have none
+func (p *mp4Probe) readTrackHeader(offset, length int64) error {
+	if p.width > 0 {
+		return nil
+	}
+	buf, err := p.read(offset, length, 84)
+	if err != nil {
+		return err
+	}
+	fields := buf[24:] // Past version, flags, times, track ID and duration
+	if buf[0] == 1 {
+		// 64-bit times and duration
+		if buf, err = p.read(offset, length, 96); err != nil {
+			return err
+		}
+		fields = buf[36:]
+	}
+
+	// Reserved, layer, group and volume precede the 3x3 matrix {a b u c d v x y w}
+	matrix := fields[16:52]
+	width := int(binary.BigEndian.Uint32(fields[52:]) >> 16) // 16.16 fixed point
+	height := int(binary.BigEndian.Uint32(fields[56:]) >> 16)
+	if width == 0 || height == 0 {
+		return nil
+	}
+
+	a := int32(binary.BigEndian.Uint32(matrix[0:]))
+	d := int32(binary.BigEndian.Uint32(matrix[16:]))
+	if a == 0 && d == 0 {
+		width, height = height, width
+	}
+	p.width, p.height = width, height
+	return nil
+}
+
+// read returns the first n bytes of a box body, or an error if it is shorter
+func (p *mp4Probe) read(offset, length int64, n int) ([]byte, error) {
+	if length < int64(n) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, n)
+	if _, err := p.r.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,160 @@
+// Package passhash hashes passwords with argon2id and encodes them in the PHC
+// string format, e.g. "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>". It also
+// verifies legacy bcrypt hashes so they can be upgraded.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	ErrMalformedHash   = errors.New("malformed password hash")
+)
+
+// Params are the argon2id cost parameters
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var encoding = base64.RawStdEncoding
+
+// Hasher hashes new passwords with argon2id and verifies stored hashes
+type Hasher struct {
+	params Params
+}
+
+// New creates a Hasher, filling unset parameters from DefaultParams
+func New(params Params) *Hasher {
+	if params.Memory == 0 {
+		params.Memory = DefaultParams.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = DefaultParams.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultParams.Parallelism
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultParams.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultParams.KeyLength
+	}
+	return &Hasher{params: params}
+}
+
+// Hash returns the PHC-encoded argon2id hash of password
+func (h *Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		encoding.EncodeToString(salt), encoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches an argon2id or bcrypt hash
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(actual, key) == 1, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, ErrUnsupportedHash
+}
+
+// NeedsRehash reports whether a hash uses another algorithm or weaker
+// parameters than the Hasher and should be replaced
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		return true
+	}
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		uint32(len(salt)) < h.params.SaltLength ||
+		uint32(len(key)) < h.params.KeyLength
+}
+
+// decodeArgon2id parses "$argon2id$v=19$m=...,t=...,p=...$salt$hash"
+func decodeArgon2id(encoded string) (Params, []byte, []byte, error) {
+	var params Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrUnsupportedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	return params, salt, key, nil
+}
+
+// isBcrypt reports whether encoded looks like a bcrypt hash
+func isBcrypt(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
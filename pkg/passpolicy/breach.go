@@ -0,0 +1,65 @@
+package passpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLength is how many leading SHA-1 hex characters name each corpus file
+const prefixLength = 5
+
+// BreachCorpus looks passwords up in a local copy of a breached password list,
+// split by SHA-1 prefix the way the Pwned Passwords downloader writes it: the
+// file <dir>/ABCDE.txt holds "SUFFIX:COUNT" lines for hashes starting ABCDE.
+type BreachCorpus struct {
+	dir string
+}
+
+// OpenBreachCorpus opens a corpus directory
+func OpenBreachCorpus(dir string) (*BreachCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password corpus: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password corpus %s is not a directory", dir)
+	}
+	return &BreachCorpus{dir: dir}, nil
+}
+
+// Count returns how many times the password appears in the corpus
+func (c *BreachCorpus) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineSuffix, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 1 {
+			n = 1
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,137 @@
+// Package passpolicy decides whether a password is acceptable. It estimates
+// strength offline in the style of zxcvbn, rejects passwords built from the
+// user's own username or email, and checks a local breached password corpus.
+package passpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Default length limits
+const (
+	DefaultMinLength = 8
+	DefaultMaxLength = 256
+)
+
+// Violation codes
+const (
+	CodeTooShort         = "too_short"
+	CodeTooLong          = "too_long"
+	CodeTooWeak          = "too_weak"
+	CodeContainsUsername = "contains_username"
+	CodeContainsEmail    = "contains_email"
+	CodeBreached         = "breached"
+)
+
+// Violation is one reason a password was rejected
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Result is the outcome of checking a password
+type Result struct {
+	Estimate   Estimate    `json:"strength"`
+	Violations []Violation `json:"violations"`
+}
+
+// OK reports whether the password passed every rule
+func (r *Result) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// UserInfo is what is known about the password's owner
+type UserInfo struct {
+	Username string
+	Email    string
+}
+
+// Policy holds the password rules
+type Policy struct {
+	MinLength int
+	MaxLength int
+	MinScore  int           // Lowest accepted strength score, 0 to 4
+	Breaches  *BreachCorpus // Nil skips the breach check
+}
+
+// New creates a policy with the default length limits
+func New(minScore int, breaches *BreachCorpus) *Policy {
+	return &Policy{
+		MinLength: DefaultMinLength,
+		MaxLength: DefaultMaxLength,
+		MinScore:  minScore,
+		Breaches:  breaches,
+	}
+}
+
+// Check applies every rule to password. An error means the breach corpus could
+// not be read; the returned result still reflects the other rules.
+func (p *Policy) Check(password string, user UserInfo) (*Result, error) {
+	result := &Result{
+		Estimate:   EstimateStrength(password, user.Username, user.Email),
+		Violations: []Violation{},
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		result.add(CodeTooShort, fmt.Sprintf("Password must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		result.add(CodeTooLong, fmt.Sprintf("Password must be at most %d characters", p.MaxLength))
+	}
+
+	if containsInput(password, user.Username) {
+		result.add(CodeContainsUsername, "Password must not contain your username")
+	}
+	email := strings.ToLower(strings.TrimSpace(user.Email))
+	local, _, _ := strings.Cut(email, "@")
+	if containsInput(password, email) || containsInput(password, local) {
+		result.add(CodeContainsEmail, "Password must not contain your email address")
+	}
+
+	if result.Estimate.Score < p.MinScore {
+		message := "Password is too easy to guess"
+		if result.Estimate.Warning != "" {
+			message += ": " + result.Estimate.Warning
+		}
+		result.add(CodeTooWeak, message)
+	}
+
+	if p.Breaches != nil {
+		count, err := p.Breaches.Count(password)
+		if err != nil {
+			return result, err
+		}
+		if count > 0 {
+			result.add(CodeBreached, "This password has appeared in a data breach and cannot be used")
+		}
+	}
+
+	return result, nil
+}
+
+func (r *Result) add(code, message string) {
+	r.Violations = append(r.Violations, Violation{Code: code, Message: message})
+}
+
+// containsInput reports whether the password contains input, ignoring case and
+// common l33t substitutions. Inputs shorter than three characters are ignored.
+func containsInput(password, input string) bool {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if utf8.RuneCountInString(input) < 3 {
+		return false
+	}
+	lower := strings.ToLower(password)
+	return strings.Contains(lower, input) || strings.Contains(unl33t(lower), unl33t(input))
+}
+
+func unl33t(s string) string {
+	return strings.Map(func(r rune) rune {
+		if sub, ok := l33tTable[r]; ok {
+			return sub
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,424 @@
+package passpolicy
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Match patterns, used to pick feedback for the weakest part of a password
+const (
+	patternDictionary = "dictionary"
+	patternUserInput  = "user_input"
+	patternSequence   = "sequence"
+	patternRepeat     = "repeat"
+	patternSpatial    = "spatial"
+	patternYear       = "year"
+)
+
+// bruteforceLog10 is the log10 guesses charged per character no pattern explains
+const bruteforceLog10 = 1.0
+
+// minYearSpace is the fewest guesses charged for a year close to today
+const minYearSpace = 20
+
+// minSubmatchLog10 is the fewest guesses charged for a pattern that is only
+// part of the password, so strings of common words are not free
+var minSubmatchLog10 = math.Log10(50)
+
+// maxAnalyzedLength bounds the work done on long passwords; characters past it
+// are charged as brute force
+const maxAnalyzedLength = 100
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords maps common passwords to their popularity rank
+var commonPasswords = rankedDictionary(strings.Fields(commonPasswordList))
+
+// keyboardRows are runs of adjacent keys on a QWERTY keyboard
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./", "!@#$%^&*()_+", "qazwsxedcrfvtgbyhnujmikolp"}
+
+// l33tTable undoes common character substitutions
+var l33tTable = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// Estimate is a password strength estimate in the style of zxcvbn
+type Estimate struct {
+	Score        int      `json:"score"`         // 0 (too guessable) to 4 (very unguessable)
+	GuessesLog10 float64  `json:"guesses_log10"` // Estimated guesses needed to crack it
+	Warning      string   `json:"warning,omitempty"`
+	Suggestions  []string `json:"suggestions,omitempty"`
+}
+
+// match is a part of the password explained by a guessable pattern
+type match struct {
+	start, end   int // Rune offsets, end exclusive
+	pattern      string
+	guessesLog10 float64
+}
+
+// estimator guesses one password, remembering the cost of repeated blocks
+type estimator struct {
+	userInputs map[string]int
+	units      map[string]float64
+}
+
+// EstimateStrength estimates how many guesses an attacker needs to find the
+// password. userInputs such as the username are treated as known words.
+func EstimateStrength(password string, userInputs ...string) Estimate {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Estimate{Score: 0, Warning: "Password is empty"}
+	}
+
+	e := &estimator{
+		userInputs: rankedDictionary(normalizeInputs(userInputs)),
+		units:      map[string]float64{},
+	}
+	extra := 0.0
+	if len(runes) > maxAnalyzedLength {
+		extra = float64(len(runes)-maxAnalyzedLength) * bruteforceLog10
+		runes = runes[:maxAnalyzedLength]
+	}
+
+	guesses, used := e.guess(runes)
+	guesses += extra
+	estimate := Estimate{Score: score(guesses), GuessesLog10: math.Round(guesses*100) / 100}
+	if estimate.Score < 3 {
+		estimate.Warning, estimate.Suggestions = feedback(used)
+	}
+	return estimate
+}
+
+// guess returns the log10 guesses of the cheapest explanation of runes and
+// the matches it uses
+func (e *estimator) guess(runes []rune) (float64, []*match) {
+	matches := e.findMatches(runes)
+
+	// best[i] is the cheapest way to guess the first i runes; via[i] the match ending there
+	best := make([]float64, len(runes)+1)
+	via := make([]*match, len(runes)+1)
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] + bruteforceLog10
+		via[i] = nil
+		for k := range matches {
+			m := &matches[k]
+			if m.end != i {
+				continue
+			}
+			cost := m.guessesLog10
+			if m.end-m.start < len(runes) {
+				cost = math.Max(cost, minSubmatchLog10)
+			}
+			if best[m.start]+cost < best[i] {
+				best[i] = best[m.start] + cost
+				via[i] = m
+			}
+		}
+	}
+
+	var used []*match
+	for i := len(runes); i > 0; {
+		if via[i] == nil {
+			i--
+			continue
+		}
+		used = append(used, via[i])
+		i = via[i].start
+	}
+
+	return best[len(runes)], used
+}
+
+// score buckets guesses the way zxcvbn does
+func score(guessesLog10 float64) int {
+	switch {
+	case guessesLog10 < 3:
+		return 0
+	case guessesLog10 < 6:
+		return 1
+	case guessesLog10 < 8:
+		return 2
+	case guessesLog10 < 10:
+		return 3
+	}
+	return 4
+}
+
+// feedback explains the longest guessable pattern found
+func feedback(used []*match) (string, []string) {
+	suggestions := []string{"Use a few words that are not commonly found together", "Longer passwords are stronger"}
+	var longest *match
+	for _, m := range used {
+		if longest == nil || m.end-m.start > longest.end-longest.start {
+			longest = m
+		}
+	}
+	if longest == nil {
+		return "Password is too short", suggestions
+	}
+
+	switch longest.pattern {
+	case patternDictionary:
+		return "This is a commonly used password", append(suggestions, "Predictable substitutions like '@' for 'a' don't help much")
+	case patternUserInput:
+		return "Passwords based on your name or email are easy to guess", suggestions
+	case patternSequence:
+		return "Sequences like abc or 6543 are easy to guess", append(suggestions, "Avoid sequences")
+	case patternRepeat:
+		return "Repeats like aaa or abcabc are easy to guess", append(suggestions, "Avoid repeated words and characters")
+	case patternSpatial:
+		return "Keyboard patterns like qwerty are easy to guess", append(suggestions, "Avoid keyboard patterns")
+	case patternYear:
+		return "Recent years are easy to guess", append(suggestions, "Avoid years that are associated with you")
+	}
+	return "", suggestions
+}
+
+func (e *estimator) findMatches(runes []rune) []match {
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, commonPasswords, patternDictionary)...)
+	matches = append(matches, dictionaryMatches(runes, e.userInputs, patternUserInput)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, e.repeatMatches(runes)...)
+	matches = append(matches, spatialMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+	return matches
+}
+
+// dictionaryMatches finds words from dict, including reversed and l33t spellings
+func dictionaryMatches(runes []rune, dict map[string]int, pattern string) []match {
+	if len(dict) == 0 {
+		return nil
+	}
+	lower := []rune(strings.ToLower(string(runes)))
+	unl33t := make([]rune, len(lower))
+	for i, r := range lower {
+		if sub, ok := l33tTable[r]; ok {
+			unl33t[i] = sub
+		} else {
+			unl33t[i] = r
+		}
+	}
+
+	var matches []match
+	for i := 0; i < len(lower); i++ {
+		for j := i + 3; j <= len(lower); j++ {
+			word, l33t := string(lower[i:j]), false
+			rank, ok := dict[word]
+			if !ok {
+				word, l33t = string(unl33t[i:j]), true
+				rank, ok = dict[word]
+			}
+			reversed := false
+			if !ok {
+				word, l33t = string(lower[i:j]), false
+				rank, ok = dict[reverse(word)]
+				reversed = ok
+			}
+			if !ok {
+				continue
+			}
+
+			guesses := math.Log10(float64(rank)) + uppercaseVariations(runes[i:j])
+			if l33t {
+				guesses += math.Log10(2)
+			}
+			if reversed {
+				guesses += math.Log10(2)
+			}
+			matches = append(matches, match{start: i, end: j, pattern: pattern, guessesLog10: guesses})
+		}
+	}
+	return matches
+}
+
+// uppercaseVariations is the log10 guesses added by capitalisation
+func uppercaseVariations(runes []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case lower == 0, upper == 1 && unicode.IsUpper(runes[0]):
+		return math.Log10(2)
+	}
+	return float64(min(upper, lower)) * math.Log10(2)
+}
+
+// sequenceMatches finds runs like abc, 9876 or xyz
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+2 < len(runes); {
+		delta := runes[i+1] - runes[i]
+		j := i + 1
+		if delta == 1 || delta == -1 {
+			for j+1 < len(runes) && runes[j+1]-runes[j] == delta && sameClass(runes[j+1], runes[i]) {
+				j++
+			}
+		}
+		if j-i+1 >= 3 && sameClass(runes[i+1], runes[i]) {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("aAzZ01", runes[i]):
+				base = 4
+			case unicode.IsDigit(runes[i]):
+				base = 10
+			}
+			guesses := math.Log10(base * float64(j-i+1))
+			if delta < 0 {
+				guesses += math.Log10(2)
+			}
+			matches = append(matches, match{start: i, end: j + 1, pattern: patternSequence, guessesLog10: guesses})
+			i = j + 1
+			continue
+		}
+		i++
+	}
+	return matches
+}
+
+func sameClass(a, b rune) bool {
+	return unicode.IsDigit(a) && unicode.IsDigit(b) ||
+		unicode.IsLower(a) && unicode.IsLower(b) ||
+		unicode.IsUpper(a) && unicode.IsUpper(b)
+}
+
+// repeatMatches finds a character or block repeated back to back, like aaa or abcabc
+func (e *estimator) repeatMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes); i++ {
+		for size := 1; i+2*size <= len(runes); size++ {
+			unit := string(runes[i : i+size])
+			count := 1
+			for i+(count+1)*size <= len(runes) && string(runes[i+count*size:i+(count+1)*size]) == unit {
+				count++
+			}
+			if count < 2 || (size == 1 && count < 3) {
+				continue
+			}
+
+			unitGuesses, ok := e.units[unit]
+			if !ok {
+				unitGuesses, _ = e.guess([]rune(unit))
+				e.units[unit] = unitGuesses
+			}
+			matches = append(matches, match{
+				start:        i,
+				end:          i + count*size,
+				pattern:      patternRepeat,
+				guessesLog10: unitGuesses + math.Log10(float64(count)),
+			})
+		}
+	}
+	return matches
+}
+
+// spatialMatches finds runs of at least four adjacent keys
+func spatialMatches(runes []rune) []match {
+	lower := strings.ToLower(string(runes))
+	lowerRunes := []rune(lower)
+
+	var matches []match
+	for i := 0; i+4 <= len(lowerRunes); i++ {
+		for j := len(lowerRunes); j >= i+4; j-- {
+			run := string(lowerRunes[i:j])
+			if !onKeyboardRow(run) {
+				continue
+			}
+			// Starting key times direction times length
+			guesses := math.Log10(47*2*float64(j-i)) + uppercaseVariations(runes[i:j])
+			matches = append(matches, match{start: i, end: j, pattern: patternSpatial, guessesLog10: guesses})
+			break
+		}
+	}
+	return matches
+}
+
+func onKeyboardRow(run string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, run) || strings.Contains(row, reverse(run)) {
+			return true
+		}
+	}
+	return false
+}
+
+// yearMatches finds four-digit years between 1900 and 2099
+func yearMatches(runes []rune) []match {
+	var matches []match
+	now := time.Now().Year()
+	for i := 0; i+4 <= len(runes); i++ {
+		year := 0
+		for _, r := range runes[i : i+4] {
+			if !unicode.IsDigit(r) {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year < 1900 || year > 2099 {
+			continue
+		}
+		space := now - year
+		if space < 0 {
+			space = -space
+		}
+		matches = append(matches, match{
+			start:        i,
+			end:          i + 4,
+			pattern:      patternYear,
+			guessesLog10: math.Log10(float64(max(space, minYearSpace))),
+		})
+	}
+	return matches
+}
+
+// rankedDictionary maps each word to its 1-based position
+func rankedDictionary(words []string) map[string]int {
+	dict := make(map[string]int, len(words))
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if _, ok := dict[word]; !ok {
+			dict[word] = i + 1
+		}
+	}
+	return dict
+}
+
+// normalizeInputs lowercases user inputs and splits emails so both the full
+// address and its local part are matched
+func normalizeInputs(inputs []string) []string {
+	var words []string
+	for _, input := range inputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if len(input) < 3 {
+			continue
+		}
+		words = append(words, input)
+		if local, _, ok := strings.Cut(input, "@"); ok && len(local) >= 3 {
+			words = append(words, local)
+		}
+	}
+	return words
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
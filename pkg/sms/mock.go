@@ -0,0 +1,59 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// MockSender records messages in memory instead of delivering them
+type MockSender struct {
+	mu     sync.Mutex
+	outbox []*Message
+}
+
+// NewMockSender creates a new mock sender
+func NewMockSender() *MockSender {
+	return &MockSender{}
+}
+
+// Send stores the message in the outbox
+func (m *MockSender) Send(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copied := *msg
+	m.outbox = append(m.outbox, &copied)
+	log.Printf("📱 [mock sms] to=%s\n%s", msg.To, msg.Body)
+	return nil
+}
+
+// Outbox returns all messages sent so far
+func (m *MockSender) Outbox() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]*Message, len(m.outbox))
+	copy(messages, m.outbox)
+	return messages
+}
+
+// LastTo returns the most recent message sent to a number
+func (m *MockSender) LastTo(to string) *Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.outbox) - 1; i >= 0; i-- {
+		if m.outbox[i].To == to {
+			return m.outbox[i]
+		}
+	}
+	return nil
+}
+
+// Reset clears the outbox
+func (m *MockSender) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outbox = nil
+}
@@ -0,0 +1,41 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+)
+
+// Message represents an outgoing text message
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender delivers text messages
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Config holds SMS provider configuration
+type Config struct {
+	Provider          string // "twilio", "mock"
+	TwilioBaseURL     string
+	TwilioAccountSID  string
+	TwilioAuthToken   string
+	TwilioPhoneNumber string
+}
+
+// NewSender creates a Sender for the configured provider
+func NewSender(cfg *Config) (Sender, error) {
+	switch cfg.Provider {
+	case "", "mock":
+		return NewMockSender(), nil
+	case "twilio":
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" || cfg.TwilioPhoneNumber == "" {
+			return nil, fmt.Errorf("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_PHONE_NUMBER are required for twilio sms provider")
+		}
+		return NewTwilioSender(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported sms provider: %s", cfg.Provider)
+	}
+}
@@ -0,0 +1,78 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTwilioBaseURL is the public Twilio REST API endpoint
+const DefaultTwilioBaseURL = "https://api.twilio.com"
+
+// TwilioSender delivers messages through the Twilio Messages API.
+// BaseURL can point at any Twilio-compatible server, e.g. a local stand-in.
+type TwilioSender struct {
+	baseURL    string
+	accountSID string
+	authToken  string
+	from       string
+	client     *http.Client
+}
+
+// NewTwilioSender creates a new Twilio sender
+func NewTwilioSender(cfg *Config) *TwilioSender {
+	baseURL := cfg.TwilioBaseURL
+	if baseURL == "" {
+		baseURL = DefaultTwilioBaseURL
+	}
+	return &TwilioSender{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		accountSID: cfg.TwilioAccountSID,
+		authToken:  cfg.TwilioAuthToken,
+		from:       cfg.TwilioPhoneNumber,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send delivers a text message
+func (t *TwilioSender) Send(ctx context.Context, msg *Message) error {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.baseURL, url.PathEscape(t.accountSID))
+
+	form := url.Values{}
+	form.Set("To", msg.To)
+	form.Set("From", t.from)
+	form.Set("Body", msg.Body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build sms request: %w", err)
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send sms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("sms provider error %d: %s", apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("sms provider returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localURLPrefix is the path local files are served under
+const localURLPrefix = "/uploads/"
+
+// LocalStorage keeps media on local disk, served by the API under /uploads/
+type LocalStorage struct {
+	root    string
+	baseURL string
+}
+
+// NewLocalStorage creates a local disk storage rooted at cfg.LocalDir
+func NewLocalStorage(cfg *Config) (*LocalStorage, error) {
+	root, err := filepath.Abs(cfg.LocalDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve upload directory: %w", err)
+	}
+	return &LocalStorage{root: root, baseURL: strings.TrimRight(cfg.BaseURL, "/")}, nil
+}
+
+// Put writes the file next to its final path and renames it into place, so
+// a failed upload never leaves a partial file behind
+func (l *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write upload: %w", err)
+	}
+	if size >= 0 && n != size {
+		return "", fmt.Errorf("failed to write upload: wrote %d of %d bytes", n, size)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store upload: %w", err)
+	}
+	return l.baseURL + localURLPrefix + key, nil
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path resolves a key to a file inside the storage root
+func (l *LocalStorage) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	path := filepath.Join(l.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, l.root+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return path, nil
+}
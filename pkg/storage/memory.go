@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// memoryURLPrefix is the URL prefix of objects held in memory
+const memoryURLPrefix = "memory://uploads"
+
+// Object is a file held by MemoryStorage
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// MemoryStorage keeps objects in memory, a stand-in for tests and local runs
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string]*Object
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]*Object)}
+}
+
+func (m *MemoryStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return "", fmt.Errorf("failed to read upload: got %d of %d bytes", len(data), size)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = &Object{Data: data, ContentType: contentType}
+	return memoryURLPrefix + "/" + key, nil
+}
+
+func (m *MemoryStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// Get returns the object stored under key, or nil
+func (m *MemoryStorage) Get(key string) *Object {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.objects[key]
+}
+
+// Len returns the number of stored objects
+func (m *MemoryStorage) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.objects)
+}
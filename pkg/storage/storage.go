@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrInvalidKey is returned for keys that are empty or escape the storage root
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage stores uploaded media and serves it at public URLs
+type Storage interface {
+	// Put stores size bytes from r under key and returns the public URL
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error)
+	// Delete removes the object at key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Config holds media storage configuration
+type Config struct {
+	Provider string // "local", "s3", "memory"
+
+	// Local disk; files are served under BaseURL + "/uploads/"
+	LocalDir string
+	BaseURL  string
+
+	// S3 and S3-compatible services such as MinIO
+	S3Bucket          string
+	S3Region          string
+	S3Endpoint        string // Empty for AWS
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PublicURL       string // Public prefix for objects, e.g. a CDN; defaults to the bucket URL
+	S3PathStyle       bool   // Address the bucket in the path, as MinIO expects
+}
+
+// New creates a Storage for the configured provider
+func New(cfg *Config) (Storage, error) {
+	switch cfg.Provider {
+	case "", "local":
+		if cfg.LocalDir == "" {
+			return nil, fmt.Errorf("LOCAL_UPLOAD_DIR is required for local storage")
+		}
+		return NewLocalStorage(cfg)
+	case "s3":
+		if cfg.S3Bucket == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return nil, fmt.Errorf("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for s3 storage")
+		}
+		return NewS3Storage(cfg), nil
+	case "memory":
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage provider: %s", cfg.Provider)
+	}
+}
+
+// validKey reports whether key is a relative slash-separated path without
+// empty, "." or ".." segments
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+// Package useragent extracts the browser, operating system and device type
+// from HTTP User-Agent strings. It recognises the major browsers and platforms
+// and reports "Unknown" for anything else.
+package useragent
+
+import (
+	"strings"
+)
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// Unknown is reported for a browser or OS that is not recognised
+const Unknown = "Unknown"
+
+// Info is a parsed User-Agent
+type Info struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os"`
+	OSVersion      string `json:"os_version,omitempty"`
+	DeviceType     string `json:"device_type"`
+}
+
+// String describes the device for people, e.g. "Chrome on Windows"
+func (i Info) String() string {
+	return i.Browser + " on " + i.OS
+}
+
+// browserRule recognises a browser by a product token. Rules are checked in
+// order because most browsers also claim to be Safari, Chrome or Mozilla.
+type browserRule struct {
+	name   string
+	tokens []string
+}
+
+var browserRules = []browserRule{
+	{"Edge", []string{"Edg/", "EdgA/", "EdgiOS/", "Edge/"}},
+	{"Opera", []string{"OPR/", "OPiOS/", "Opera/"}},
+	{"Samsung Internet", []string{"SamsungBrowser/"}},
+	{"Firefox", []string{"FxiOS/", "Firefox/"}},
+	{"Chrome", []string{"CriOS/", "Chrome/"}},
+	{"Safari", []string{"Version/"}},
+	{"Internet Explorer", []string{"MSIE ", "rv:"}},
+	{"curl", []string{"curl/"}},
+	{"Wget", []string{"Wget/"}},
+	{"Postman", []string{"PostmanRuntime/"}},
+	{"Python", []string{"python-requests/", "Python-urllib/"}},
+	{"Go", []string{"Go-http-client/"}},
+	{"OkHttp", []string{"okhttp/"}},
+}
+
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "facebookexternalhit", "headless"}
+
+// windowsVersions maps Windows NT versions to marketing names
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// Parse parses a User-Agent string
+func Parse(ua string) Info {
+	info := Info{Browser: Unknown, OS: Unknown, DeviceType: DeviceUnknown}
+	if strings.TrimSpace(ua) == "" {
+		return info
+	}
+
+	info.Browser, info.BrowserVersion = parseBrowser(ua)
+	info.OS, info.OSVersion = parseOS(ua)
+	info.DeviceType = parseDeviceType(ua, info.OS)
+	return info
+}
+
+func parseBrowser(ua string) (string, string) {
+	for _, rule := range browserRules {
+		for _, token := range rule.tokens {
+			idx := strings.Index(ua, token)
+			if idx < 0 {
+				continue
+			}
+			// "rv:" only identifies Internet Explorer 11 alongside Trident
+			if token == "rv:" && !strings.Contains(ua, "Trident/") {
+				continue
+			}
+			// Safari's "Version/" token is shared with other WebKit shells
+			if rule.name == "Safari" && !strings.Contains(ua, "Safari/") {
+				continue
+			}
+			return rule.name, majorVersion(ua[idx+len(token):])
+		}
+	}
+	if strings.Contains(ua, "Safari/") && strings.Contains(ua, "AppleWebKit/") {
+		return "Safari", ""
+	}
+	return Unknown, ""
+}
+
+func parseOS(ua string) (string, string) {
+	switch {
+	case strings.Contains(ua, "Windows NT "):
+		version := versionAfter(ua, "Windows NT ")
+		if name, ok := windowsVersions[version]; ok {
+			version = name
+		}
+		return "Windows", version
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		for _, token := range []string{"iPhone OS ", "CPU OS "} {
+			if strings.Contains(ua, token) {
+				return "iOS", versionAfter(ua, token)
+			}
+		}
+		return "iOS", ""
+	case strings.Contains(ua, "Android"):
+		return "Android", versionAfter(ua, "Android ")
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS", ""
+	case strings.Contains(ua, "Mac OS X"):
+		return "macOS", versionAfter(ua, "Mac OS X ")
+	case strings.Contains(ua, "Linux"):
+		return "Linux", ""
+	}
+	return Unknown, ""
+}
+
+func parseDeviceType(ua, os string) string {
+	lower := strings.ToLower(ua)
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			return DeviceBot
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet"):
+		return DeviceTablet
+	case os == "Android" && !strings.Contains(ua, "Mobile"):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		return DeviceMobile
+	case os == "Windows" || os == "macOS" || os == "Linux" || os == "ChromeOS":
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
+
+// versionAfter reads a dotted version following token, turning the
+// underscores Apple uses into dots
+func versionAfter(ua, token string) string {
+	idx := strings.Index(ua, token)
+	if idx < 0 {
+		return ""
+	}
+	rest := ua[idx+len(token):]
+	end := 0
+	for end < len(rest) && (rest[end] >= '0' && rest[end] <= '9' || rest[end] == '.' || rest[end] == '_') {
+		end++
+	}
+	return strings.TrimRight(strings.ReplaceAll(rest[:end], "_", "."), ".")
+}
+
+// majorVersion returns the leading number of a version string
+func majorVersion(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
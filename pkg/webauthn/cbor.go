@@ -0,0 +1,181 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth bounds nesting so hostile input cannot exhaust the stack
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// decodeCBOR decodes one CBOR data item and returns it with the remaining bytes.
+// It supports the definite-length subset WebAuthn authenticators emit.
+// Integers decode to int64, byte strings to []byte, text to string, arrays to
+// []interface{} and maps to map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.New("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	// Floats and simple values share major type 7 and read their own argument
+	if major == 7 {
+		return decodeCBORSimple(data, info)
+	}
+
+	arg, rest, err := readCBORArgument(data, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		b := rest[:arg]
+		if major == 3 {
+			return string(b), rest[arg:], nil
+		}
+		return append([]byte(nil), b...), rest[arg:], nil
+	case 4:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			if item, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			if key, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			if value, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, rest, nil
+	case 6:
+		// Tags carry no meaning for WebAuthn structures; return the tagged item
+		return decodeCBORItem(rest, depth+1)
+	}
+
+	return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+func readCBORArgument(data []byte, info byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data[1:], nil
+	case info == 24:
+		if len(data) < 2 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(data[1]), data[2:], nil
+	case info == 25:
+		if len(data) < 3 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data[1:])), data[3:], nil
+	case info == 26:
+		if len(data) < 5 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data[1:])), data[5:], nil
+	case info == 27:
+		if len(data) < 9 {
+			return 0, nil, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data[1:]), data[9:], nil
+	}
+	return 0, nil, errors.New("cbor: indefinite lengths are not supported")
+}
+
+func decodeCBORSimple(data []byte, info byte) (interface{}, []byte, error) {
+	switch info {
+	case 20:
+		return false, data[1:], nil
+	case 21:
+		return true, data[1:], nil
+	case 22, 23:
+		return nil, data[1:], nil
+	case 25:
+		if len(data) < 3 {
+			return nil, nil, errCBORTruncated
+		}
+		return halfToFloat(binary.BigEndian.Uint16(data[1:])), data[3:], nil
+	case 26:
+		if len(data) < 5 {
+			return nil, nil, errCBORTruncated
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data[1:]))), data[5:], nil
+	case 27:
+		if len(data) < 9 {
+			return nil, nil, errCBORTruncated
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data[1:])), data[9:], nil
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,101 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers accepted for credentials
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// publicKey is a credential public key decoded from its COSE form
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key and returns the unconsumed bytes after it
+func parsePublicKey(data []byte) (*publicKey, []byte, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, errors.New("cose key is not a map")
+	}
+
+	kty, _ := m[int64(coseKeyType)].(int64)
+	alg, _ := m[int64(coseAlgorithm)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+	p1, _ := m[int64(-1)].([]byte)
+	p2, _ := m[int64(-2)].([]byte)
+	p3, _ := m[int64(-3)].([]byte)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		if crv != coseCurveP256 || len(p2) != 32 || len(p3) != 32 {
+			return nil, nil, errors.New("invalid P-256 key")
+		}
+		x, y := new(big.Int).SetBytes(p2), new(big.Int).SetBytes(p3)
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, nil, errors.New("P-256 point not on curve")
+		}
+		return &publicKey{alg: alg, key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, rest, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		if crv != coseCurveEd25519 || len(p2) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("invalid Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(p2)}, rest, nil
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		if len(p1) == 0 || len(p2) == 0 || len(p2) > 4 {
+			return nil, nil, errors.New("invalid RSA key")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(p1), E: int(new(big.Int).SetBytes(p2).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, nil, errors.New("RSA key too short")
+		}
+		return &publicKey{alg: alg, key: key}, rest, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks sig over data with the key's algorithm
+func (k *publicKey) verify(data, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
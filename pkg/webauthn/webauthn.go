@@ -0,0 +1,411 @@
+// Package webauthn verifies passkey registrations and assertions for a
+// relying party. Only the "none" attestation format is supported, so
+// authenticators are trusted as self-asserted.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChallengeTimeout is how long a client has to answer a challenge
+const ChallengeTimeout = 5 * time.Minute
+
+var (
+	ErrInvalidResponse        = errors.New("invalid webauthn response")
+	ErrChallengeMismatch      = errors.New("webauthn challenge mismatch")
+	ErrOriginMismatch         = errors.New("webauthn origin not allowed")
+	ErrRPIDMismatch           = errors.New("webauthn relying party mismatch")
+	ErrUserNotPresent         = errors.New("user presence not asserted")
+	ErrUnsupportedAttestation = errors.New("unsupported attestation format")
+	ErrInvalidSignature       = errors.New("invalid webauthn signature")
+	ErrCounterRegression      = errors.New("signature counter did not increase")
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// Config describes the relying party
+type Config struct {
+	RPID    string   // Domain the credentials are scoped to, e.g. "kiekky.com"
+	RPName  string   // Name shown by the authenticator
+	Origins []string // Allowed client origins, e.g. "https://kiekky.com"
+}
+
+// RelyingParty creates and verifies WebAuthn ceremonies
+type RelyingParty struct {
+	id      string
+	name    string
+	origins map[string]bool
+}
+
+// New creates a relying party
+func New(cfg Config) (*RelyingParty, error) {
+	if cfg.RPID == "" {
+		return nil, errors.New("webauthn: relying party ID is required")
+	}
+	if len(cfg.Origins) == 0 {
+		return nil, errors.New("webauthn: at least one origin is required")
+	}
+
+	rp := &RelyingParty{id: cfg.RPID, name: cfg.RPName, origins: make(map[string]bool)}
+	if rp.name == "" {
+		rp.name = cfg.RPID
+	}
+	for _, origin := range cfg.Origins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("webauthn: invalid origin %q", origin)
+		}
+		rp.origins[u.Scheme+"://"+u.Host] = true
+	}
+	return rp, nil
+}
+
+// Bytes is binary data encoded as unpadded base64url in JSON
+type Bytes []byte
+
+// MarshalJSON encodes b as base64url
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON accepts base64url with or without padding
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// NewChallenge returns a random base64url challenge
+func NewChallenge() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// User identifies the account a credential is created for
+type User struct {
+	ID          []byte // Opaque user handle, returned by discoverable credentials
+	Name        string
+	DisplayName string
+}
+
+// CredentialDescriptor references an existing credential
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CreationOptions is passed to navigator.credentials.create()
+type CreationOptions struct {
+	PublicKey PublicKeyCreationOptions `json:"publicKey"`
+}
+
+// PublicKeyCreationOptions mirrors PublicKeyCredentialCreationOptions
+type PublicKeyCreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// RequestOptions is passed to navigator.credentials.get()
+type RequestOptions struct {
+	PublicKey PublicKeyRequestOptions `json:"publicKey"`
+}
+
+// PublicKeyRequestOptions mirrors PublicKeyCredentialRequestOptions
+type PublicKeyRequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions builds registration options. Credentials in exclude are
+// rejected by the authenticator so the same device is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge string, user User, exclude []CredentialDescriptor) *CreationOptions {
+	return &CreationOptions{PublicKey: PublicKeyCreationOptions{
+		Challenge: challenge,
+		RP:        rpEntity{ID: rp.id, Name: rp.name},
+		User:      userEntity{ID: user.ID, Name: user.Name, DisplayName: user.DisplayName},
+		PubKeyCredParams: []credentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            ChallengeTimeout.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+	}}
+}
+
+// RequestOptions builds login options. An empty allow list lets the
+// authenticator offer any discoverable credential for the relying party.
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor) *RequestOptions {
+	return &RequestOptions{PublicKey: PublicKeyRequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.id,
+		Timeout:          ChallengeTimeout.Milliseconds(),
+		AllowCredentials: allow,
+		UserVerification: "preferred",
+	}}
+}
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential from create()
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes    `json:"clientDataJSON"`
+		AttestationObject Bytes    `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential from get()
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Credential is a verified new credential to store for the user
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key as returned by the authenticator
+	SignCount    uint32
+	AAGUID       []byte
+	Transports   []string
+	UserVerified bool
+}
+
+// Assertion is the result of a verified login
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// Challenge extracts the challenge a response answers, so the caller can look
+// up the stored ceremony before verifying it
+func Challenge(clientDataJSON []byte) (string, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil || cd.Challenge == "" {
+		return "", fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+	return cd.Challenge, nil
+}
+
+// VerifyRegistration checks a create() response against the issued challenge
+func (rp *RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge string) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if format != "none" || len(statement) != 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAttestation, format)
+	}
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return nil, fmt.Errorf("%w: missing attested credential data", ErrInvalidResponse)
+	}
+
+	// Attested credential data: AAGUID, length-prefixed credential ID, COSE key
+	data := authData.rest
+	if len(data) < 18 {
+		return nil, fmt.Errorf("%w: truncated credential data", ErrInvalidResponse)
+	}
+	aaguid := data[:16]
+	idLen := int(binary.BigEndian.Uint16(data[16:18]))
+	data = data[18:]
+	if idLen == 0 || idLen > 1023 || len(data) < idLen {
+		return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidResponse)
+	}
+	credentialID := data[:idLen]
+	data = data[idLen:]
+
+	// Extensions may follow the key, so keep only the bytes the key used
+	_, rest, err := parsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	publicKeyBytes := data[:len(data)-len(rest)]
+
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, credentialID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	return &Credential{
+		ID:           append([]byte(nil), credentialID...),
+		PublicKey:    append([]byte(nil), publicKeyBytes...),
+		SignCount:    authData.signCount,
+		AAGUID:       append([]byte(nil), aaguid...),
+		Transports:   resp.Response.Transports,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks a get() response against the issued challenge and the
+// stored credential. storedCount is the last signature counter seen; a counter
+// that does not increase suggests a cloned authenticator.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge string, credentialPublicKey []byte, storedCount uint32) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := rp.parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := parsePublicKey(credentialPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("stored credential key: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, resp.Response.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Authenticators without a counter always report zero
+	if (authData.signCount != 0 || storedCount != 0) && authData.signCount <= storedCount {
+		return nil, ErrCounterRegression
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony %q", ErrInvalidResponse, cd.Type)
+	}
+	if cd.Challenge != challenge {
+		return ErrChallengeMismatch
+	}
+	if !rp.origins[cd.Origin] {
+		return fmt.Errorf("%w: %q", ErrOriginMismatch, cd.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	flags     byte
+	signCount uint32
+	rest      []byte
+}
+
+func (rp *RelyingParty) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: truncated authenticator data", ErrInvalidResponse)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.id))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, ErrRPIDMismatch
+	}
+
+	authData := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+		rest:      data[37:],
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return nil, ErrUserNotPresent
+	}
+	return authData, nil
+}